@@ -230,9 +230,10 @@ func main() {
 		panic(err)
 	}
 
+	var c cache.Cache
 	if features.IsControllerEnabled(features.ModelAdapterController) {
 		// cache is enabled for model adapter scheduling.
-		cache.Init(config, stopCh, nil)
+		c = cache.Init(config, stopCh, nil)
 	}
 
 	certsReady := make(chan struct{})
@@ -243,7 +244,7 @@ func main() {
 	}
 
 	// Initialize controllers
-	controller.Initialize()
+	controller.Initialize(c)
 
 	// Cert won't be ready until manager starts, so start a goroutine here which
 	// will block until the cert is ready before setting up the controllers.
@@ -17,6 +17,7 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
 
 	"github.com/vllm-project/aibrix/pkg/cache"
@@ -29,6 +30,9 @@ import (
 
 func main() {
 	redisClient := utils.GetRedisClient()
+	if err := utils.IndexUsers(context.Background(), redisClient); err != nil {
+		klog.ErrorS(err, "unable to index the users, users stored without the index are not listed")
+	}
 
 	klog.Info("starting cache")
 	stopCh := make(chan struct{})
@@ -49,9 +53,9 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
-	cache.Init(config, stopCh, redisClient)
+	c := cache.Init(config, stopCh, redisClient)
 
 	klog.Info("Starting listening on port 8090")
-	srv := metadata.NewHTTPServer(":8090", redisClient)
+	srv := metadata.NewHTTPServer(":8090", redisClient, c)
 	klog.Fatal(srv.ListenAndServe())
 }
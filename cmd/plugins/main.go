@@ -17,6 +17,7 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"net"
@@ -26,6 +27,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"google.golang.org/grpc"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
@@ -35,16 +37,20 @@ import (
 	extProcPb "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
 	"github.com/vllm-project/aibrix/pkg/cache"
 	"github.com/vllm-project/aibrix/pkg/plugins/gateway"
+	"github.com/vllm-project/aibrix/pkg/plugins/gateway/prefixcacheindexer/tokenizer"
+	"github.com/vllm-project/aibrix/pkg/plugins/gateway/profile"
 	"github.com/vllm-project/aibrix/pkg/utils"
 	healthPb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
 var (
-	grpc_port int
+	grpc_port    int
+	metrics_port int
 )
 
 func main() {
 	flag.IntVar(&grpc_port, "port", 50052, "gRPC port")
+	flag.IntVar(&metrics_port, "metrics-port", 8080, "port of the prometheus metrics of the gateway plugin")
 	klog.InitFlags(flag.CommandLine)
 	defer klog.Flush()
 	flag.Parse()
@@ -72,7 +78,7 @@ func main() {
 		panic(err)
 	}
 
-	cache.Init(config, stopCh, redisClient)
+	store := cache.Init(config, stopCh, redisClient)
 
 	// Connect to K8s cluster
 	k8sClient, err := kubernetes.NewForConfig(config)
@@ -80,6 +86,13 @@ func main() {
 		klog.Fatalf("Error creating kubernetes client: %v", err)
 	}
 
+	if err := profile.InitDefaultStore(context.Background(), k8sClient); err != nil {
+		klog.Fatalf("Error loading gpu profiles: %v", err)
+	}
+	if err := tokenizer.InitDefaultStore(context.Background(), k8sClient); err != nil {
+		klog.Fatalf("Error loading tokenizers: %v", err)
+	}
+
 	// grpc server init
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", grpc_port))
 	if err != nil {
@@ -88,17 +101,31 @@ func main() {
 
 	s := grpc.NewServer()
 
-	extProcPb.RegisterExternalProcessorServer(s, gateway.NewServer(redisClient, k8sClient))
+	gatewayServer := gateway.NewServer(redisClient, k8sClient, store)
+	extProcPb.RegisterExternalProcessorServer(s, gatewayServer)
 	healthPb.RegisterHealthServer(s, gateway.NewHealthCheckServer())
 
 	klog.Info("starting gRPC server on port :50052")
 
+	// routing explain and cache introspection APIs are served along with profiling for debugging
+	http.Handle(gateway.ExplainPath, gatewayServer.ExplainHandler())
+	http.Handle(cache.DebugPath, cache.NewDebugHandler(store))
 	go func() {
 		if err := http.ListenAndServe("localhost:6060", nil); err != nil {
 			klog.Fatalf("failed to setup profiling: %v", err)
 		}
 	}()
 
+	go func() {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.Handler())
+		// engine sidecars push their load reports along with the metrics port
+		mux.Handle(gateway.PodMetricsPushPath, gatewayServer.PodMetricsPushHandler())
+		if err := http.ListenAndServe(fmt.Sprintf(":%d", metrics_port), mux); err != nil {
+			klog.Fatalf("failed to serve metrics: %v", err)
+		}
+	}()
+
 	// shutdown
 	var gracefulStop = make(chan os.Signal, 1)
 	signal.Notify(gracefulStop, syscall.SIGTERM)
@@ -0,0 +1,167 @@
+/*
+Copyright 2024 The Aibrix Team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// profile-fit fits the prefill latency terms of a gateway GPU profile from
+// benchmark CSV files and prints the profile as YAML, e.g.
+//
+//	go run ./cmd/profile-fit -model mistral-7b -gpu A100 -cost 1.2 \
+//	  -linear linear.csv -linear-breakpoints 192,384 \
+//	  -attention attention.csv -attention-breakpoints 1025 -attention-degree 1 \
+//	  -short-attention short-attention.csv -short-attention-breakpoints 1025 -short-prefill-tokens 1024 \
+//	  -o mistral-7b-a100.yaml
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/vllm-project/aibrix/pkg/plugins/gateway/profile"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+)
+
+type termFlags struct {
+	name        string
+	file        string
+	xColumn     string
+	breakpoints string
+	degree      int
+}
+
+func newTermFlags(name, xColumn, breakpoints string, degree int) *termFlags {
+	t := &termFlags{name: name}
+	flag.StringVar(&t.file, name, "", fmt.Sprintf("CSV file with %s term samples", name))
+	flag.StringVar(&t.xColumn, name+"-x-column", xColumn, fmt.Sprintf("CSV column of the %s term variable", name))
+	flag.StringVar(&t.breakpoints, name+"-breakpoints", breakpoints,
+		fmt.Sprintf("comma separated values splitting the %s term into pieces", name))
+	flag.IntVar(&t.degree, name+"-degree", degree, fmt.Sprintf("polynomial degree of the %s term pieces", name))
+	return t
+}
+
+func (t *termFlags) fit(yColumn string, yScale float64, table bool) (*profile.Term, error) {
+	if t.file == "" {
+		return nil, nil
+	}
+	f, err := os.Open(t.file)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			klog.ErrorS(err, "failed to close samples", "file", t.file)
+		}
+	}()
+
+	xs, ys, err := profile.ReadSamples(f, t.xColumn, yColumn)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", t.file, err)
+	}
+	for i := range ys {
+		ys[i] *= yScale
+	}
+	if table {
+		return profile.FitLookupTable(xs, ys)
+	}
+
+	breakpoints, err := parseBreakpoints(t.breakpoints)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s breakpoints: %w", t.name, err)
+	}
+	return profile.FitPiecewisePolynomial(xs, ys, breakpoints, t.degree)
+}
+
+func parseBreakpoints(value string) ([]float64, error) {
+	var breakpoints []float64
+	for _, field := range strings.Split(value, ",") {
+		if field = strings.TrimSpace(field); field == "" {
+			continue
+		}
+		breakpoint, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return nil, err
+		}
+		breakpoints = append(breakpoints, breakpoint)
+	}
+	return breakpoints, nil
+}
+
+func main() {
+	p := &profile.Profile{Prefill: &profile.PrefillModel{}}
+	var yColumn, output string
+	var yScale float64
+	var table bool
+
+	flag.StringVar(&p.Model, "model", "", "model name of the profile, empty applies to any model")
+	flag.StringVar(&p.GPU, "gpu", "", "GPU type of the profile")
+	flag.Float64Var(&p.Cost, "cost", 1.0, "price of one GPU in dollars per hour")
+	flag.Float64Var(&p.TimePerOutputToken, "time-per-output-token", 0, "decode latency per output token in seconds")
+	flag.Float64Var(&p.Prefill.Utilization, "utilization", 0,
+		"fraction of prefill time spent in the modeled terms, 0 disables")
+	linear := newTermFlags("linear", "num_batched_tokens", "", 1)
+	attention := newTermFlags("attention", "context_length", "", 1)
+	shortAttention := newTermFlags("short-attention", "context_length", "", 1)
+	flag.IntVar(&p.Prefill.ShortPrefillTokens, "short-prefill-tokens", 0,
+		"largest number of uncached tokens of the prefills measured by -short-attention")
+	quadratic := newTermFlags("quadratic", "num_batched_tokens", "", 2)
+	flag.StringVar(&yColumn, "y-column", "latency_ms", "CSV column of the measured latency")
+	flag.Float64Var(&yScale, "y-scale", 0.001, "factor converting the measured latency to seconds")
+	flag.BoolVar(&table, "table", false, "emit lookup tables instead of piecewise polynomials")
+	flag.StringVar(&output, "o", "", "output file, defaults to stdout")
+	klog.InitFlags(flag.CommandLine)
+	flag.Parse()
+
+	if p.GPU == "" {
+		klog.Fatal("-gpu is required")
+	}
+
+	var err error
+	if p.Prefill.Linear, err = linear.fit(yColumn, yScale, table); err != nil {
+		klog.Fatalf("failed to fit linear term: %v", err)
+	}
+	if p.Prefill.Attention, err = attention.fit(yColumn, yScale, table); err != nil {
+		klog.Fatalf("failed to fit attention term: %v", err)
+	}
+	if p.Prefill.ShortAttention, err = shortAttention.fit(yColumn, yScale, table); err != nil {
+		klog.Fatalf("failed to fit short attention term: %v", err)
+	}
+	if p.Prefill.Quadratic, err = quadratic.fit(yColumn, yScale, table); err != nil {
+		klog.Fatalf("failed to fit quadratic term: %v", err)
+	}
+	if p.Prefill.Linear == nil && p.Prefill.Attention == nil && p.Prefill.ShortAttention == nil &&
+		p.Prefill.Quadratic == nil {
+		klog.Fatal("at least one of -linear, -attention, -short-attention and -quadratic is required")
+	}
+
+	data, err := yaml.Marshal(p)
+	if err != nil {
+		klog.Fatalf("failed to marshal profile: %v", err)
+	}
+	// validate the generated profile the same way the gateway loads it
+	if err := profile.NewStore().Load(data); err != nil {
+		klog.Fatalf("generated profile is invalid: %v", err)
+	}
+
+	if output == "" {
+		fmt.Print(string(data))
+		return
+	}
+	if err := os.WriteFile(output, data, 0o644); err != nil {
+		klog.Fatalf("failed to write %s: %v", output, err)
+	}
+}
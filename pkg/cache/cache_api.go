@@ -17,6 +17,8 @@ limitations under the License.
 package cache
 
 import (
+	"time"
+
 	"github.com/vllm-project/aibrix/pkg/metrics"
 	v1 "k8s.io/api/core/v1"
 )
@@ -27,6 +29,7 @@ type Cache interface {
 	ModelCache
 	MetricCache
 	TraceCache
+	DebugCache
 }
 
 // PodCache defines operations for pod information caching
@@ -51,6 +54,14 @@ type PodCache interface {
 	//   map[string]*v1.Pod: Pod objects matching the criteria
 	//   error: Error information if operation fails
 	ListPodsByModel(modelName string) (map[string]*v1.Pod, error)
+
+	// GetPodGPUType gets the GPU type a pod runs on
+	// Parameters:
+	//   podName: Name of the pod
+	// Returns:
+	//   string: GPU type from the model.aibrix.ai/gpu-type pod label or the nvidia.com/gpu.product node label
+	//   error: Error information if operation fails
+	GetPodGPUType(podName string) (string, error)
 }
 
 // ModelCache defines operations for model information caching
@@ -74,6 +85,14 @@ type ModelCache interface {
 	//   map[string]struct{}: Set of model names
 	//   error: Error information if operation fails
 	ListModelsByPod(podName string) (map[string]struct{}, error)
+
+	// GetModelInfo gets the metadata of a model
+	// Parameters:
+	//   modelName: Name of the model
+	// Returns:
+	//   *ModelInfo: Creation time, owner, parent, context length and ready replicas of the model
+	//   error: Error information if operation fails
+	GetModelInfo(modelName string) (*ModelInfo, error)
 }
 
 // MetricCache defines operations for metric data caching
@@ -97,6 +116,55 @@ type MetricCache interface {
 	//   error: Error information if operation fails
 	GetMetricValueByPodModel(podName, modelName string, metricName string) (metrics.MetricValue, error)
 
+	// GetPodMetricsUpdateTime gets the time the metrics of a pod were last scraped
+	// Parameters:
+	//   podName: Name of the pod
+	// Returns:
+	//   time.Time: Time of the last successful scrape
+	//   error: Error information if the metrics of the pod were never scraped
+	GetPodMetricsUpdateTime(podName string) (time.Time, error)
+
+	// GetMetricRate gets the per second rate of a counter metric over a window
+	// Parameters:
+	//   podName: Name of the pod
+	//   modelName: Name of the model, empty for pod metrics
+	//   metricName: Name of the metric
+	//   window: Time window up to the latest sample
+	// Returns:
+	//   float64: Increase of the metric per second
+	//   error: Error information if the metric has less than two samples
+	GetMetricRate(podName, modelName, metricName string, window time.Duration) (float64, error)
+
+	// GetMetricPercentile gets a percentile of the observations of a histogram metric over a window
+	// Parameters:
+	//   podName: Name of the pod
+	//   modelName: Name of the model, empty for pod metrics
+	//   metricName: Name of the metric
+	//   percentile: Percentile between 0 and 100
+	//   window: Time window up to the latest sample
+	// Returns:
+	//   float64: Bucket bound of the percentile of the observations in the window
+	//   error: Error information if there is no observation in the window
+	GetMetricPercentile(podName, modelName, metricName string, percentile float64, window time.Duration) (float64, error)
+
+	// GetMetricEWMA gets the exponentially weighted moving average of a counter or gauge metric
+	// Parameters:
+	//   podName: Name of the pod
+	//   modelName: Name of the model, empty for pod metrics
+	//   metricName: Name of the metric
+	//   halfLife: Age at which the weight of a sample halves
+	// Returns:
+	//   float64: Moving average of the recent samples
+	//   error: Error information if the metric has no history
+	GetMetricEWMA(podName, modelName, metricName string, halfLife time.Duration) (float64, error)
+
+	// PushPodMetrics merges the metrics pushed by a pod, which is not polled while pushing
+	// Parameters:
+	//   report: Load report of the pod
+	// Returns:
+	//   error: Error information if the pod does not exist or the report is invalid
+	PushPodMetrics(report *PodMetricReport) error
+
 	// AddRequestCount starts tracking request count
 	// Parameters:
 	//   requestID: Unique request identifier
@@ -112,7 +180,7 @@ type MetricCache interface {
 	//   traceTerm: Trace term identifier
 	DoneRequestCount(requestID string, modelName string, traceTerm int64)
 
-	// AddSubscriber adds a metric subscriber
+	// AddSubscriber adds a metric subscriber, whose metrics are collected from the pods
 	// Parameters:
 	//   subscriber: Metric subscriber implementation
 	AddSubscriber(subscriber metrics.MetricSubscriber)
@@ -137,3 +205,14 @@ type TraceCache interface {
 	//   traceTerm: Trace term identifier
 	DoneRequestTrace(requestID string, modelName string, inputTokens, outputTokens, traceTerm int64)
 }
+
+// DebugCache defines operations for cache introspection
+type DebugCache interface {
+	// GetDebugSnapshot returns the state of the cache for debugging
+	// Parameters:
+	//   modelName: Name of the model to filter by, empty for all models
+	//   podName: Name of the pod to filter by, empty for all pods
+	// Returns:
+	//   *DebugSnapshot: State of the pods and the models
+	GetDebugSnapshot(modelName, podName string) *DebugSnapshot
+}
@@ -0,0 +1,181 @@
+/*
+Copyright 2024 The Aibrix Team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cache
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/vllm-project/aibrix/pkg/metrics"
+	"github.com/vllm-project/aibrix/pkg/utils"
+	"k8s.io/klog/v2"
+)
+
+// DebugPath is the path of the cache introspection API
+const DebugPath = "/debug/cache"
+
+// DebugSnapshot is the state of the cache served by the introspection API.
+type DebugSnapshot struct {
+	Pods   map[string]*DebugPod   `json:"pods"`
+	Models map[string]*DebugModel `json:"models"`
+}
+
+// DebugPod is the state of a pod, Adapters are the LoRA adapters placed on the pod besides its base model.
+// DiscoveredModels are the models mapped only because the engine serves them, and UnservedModels are the models
+// of the pod not served by the engine.
+type DebugPod struct {
+	IP                string                            `json:"ip"`
+	Ready             bool                              `json:"ready"`
+	BaseModel         string                            `json:"base_model"`
+	Adapters          []string                          `json:"adapters,omitempty"`
+	DiscoveredModels  []string                          `json:"discovered_models,omitempty"`
+	UnservedModels    []string                          `json:"unserved_models,omitempty"`
+	Metrics           map[string]interface{}            `json:"metrics,omitempty"`
+	ModelMetrics      map[string]map[string]interface{} `json:"model_metrics,omitempty"`
+	MetricsUpdateTime *time.Time                        `json:"metrics_update_time,omitempty"`
+	MetricsAgeSeconds *float64                          `json:"metrics_age_seconds,omitempty"`
+	Pushing           bool                              `json:"pushing"`
+}
+
+// DebugModel is the state of a model, RequestTrace are the request counts of the current trace window by bucket.
+type DebugModel struct {
+	Pods            []string       `json:"pods"`
+	PendingRequests int32          `json:"pending_requests"`
+	RequestTrace    map[string]int `json:"request_trace,omitempty"`
+}
+
+// GetDebugSnapshot returns the state of the cache, optionally filtered by model and pod
+// Parameters:
+//
+//	modelName: Name of the model to filter by, empty for all models
+//	podName: Name of the pod to filter by, empty for all pods
+//
+// Returns:
+//
+//	*DebugSnapshot: State of the pods and the models matching the filters
+func (c *Store) GetDebugSnapshot(modelName, podName string) *DebugSnapshot {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	now := time.Now()
+	snapshot := &DebugSnapshot{Pods: map[string]*DebugPod{}, Models: map[string]*DebugModel{}}
+	for name, pod := range c.Pods {
+		if podName != "" && name != podName {
+			continue
+		}
+		if _, ok := c.PodToModelMapping[name][modelName]; modelName != "" && !ok {
+			continue
+		}
+		baseModel, _ := PodModelKey(pod)
+		debugPod := &DebugPod{
+			IP:           pod.Status.PodIP,
+			Ready:        utils.IsPodReady(pod),
+			BaseModel:    baseModel,
+			Metrics:      debugMetricValues(c.PodMetrics[name]),
+			ModelMetrics: map[string]map[string]interface{}{},
+			Pushing:      c.isPushingLocked(name, now),
+		}
+		for model := range c.PodToModelMapping[name] {
+			if model != debugPod.BaseModel {
+				debugPod.Adapters = append(debugPod.Adapters, model)
+			}
+		}
+		sort.Strings(debugPod.Adapters)
+		for model := range c.podDiscoveredModels[name] {
+			debugPod.DiscoveredModels = append(debugPod.DiscoveredModels, model)
+		}
+		sort.Strings(debugPod.DiscoveredModels)
+		debugPod.UnservedModels = append([]string(nil), c.podUnservedModels[name]...)
+		for model, modelMetrics := range c.PodModelMetrics[name] {
+			if modelName == "" || model == modelName {
+				debugPod.ModelMetrics[model] = debugMetricValues(modelMetrics)
+			}
+		}
+		if updateTime, ok := c.podMetricsUpdateTime[name]; ok {
+			age := now.Sub(updateTime).Seconds()
+			debugPod.MetricsUpdateTime, debugPod.MetricsAgeSeconds = &updateTime, &age
+		}
+		snapshot.Pods[name] = debugPod
+	}
+
+	for name, pods := range c.ModelToPodMapping {
+		if modelName != "" && name != modelName {
+			continue
+		}
+		if _, ok := pods[podName]; podName != "" && !ok {
+			continue
+		}
+		debugModel := &DebugModel{Pods: make([]string, 0, len(pods))}
+		for pod := range pods {
+			debugModel.Pods = append(debugModel.Pods, pod)
+		}
+		sort.Strings(debugModel.Pods)
+		if counter, ok := c.pendingRequests.Load(name); ok {
+			debugModel.PendingRequests = atomic.LoadInt32(counter.(*int32))
+		}
+		// traces are reset to nil once written to the storage
+		if value, ok := c.requestTrace.Load(name); ok {
+			if trace, ok := value.(*RequestTrace); ok && trace != nil {
+				debugModel.RequestTrace = trace.ToMap(debugModel.PendingRequests)
+			}
+		}
+		snapshot.Models[name] = debugModel
+	}
+	return snapshot
+}
+
+// debugMetricValues converts metric values to their JSON representation: a number for counters and gauges,
+// a string for label metrics and Prometheus results, and the sum, count and buckets for histograms.
+func debugMetricValues(values map[string]metrics.MetricValue) map[string]interface{} {
+	if len(values) == 0 {
+		return nil
+	}
+	debugValues := make(map[string]interface{}, len(values))
+	for metricName, value := range values {
+		switch v := value.(type) {
+		case *metrics.SimpleMetricValue:
+			debugValues[metricName] = v.Value
+		case *metrics.HistogramMetricValue:
+			debugValues[metricName] = map[string]interface{}{"sum": v.Sum, "count": v.Count, "buckets": v.Buckets}
+		case *metrics.LabelValueMetricValue:
+			debugValues[metricName] = v.Value
+		case *metrics.PrometheusMetricValue:
+			if v.Result != nil && *v.Result != nil {
+				debugValues[metricName] = (*v.Result).String()
+			}
+		}
+	}
+	return debugValues
+}
+
+// NewDebugHandler returns the handler of the read-only cache introspection API, which serves the state of
+// the cache as JSON filtered by the model and pod query parameters.
+func NewDebugHandler(c Cache) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		snapshot := c.GetDebugSnapshot(r.URL.Query().Get("model"), r.URL.Query().Get("pod"))
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(snapshot); err != nil {
+			klog.ErrorS(err, "failed to write cache snapshot")
+		}
+	})
+}
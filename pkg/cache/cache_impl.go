@@ -19,6 +19,7 @@ package cache
 import (
 	"fmt"
 	"sync/atomic"
+	"time"
 
 	"github.com/vllm-project/aibrix/pkg/metrics"
 	v1 "k8s.io/api/core/v1"
@@ -77,6 +78,39 @@ func (c *Store) ListPodsByModel(modelName string) (map[string]*v1.Pod, error) {
 	return podsMap, nil
 }
 
+// GetPodGPUType gets the GPU type of a Pod, the pod label takes precedence
+// over the GPU product label of the node the Pod is scheduled on
+// Parameters:
+//
+//	podName: Name of the Pod to query
+//
+// Returns:
+//
+//	string: GPU type of the Pod
+//	error: Error if Pod doesn't exist or GPU type is unknown
+func (c *Store) GetPodGPUType(podName string) (string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	pod, ok := c.Pods[podName]
+	if !ok {
+		return "", fmt.Errorf("pod does not exist in the cache: %s", podName)
+	}
+	if gpuType, ok := pod.Labels[PodGPUTypeIdentifier]; ok && gpuType != "" {
+		return gpuType, nil
+	}
+
+	node, ok := c.Nodes[pod.Spec.NodeName]
+	if !ok {
+		return "", fmt.Errorf("gpu type is unknown for pod: %s", podName)
+	}
+	gpuType := node.Labels[NodeGPUProductIdentifier]
+	if gpuType == "" {
+		return "", fmt.Errorf("gpu type is unknown for pod: %s", podName)
+	}
+	return gpuType, nil
+}
+
 // ListModels returns all cached model names
 // Returns:
 //
@@ -149,6 +183,9 @@ func (c *Store) GetMetricValueByPod(podName, metricName string) (metrics.MetricV
 	if !ok {
 		return nil, fmt.Errorf("pod does not exist in the podMetrics cache")
 	}
+	if err := c.checkPodMetricsStalenessLocked(podName); err != nil {
+		return nil, err
+	}
 
 	metricVal, ok := podMetrics[metricName]
 	if !ok {
@@ -177,6 +214,9 @@ func (c *Store) GetMetricValueByPodModel(podName, modelName string, metricName s
 	if !ok {
 		return nil, fmt.Errorf("pod does not exist in the podMetrics cache")
 	}
+	if err := c.checkPodMetricsStalenessLocked(podName); err != nil {
+		return nil, err
+	}
 
 	modelMetrics, ok := podMetrics[modelName]
 	if !ok {
@@ -191,6 +231,39 @@ func (c *Store) GetMetricValueByPodModel(podName, modelName string, metricName s
 	return metricVal, nil
 }
 
+// GetPodMetricsUpdateTime retrieves the time the metrics of a Pod were last scraped
+// Parameters:
+//
+//	podName: Name of the Pod
+//
+// Returns:
+//
+//	time.Time: Time of the last successful scrape
+//	error: Error if the metrics of the Pod were never scraped
+func (c *Store) GetPodMetricsUpdateTime(podName string) (time.Time, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	updateTime, ok := c.podMetricsUpdateTime[podName]
+	if !ok {
+		return time.Time{}, fmt.Errorf("metrics of pod %s were never scraped", podName)
+	}
+	return updateTime, nil
+}
+
+// checkPodMetricsStalenessLocked returns an error if the metrics of the pod were last scraped more than
+// AIBRIX_POD_METRIC_STALENESS_INTERVALS refresh intervals ago.
+func (c *Store) checkPodMetricsStalenessLocked(podName string) error {
+	if podMetricStalenessIntervals == 0 {
+		return nil
+	}
+	updateTime, ok := c.podMetricsUpdateTime[podName]
+	if ok && time.Since(updateTime) > time.Duration(podMetricStalenessIntervals)*podMetricRefreshInterval {
+		return fmt.Errorf("metrics of pod %s are stale, last scraped at %v", podName, updateTime)
+	}
+	return nil
+}
+
 // AddRequestCount tracks new request initiation
 // Parameters:
 //
@@ -275,11 +348,14 @@ func (c *Store) DoneRequestTrace(requestID string, modelName string, inputTokens
 	}
 }
 
-// AddSubscriber registers new metric subscriber
+// AddSubscriber registers new metric subscriber, the union of the metrics of all subscribers is collected
+// from the pods, or all metrics if there is no subscriber
 // Parameters:
 //
 //	subscriber: Metric subscriber implementation
 func (c *Store) AddSubscriber(subscriber metrics.MetricSubscriber) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.subscribers = append(c.subscribers, subscriber)
 	c.aggregateMetrics()
 }
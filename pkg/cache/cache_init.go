@@ -17,7 +17,6 @@ limitations under the License.
 package cache
 
 import (
-	"errors"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -28,48 +27,44 @@ import (
 	"k8s.io/klog/v2"
 
 	prometheusv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	modelv1alpha1 "github.com/vllm-project/aibrix/api/model/v1alpha1"
 	"github.com/vllm-project/aibrix/pkg/metrics"
 )
 
-var (
-	store = &Store{} // Global cache store instance
-	once  sync.Once  // Singleton pattern control lock
-)
-
 // Store contains core data structures and components of the caching system
 type Store struct {
 	mu            sync.RWMutex     // Read-write lock for concurrency safety
-	initialized   bool             // Initialization status flag
 	redisClient   *redis.Client    // Redis client instance
 	prometheusApi prometheusv1.API // Prometheus API client
 
 	// Metrics related fields
 	subscribers       []metrics.MetricSubscriber // List of metric subscribers
-	metrics           map[string]any             // Generic metric storage
+	subscribedMetrics map[string]struct{}        // Union of the metrics of the subscribers
 	requestTrace      *sync.Map                  // Request trace data (model_name: RequestTrace)
 	pendingRequests   *sync.Map                  // In-progress request records
 	numRequestsTraces int32                      // Request trace counter
 
 	// Pod related storage
-	Pods            map[string]*v1.Pod                                   // Pod name to Pod object mapping
-	PodMetrics      map[string]map[string]metrics.MetricValue            // Pod metrics (pod_name -> metric_name -> value)
-	PodModelMetrics map[string]map[string]map[string]metrics.MetricValue // Pod-model metrics (pod_name -> model_name -> metric_name -> value)
+	Pods                 map[string]*v1.Pod                                   // Pod name to Pod object mapping
+	PodMetrics           map[string]map[string]metrics.MetricValue            // Pod metrics (pod_name -> metric_name -> value)
+	PodModelMetrics      map[string]map[string]map[string]metrics.MetricValue // Pod-model metrics (pod_name -> model_name -> metric_name -> value)
+	podMetricsUpdateTime map[string]time.Time                                 // Time of the last successful metrics scrape per pod
+	podMetricsPushTime   map[string]time.Time                                 // Time of the last metrics push per pod
+	podMetricHistory     map[string]map[metricHistoryKey]*metricHistory       // Recent samples of the metrics per pod
+	podDerivedMetrics    map[string]map[metricHistoryKey]float64              // Last derived metric values per pod
 
-	// Mapping relationships
-	PodToModelMapping map[string]map[string]struct{} // Pod to model mapping (pod_name -> model set)
-	ModelToPodMapping map[string]map[string]*v1.Pod  // Model to pod mapping (model_name -> pod set)
-}
+	// Node related storage
+	Nodes map[string]*v1.Node // Node name to Node object mapping, only nodes with gpu product label
 
-// Get retrieves the cache instance
-// Returns:
-//
-//	Cache: Cache interface instance
-//	error: Returns error if cache is not initialized
-func Get() (Cache, error) {
-	if !store.initialized {
-		return nil, errors.New("cache is not initialized")
-	}
-	return store, nil
+	// Mapping relationships
+	PodToModelMapping   map[string]map[string]struct{}    // Pod to model mapping (pod_name -> model set)
+	ModelToPodMapping   map[string]map[string]*v1.Pod     // Model to pod mapping (model_name -> pod set)
+	podDiscoveredModels map[string]map[string]struct{}    // Models mapped only because the engine of the pod serves them
+	podUnservedModels   map[string][]string               // Models of the pod not served by its engine
+	podServedModels     map[string]map[string]servedModel // Models last listed by the engine of the pod
+
+	// Model adapter related storage
+	modelAdapters map[string]*modelv1alpha1.ModelAdapter // Model adapters by model name
 }
 
 // New creates a new cache store instance
@@ -83,22 +78,31 @@ func Get() (Cache, error) {
 //	Store: Initialized cache store instance
 func New(redisClient *redis.Client, prometheusApi prometheusv1.API) *Store {
 	return &Store{
-		initialized:     true,
 		redisClient:     redisClient,
 		prometheusApi:   prometheusApi,
 		requestTrace:    &sync.Map{},
 		pendingRequests: &sync.Map{},
 
 		// Initialize storage maps
-		Pods:              make(map[string]*v1.Pod),
-		PodMetrics:        make(map[string]map[string]metrics.MetricValue),
-		PodModelMetrics:   make(map[string]map[string]map[string]metrics.MetricValue),
-		PodToModelMapping: make(map[string]map[string]struct{}),
-		ModelToPodMapping: make(map[string]map[string]*v1.Pod),
+		Pods:                 make(map[string]*v1.Pod),
+		PodMetrics:           make(map[string]map[string]metrics.MetricValue),
+		PodModelMetrics:      make(map[string]map[string]map[string]metrics.MetricValue),
+		podMetricsUpdateTime: make(map[string]time.Time),
+		podMetricsPushTime:   make(map[string]time.Time),
+		podMetricHistory:     make(map[string]map[metricHistoryKey]*metricHistory),
+		podDerivedMetrics:    make(map[string]map[metricHistoryKey]float64),
+		Nodes:                make(map[string]*v1.Node),
+		PodToModelMapping:    make(map[string]map[string]struct{}),
+		ModelToPodMapping:    make(map[string]map[string]*v1.Pod),
+		podDiscoveredModels:  make(map[string]map[string]struct{}),
+		podUnservedModels:    make(map[string][]string),
+		podServedModels:      make(map[string]map[string]servedModel),
+		modelAdapters:        make(map[string]*modelv1alpha1.ModelAdapter),
 	}
 }
 
-// Init initializes the cache store (singleton pattern)
+// Init creates a cache store and starts watching the cluster and collecting the pod metrics, the store is
+// passed to the components using it
 // Parameters:
 //
 //	config: Kubernetes configuration
@@ -109,16 +113,15 @@ func New(redisClient *redis.Client, prometheusApi prometheusv1.API) *Store {
 //
 //	*Store: Pointer to initialized store instance
 func Init(config *rest.Config, stopCh <-chan struct{}, redisClient *redis.Client) *Store {
-	once.Do(func() {
-		store = New(redisClient, initPrometheusAPI())
+	store := New(redisClient, initPrometheusAPI())
 
-		// Initialize cache components
-		if err := initCacheInformers(store, config, stopCh); err != nil {
-			panic(err)
-		}
-		initMetricsCache(store, stopCh)
-		initTraceCache(redisClient, stopCh)
-	})
+	// Initialize cache components
+	if err := initCacheInformers(store, config, stopCh); err != nil {
+		panic(err)
+	}
+	initMetricsCache(store, stopCh)
+	initModelDiscovery(store, stopCh)
+	initTraceCache(store, redisClient, stopCh)
 
 	return store
 }
@@ -149,9 +152,10 @@ func initMetricsCache(store *Store, stopCh <-chan struct{}) {
 // initTraceCache initializes request tracing cache
 // Parameters:
 //
+//	store: Cache store instance
 //	redisClient: Redis client instance
 //	stopCh: Stop signal channel
-func initTraceCache(redisClient *redis.Client, stopCh <-chan struct{}) {
+func initTraceCache(store *Store, redisClient *redis.Client, stopCh <-chan struct{}) {
 	// Calculate time offset for window alignment
 	tickerOffset := time.Duration(time.Now().UnixNano()) % RequestTraceWriteInterval
 	var traceAlignmentTimer *time.Timer
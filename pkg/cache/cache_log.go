@@ -17,7 +17,11 @@ package cache
 
 import "k8s.io/klog/v2"
 
+// updateDebugInfo logs the state of the cache at V(4), the state is also served as JSON on DebugPath.
 func (c *Store) updateDebugInfo() {
+	if !klog.V(4).Enabled() {
+		return
+	}
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
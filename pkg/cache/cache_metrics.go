@@ -18,7 +18,10 @@ package cache
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	prometheusv1 "github.com/prometheus/client_golang/api/prometheus/v1"
@@ -32,54 +35,34 @@ import (
 const (
 	podPort                             = 8000
 	defaultPodMetricRefreshIntervalInMS = 50
+	defaultPodMetricScrapeConcurrency   = 16
+	defaultPodMetricScrapeTimeoutInMS   = 1000
+
+	derivedMetricSourceLocal      = "local"
+	derivedMetricSourcePrometheus = "prometheus"
 )
 
 var (
-	counterGaugeMetricNames = []string{
-		metrics.NumRequestsRunning,
-		metrics.NumRequestsWaiting,
-		metrics.NumRequestsSwapped,
-		metrics.AvgPromptThroughputToksPerS,
-		metrics.AvgGenerationThroughputToksPerS,
-		metrics.GPUCacheUsagePerc,
-		metrics.CPUCacheUsagePerc,
-	}
-
-	// histogram metric example - time_to_first_token_seconds, _sum, _bucket _count.
-	histogramMetricNames = []string{
-		metrics.IterationTokensTotal,
-		metrics.TimeToFirstTokenSeconds,
-		metrics.TimePerOutputTokenSeconds,
-		metrics.E2ERequestLatencySeconds,
-		metrics.RequestQueueTimeSeconds,
-		metrics.RequestInferenceTimeSeconds,
-		metrics.RequestDecodeTimeSeconds,
-		metrics.RequestPrefillTimeSeconds,
-	}
-
-	prometheusMetricNames = []string{
-		metrics.P95TTFT5m,
-		metrics.P95TTFT5mPod,
-		metrics.AvgTTFT5mPod,
-		metrics.P95TPOT5mPod,
-		metrics.AvgTPOT5mPod,
-		metrics.AvgPromptToksPerReq,
-		metrics.AvgGenerationToksPerReq,
-		metrics.AvgE2ELatencyPod,
-		metrics.AvgRequestsPerMinPod,
-		metrics.AvgPromptThroughputToksPerMinPod,
-		metrics.AvgGenerationThroughputToksPerMinPod,
-	}
-
-	labelQueryMetricNames = []string{
-		metrics.MaxLora,
-		metrics.WaitingLoraAdapters,
-		metrics.RunningLoraAdapters,
-	}
 	// TODO: add a helper function for get methods.
-	podMetricRefreshInterval = getPodMetricRefreshInterval()
+	podMetricRefreshInterval   = getPodMetricRefreshInterval()
+	podMetricScrapeConcurrency = getPositiveIntEnv("AIBRIX_POD_METRIC_SCRAPE_CONCURRENCY", defaultPodMetricScrapeConcurrency)
+	podMetricScrapeTimeout     = time.Duration(getPositiveIntEnv("AIBRIX_POD_METRIC_SCRAPE_TIMEOUT_MS", defaultPodMetricScrapeTimeoutInMS)) * time.Millisecond
+	// podMetricStalenessIntervals is the number of refresh intervals after which the metrics of a pod are stale
+	// and not returned, 0 never considers metrics stale.
+	podMetricStalenessIntervals = getPositiveIntEnv("AIBRIX_POD_METRIC_STALENESS_INTERVALS", 0)
+	// derivedMetricSource is local to compute the PromQL-based metrics with a derivation from the metric history,
+	// or prometheus to query them from the Prometheus endpoint if configured.
+	derivedMetricSource = utils.LoadEnv("AIBRIX_DERIVED_METRIC_SOURCE", defaultDerivedMetricSource())
 )
 
+// defaultDerivedMetricSource queries the PromQL-based metrics from Prometheus when its endpoint is configured.
+func defaultDerivedMetricSource() string {
+	if utils.LoadEnv("PROMETHEUS_ENDPOINT", "") != "" {
+		return derivedMetricSourcePrometheus
+	}
+	return derivedMetricSourceLocal
+}
+
 func initPrometheusAPI() prometheusv1.API {
 	// Load environment variables
 	prometheusEndpoint := utils.LoadEnv("PROMETHEUS_ENDPOINT", "")
@@ -115,75 +98,254 @@ func getPodMetricRefreshInterval() time.Duration {
 	return defaultPodMetricRefreshIntervalInMS * time.Millisecond
 }
 
-func (c *Store) updatePodMetrics() {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+// getListEnv returns the comma separated values of the environment variable, nil if it is not set.
+func getListEnv(env string) []string {
+	var values []string
+	for _, value := range strings.Split(utils.LoadEnv(env, ""), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
 
-	readyPods := utils.FilterReadyPods(c.Pods)
-	if len(readyPods) == 0 {
-		return
+func getPositiveIntEnv(env string, defaultValue int) int {
+	value := utils.LoadEnv(env, "")
+	if value != "" {
+		intValue, err := strconv.Atoi(value)
+		if err != nil || intValue <= 0 {
+			klog.Infof("invalid %s: %s, falling back to default", env, value)
+		} else {
+			klog.Infof("using %s env value: %d", env, intValue)
+			return intValue
+		}
 	}
+	klog.Infof("using default %s: %d", env, defaultValue)
+	return defaultValue
+}
+
+// collectedMetricNames groups the metrics to collect from the pods by the way they are collected, which is
+// derived from their definition in metrics.Metrics.
+type collectedMetricNames struct {
+	counterGauge []string
+	histogram    []string
+	labelQuery   []string
+	prometheus   []string
+	// derived metrics are computed from the history of their source metrics, which are collected too.
+	derived []string
+}
 
-	for _, pod := range readyPods {
-		podName := pod.Name
-		if len(c.PodMetrics[podName]) == 0 {
-			c.PodMetrics[podName] = map[string]metrics.MetricValue{}
+func newCollectedMetricNames(metricNames []string, deriveLocally bool) *collectedMetricNames {
+	names := &collectedMetricNames{}
+	collected := map[string]bool{}
+	var collect func(metricName string)
+	collect = func(metricName string) {
+		if collected[metricName] {
+			return
+		}
+		collected[metricName] = true
+		metric, exists := metrics.Metrics[metricName]
+		if !exists {
+			klog.V(4).Infof("Cannot find %v in the metric list", metricName)
+			return
 		}
-		if len(c.PodModelMetrics[podName]) == 0 {
-			c.PodModelMetrics[podName] = make(map[string]map[string]metrics.MetricValue)
+		switch {
+		case deriveLocally && metric.Derivation != nil:
+			names.derived = append(names.derived, metricName)
+			collect(metric.Derivation.Source)
+		case metric.MetricSource == metrics.PrometheusEndpoint && metric.MetricType.Query == metrics.PromQL:
+			names.prometheus = append(names.prometheus, metricName)
+		case metric.MetricSource == metrics.PodRawMetrics && metric.MetricType.Query == metrics.QueryLabel:
+			names.labelQuery = append(names.labelQuery, metricName)
+		case metric.MetricSource == metrics.PodRawMetrics && metric.MetricType.Raw == metrics.Histogram:
+			names.histogram = append(names.histogram, metricName)
+		case metric.MetricSource == metrics.PodRawMetrics && metric.MetricType.IsRawMetric():
+			names.counterGauge = append(names.counterGauge, metricName)
+		default:
+			klog.V(4).Infof("Collecting %v from %v is not supported", metricName, metric.MetricSource)
 		}
+	}
+	for _, metricName := range metricNames {
+		collect(metricName)
+	}
+	for _, group := range [][]string{names.counterGauge, names.histogram, names.labelQuery, names.prometheus, names.derived} {
+		sort.Strings(group)
+	}
+	return names
+}
 
-		// We should use the primary container port. In the future, we can decide whether to use sidecar container's port
-		url := fmt.Sprintf("http://%s:%d/metrics", pod.Status.PodIP, podPort)
-		allMetrics, err := metrics.ParseMetricsURL(url)
-		if err != nil {
-			klog.V(4).Infof("Error parsing metric families: %v\n", err)
+// collectedMetricNamesLocked returns the union of the metrics of the subscribers, or all metrics if there is no subscriber.
+func (c *Store) collectedMetricNamesLocked() *collectedMetricNames {
+	metricNames := make([]string, 0, len(metrics.Metrics))
+	if len(c.subscribers) == 0 {
+		for metricName := range metrics.Metrics {
+			metricNames = append(metricNames, metricName)
 		}
+	} else {
+		for metricName := range c.subscribedMetrics {
+			metricNames = append(metricNames, metricName)
+		}
+	}
+	deriveLocally := c.prometheusApi == nil || derivedMetricSource != derivedMetricSourcePrometheus
+	return newCollectedMetricNames(metricNames, deriveLocally)
+}
 
-		// parse counterGaugeMetricsNames
-		c.updateSimpleMetricFromRawMetricsLocked(pod, allMetrics)
+// podMetricRecord holds the metrics of a pod scraped in one refresh, which replace the previous metrics of the pod at once.
+type podMetricRecord struct {
+	podMetrics      map[string]metrics.MetricValue
+	podModelMetrics map[string]map[string]metrics.MetricValue
+}
 
-		// parse histogramMetrics
-		c.updateHistogramMetricFromRawMetricsLocked(pod, allMetrics)
+func newPodMetricRecord() *podMetricRecord {
+	return &podMetricRecord{
+		podMetrics:      map[string]metrics.MetricValue{},
+		podModelMetrics: map[string]map[string]metrics.MetricValue{},
+	}
+}
+
+// updatePodMetrics scrapes the subscribed metrics of the ready pods not pushing their metrics concurrently without
+// holding the lock, and then swaps in the metrics of the pods scraped successfully. Pods failing to scrape keep their
+// previous metrics, which become stale.
+func (c *Store) updatePodMetrics() {
+	c.mu.RLock()
+	names := c.collectedMetricNamesLocked()
+	now := time.Now()
+	var readyPods []*v1.Pod
+	podModels := map[string][]string{}
+	for _, pod := range utils.FilterReadyPods(c.Pods) {
+		key := PodKey(pod)
+		// pods pushing their metrics are not polled
+		if c.isPushingLocked(key, now) {
+			continue
+		}
+		readyPods = append(readyPods, pod)
+		for modelName := range c.PodToModelMapping[key] {
+			podModels[key] = append(podModels[key], modelName)
+		}
+	}
+	c.mu.RUnlock()
+	if len(readyPods) == 0 {
+		return
+	}
 
-		// parse QueryLabel metrics
-		c.updateQueryLabelMetricFromRawMetricsLocked(pod, allMetrics)
+	records := make([]*podMetricRecord, len(readyPods))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < podMetricScrapeConcurrency && i < len(readyPods); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				records[j] = c.scrapePodMetrics(readyPods[j], podModels[PodKey(readyPods[j])], names)
+			}
+		}()
+	}
+	for i := range readyPods {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
 
-		if c.prometheusApi == nil {
-			klog.V(4).InfoS("Prometheus api is not initialized, PROMETHEUS_ENDPOINT is not configured, skip fetching prometheus metrics")
+	now = time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, pod := range readyPods {
+		key := PodKey(pod)
+		// skip pods failed to scrape, pods deleted and pods started pushing during the scrape
+		if records[i] == nil || c.Pods[key] == nil || c.isPushingLocked(key, now) {
 			continue
 		}
-		// parse prometheus metrics
-		c.updateMetricFromPromQLLocked(pod)
+		c.PodMetrics[key] = records[i].podMetrics
+		c.PodModelMetrics[key] = records[i].podModelMetrics
+		c.podMetricsUpdateTime[key] = now
+		c.recordMetricHistoryLocked(key, records[i], now)
+		c.updateDerivedMetricsLocked(key, names.derived, now)
+	}
+}
+
+// scrapePodMetrics returns the metrics of the pod, nil if the metrics cannot be scraped within the timeout.
+func (c *Store) scrapePodMetrics(pod *v1.Pod, modelNames []string, names *collectedMetricNames) *podMetricRecord {
+	ctx, cancel := context.WithTimeout(context.Background(), podMetricScrapeTimeout)
+	defer cancel()
+
+	// We should use the primary container port. In the future, we can decide whether to use sidecar container's port
+	url := fmt.Sprintf("http://%s:%d/metrics", pod.Status.PodIP, podPort)
+	allMetrics, err := metrics.ParseMetricsURLWithContext(ctx, url)
+	if err != nil {
+		klog.V(4).Infof("Error parsing metric families: %v\n", err)
+		return nil
+	}
+
+	record := newPodMetricRecord()
+	// the engine profile translates the metrics of other engines than vLLM
+	profile := metrics.GetEngineProfile(pod.Labels[metrics.EngineIdentifier])
+
+	// parse counterGaugeMetricsNames
+	c.updateSimpleMetricFromRawMetrics(record, pod, profile, allMetrics, names.counterGauge)
+
+	// parse histogramMetrics
+	c.updateHistogramMetricFromRawMetrics(record, pod, profile, allMetrics, names.histogram)
+
+	// parse QueryLabel metrics
+	c.updateQueryLabelMetricFromRawMetrics(record, pod, profile, allMetrics, names.labelQuery)
+
+	if c.prometheusApi == nil {
+		klog.V(4).InfoS("Prometheus api is not initialized, PROMETHEUS_ENDPOINT is not configured, skip fetching prometheus metrics")
+		return record
 	}
+	// parse prometheus metrics
+	c.updateMetricFromPromQL(ctx, record, pod, modelNames, names.prometheus)
+	return record
 }
 
-func (c *Store) updateSimpleMetricFromRawMetricsLocked(pod *v1.Pod, allMetrics map[string]*dto.MetricFamily) {
-	podName := pod.Name
-	for _, metricName := range counterGaugeMetricNames {
+// modelNameOfMetric returns the model label of the metric, or the model of the pod if the engine has no model label.
+func modelNameOfMetric(pod *v1.Pod, profile *metrics.EngineProfile, familyMetric *dto.Metric) string {
+	if profile.ModelLabel == "" {
+		modelName, _ := PodModelKey(pod)
+		return modelName
+	}
+	modelName, _ := metrics.GetLabelValueForKey(familyMetric, profile.ModelLabel)
+	return EngineModelKey(pod.Namespace, modelName)
+}
+
+func (c *Store) updateSimpleMetricFromRawMetrics(record *podMetricRecord, pod *v1.Pod, profile *metrics.EngineProfile, allMetrics map[string]*dto.MetricFamily, metricNames []string) {
+	podName := PodKey(pod)
+	for _, metricName := range metricNames {
 		metric, exists := metrics.Metrics[metricName]
 		if !exists {
 			klog.V(4).Infof("Cannot find %v in the metric list", metricName)
 			continue
 		}
 
-		// TODO: we should refact metricName to fit other engine
-		metricFamily, exists := allMetrics[fmt.Sprintf("vllm:%s", metricName)]
+		rawMetric, exists := profile.RawMetric(metricName)
+		if !exists {
+			klog.V(5).Infof("Engine %s does not export %v", profile.Name, metricName)
+			continue
+		}
+		metricFamily, exists := allMetrics[rawMetric.Name]
 		if !exists {
-			klog.V(4).Infof("Cannot find %v in the pod metrics", metricName)
+			klog.V(4).Infof("Cannot find %v in the pod metrics", rawMetric.Name)
 			continue
 		}
 		scope := metric.MetricScope
 		for _, familyMetric := range metricFamily.Metric {
-			modelName, _ := metrics.GetLabelValueForKey(familyMetric, "model_name")
+			if !rawMetric.Matches(familyMetric) {
+				continue
+			}
+			modelName := modelNameOfMetric(pod, profile, familyMetric)
 
 			metricValue, err := metrics.GetCounterGaugeValue(familyMetric, metricFamily.GetType())
 			if err != nil {
 				klog.V(4).Infof("failed to parse metrics %s from pod %s %s %d: %v", metricName, podName, pod.Status.PodIP, podPort, err)
 				continue
 			}
+			metricValue = rawMetric.ScaleValue(metricValue)
+			// counters with several series per model, e.g. by finish reason, are summed up
+			if metric.MetricType.Raw == metrics.Counter && len(rawMetric.Labels) == 0 {
+				metricValue += record.simpleValue(modelName, metricName)
+			}
 
-			err = c.updatePodRecordLocked(podName, modelName, metricName, scope, &metrics.SimpleMetricValue{Value: metricValue})
+			err = record.update(modelName, metricName, scope, &metrics.SimpleMetricValue{Value: metricValue})
 			if err != nil {
 				klog.V(4).Infof("Failed to update metrics %s from pod %s %s %d: %v", metricName, podName, pod.Status.PodIP, podPort, err)
 				continue
@@ -194,35 +356,44 @@ func (c *Store) updateSimpleMetricFromRawMetricsLocked(pod *v1.Pod, allMetrics m
 	}
 }
 
-func (c *Store) updateHistogramMetricFromRawMetricsLocked(pod *v1.Pod, allMetrics map[string]*dto.MetricFamily) {
-	podName := pod.Name
-	for _, metricName := range histogramMetricNames {
+func (c *Store) updateHistogramMetricFromRawMetrics(record *podMetricRecord, pod *v1.Pod, profile *metrics.EngineProfile, allMetrics map[string]*dto.MetricFamily, metricNames []string) {
+	podName := PodKey(pod)
+	for _, metricName := range metricNames {
 		metric, exists := metrics.Metrics[metricName]
 		if !exists {
 			klog.V(4).Infof("Cannot find %v in the metric list", metricName)
 			continue
 		}
 
-		metricFamily, exists := allMetrics[fmt.Sprintf("vllm:%s", metricName)]
+		rawMetric, exists := profile.RawMetric(metricName)
+		if !exists {
+			klog.V(5).Infof("Engine %s does not export %v", profile.Name, metricName)
+			continue
+		}
+		metricFamily, exists := allMetrics[rawMetric.Name]
 		if !exists {
-			klog.V(4).Infof("Cannot find %v in the pod metrics", metricName)
+			klog.V(4).Infof("Cannot find %v in the pod metrics", rawMetric.Name)
 			continue
 		}
 		scope := metric.MetricScope
 		for _, familyMetric := range metricFamily.Metric {
-			modelName, _ := metrics.GetLabelValueForKey(familyMetric, "model_name")
+			if !rawMetric.Matches(familyMetric) {
+				continue
+			}
+			modelName := modelNameOfMetric(pod, profile, familyMetric)
 			metricValue, err := metrics.GetHistogramValue(familyMetric)
 			if err != nil {
 				klog.V(4).Infof("failed to parse metrics %s from pod %s %s %d: %v", metricName, pod.Name, pod.Status.PodIP, podPort, err)
 				continue
 			}
+			metricValue = rawMetric.ScaleHistogram(metricValue)
 
 			histogramValue := &metrics.HistogramMetricValue{
 				Sum:     metricValue.Sum,
 				Count:   metricValue.Count,
 				Buckets: metricValue.Buckets,
 			}
-			err = c.updatePodRecordLocked(podName, modelName, metricName, scope, histogramValue)
+			err = record.update(modelName, metricName, scope, histogramValue)
 			if err != nil {
 				klog.V(4).Infof("Failed to update metrics %s from pod %s %s %d: %v", metricName, podName, pod.Status.PodIP, podPort, err)
 				continue
@@ -234,26 +405,33 @@ func (c *Store) updateHistogramMetricFromRawMetricsLocked(pod *v1.Pod, allMetric
 	}
 }
 
-func (c *Store) updateQueryLabelMetricFromRawMetricsLocked(pod *v1.Pod, allMetrics map[string]*dto.MetricFamily) {
-	podName := pod.Name
+func (c *Store) updateQueryLabelMetricFromRawMetrics(record *podMetricRecord, pod *v1.Pod, profile *metrics.EngineProfile, allMetrics map[string]*dto.MetricFamily, metricNames []string) {
+	podName := PodKey(pod)
 
-	for _, labelMetricName := range labelQueryMetricNames {
+	for _, labelMetricName := range metricNames {
 		metric, exists := metrics.Metrics[labelMetricName]
 		if !exists {
 			klog.V(4).Infof("Cannot find %v in the metric list", labelMetricName)
 			continue
 		}
-		rawMetricName := metric.RawMetricName
+		rawMetric, exists := profile.RawMetric(metric.RawMetricName)
+		if !exists {
+			klog.V(5).Infof("Engine %s does not export %v", profile.Name, metric.RawMetricName)
+			continue
+		}
 		scope := metric.MetricScope
-		metricFamily, exists := allMetrics[fmt.Sprintf("vllm:%s", rawMetricName)]
+		metricFamily, exists := allMetrics[rawMetric.Name]
 		if !exists {
-			klog.V(4).Infof("Cannot find %v in the pod metrics", rawMetricName)
+			klog.V(4).Infof("Cannot find %v in the pod metrics", rawMetric.Name)
 			continue
 		}
 		for _, familyMetric := range metricFamily.Metric {
-			modelName, _ := metrics.GetLabelValueForKey(familyMetric, "model_name")
+			if !rawMetric.Matches(familyMetric) {
+				continue
+			}
+			modelName := modelNameOfMetric(pod, profile, familyMetric)
 			labelValue, _ := metrics.GetLabelValueForKey(familyMetric, labelMetricName)
-			err := c.updatePodRecordLocked(podName, modelName, labelMetricName, scope, &metrics.LabelValueMetricValue{Value: labelValue})
+			err := record.update(modelName, labelMetricName, scope, &metrics.LabelValueMetricValue{Value: labelValue})
 			if err != nil {
 				klog.V(4).Infof("Failed to update metrics %s from pod %s %s %d: %v", labelMetricName, podName, pod.Status.PodIP, podPort, err)
 				continue
@@ -264,10 +442,10 @@ func (c *Store) updateQueryLabelMetricFromRawMetricsLocked(pod *v1.Pod, allMetri
 	}
 }
 
-func (c *Store) updateMetricFromPromQLLocked(pod *v1.Pod) {
-	podName := pod.Name
+func (c *Store) updateMetricFromPromQL(ctx context.Context, record *podMetricRecord, pod *v1.Pod, modelNames []string, metricNames []string) {
+	podName := PodKey(pod)
 
-	for _, metricName := range prometheusMetricNames {
+	for _, metricName := range metricNames {
 		queryLabels := map[string]string{
 			"instance": fmt.Sprintf("%s:%d", pod.Status.PodIP, podPort),
 		}
@@ -278,16 +456,16 @@ func (c *Store) updateMetricFromPromQLLocked(pod *v1.Pod) {
 		}
 		scope := metric.MetricScope
 		if scope == metrics.PodMetricScope {
-			err := c.queryUpdatePromQLMetricsLocked(metric, queryLabels, podName, "", metricName)
+			err := c.queryUpdatePromQLMetrics(ctx, record, metric, queryLabels, podName, "", metricName)
 			if err != nil {
 				klog.V(4).Infof("Failed to query and update PromQL metrics: %v", err)
 				continue
 			}
 		} else if scope == metrics.PodModelMetricScope {
-			if modelNames, ok := c.PodToModelMapping[podName]; ok {
-				for modelName := range modelNames {
+			if len(modelNames) > 0 {
+				for _, modelName := range modelNames {
 					queryLabels["model_name"] = modelName
-					err := c.queryUpdatePromQLMetricsLocked(metric, queryLabels, podName, modelName, metricName)
+					err := c.queryUpdatePromQLMetrics(ctx, record, metric, queryLabels, podName, modelName, metricName)
 					if err != nil {
 						klog.V(4).Infof("Failed to query and update PromQL metrics: %v", err)
 						continue
@@ -302,11 +480,11 @@ func (c *Store) updateMetricFromPromQLLocked(pod *v1.Pod) {
 	}
 }
 
-func (c *Store) queryUpdatePromQLMetricsLocked(metric metrics.Metric, queryLabels map[string]string, podName string, modelName string, metricName string) error {
+func (c *Store) queryUpdatePromQLMetrics(ctx context.Context, record *podMetricRecord, metric metrics.Metric, queryLabels map[string]string, podName string, modelName string, metricName string) error {
 	scope := metric.MetricScope
 	query := metrics.BuildQuery(metric.PromQL, queryLabels)
 	// Querying metrics
-	result, warnings, err := c.prometheusApi.Query(context.Background(), query, time.Now())
+	result, warnings, err := c.prometheusApi.Query(ctx, query, time.Now())
 	if err != nil {
 		// Skip this model fetching if an error is thrown
 		return fmt.Errorf("error executing query: %v", err)
@@ -317,7 +495,7 @@ func (c *Store) queryUpdatePromQLMetricsLocked(metric metrics.Metric, queryLabel
 
 	// Update metrics
 	metricValue := &metrics.PrometheusMetricValue{Result: &result}
-	err = c.updatePodRecordLocked(podName, modelName, metricName, scope, metricValue)
+	err = record.update(modelName, metricName, scope, metricValue)
 	if err != nil {
 		return fmt.Errorf("failed to update metrics %s from prometheus %s: %v", metricName, podName, err)
 	}
@@ -325,22 +503,35 @@ func (c *Store) queryUpdatePromQLMetricsLocked(metric metrics.Metric, queryLabel
 	return nil
 }
 
-// Update `PodMetrics` and `PodModelMetrics` according to the metric scope
-// TODO: replace in-place metric update podMetrics and podModelMetrics to fresh copy for preventing stale metric keys
-func (c *Store) updatePodRecordLocked(podName string, modelName string, metricName string, scope metrics.MetricScope, metricValue metrics.MetricValue) error {
+// simpleValue returns the counter or gauge value of the record, 0 if the record has no such value.
+func (r *podMetricRecord) simpleValue(modelName string, metricName string) float64 {
+	if modelName == "" {
+		if value, ok := r.podMetrics[metricName]; ok {
+			return value.GetSimpleValue()
+		}
+		return 0
+	}
+	if value, ok := r.podModelMetrics[modelName][metricName]; ok {
+		return value.GetSimpleValue()
+	}
+	return 0
+}
+
+// Update the pod metrics or the pod model metrics of the record according to the metric scope
+func (r *podMetricRecord) update(modelName string, metricName string, scope metrics.MetricScope, metricValue metrics.MetricValue) error {
 	if scope == metrics.PodMetricScope {
 		if modelName != "" {
 			return fmt.Errorf("modelName should be empty for scope %v", scope)
 		}
-		c.PodMetrics[podName][metricName] = metricValue
+		r.podMetrics[metricName] = metricValue
 	} else if scope == metrics.PodModelMetricScope {
 		if modelName == "" {
 			return fmt.Errorf("modelName should not be empty for scope %v", scope)
 		}
-		if len(c.PodModelMetrics[podName][modelName]) == 0 {
-			c.PodModelMetrics[podName][modelName] = map[string]metrics.MetricValue{}
+		if len(r.podModelMetrics[modelName]) == 0 {
+			r.podModelMetrics[modelName] = map[string]metrics.MetricValue{}
 		}
-		c.PodModelMetrics[podName][modelName][metricName] = metricValue
+		r.podModelMetrics[modelName][metricName] = metricValue
 	} else {
 		return fmt.Errorf("scope %v is not supported", scope)
 	}
@@ -357,13 +548,16 @@ func (c *Store) updateModelMetrics() {
 	}
 }
 
+// aggregateMetrics updates the union of the metrics of the subscribers, which is collected from the next refresh on.
 func (c *Store) aggregateMetrics() {
+	subscribedMetrics := map[string]struct{}{}
 	for _, subscriber := range c.subscribers {
 		for _, metric := range subscriber.SubscribedMetrics() {
-			if _, exists := c.metrics[metric]; !exists {
-				// TODO: refactor to
-				c.metrics[metric] = "yes"
+			if _, exists := metrics.Metrics[metric]; !exists {
+				klog.Warningf("Metric %v subscribed by %T is not defined and will not be collected", metric, subscriber)
 			}
+			subscribedMetrics[metric] = struct{}{}
 		}
 	}
+	c.subscribedMetrics = subscribedMetrics
 }
@@ -16,22 +16,32 @@ limitations under the License.
 package cache
 
 import (
+	"encoding/json"
 	"fmt"
 	"math"
 	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"runtime"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/prometheus/common/expfmt"
+	modelv1alpha1 "github.com/vllm-project/aibrix/api/model/v1alpha1"
+	"github.com/vllm-project/aibrix/pkg/metrics"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/klog/v2"
 )
 
 func newTraceCache() *Store {
 	return &Store{
-		initialized:     true,
 		requestTrace:    &sync.Map{},
 		pendingRequests: &sync.Map{},
 	}
@@ -119,8 +129,482 @@ var _ = Describe("Cache", func() {
 		pendingCounter, _ := cache.pendingRequests.Load("model")
 		Expect(atomic.LoadInt32(pendingCounter.(*int32))).To(Equal(int32(0)))
 	})
+
+	It("should detect pod gpu type from pod and node labels", func() {
+		cache := New(nil, nil)
+		cache.addNode(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "gpu-node",
+			Labels: map[string]string{NodeGPUProductIdentifier: "NVIDIA-A100-SXM4-80GB"}}})
+		cache.addNode(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "cpu-node"}})
+		cache.addNode(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "unlabeled-node",
+			Labels: map[string]string{NodeGPUProductIdentifier: ""}}})
+		Expect(cache.Nodes).To(HaveLen(2))
+
+		for name, labels := range map[string]map[string]string{
+			"p1": {modelIdentifier: "m1"},
+			"p2": {modelIdentifier: "m1", PodGPUTypeIdentifier: "L4"},
+		} {
+			cache.addPod(&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+				Spec: v1.PodSpec{NodeName: "gpu-node"}})
+		}
+		cache.addPod(&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "p3", Labels: map[string]string{modelIdentifier: "m1"}},
+			Spec: v1.PodSpec{NodeName: "cpu-node"}})
+		cache.addPod(&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "p5", Labels: map[string]string{modelIdentifier: "m1"}},
+			Spec: v1.PodSpec{NodeName: "unlabeled-node"}})
+
+		gpuType, err := cache.GetPodGPUType("p1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(gpuType).To(Equal("NVIDIA-A100-SXM4-80GB"))
+		gpuType, err = cache.GetPodGPUType("p2")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(gpuType).To(Equal("L4"))
+		_, err = cache.GetPodGPUType("p3")
+		Expect(err).To(HaveOccurred())
+		_, err = cache.GetPodGPUType("p4")
+		Expect(err).To(HaveOccurred())
+		_, err = cache.GetPodGPUType("p5")
+		Expect(err).To(HaveOccurred())
+
+		cache.deleteNode(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "gpu-node"}})
+		_, err = cache.GetPodGPUType("p1")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should translate engine metrics to canonical metrics", func() {
+		body := `# TYPE tgi_queue_size gauge
+tgi_queue_size 3
+# TYPE tgi_request_duration histogram
+tgi_request_duration_bucket{le="0.5"} 1
+tgi_request_duration_bucket{le="+Inf"} 2
+tgi_request_duration_sum 1.5
+tgi_request_duration_count 2
+# TYPE nv_trt_llm_request_metrics gauge
+nv_trt_llm_request_metrics{model="tensorrt_llm",request_type="active"} 4
+nv_trt_llm_request_metrics{model="tensorrt_llm",request_type="max"} 64
+`
+		var parser expfmt.TextParser
+		allMetrics, err := parser.TextToMetricFamilies(strings.NewReader(body))
+		Expect(err).ToNot(HaveOccurred())
+
+		cache := New(nil, nil)
+		names := cache.collectedMetricNamesLocked()
+		records := map[string]*podMetricRecord{}
+		for _, engine := range []string{metrics.EngineTGI, metrics.EngineTensorRTLLM} {
+			pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: engine,
+				Labels: map[string]string{modelIdentifier: "m1", metrics.EngineIdentifier: engine}}}
+			records[engine] = newPodMetricRecord()
+			profile := metrics.GetEngineProfile(engine)
+			cache.updateSimpleMetricFromRawMetrics(records[engine], pod, profile, allMetrics, names.counterGauge)
+			cache.updateHistogramMetricFromRawMetrics(records[engine], pod, profile, allMetrics, names.histogram)
+		}
+
+		tgiMetrics := records[metrics.EngineTGI].podModelMetrics["m1"]
+		Expect(tgiMetrics[metrics.NumRequestsWaiting].GetSimpleValue()).To(Equal(3.0))
+		Expect(tgiMetrics[metrics.E2ERequestLatencySeconds].GetHistogramValue().GetMean()).To(Equal(0.75))
+		Expect(tgiMetrics).ToNot(HaveKey(metrics.NumRequestsRunning))
+		trtMetrics := records[metrics.EngineTensorRTLLM].podModelMetrics["m1"]
+		Expect(trtMetrics[metrics.NumRequestsRunning].GetSimpleValue()).To(Equal(4.0))
+	})
+
+	It("should collect the metrics subscribed", func() {
+		cache := New(nil, nil)
+		names := cache.collectedMetricNamesLocked()
+		Expect(names.counterGauge).To(ContainElement(metrics.NumRequestsRunning))
+		Expect(names.histogram).To(ContainElement(metrics.TimeToFirstTokenSeconds))
+		Expect(names.labelQuery).To(ContainElement(metrics.MaxLora))
+		// PromQL-based metrics are derived locally without a Prometheus endpoint
+		Expect(names.derived).To(ContainElement(metrics.P95TTFT5m))
+		Expect(names.prometheus).To(BeEmpty())
+
+		// metrics defined in metrics.Metrics are collected without changes to the scraper
+		metrics.Metrics["test_requests_total"] = metrics.Metric{
+			MetricScope:  metrics.PodMetricScope,
+			MetricSource: metrics.PodRawMetrics,
+			MetricType:   metrics.MetricType{Raw: metrics.Counter},
+		}
+		defer delete(metrics.Metrics, "test_requests_total")
+		cache.AddSubscriber(testSubscriber{metrics.NumRequestsWaiting, metrics.TimeToFirstTokenSeconds})
+		cache.AddSubscriber(testSubscriber{"test_requests_total", "undefined_metric"})
+		names = cache.collectedMetricNamesLocked()
+		Expect(names.counterGauge).To(Equal([]string{metrics.NumRequestsWaiting, "test_requests_total"}))
+		Expect(names.histogram).To(Equal([]string{metrics.TimeToFirstTokenSeconds}))
+		Expect(names.labelQuery).To(BeEmpty())
+		Expect(names.prometheus).To(BeEmpty())
+
+		body := `# TYPE vllm:test_requests_total counter
+vllm:test_requests_total 7
+# TYPE vllm:num_requests_running gauge
+vllm:num_requests_running{model_name="m1"} 2
+`
+		var parser expfmt.TextParser
+		allMetrics, err := parser.TextToMetricFamilies(strings.NewReader(body))
+		Expect(err).ToNot(HaveOccurred())
+		pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "p1"}}
+		record := newPodMetricRecord()
+		cache.updateSimpleMetricFromRawMetrics(record, pod, metrics.GetEngineProfile(""), allMetrics, names.counterGauge)
+		Expect(record.podMetrics["test_requests_total"].GetSimpleValue()).To(Equal(7.0))
+		Expect(record.podModelMetrics).To(BeEmpty())
+	})
+
+	It("should scrape pod metrics concurrently without blocking reads", func() {
+		body := "# TYPE vllm:num_requests_waiting gauge\nvllm:num_requests_waiting{model_name=\"m1\"} 2\n"
+		defer servePodMetrics("127.0.0.2", 0, body).Close()
+		defer servePodMetrics("127.0.0.3", time.Second, body).Close()
+
+		defer func(timeout time.Duration, intervals int) {
+			podMetricScrapeTimeout, podMetricStalenessIntervals = timeout, intervals
+		}(podMetricScrapeTimeout, podMetricStalenessIntervals)
+		podMetricScrapeTimeout = 200 * time.Millisecond
+
+		cache := New(nil, nil)
+		for name, ip := range map[string]string{"fast": "127.0.0.2", "slow": "127.0.0.3"} {
+			cache.addPod(&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{modelIdentifier: "m1"}},
+				Status: v1.PodStatus{PodIP: ip, Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionTrue}}}})
+		}
+		cache.PodModelMetrics["slow"] = map[string]map[string]metrics.MetricValue{
+			"m1": {metrics.NumRequestsWaiting: &metrics.SimpleMetricValue{Value: 1}}}
+		cache.podMetricsUpdateTime["slow"] = time.Now().Add(-time.Hour)
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			cache.updatePodMetrics()
+		}()
+		time.Sleep(50 * time.Millisecond)
+		// reads are not blocked by the slow scrape
+		value, err := cache.GetMetricValueByPodModel("slow", "m1", metrics.NumRequestsWaiting)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(value.GetSimpleValue()).To(Equal(1.0))
+		Eventually(done, podMetricScrapeTimeout*2).Should(BeClosed())
+
+		value, err = cache.GetMetricValueByPodModel("fast", "m1", metrics.NumRequestsWaiting)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(value.GetSimpleValue()).To(Equal(2.0))
+		updateTime, err := cache.GetPodMetricsUpdateTime("fast")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(updateTime).To(BeTemporally("~", time.Now(), time.Second))
+
+		// the slow pod keeps its previous metrics, which are stale
+		value, err = cache.GetMetricValueByPodModel("slow", "m1", metrics.NumRequestsWaiting)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(value.GetSimpleValue()).To(Equal(1.0))
+		podMetricStalenessIntervals = 3
+		_, err = cache.GetMetricValueByPodModel("slow", "m1", metrics.NumRequestsWaiting)
+		Expect(err).To(MatchError(ContainSubstring("stale")))
+		_, err = cache.GetMetricValueByPodModel("fast", "m1", metrics.NumRequestsWaiting)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("should merge pushed metrics and poll pods not pushing", func() {
+		defer servePodMetrics("127.0.0.4", 0, "# TYPE vllm:num_requests_waiting gauge\nvllm:num_requests_waiting{model_name=\"m1\"} 9\n").Close()
+		defer func(timeout time.Duration) { podMetricPushTimeout = timeout }(podMetricPushTimeout)
+		podMetricPushTimeout = 100 * time.Millisecond
+
+		cache := New(nil, nil)
+		cache.addPod(&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "p1", Labels: map[string]string{modelIdentifier: "m1"}},
+			Status: v1.PodStatus{PodIP: "127.0.0.4", Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionTrue}}}})
+		cache.PodModelMetrics["p1"] = map[string]map[string]metrics.MetricValue{
+			"m1": {metrics.GPUCacheUsagePerc: &metrics.SimpleMetricValue{Value: 0.5}}}
+
+		Expect(cache.PushPodMetrics(&PodMetricReport{PodName: "p2"})).To(MatchError(ContainSubstring("does not exist")))
+		Expect(cache.PushPodMetrics(&PodMetricReport{PodName: "p1", Metrics: map[string]float64{metrics.NumRequestsWaiting: 1}})).To(HaveOccurred())
+		Expect(cache.PushPodMetrics(&PodMetricReport{PodName: "p1", Metrics: map[string]float64{"undefined_metric": 1}})).To(HaveOccurred())
+		Expect(cache.PushPodMetrics(&PodMetricReport{PodName: "p1",
+			ModelMetrics: map[string]map[string]float64{"m1": {metrics.RequestPrefillTimeSeconds: 1}}})).To(MatchError(ContainSubstring("not a counter or gauge")))
+		Expect(cache.PushPodMetrics(&PodMetricReport{PodName: "p1", LabelMetrics: map[string]string{"undefined_metric": "x"}})).To(MatchError(ContainSubstring("not defined")))
+		Expect(cache.PushPodMetrics(&PodMetricReport{PodName: "p1", LabelMetrics: map[string]string{metrics.MaxLora: "x"}})).ToNot(HaveOccurred())
+		Expect(cache.PushPodMetrics(&PodMetricReport{PodName: "p1", LabelMetrics: map[string]string{metrics.NumRequestsWaiting: "x"}})).To(HaveOccurred())
+		Expect(cache.PushPodMetrics(&PodMetricReport{
+			PodName:      "p1",
+			ModelMetrics: map[string]map[string]float64{"m1": {metrics.NumRequestsWaiting: 1}},
+		})).ToNot(HaveOccurred())
+
+		// metrics not in the report are kept, and the pushing pod is not polled
+		cache.updatePodMetrics()
+		value, err := cache.GetMetricValueByPodModel("p1", "m1", metrics.NumRequestsWaiting)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(value.GetSimpleValue()).To(Equal(1.0))
+		value, err = cache.GetMetricValueByPodModel("p1", "m1", metrics.GPUCacheUsagePerc)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(value.GetSimpleValue()).To(Equal(0.5))
+		value, err = cache.GetMetricValueByPod("p1", metrics.MaxLora)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(value.GetLabelValue()).To(Equal("x"))
+
+		// the pod is polled again once it stops pushing
+		time.Sleep(podMetricPushTimeout)
+		cache.updatePodMetrics()
+		value, err = cache.GetMetricValueByPodModel("p1", "m1", metrics.NumRequestsWaiting)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(value.GetSimpleValue()).To(Equal(9.0))
+	})
+
+	It("should keep a history of pod metrics", func() {
+		cache := New(nil, nil)
+		now := time.Now()
+		// 30 samples per second: running requests grow by 2/s, and the ttft observations of the last
+		// 10 seconds are slower than before
+		for i := 0; i <= 30; i++ {
+			slow := float64(max(0, i-20))
+			record := newPodMetricRecord()
+			Expect(record.update("m1", metrics.NumRequestsRunning, metrics.PodModelMetricScope, &metrics.SimpleMetricValue{Value: float64(2 * i)})).To(Succeed())
+			Expect(record.update("m1", metrics.TimeToFirstTokenSeconds, metrics.PodModelMetricScope, &metrics.HistogramMetricValue{
+				Sum:     float64(i) + slow,
+				Count:   float64(i),
+				Buckets: map[string]float64{"0.1": float64(i) - slow, "1.0": float64(i), "+Inf": float64(i)},
+			})).To(Succeed())
+			record.podMetrics[metrics.MaxLora] = &metrics.LabelValueMetricValue{Value: "4"}
+			cache.recordMetricHistoryLocked("p1", record, now.Add(time.Duration(i-30)*time.Second))
+			// samples within the history interval are dropped
+			cache.recordMetricHistoryLocked("p1", newPodMetricRecord(), now.Add(time.Duration(i-30)*time.Second+time.Millisecond))
+		}
+
+		rate, err := cache.GetMetricRate("p1", "m1", metrics.NumRequestsRunning, 10*time.Second)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rate).To(BeNumerically("~", 2.0, 0.01))
+		p90, err := cache.GetMetricPercentile("p1", "m1", metrics.TimeToFirstTokenSeconds, 90, 10*time.Second)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(p90).To(Equal(1.0))
+		p50, err := cache.GetMetricPercentile("p1", "m1", metrics.TimeToFirstTokenSeconds, 50, time.Minute)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(p50).To(Equal(0.1))
+		_, err = cache.GetMetricPercentile("p1", "m1", metrics.NumRequestsRunning, 90, time.Minute)
+		Expect(err).To(HaveOccurred())
+		ewma, err := cache.GetMetricEWMA("p1", "m1", metrics.NumRequestsRunning, time.Second)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ewma).To(BeNumerically("~", 58.0, 0.1))
+
+		// label metrics and unknown pods have no history
+		_, err = cache.GetMetricEWMA("p1", "", metrics.MaxLora, time.Second)
+		Expect(err).To(HaveOccurred())
+		_, err = cache.GetMetricRate("p2", "m1", metrics.NumRequestsRunning, time.Minute)
+		Expect(err).To(HaveOccurred())
+
+		// derived metrics are computed from the history of their source metrics
+		cache.updateDerivedMetricsLocked("p1", []string{metrics.P95TTFT5m, metrics.AvgTTFT5mPod}, now)
+		value, err := cache.GetMetricValueByPodModel("p1", "m1", metrics.P95TTFT5m)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(value.GetSimpleValue()).To(Equal(1.0))
+		value, err = cache.GetMetricValueByPod("p1", metrics.AvgTTFT5mPod)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(value.GetSimpleValue()).To(BeNumerically("~", 40.0/30, 0.001))
+
+		// derived metrics keep their last value while no request completes within their window
+		idle := now.Add(10 * time.Minute)
+		for i := 0; i < 2; i++ {
+			record := newPodMetricRecord()
+			Expect(record.update("m1", metrics.RequestPromptTokens, metrics.PodModelMetricScope, &metrics.HistogramMetricValue{
+				Sum: 1000, Count: 10, Buckets: map[string]float64{"+Inf": 10},
+			})).To(Succeed())
+			cache.recordMetricHistoryLocked("p1", record, idle.Add(time.Duration(i)*time.Second))
+		}
+		cache.PodModelMetrics["p1"] = map[string]map[string]metrics.MetricValue{}
+		cache.updateDerivedMetricsLocked("p1", []string{metrics.AvgPromptToksPerReq, metrics.P95TTFT5m}, idle.Add(time.Second))
+		_, err = cache.GetMetricValueByPodModel("p1", "m1", metrics.AvgPromptToksPerReq)
+		Expect(err).To(HaveOccurred())
+		value, err = cache.GetMetricValueByPodModel("p1", "m1", metrics.P95TTFT5m)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(value.GetSimpleValue()).To(Equal(1.0))
+
+		// the history keeps the latest samples only
+		history := newMetricHistory(3)
+		for i := 0; i < 5; i++ {
+			history.add(now.Add(time.Duration(i)*time.Second), &metrics.SimpleMetricValue{Value: float64(i)})
+		}
+		Expect(history.size).To(Equal(3))
+		earliest, latest, err := history.window(now.Add(4*time.Second), time.Minute)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(earliest.value.GetSimpleValue()).To(Equal(2.0))
+		Expect(latest.value.GetSimpleValue()).To(Equal(4.0))
+	})
+
+	It("should serve the state of the cache for debugging", func() {
+		cache := New(nil, nil)
+		for _, name := range []string{"p1", "p2"} {
+			cache.addPod(&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{modelIdentifier: "m1"}},
+				Status: v1.PodStatus{PodIP: "10.0.0.1", Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionTrue}}}})
+		}
+		cache.mu.Lock()
+		cache.addPodAndModelMappingLocked("p1", "lora-1")
+		cache.mu.Unlock()
+		Expect(cache.PushPodMetrics(&PodMetricReport{
+			PodName:      "p1",
+			ModelMetrics: map[string]map[string]float64{"lora-1": {metrics.NumRequestsWaiting: 2}},
+			LabelMetrics: map[string]string{metrics.RunningLoraAdapters: "lora-1"},
+		})).To(Succeed())
+		cache.AddRequestCount("r1", "lora-1")
+
+		server := httptest.NewServer(NewDebugHandler(cache))
+		defer server.Close()
+		resp, err := http.Get(server.URL + DebugPath + "?model=lora-1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		snapshot := &DebugSnapshot{}
+		Expect(json.NewDecoder(resp.Body).Decode(snapshot)).To(Succeed())
+		Expect(resp.Body.Close()).To(Succeed())
+
+		// only the pods serving the model are returned
+		Expect(snapshot.Pods).To(HaveLen(1))
+		pod := snapshot.Pods["p1"]
+		Expect(pod.Ready).To(BeTrue())
+		Expect(pod.BaseModel).To(Equal("m1"))
+		Expect(pod.Adapters).To(Equal([]string{"lora-1"}))
+		Expect(pod.Pushing).To(BeTrue())
+		Expect(pod.MetricsAgeSeconds).ToNot(BeNil())
+		Expect(pod.Metrics[metrics.RunningLoraAdapters]).To(Equal("lora-1"))
+		Expect(pod.ModelMetrics["lora-1"][metrics.NumRequestsWaiting]).To(Equal(2.0))
+		Expect(snapshot.Models).To(HaveLen(1))
+		Expect(snapshot.Models["lora-1"].Pods).To(Equal([]string{"p1"}))
+		Expect(snapshot.Models["lora-1"].PendingRequests).To(Equal(int32(1)))
+
+		snapshot = cache.GetDebugSnapshot("", "p2")
+		Expect(snapshot.Pods).To(HaveKey("p2"))
+		Expect(snapshot.Pods["p2"].Adapters).To(BeEmpty())
+		Expect(snapshot.Models).To(HaveLen(1))
+		Expect(snapshot.Models["m1"].Pods).To(Equal([]string{"p1", "p2"}))
+
+		resp, err = http.Post(server.URL+DebugPath, "application/json", nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.Body.Close()).To(Succeed())
+		Expect(resp.StatusCode).To(Equal(http.StatusMethodNotAllowed))
+	})
+
+	It("should key pods by namespace and optionally namespace models", func() {
+		newPod := func(namespace string) *v1.Pod {
+			return &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "p1", Namespace: namespace, Labels: map[string]string{modelIdentifier: "llama-8b"}}}
+		}
+		adapter := func(namespace string) *modelv1alpha1.ModelAdapter {
+			return &modelv1alpha1.ModelAdapter{ObjectMeta: metav1.ObjectMeta{Name: "lora-1", Namespace: namespace},
+				Status: modelv1alpha1.ModelAdapterStatus{Instances: []string{"p1"}}}
+		}
+
+		// same-named pods in two namespaces serve the same model
+		cache := New(nil, nil)
+		cache.addPod(newPod("team-a"))
+		cache.addPod(newPod("team-b"))
+		Expect(cache.Pods).To(HaveLen(2))
+		pods, err := cache.ListPodsByModel("llama-8b")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pods).To(HaveKey("team-a/p1"))
+		Expect(pods).To(HaveKey("team-b/p1"))
+		cache.addModelAdapter(adapter("team-b"))
+		models, err := cache.ListModelsByPod("team-b/p1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(models).To(HaveKey("lora-1"))
+		cache.deletePod(newPod("team-a"))
+		Expect(cache.Pods).To(HaveLen(1))
+
+		// namespaced models of the same name are different models
+		defer func(namespaced bool) { namespacedModels = namespaced }(namespacedModels)
+		namespacedModels = true
+		cache = New(nil, nil)
+		cache.addPod(newPod("team-a"))
+		cache.addPod(newPod("team-b"))
+		cache.addModelAdapter(adapter("team-b"))
+		Expect(cache.ListModels()).To(ConsistOf("team-a/llama-8b", "team-b/llama-8b", "team-b/lora-1"))
+		pods, err = cache.ListPodsByModel("team-a/llama-8b")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pods).To(HaveLen(1))
+		Expect(pods).To(HaveKey("team-a/p1"))
+		// names containing "/" are qualified, and a pod cannot join the model of another namespace
+		Expect(ModelKey("team-a", "meta-llama/Llama-3.1-8B")).To(Equal("team-a/meta-llama/Llama-3.1-8B"))
+		intruder := newPod("team-a")
+		intruder.Name = "p2"
+		intruder.Labels = map[string]string{modelIdentifier: "team-b/llama-8b"}
+		cache.addPod(intruder)
+		pods, err = cache.ListPodsByModel("team-b/llama-8b")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pods).To(HaveLen(1))
+		Expect(pods).To(HaveKey("team-b/p1"))
+		// engines report the qualified names of their namespace
+		Expect(EngineModelKey("team-a", "team-a/llama-8b")).To(Equal("team-a/llama-8b"))
+		Expect(EngineModelKey("team-a", "team-b/llama-8b")).To(Equal("team-a/team-b/llama-8b"))
+		Expect(EngineModelKey("team-a", "llama-8b")).To(Equal("team-a/llama-8b"))
+	})
+
+	It("should discover the models served by the engines of the pods", func() {
+		defer servePodMetrics("127.0.0.5", 0, `{"object":"list","data":[{"id":"llama-8b"},{"id":"lora-2"}]}`).Close()
+
+		cache := New(nil, nil)
+		cache.addPod(&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "p1", Labels: map[string]string{modelIdentifier: "llama-8b"}},
+			Status: v1.PodStatus{PodIP: "127.0.0.5", Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionTrue}}}})
+		cache.addModelAdapter(&modelv1alpha1.ModelAdapter{ObjectMeta: metav1.ObjectMeta{Name: "lora-1"},
+			Status: modelv1alpha1.ModelAdapterStatus{Instances: []string{"p1"}}})
+
+		// the adapter loaded directly on the engine is mapped, the adapter not served is kept and flagged
+		cache.discoverPodModels()
+		models, err := cache.ListModelsByPod("p1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(models).To(HaveLen(3))
+		Expect(models).To(HaveKey("lora-2"))
+		Expect(cache.GetModel("lora-2")).To(BeTrue())
+		snapshot := cache.GetDebugSnapshot("", "p1")
+		Expect(snapshot.Pods["p1"].DiscoveredModels).To(Equal([]string{"lora-2"}))
+		Expect(snapshot.Pods["p1"].UnservedModels).To(Equal([]string{"lora-1"}))
+
+		// the discovered adapter is unmapped once it is no longer served, unless it is known from a model adapter
+		cache.reconcilePodModelsLocked("p1", map[string]servedModel{"llama-8b": {}})
+		Expect(cache.GetModel("lora-2")).To(BeFalse())
+		cache.reconcilePodModelsLocked("p1", map[string]servedModel{"llama-8b": {}, "lora-2": {}})
+		cache.addModelAdapter(&modelv1alpha1.ModelAdapter{ObjectMeta: metav1.ObjectMeta{Name: "lora-2"},
+			Status: modelv1alpha1.ModelAdapterStatus{Instances: []string{"p1"}}})
+		cache.reconcilePodModelsLocked("p1", map[string]servedModel{"llama-8b": {}})
+		Expect(cache.GetModel("lora-2")).To(BeTrue())
+		Expect(cache.podUnservedModels["p1"]).To(Equal([]string{"lora-1", "lora-2"}))
+
+		cache.deletePod(cache.Pods["p1"])
+		Expect(cache.podDiscoveredModels).To(BeEmpty())
+		Expect(cache.podUnservedModels).To(BeEmpty())
+	})
+
+	It("should return the metadata of the models", func() {
+		created := time.Now().Add(-time.Hour).Truncate(time.Second)
+		newPod := func(name string, created time.Time, annotations map[string]string) *v1.Pod {
+			return &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "team-a", Labels: map[string]string{modelIdentifier: "llama-8b"},
+				Annotations: annotations, CreationTimestamp: metav1.NewTime(created)},
+				Status: v1.PodStatus{Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionTrue}}}}
+		}
+		baseModel := "llama-8b"
+		cache := New(nil, nil)
+		cache.addPod(newPod("p1", created, map[string]string{ModelOwnerIdentifier: "alice"}))
+		cache.addPod(newPod("p2", created.Add(time.Minute), nil))
+		cache.addModelAdapter(&modelv1alpha1.ModelAdapter{ObjectMeta: metav1.ObjectMeta{Name: "lora-1", Namespace: "team-a",
+			CreationTimestamp: metav1.NewTime(created.Add(time.Hour))},
+			Spec:   modelv1alpha1.ModelAdapterSpec{BaseModel: &baseModel},
+			Status: modelv1alpha1.ModelAdapterStatus{Instances: []string{"p2"}}})
+		cache.reconcilePodModelsLocked("team-a/p1", map[string]servedModel{"llama-8b": {MaxModelLen: 8192},
+			"lora-2": {Parent: "llama-8b", MaxModelLen: 4096}})
+		cache.reconcilePodModelsLocked("team-a/p2", map[string]servedModel{"llama-8b": {MaxModelLen: 4096}, "lora-1": {}})
+
+		info, err := cache.GetModelInfo("llama-8b")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(*info).To(Equal(ModelInfo{Name: "llama-8b", CreationTime: created, Owner: "alice", MaxModelLen: 4096, ReadyReplicas: 2}))
+		info, err = cache.GetModelInfo("lora-1")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(*info).To(Equal(ModelInfo{Name: "lora-1", CreationTime: created.Add(time.Hour), Owner: "team-a", Parent: "llama-8b", ReadyReplicas: 1}))
+		info, err = cache.GetModelInfo("lora-2")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.Parent).To(Equal("llama-8b"))
+		Expect(info.MaxModelLen).To(Equal(4096))
+		_, err = cache.GetModelInfo("lora-3")
+		Expect(err).To(HaveOccurred())
+	})
 })
 
+// servePodMetrics serves the metrics body on the pod port of a loopback address after the delay, skipping
+// the test if the address is not available.
+func servePodMetrics(ip string, delay time.Duration, body string) *httptest.Server {
+	listener, err := net.Listen("tcp", fmt.Sprintf("%s:%d", ip, podPort))
+	if err != nil {
+		Skip(fmt.Sprintf("cannot listen on %s: %v", ip, err))
+	}
+	server := &httptest.Server{Listener: listener, Config: &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		_, _ = fmt.Fprint(w, body)
+	})}}
+	server.Start()
+	return server
+}
+
 func BenchmarkLagacyAddRequestTrace(b *testing.B) {
 	cache := &lagacyCache{
 		requestTrace: map[string]map[string]int{},
@@ -204,3 +688,9 @@ func BenchmarkDoneRequestTrace(b *testing.B) {
 	}
 	wg.Wait()
 }
+
+type testSubscriber []string
+
+func (s testSubscriber) SubscribedMetrics() []string {
+	return s
+}
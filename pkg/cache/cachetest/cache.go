@@ -0,0 +1,411 @@
+/*
+Copyright 2024 The Aibrix Team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package cachetest provides a fake cache.Cache for the tests of the routers, the gateway and the controllers.
+package cachetest
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/vllm-project/aibrix/pkg/cache"
+	"github.com/vllm-project/aibrix/pkg/metrics"
+	"github.com/vllm-project/aibrix/pkg/utils"
+)
+
+// Cache is an in-memory cache.Cache whose pods, models and metric values are set by the tests. Pods are keyed
+// by cache.PodKey like in the cache, metric values have no history and request traces are not recorded.
+type Cache struct {
+	mu              sync.RWMutex
+	pods            map[string]*v1.Pod
+	modelPods       map[string]map[string]*v1.Pod
+	podModels       map[string]map[string]struct{}
+	podMetrics      map[string]map[string]metrics.MetricValue
+	podModelMetrics map[string]map[string]map[string]metrics.MetricValue
+	updateTimes     map[string]time.Time
+	gpuTypes        map[string]string
+	modelInfos      map[string]*cache.ModelInfo
+	pendingRequests map[string]int32
+	subscribers     []metrics.MetricSubscriber
+}
+
+var _ cache.Cache = &Cache{}
+
+// New returns an empty fake cache.
+func New() *Cache {
+	return &Cache{
+		pods:            map[string]*v1.Pod{},
+		modelPods:       map[string]map[string]*v1.Pod{},
+		podModels:       map[string]map[string]struct{}{},
+		podMetrics:      map[string]map[string]metrics.MetricValue{},
+		podModelMetrics: map[string]map[string]map[string]metrics.MetricValue{},
+		updateTimes:     map[string]time.Time{},
+		gpuTypes:        map[string]string{},
+		modelInfos:      map[string]*cache.ModelInfo{},
+		pendingRequests: map[string]int32{},
+	}
+}
+
+// AddPod adds the pod serving the models, e.g. its base model and LoRA adapters.
+func (c *Cache) AddPod(pod *v1.Pod, models ...string) *Cache {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := cache.PodKey(pod)
+	c.pods[key] = pod
+	if c.podModels[key] == nil {
+		c.podModels[key] = map[string]struct{}{}
+	}
+	for _, model := range models {
+		c.podModels[key][model] = struct{}{}
+		if c.modelPods[model] == nil {
+			c.modelPods[model] = map[string]*v1.Pod{}
+		}
+		c.modelPods[model][key] = pod
+	}
+	return c
+}
+
+// DeletePod deletes the pod along with its models and metrics.
+func (c *Cache) DeletePod(podName string) *Cache {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for model := range c.podModels[podName] {
+		delete(c.modelPods[model], podName)
+		if len(c.modelPods[model]) == 0 {
+			delete(c.modelPods, model)
+		}
+	}
+	delete(c.pods, podName)
+	delete(c.podModels, podName)
+	delete(c.podMetrics, podName)
+	delete(c.podModelMetrics, podName)
+	delete(c.updateTimes, podName)
+	return c
+}
+
+// SetPodMetric sets the value of a pod scope metric of the pod.
+func (c *Cache) SetPodMetric(podName, metricName string, value metrics.MetricValue) *Cache {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.podMetrics[podName] == nil {
+		c.podMetrics[podName] = map[string]metrics.MetricValue{}
+	}
+	c.podMetrics[podName][metricName] = value
+	c.updateTimes[podName] = time.Now()
+	return c
+}
+
+// SetPodModelMetric sets the value of a pod model scope metric of the pod.
+func (c *Cache) SetPodModelMetric(podName, modelName, metricName string, value metrics.MetricValue) *Cache {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.podModelMetrics[podName] == nil {
+		c.podModelMetrics[podName] = map[string]map[string]metrics.MetricValue{}
+	}
+	if c.podModelMetrics[podName][modelName] == nil {
+		c.podModelMetrics[podName][modelName] = map[string]metrics.MetricValue{}
+	}
+	c.podModelMetrics[podName][modelName][metricName] = value
+	c.updateTimes[podName] = time.Now()
+	return c
+}
+
+// SetPodGPUType sets the GPU type of the pod.
+func (c *Cache) SetPodGPUType(podName, gpuType string) *Cache {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gpuTypes[podName] = gpuType
+	return c
+}
+
+// SetModelInfo sets the metadata of the model returned by GetModelInfo instead of the metadata derived from its pods.
+func (c *Cache) SetModelInfo(info *cache.ModelInfo) *Cache {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.modelInfos[info.Name] = info
+	return c
+}
+
+// Subscribers returns the metric subscribers added to the cache.
+func (c *Cache) Subscribers() []metrics.MetricSubscriber {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return append([]metrics.MetricSubscriber(nil), c.subscribers...)
+}
+
+// PendingRequests returns the number of requests of the model counted but not done.
+func (c *Cache) PendingRequests(modelName string) int32 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.pendingRequests[modelName]
+}
+
+func (c *Cache) GetPod(podName string) (*v1.Pod, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	pod, ok := c.pods[podName]
+	if !ok {
+		return nil, fmt.Errorf("pod does not exist in the cache: %s", podName)
+	}
+	return pod, nil
+}
+
+func (c *Cache) ListPods() map[string]*v1.Pod {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return copyPods(c.pods)
+}
+
+func (c *Cache) ListPodsByModel(modelName string) (map[string]*v1.Pod, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	pods, ok := c.modelPods[modelName]
+	if !ok {
+		return nil, fmt.Errorf("model does not exist in the cache: %s", modelName)
+	}
+	return copyPods(pods), nil
+}
+
+func (c *Cache) GetPodGPUType(podName string) (string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if gpuType, ok := c.gpuTypes[podName]; ok {
+		return gpuType, nil
+	}
+	pod, ok := c.pods[podName]
+	if !ok {
+		return "", fmt.Errorf("pod does not exist in the cache: %s", podName)
+	}
+	if gpuType := pod.Labels[cache.PodGPUTypeIdentifier]; gpuType != "" {
+		return gpuType, nil
+	}
+	return "", fmt.Errorf("gpu type of pod %s is unknown", podName)
+}
+
+func (c *Cache) GetModel(modelName string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	_, ok := c.modelPods[modelName]
+	return ok
+}
+
+func (c *Cache) ListModels() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	models := make([]string, 0, len(c.modelPods))
+	for model := range c.modelPods {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+	return models
+}
+
+func (c *Cache) ListModelsByPod(podName string) (map[string]struct{}, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	models, ok := c.podModels[podName]
+	if !ok {
+		return nil, fmt.Errorf("pod does not exist in the cache: %s", podName)
+	}
+	copied := make(map[string]struct{}, len(models))
+	for model := range models {
+		copied[model] = struct{}{}
+	}
+	return copied, nil
+}
+
+func (c *Cache) GetModelInfo(modelName string) (*cache.ModelInfo, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if info, ok := c.modelInfos[modelName]; ok {
+		copied := *info
+		return &copied, nil
+	}
+	pods, ok := c.modelPods[modelName]
+	if !ok {
+		return nil, fmt.Errorf("model does not exist in the cache: %s", modelName)
+	}
+	info := &cache.ModelInfo{Name: modelName}
+	for _, pod := range pods {
+		if utils.IsPodReady(pod) {
+			info.ReadyReplicas++
+		}
+		if info.CreationTime.IsZero() || pod.CreationTimestamp.Time.Before(info.CreationTime) {
+			info.CreationTime, info.Owner = pod.CreationTimestamp.Time, pod.Namespace
+		}
+	}
+	return info, nil
+}
+
+func (c *Cache) GetMetricValueByPod(podName, metricName string) (metrics.MetricValue, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	podMetrics, ok := c.podMetrics[podName]
+	if !ok {
+		return nil, fmt.Errorf("pod does not exist in the podMetrics cache")
+	}
+	value, ok := podMetrics[metricName]
+	if !ok {
+		return nil, fmt.Errorf("no metric available for %v", metricName)
+	}
+	return value, nil
+}
+
+func (c *Cache) GetMetricValueByPodModel(podName, modelName string, metricName string) (metrics.MetricValue, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	podMetrics, ok := c.podModelMetrics[podName]
+	if !ok {
+		return nil, fmt.Errorf("pod does not exist in the podMetrics cache")
+	}
+	modelMetrics, ok := podMetrics[modelName]
+	if !ok {
+		return nil, fmt.Errorf("model does not exist in the podMetrics cache")
+	}
+	value, ok := modelMetrics[metricName]
+	if !ok {
+		return nil, fmt.Errorf("no metric available for %v", metricName)
+	}
+	return value, nil
+}
+
+func (c *Cache) GetPodMetricsUpdateTime(podName string) (time.Time, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	updateTime, ok := c.updateTimes[podName]
+	if !ok {
+		return time.Time{}, fmt.Errorf("metrics of pod %s were never scraped", podName)
+	}
+	return updateTime, nil
+}
+
+func (c *Cache) GetMetricRate(podName, modelName, metricName string, window time.Duration) (float64, error) {
+	return 0, fmt.Errorf("no metric history available for %v", metricName)
+}
+
+func (c *Cache) GetMetricPercentile(podName, modelName, metricName string, percentile float64, window time.Duration) (float64, error) {
+	return 0, fmt.Errorf("no metric history available for %v", metricName)
+}
+
+func (c *Cache) GetMetricEWMA(podName, modelName, metricName string, halfLife time.Duration) (float64, error) {
+	return 0, fmt.Errorf("no metric history available for %v", metricName)
+}
+
+// PushPodMetrics sets the metrics of the report, the report is not validated against the metric definitions.
+func (c *Cache) PushPodMetrics(report *cache.PodMetricReport) error {
+	podName := report.PodKey()
+	if _, err := c.GetPod(podName); err != nil {
+		return err
+	}
+	for metricName, value := range report.Metrics {
+		c.SetPodMetric(podName, metricName, &metrics.SimpleMetricValue{Value: value})
+	}
+	for modelName, modelMetrics := range report.ModelMetrics {
+		for metricName, value := range modelMetrics {
+			c.SetPodModelMetric(podName, modelName, metricName, &metrics.SimpleMetricValue{Value: value})
+		}
+	}
+	for metricName, value := range report.LabelMetrics {
+		c.SetPodMetric(podName, metricName, &metrics.LabelValueMetricValue{Value: value})
+	}
+	return nil
+}
+
+func (c *Cache) AddRequestCount(requestID string, modelName string) (traceTerm int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.pendingRequests[modelName]++
+	return 0
+}
+
+func (c *Cache) DoneRequestCount(requestID string, modelName string, traceTerm int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.pendingRequests[modelName]--
+}
+
+func (c *Cache) AddSubscriber(subscriber metrics.MetricSubscriber) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.subscribers = append(c.subscribers, subscriber)
+}
+
+func (c *Cache) AddRequestTrace(requestID string, modelName string, inputTokens, outputTokens int64) {
+}
+
+func (c *Cache) DoneRequestTrace(requestID string, modelName string, inputTokens, outputTokens, traceTerm int64) {
+	c.DoneRequestCount(requestID, modelName, traceTerm)
+}
+
+// GetDebugSnapshot returns the pods, models and pending requests of the cache, without metric values.
+func (c *Cache) GetDebugSnapshot(modelName, podName string) *cache.DebugSnapshot {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	snapshot := &cache.DebugSnapshot{Pods: map[string]*cache.DebugPod{}, Models: map[string]*cache.DebugModel{}}
+	for name, pod := range c.pods {
+		if _, ok := c.podModels[name][modelName]; (podName != "" && name != podName) || (modelName != "" && !ok) {
+			continue
+		}
+		snapshot.Pods[name] = &cache.DebugPod{IP: pod.Status.PodIP}
+	}
+	for model, pods := range c.modelPods {
+		if _, ok := pods[podName]; (modelName != "" && model != modelName) || (podName != "" && !ok) {
+			continue
+		}
+		debugModel := &cache.DebugModel{PendingRequests: c.pendingRequests[model]}
+		for name := range pods {
+			debugModel.Pods = append(debugModel.Pods, name)
+		}
+		sort.Strings(debugModel.Pods)
+		snapshot.Models[model] = debugModel
+	}
+	return snapshot
+}
+
+func copyPods(pods map[string]*v1.Pod) map[string]*v1.Pod {
+	copied := make(map[string]*v1.Pod, len(pods))
+	for name, pod := range pods {
+		copied[name] = pod
+	}
+	return copied
+}
@@ -17,9 +17,14 @@ package cache
 
 import (
 	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 
 	crdinformers "github.com/vllm-project/aibrix/pkg/client/informers/externalversions"
 	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
@@ -30,6 +35,7 @@ import (
 	modelv1alpha1 "github.com/vllm-project/aibrix/api/model/v1alpha1"
 	v1alpha1 "github.com/vllm-project/aibrix/pkg/client/clientset/versioned"
 	v1alpha1scheme "github.com/vllm-project/aibrix/pkg/client/clientset/versioned/scheme"
+	"github.com/vllm-project/aibrix/pkg/utils"
 	"k8s.io/client-go/kubernetes/scheme"
 )
 
@@ -37,8 +43,67 @@ const (
 	modelIdentifier = "model.aibrix.ai/name"
 	nodeType        = "ray.io/node-type"
 	nodeWorker      = "worker"
+
+	// PodRoleIdentifier is the pod label marking the serving role of a pod
+	// in a prefill/decode disaggregated deployment.
+	PodRoleIdentifier = "model.aibrix.ai/role"
+	PodRolePrefill    = "prefill"
+	PodRoleDecode     = "decode"
+
+	// PodGPUTypeIdentifier is the pod label overriding the GPU type detected from the node.
+	PodGPUTypeIdentifier = "model.aibrix.ai/gpu-type"
+	// NodeGPUProductIdentifier is the node label published by NVIDIA GPU feature discovery.
+	NodeGPUProductIdentifier = "nvidia.com/gpu.product"
+)
+
+var (
+	// cacheNamespaces restricts the pods and model adapters watched to the namespaces, all namespaces if empty.
+	cacheNamespaces = getListEnv("AIBRIX_CACHE_NAMESPACES")
+	// cachePodLabelSelector restricts the pods watched to those matching the label selector.
+	cachePodLabelSelector = utils.LoadEnv("AIBRIX_CACHE_POD_LABEL_SELECTOR", "")
+	// namespacedModels qualifies the model names with the namespace of their pods and model adapters,
+	// so that models of the same name in different namespaces are different models.
+	namespacedModels, _ = strconv.ParseBool(utils.LoadEnv("AIBRIX_CACHE_NAMESPACED_MODELS", "false"))
 )
 
+// PodKey returns the key of the pod in the cache, namespace/name, or the name for pods without namespace.
+func PodKey(pod *v1.Pod) string {
+	return podKey(pod.Namespace, pod.Name)
+}
+
+func podKey(namespace, name string) string {
+	if namespace == "" {
+		return name
+	}
+	return namespace + "/" + name
+}
+
+// ModelKey returns the name of the model in the cache, namespace/name if models are namespaced. Names
+// containing "/", e.g. meta-llama/Llama-3.1-8B, are qualified too, so that a pod or a model adapter
+// never names a model of another namespace.
+func ModelKey(namespace, modelName string) string {
+	if !namespacedModels || namespace == "" || modelName == "" {
+		return modelName
+	}
+	return namespace + "/" + modelName
+}
+
+// EngineModelKey returns the name in the cache of a model reported by the engine of a pod in the namespace.
+// Engines serve namespaced models under the qualified name, e.g. --served-model-name team-a/llama-8b, which
+// is kept if it is qualified with the namespace of the pod.
+func EngineModelKey(namespace, modelName string) string {
+	if namespacedModels && strings.HasPrefix(modelName, namespace+"/") {
+		return modelName
+	}
+	return ModelKey(namespace, modelName)
+}
+
+// PodModelKey returns the name of the base model of the pod in the cache.
+func PodModelKey(pod *v1.Pod) (string, bool) {
+	modelName, ok := pod.Labels[modelIdentifier]
+	return ModelKey(pod.Namespace, modelName), ok
+}
+
 func initCacheInformers(instance *Store, config *rest.Config, stopCh <-chan struct{}) error {
 	if err := v1alpha1scheme.AddToScheme(scheme.Scheme); err != nil {
 		return err
@@ -54,34 +119,71 @@ func initCacheInformers(instance *Store, config *rest.Config, stopCh <-chan stru
 		return err
 	}
 
-	factory := informers.NewSharedInformerFactoryWithOptions(k8sClientSet, 0)
-	crdFactory := crdinformers.NewSharedInformerFactoryWithOptions(crdClientSet, 0)
+	podSelector, err := labels.Parse(cachePodLabelSelector)
+	if err != nil {
+		return fmt.Errorf("invalid pod label selector %q: %v", cachePodLabelSelector, err)
+	}
+	namespaces := cacheNamespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
 
-	podInformer := factory.Core().V1().Pods().Informer()
-	modelInformer := crdFactory.Model().V1alpha1().ModelAdapters().Informer()
+	// nodes are cluster scoped, while pods and model adapters are watched in each namespace
+	factory := informers.NewSharedInformerFactoryWithOptions(k8sClientSet, 0)
+	nodeInformer := factory.Core().V1().Nodes().Informer()
+	hasSynced := []cache.InformerSynced{nodeInformer.HasSynced}
+	var podInformers, modelInformers []cache.SharedIndexInformer
+	for _, namespace := range namespaces {
+		podFactory := informers.NewSharedInformerFactoryWithOptions(k8sClientSet, 0, informers.WithNamespace(namespace),
+			informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+				options.LabelSelector = podSelector.String()
+			}))
+		crdFactory := crdinformers.NewSharedInformerFactoryWithOptions(crdClientSet, 0, crdinformers.WithNamespace(namespace))
+
+		podInformer := podFactory.Core().V1().Pods().Informer()
+		modelInformer := crdFactory.Model().V1alpha1().ModelAdapters().Informer()
+		podInformers = append(podInformers, podInformer)
+		modelInformers = append(modelInformers, modelInformer)
+		hasSynced = append(hasSynced, podInformer.HasSynced, modelInformer.HasSynced)
+
+		podFactory.Start(stopCh)
+		crdFactory.Start(stopCh)
+	}
 
 	defer runtime.HandleCrash()
 	factory.Start(stopCh)
-	crdFactory.Start(stopCh)
 
-	if !cache.WaitForCacheSync(stopCh, podInformer.HasSynced, modelInformer.HasSynced) {
+	if !cache.WaitForCacheSync(stopCh, hasSynced...) {
 		return errors.New("timed out waiting for caches to sync")
 	}
+	klog.InfoS("watching pods and model adapters", "namespaces", namespaces, "podLabelSelector", podSelector.String(), "namespacedModels", namespacedModels)
+
+	for _, podInformer := range podInformers {
+		if _, err := podInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    instance.addPod,
+			UpdateFunc: instance.updatePod,
+			DeleteFunc: instance.deletePod,
+		}); err != nil {
+			return err
+		}
+	}
 
-	if _, err := podInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc:    instance.addPod,
-		UpdateFunc: instance.updatePod,
-		DeleteFunc: instance.deletePod,
+	if _, err := nodeInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    instance.addNode,
+		UpdateFunc: instance.updateNode,
+		DeleteFunc: instance.deleteNode,
 	}); err != nil {
 		return err
 	}
 
-	if _, err = modelInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc:    instance.addModelAdapter,
-		UpdateFunc: instance.updateModelAdapter,
-		DeleteFunc: instance.deleteModelAdapter,
-	}); err != nil {
-		return err
+	for _, modelInformer := range modelInformers {
+		if _, err = modelInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    instance.addModelAdapter,
+			UpdateFunc: instance.updateModelAdapter,
+			DeleteFunc: instance.deleteModelAdapter,
+		}); err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -93,7 +195,7 @@ func (c *Store) addPod(obj interface{}) {
 
 	pod := obj.(*v1.Pod)
 	// only track pods with model deployments
-	modelName, ok := pod.Labels[modelIdentifier]
+	modelName, ok := PodModelKey(pod)
 	if !ok {
 		return
 	}
@@ -104,8 +206,9 @@ func (c *Store) addPod(obj interface{}) {
 		return
 	}
 
-	c.Pods[pod.Name] = pod
-	c.addPodAndModelMappingLocked(pod.Name, modelName)
+	key := PodKey(pod)
+	c.Pods[key] = pod
+	c.addPodAndModelMappingLocked(key, modelName)
 	klog.V(4).Infof("POD CREATED: %s/%s", pod.Namespace, pod.Name)
 	c.metricsDebugInfo()
 }
@@ -117,8 +220,8 @@ func (c *Store) updatePod(oldObj interface{}, newObj interface{}) {
 	oldPod := oldObj.(*v1.Pod)
 	newPod := newObj.(*v1.Pod)
 
-	oldModelName, oldOk := oldPod.Labels[modelIdentifier]
-	newModelName, newOk := newPod.Labels[modelIdentifier]
+	oldModelName, oldOk := PodModelKey(oldPod)
+	newModelName, newOk := PodModelKey(newPod)
 
 	if !oldOk && !newOk {
 		return // No model information to track in either old or new pod
@@ -126,8 +229,8 @@ func (c *Store) updatePod(oldObj interface{}, newObj interface{}) {
 
 	// Remove old mappings if present
 	if oldOk {
-		delete(c.Pods, oldPod.Name)
-		c.deletePodAndModelMapping(oldPod.Name, oldModelName)
+		delete(c.Pods, PodKey(oldPod))
+		c.deletePodAndModelMapping(PodKey(oldPod), oldModelName)
 	}
 
 	// ignore worker pods
@@ -146,8 +249,8 @@ func (c *Store) updatePod(oldObj interface{}, newObj interface{}) {
 
 	// Add new mappings if present
 	if newOk {
-		c.Pods[newPod.Name] = newPod
-		c.addPodAndModelMappingLocked(newPod.Name, newModelName)
+		c.Pods[PodKey(newPod)] = newPod
+		c.addPodAndModelMappingLocked(PodKey(newPod), newModelName)
 	}
 
 	klog.V(4).Infof("POD UPDATED: %s/%s %s", newPod.Namespace, newPod.Name, newPod.Status.Phase)
@@ -165,26 +268,85 @@ func (c *Store) deletePod(obj interface{}) {
 	}
 
 	// delete base model and associated lora models on this pod
-	if models, ok := c.PodToModelMapping[pod.Name]; ok {
+	key := PodKey(pod)
+	if models, ok := c.PodToModelMapping[key]; ok {
 		for modelName := range models {
-			c.deletePodAndModelMapping(pod.Name, modelName)
+			c.deletePodAndModelMapping(key, modelName)
 		}
 	}
-	delete(c.Pods, pod.Name)
-	delete(c.PodMetrics, pod.Name)
-	delete(c.PodModelMetrics, pod.Name)
+	delete(c.Pods, key)
+	delete(c.PodMetrics, key)
+	delete(c.PodModelMetrics, key)
+	delete(c.podMetricsUpdateTime, key)
+	delete(c.podMetricsPushTime, key)
+	delete(c.podMetricHistory, key)
+	delete(c.podDerivedMetrics, key)
+	delete(c.podDiscoveredModels, key)
+	delete(c.podUnservedModels, key)
+	delete(c.podServedModels, key)
 
 	klog.V(4).Infof("POD DELETED: %s/%s", pod.Namespace, pod.Name)
 	c.metricsDebugInfo()
 }
 
+func (c *Store) addNode(obj interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	node := obj.(*v1.Node)
+	// only track nodes with gpu product information
+	if _, ok := node.Labels[NodeGPUProductIdentifier]; !ok {
+		return
+	}
+
+	c.Nodes[node.Name] = node
+	klog.V(4).Infof("NODE CREATED: %s", node.Name)
+}
+
+func (c *Store) updateNode(oldObj interface{}, newObj interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	newNode := newObj.(*v1.Node)
+	if _, ok := newNode.Labels[NodeGPUProductIdentifier]; !ok {
+		delete(c.Nodes, newNode.Name)
+		return
+	}
+
+	c.Nodes[newNode.Name] = newNode
+	klog.V(5).Infof("NODE UPDATED: %s", newNode.Name)
+}
+
+func (c *Store) deleteNode(obj interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var node *v1.Node
+	switch t := obj.(type) {
+	case *v1.Node:
+		node = t
+	case cache.DeletedFinalStateUnknown:
+		var ok bool
+		if node, ok = t.Obj.(*v1.Node); !ok {
+			return
+		}
+	default:
+		return
+	}
+
+	delete(c.Nodes, node.Name)
+	klog.V(4).Infof("NODE DELETED: %s", node.Name)
+}
+
 func (c *Store) addModelAdapter(obj interface{}) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	model := obj.(*modelv1alpha1.ModelAdapter)
+	c.modelAdapters[ModelKey(model.Namespace, model.Name)] = model
+	// instances are the pods in the namespace of the model adapter
 	for _, pod := range model.Status.Instances {
-		c.addPodAndModelMappingLocked(pod, model.Name)
+		c.addPodAndModelMappingLocked(podKey(model.Namespace, pod), ModelKey(model.Namespace, model.Name))
 	}
 
 	klog.V(4).Infof("MODELADAPTER CREATED: %s/%s", model.Namespace, model.Name)
@@ -199,11 +361,13 @@ func (c *Store) updateModelAdapter(oldObj interface{}, newObj interface{}) {
 	newModel := newObj.(*modelv1alpha1.ModelAdapter)
 
 	for _, pod := range oldModel.Status.Instances {
-		c.deletePodAndModelMapping(pod, oldModel.Name)
+		c.deletePodAndModelMapping(podKey(oldModel.Namespace, pod), ModelKey(oldModel.Namespace, oldModel.Name))
 	}
+	delete(c.modelAdapters, ModelKey(oldModel.Namespace, oldModel.Name))
+	c.modelAdapters[ModelKey(newModel.Namespace, newModel.Name)] = newModel
 
 	for _, pod := range newModel.Status.Instances {
-		c.addPodAndModelMappingLocked(pod, newModel.Name)
+		c.addPodAndModelMappingLocked(podKey(newModel.Namespace, pod), ModelKey(newModel.Namespace, newModel.Name))
 	}
 
 	klog.V(4).Infof("MODELADAPTER UPDATED. %s/%s %s", oldModel.Namespace, oldModel.Name, newModel.Status.Phase)
@@ -216,14 +380,27 @@ func (c *Store) deleteModelAdapter(obj interface{}) {
 
 	model := obj.(*modelv1alpha1.ModelAdapter)
 	for _, pod := range model.Status.Instances {
-		c.deletePodAndModelMapping(pod, model.Name)
+		c.deletePodAndModelMapping(podKey(model.Namespace, pod), ModelKey(model.Namespace, model.Name))
 	}
+	delete(c.modelAdapters, ModelKey(model.Namespace, model.Name))
 
 	klog.V(4).Infof("MODELADAPTER DELETED: %s/%s", model.Namespace, model.Name)
 	c.metricsDebugInfo()
 }
 
+// addPodAndModelMappingLocked maps the pod to a model known from its label or a model adapter.
 func (c *Store) addPodAndModelMappingLocked(podName, modelName string) {
+	// the model is no longer unmapped when the engine stops serving it
+	if discovered, ok := c.podDiscoveredModels[podName]; ok {
+		delete(discovered, modelName)
+		if len(discovered) == 0 {
+			delete(c.podDiscoveredModels, podName)
+		}
+	}
+	c.mapPodAndModelLocked(podName, modelName)
+}
+
+func (c *Store) mapPodAndModelLocked(podName, modelName string) {
 	pod, ok := c.Pods[podName]
 	if !ok {
 		klog.Errorf("pod %s does not exist in internal-cache", podName)
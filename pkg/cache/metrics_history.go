@@ -0,0 +1,287 @@
+/*
+Copyright 2024 The Aibrix Team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cache
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/vllm-project/aibrix/pkg/metrics"
+	"k8s.io/klog/v2"
+)
+
+const (
+	defaultPodMetricHistorySize         = 300
+	defaultPodMetricHistoryIntervalInMS = 1000
+)
+
+var (
+	// podMetricHistorySize is the number of samples kept per metric, which covers size * interval of history.
+	podMetricHistorySize     = getPositiveIntEnv("AIBRIX_POD_METRIC_HISTORY_SIZE", defaultPodMetricHistorySize)
+	podMetricHistoryInterval = time.Duration(getPositiveIntEnv("AIBRIX_POD_METRIC_HISTORY_INTERVAL_MS", defaultPodMetricHistoryIntervalInMS)) * time.Millisecond
+)
+
+// metricHistoryKey identifies a metric of a pod, modelName is empty for pod scope metrics.
+type metricHistoryKey struct {
+	modelName  string
+	metricName string
+}
+
+type metricSample struct {
+	time  time.Time
+	value metrics.MetricValue
+}
+
+// metricHistory is a ring buffer of the recent samples of a counter, gauge or histogram metric.
+type metricHistory struct {
+	samples []metricSample
+	start   int
+	size    int
+}
+
+func newMetricHistory(capacity int) *metricHistory {
+	return &metricHistory{samples: make([]metricSample, capacity)}
+}
+
+// add appends the sample unless the latest sample is more recent than the history interval.
+func (h *metricHistory) add(t time.Time, value metrics.MetricValue) {
+	if h.size > 0 && t.Sub(h.at(h.size-1).time) < podMetricHistoryInterval {
+		return
+	}
+	if h.size < len(h.samples) {
+		h.samples[(h.start+h.size)%len(h.samples)] = metricSample{time: t, value: value}
+		h.size++
+		return
+	}
+	h.samples[h.start] = metricSample{time: t, value: value}
+	h.start = (h.start + 1) % len(h.samples)
+}
+
+// at returns the i-th sample from the oldest.
+func (h *metricHistory) at(i int) metricSample {
+	return h.samples[(h.start+i)%len(h.samples)]
+}
+
+// window returns the latest sample and the latest sample at or before the start of the window, or the
+// oldest sample if the history is shorter than the window.
+func (h *metricHistory) window(now time.Time, window time.Duration) (earliest, latest metricSample, err error) {
+	if h.size < 2 {
+		return metricSample{}, metricSample{}, fmt.Errorf("not enough samples in the metric history")
+	}
+	start := now.Add(-window)
+	earliest = h.at(0)
+	for i := 1; i < h.size-1 && !h.at(i).time.After(start); i++ {
+		earliest = h.at(i)
+	}
+	return earliest, h.at(h.size - 1), nil
+}
+
+// recordMetricHistoryLocked appends the counter, gauge and histogram metrics of the record to the history of the pod.
+func (c *Store) recordMetricHistoryLocked(podName string, record *podMetricRecord, now time.Time) {
+	podHistory := c.podMetricHistory[podName]
+	if podHistory == nil {
+		podHistory = map[metricHistoryKey]*metricHistory{}
+		c.podMetricHistory[podName] = podHistory
+	}
+	add := func(key metricHistoryKey, value metrics.MetricValue) {
+		switch value.(type) {
+		case *metrics.SimpleMetricValue, *metrics.HistogramMetricValue:
+		default:
+			return
+		}
+		history := podHistory[key]
+		if history == nil {
+			history = newMetricHistory(podMetricHistorySize)
+			podHistory[key] = history
+		}
+		history.add(now, value)
+	}
+	for metricName, value := range record.podMetrics {
+		add(metricHistoryKey{metricName: metricName}, value)
+	}
+	for modelName, modelMetrics := range record.podModelMetrics {
+		for metricName, value := range modelMetrics {
+			add(metricHistoryKey{modelName: modelName, metricName: metricName}, value)
+		}
+	}
+}
+
+// updateDerivedMetricsLocked computes the derived metrics of the pod from the history of their source metrics,
+// pod scope metrics aggregate the source metrics of all models of the pod. A derived metric keeps its last value while
+// it cannot be computed, e.g. while no request completed within its window.
+func (c *Store) updateDerivedMetricsLocked(podName string, derivedNames []string, now time.Time) {
+	if c.podDerivedMetrics[podName] == nil {
+		c.podDerivedMetrics[podName] = map[metricHistoryKey]float64{}
+	}
+	lastValues := c.podDerivedMetrics[podName]
+	for _, metricName := range derivedNames {
+		metric := metrics.Metrics[metricName]
+		derivation := metric.Derivation
+		windows := map[string][]metrics.MetricWindow{}
+		for key, history := range c.podMetricHistory[podName] {
+			if key.metricName != derivation.Source {
+				continue
+			}
+			earliest, latest, err := history.window(now, derivation.Window)
+			if err != nil {
+				continue
+			}
+			modelName := key.modelName
+			if metric.MetricScope == metrics.PodMetricScope {
+				modelName = ""
+			}
+			windows[modelName] = append(windows[modelName], metrics.MetricWindow{
+				Earliest: earliest.value,
+				Latest:   latest.value,
+				Elapsed:  latest.time.Sub(earliest.time),
+			})
+		}
+
+		for modelName, modelWindows := range windows {
+			value, err := derivation.Compute(modelWindows)
+			if err != nil {
+				klog.V(5).Infof("Failed to derive metrics %s of pod %s: %v", metricName, podName, err)
+				continue
+			}
+			lastValues[metricHistoryKey{modelName: modelName, metricName: metricName}] = value
+		}
+
+		record := newPodMetricRecord()
+		for key, value := range lastValues {
+			if key.metricName != metricName {
+				continue
+			}
+			if err := record.update(key.modelName, metricName, metric.MetricScope, &metrics.SimpleMetricValue{Value: value}); err != nil {
+				klog.V(4).Infof("Failed to update metrics %s of pod %s: %v", metricName, podName, err)
+			}
+		}
+		c.mergePodMetricRecordLocked(podName, record)
+	}
+}
+
+func (c *Store) getMetricHistoryLocked(podName, modelName, metricName string) (*metricHistory, error) {
+	if err := c.checkPodMetricsStalenessLocked(podName); err != nil {
+		return nil, err
+	}
+	history, ok := c.podMetricHistory[podName][metricHistoryKey{modelName: modelName, metricName: metricName}]
+	if !ok {
+		return nil, fmt.Errorf("no metric history available for %v", metricName)
+	}
+	return history, nil
+}
+
+// GetMetricRate retrieves the per second rate of a counter metric over a window
+// Parameters:
+//
+//	podName: Name of the Pod
+//	modelName: Name of the model, empty for pod metrics
+//	metricName: Name of the metric
+//	window: Time window up to the latest sample
+//
+// Returns:
+//
+//	float64: Increase of the metric per second, counter resets are handled like in Prometheus
+//	error: Error if the history has less than two samples
+func (c *Store) GetMetricRate(podName, modelName, metricName string, window time.Duration) (float64, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	history, err := c.getMetricHistoryLocked(podName, modelName, metricName)
+	if err != nil {
+		return 0, err
+	}
+	earliest, latest, err := history.window(time.Now(), window)
+	if err != nil {
+		return 0, err
+	}
+	increase := latest.value.GetSimpleValue() - earliest.value.GetSimpleValue()
+	if increase < 0 {
+		// the counter was reset in the window
+		increase = latest.value.GetSimpleValue()
+	}
+	return increase / latest.time.Sub(earliest.time).Seconds(), nil
+}
+
+// GetMetricPercentile retrieves a percentile of the observations of a histogram metric over a window
+// Parameters:
+//
+//	podName: Name of the Pod
+//	modelName: Name of the model, empty for pod metrics
+//	metricName: Name of the metric
+//	percentile: Percentile between 0 and 100
+//	window: Time window up to the latest sample
+//
+// Returns:
+//
+//	float64: Bucket bound of the percentile of the observations in the window
+//	error: Error if the metric is not a histogram or there is no observation in the window
+func (c *Store) GetMetricPercentile(podName, modelName, metricName string, percentile float64, window time.Duration) (float64, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	history, err := c.getMetricHistoryLocked(podName, modelName, metricName)
+	if err != nil {
+		return 0, err
+	}
+	earliest, latest, err := history.window(time.Now(), window)
+	if err != nil {
+		return 0, err
+	}
+	latestHistogram := latest.value.GetHistogramValue()
+	if latestHistogram == nil {
+		return 0, fmt.Errorf("metric %v is not a histogram", metricName)
+	}
+	delta := latestHistogram.Delta(earliest.value.GetHistogramValue())
+	if delta.Count == 0 {
+		return 0, fmt.Errorf("no observation of %v in the window", metricName)
+	}
+	return delta.GetPercentile(percentile)
+}
+
+// GetMetricEWMA retrieves the exponentially weighted moving average of a counter or gauge metric
+// Parameters:
+//
+//	podName: Name of the Pod
+//	modelName: Name of the model, empty for pod metrics
+//	metricName: Name of the metric
+//	halfLife: Age at which the weight of a sample halves
+//
+// Returns:
+//
+//	float64: Moving average of the samples in the history weighted by their age
+//	error: Error if the metric has no history
+func (c *Store) GetMetricEWMA(podName, modelName, metricName string, halfLife time.Duration) (float64, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	history, err := c.getMetricHistoryLocked(podName, modelName, metricName)
+	if err != nil {
+		return 0, err
+	}
+	if history.size == 0 || halfLife <= 0 {
+		return 0, fmt.Errorf("no metric history available for %v", metricName)
+	}
+	previous := history.at(0)
+	average := previous.value.GetSimpleValue()
+	for i := 1; i < history.size; i++ {
+		sample := history.at(i)
+		alpha := 1 - math.Exp(-math.Ln2*sample.time.Sub(previous.time).Seconds()/halfLife.Seconds())
+		average += alpha * (sample.value.GetSimpleValue() - average)
+		previous = sample
+	}
+	return average, nil
+}
@@ -0,0 +1,164 @@
+/*
+Copyright 2024 The Aibrix Team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cache
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/vllm-project/aibrix/pkg/metrics"
+	"k8s.io/klog/v2"
+)
+
+const defaultPodMetricPushTimeoutInMS = 1000
+
+// podMetricPushTimeout is the time after the last push before a pod is polled again.
+var podMetricPushTimeout = time.Duration(getPositiveIntEnv("AIBRIX_POD_METRIC_PUSH_TIMEOUT_MS", defaultPodMetricPushTimeoutInMS)) * time.Millisecond
+
+// PodMetricReport is a load report pushed by the engine sidecar of a pod, keyed by canonical metric names.
+type PodMetricReport struct {
+	PodName string `json:"pod_name"`
+	// Namespace is the namespace of the pod, required unless the cache is keyed by pod names only.
+	Namespace string `json:"namespace,omitempty"`
+	// Metrics are the values of the pod scope metrics, e.g. max_lora.
+	Metrics map[string]float64 `json:"metrics,omitempty"`
+	// ModelMetrics are the values of the pod model scope metrics by model name, e.g. num_requests_running.
+	ModelMetrics map[string]map[string]float64 `json:"model_metrics,omitempty"`
+	// LabelMetrics are the values of the pod scope label metrics, e.g. running_lora_adapters.
+	LabelMetrics map[string]string `json:"label_metrics,omitempty"`
+}
+
+// PodKey returns the key of the pod of the report in the cache.
+func (r *PodMetricReport) PodKey() string {
+	return podKey(r.Namespace, r.PodName)
+}
+
+// record converts the report to a metric record, validating the metric names and scopes.
+func (r *PodMetricReport) record() (*podMetricRecord, error) {
+	record := newPodMetricRecord()
+	update := func(modelName, metricName string, value metrics.MetricValue) error {
+		metric := metrics.Metrics[metricName]
+		if err := record.update(modelName, metricName, metric.MetricScope, value); err != nil {
+			return fmt.Errorf("invalid metric %s: %v", metricName, err)
+		}
+		return nil
+	}
+	// only raw counters and gauges are pushed as numbers, histograms and queries have other value types
+	updateSimple := func(modelName, metricName string, value float64) error {
+		metric, exists := metrics.Metrics[metricName]
+		if !exists {
+			return fmt.Errorf("metric %s is not defined", metricName)
+		}
+		if metric.MetricType.Raw != metrics.Counter && metric.MetricType.Raw != metrics.Gauge {
+			return fmt.Errorf("metric %s is not a counter or gauge metric", metricName)
+		}
+		return update(modelName, metricName, &metrics.SimpleMetricValue{Value: value})
+	}
+
+	for metricName, value := range r.Metrics {
+		if err := updateSimple("", metricName, value); err != nil {
+			return nil, err
+		}
+	}
+	for modelName, modelMetrics := range r.ModelMetrics {
+		if modelName == "" {
+			return nil, fmt.Errorf("model name of model metrics is empty")
+		}
+		for metricName, value := range modelMetrics {
+			if err := updateSimple(modelName, metricName, value); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for metricName, value := range r.LabelMetrics {
+		metric, exists := metrics.Metrics[metricName]
+		if !exists {
+			return nil, fmt.Errorf("metric %s is not defined", metricName)
+		}
+		if metric.MetricType.Query != metrics.QueryLabel {
+			return nil, fmt.Errorf("metric %s is not a label metric", metricName)
+		}
+		if err := update("", metricName, &metrics.LabelValueMetricValue{Value: value}); err != nil {
+			return nil, err
+		}
+	}
+	return record, nil
+}
+
+// PushPodMetrics merges the metrics pushed by a pod into the cache. The pod is not polled until it
+// stops pushing for the push timeout, metrics not in the report keep their previous values.
+// Parameters:
+//
+//	report: Load report of the pod
+//
+// Returns:
+//
+//	error: Error if the pod does not exist or the report is invalid
+func (c *Store) PushPodMetrics(report *PodMetricReport) error {
+	record, err := report.record()
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	podName := report.PodKey()
+	if _, ok := c.Pods[podName]; !ok {
+		return fmt.Errorf("pod does not exist in the cache: %s", podName)
+	}
+
+	c.mergePodMetricRecordLocked(podName, record)
+	now := time.Now()
+	c.podMetricsUpdateTime[podName] = now
+	c.podMetricsPushTime[podName] = now
+	c.recordMetricHistoryLocked(podName, record, now)
+	c.updateDerivedMetricsLocked(podName, c.collectedMetricNamesLocked().derived, now)
+	klog.V(5).InfoS("Merged pushed metrics", "pod", podName, "metrics", len(record.podMetrics), "models", len(record.podModelMetrics))
+	return nil
+}
+
+// mergePodMetricRecordLocked sets the metrics of the record, keeping the other metrics of the pod.
+func (c *Store) mergePodMetricRecordLocked(podName string, record *podMetricRecord) {
+	podMetrics := c.PodMetrics[podName]
+	if podMetrics == nil {
+		podMetrics = map[string]metrics.MetricValue{}
+		c.PodMetrics[podName] = podMetrics
+	}
+	for metricName, value := range record.podMetrics {
+		podMetrics[metricName] = value
+	}
+	podModelMetrics := c.PodModelMetrics[podName]
+	if podModelMetrics == nil {
+		podModelMetrics = map[string]map[string]metrics.MetricValue{}
+		c.PodModelMetrics[podName] = podModelMetrics
+	}
+	for modelName, modelMetrics := range record.podModelMetrics {
+		if podModelMetrics[modelName] == nil {
+			podModelMetrics[modelName] = map[string]metrics.MetricValue{}
+		}
+		for metricName, value := range modelMetrics {
+			podModelMetrics[modelName][metricName] = value
+		}
+	}
+
+}
+
+// isPushingLocked returns whether the pod has pushed its metrics within the push timeout.
+func (c *Store) isPushingLocked(podName string, now time.Time) bool {
+	pushTime, ok := c.podMetricsPushTime[podName]
+	return ok && now.Sub(pushTime) < podMetricPushTimeout
+}
@@ -0,0 +1,217 @@
+/*
+Copyright 2024 The Aibrix Team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/vllm-project/aibrix/pkg/utils"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	modelListPath                          = "/v1/models"
+	defaultModelDiscoveryIntervalInSeconds = 30
+)
+
+var (
+	// modelDiscoveryEnabled reconciles the models of the pods with the models served by their engines.
+	modelDiscoveryEnabled, _ = strconv.ParseBool(utils.LoadEnv("AIBRIX_MODEL_DISCOVERY_ENABLED", "true"))
+	modelDiscoveryInterval   = time.Duration(getPositiveIntEnv("AIBRIX_MODEL_DISCOVERY_INTERVAL_SECONDS", defaultModelDiscoveryIntervalInSeconds)) * time.Second
+)
+
+// modelList is the response of the OpenAI compatible model list API of the engines.
+type modelList struct {
+	Data []struct {
+		ID          string `json:"id"`
+		Parent      string `json:"parent"`
+		MaxModelLen int    `json:"max_model_len"`
+	} `json:"data"`
+}
+
+// servedModel is a model served by the engine of a pod, Parent is the base model of a LoRA adapter and MaxModelLen
+// the context length of the model, both empty if the engine does not report them.
+type servedModel struct {
+	Parent      string
+	MaxModelLen int
+}
+
+// initModelDiscovery initializes the model discovery loop
+// Parameters:
+//
+//	store: Cache store instance
+//	stopCh: Stop signal channel
+func initModelDiscovery(store *Store, stopCh <-chan struct{}) {
+	if !modelDiscoveryEnabled {
+		klog.Info("model discovery from the engines is disabled")
+		return
+	}
+	ticker := time.NewTicker(modelDiscoveryInterval)
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				store.discoverPodModels()
+			case <-stopCh:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+}
+
+// discoverPodModels lists the models served by the engines of the ready pods concurrently without holding the lock,
+// and then reconciles the models of the pods listed successfully. Pods failing to list keep their models.
+func (c *Store) discoverPodModels() {
+	c.mu.RLock()
+	readyPods := utils.FilterReadyPods(c.Pods)
+	c.mu.RUnlock()
+	if len(readyPods) == 0 {
+		return
+	}
+
+	servedModels := make([]map[string]servedModel, len(readyPods))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < podMetricScrapeConcurrency && i < len(readyPods); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				models, err := listServedModels(readyPods[j])
+				if err != nil {
+					klog.V(4).InfoS("failed to list the models served by the pod", "pod", PodKey(readyPods[j]), "err", err)
+					continue
+				}
+				servedModels[j] = models
+			}
+		}()
+	}
+	for i := range readyPods {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, pod := range readyPods {
+		if servedModels[i] != nil {
+			c.reconcilePodModelsLocked(PodKey(pod), servedModels[i])
+		}
+	}
+}
+
+// listServedModels returns the models served by the engine of the pod by their name in the cache.
+func listServedModels(pod *v1.Pod) (map[string]servedModel, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), podMetricScrapeTimeout)
+	defer cancel()
+
+	url := fmt.Sprintf("http://%s:%d%s", pod.Status.PodIP, podPort, modelListPath)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			klog.ErrorS(err, "error closing model list response body", "pod", PodKey(pod))
+		}
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	var list modelList
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, err
+	}
+	models := make(map[string]servedModel, len(list.Data))
+	for _, model := range list.Data {
+		if model.ID == "" {
+			continue
+		}
+		served := servedModel{MaxModelLen: model.MaxModelLen}
+		if model.Parent != "" && model.Parent != model.ID {
+			served.Parent = EngineModelKey(pod.Namespace, model.Parent)
+		}
+		models[EngineModelKey(pod.Namespace, model.ID)] = served
+	}
+	return models, nil
+}
+
+// reconcilePodModelsLocked maps the pod to the models served by its engine which are unknown from its label and the
+// model adapters, and unmaps the models discovered before which are no longer served. The models known from the
+// label and the model adapters but not served are kept and flagged as mismatches.
+func (c *Store) reconcilePodModelsLocked(podName string, servedModels map[string]servedModel) {
+	if _, ok := c.Pods[podName]; !ok {
+		return
+	}
+	c.podServedModels[podName] = servedModels
+
+	discovered := c.podDiscoveredModels[podName]
+	for modelName := range discovered {
+		if _, ok := servedModels[modelName]; !ok {
+			klog.InfoS("model is no longer served by the pod", "pod", podName, "model", modelName)
+			delete(discovered, modelName)
+			c.deletePodAndModelMapping(podName, modelName)
+		}
+	}
+	for modelName := range servedModels {
+		if _, ok := c.PodToModelMapping[podName][modelName]; ok {
+			continue
+		}
+		klog.InfoS("discovered model served by the pod", "pod", podName, "model", modelName)
+		if discovered == nil {
+			discovered = map[string]struct{}{}
+		}
+		discovered[modelName] = struct{}{}
+		c.mapPodAndModelLocked(podName, modelName)
+	}
+	if len(discovered) == 0 {
+		delete(c.podDiscoveredModels, podName)
+	} else {
+		c.podDiscoveredModels[podName] = discovered
+	}
+
+	var unserved []string
+	for modelName := range c.PodToModelMapping[podName] {
+		if _, ok := servedModels[modelName]; !ok {
+			unserved = append(unserved, modelName)
+		}
+	}
+	sort.Strings(unserved)
+	if len(unserved) != 0 && !slices.Equal(unserved, c.podUnservedModels[podName]) {
+		klog.Warningf("models %v of pod %s are not served by its engine", unserved, podName)
+	}
+	if len(unserved) == 0 {
+		delete(c.podUnservedModels, podName)
+	} else {
+		c.podUnservedModels[podName] = unserved
+	}
+}
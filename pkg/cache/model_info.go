@@ -0,0 +1,98 @@
+/*
+Copyright 2024 The Aibrix Team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cache
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/vllm-project/aibrix/pkg/utils"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ModelOwnerIdentifier is the pod or model adapter annotation naming the owner of the model.
+const ModelOwnerIdentifier = "model.aibrix.ai/owner"
+
+// ModelInfo is the metadata of a model served by the pods in the cache.
+type ModelInfo struct {
+	// Name is the name of the model in the cache
+	Name string
+	// CreationTime is the creation time of the model adapter, or of the oldest pod of a base model
+	CreationTime time.Time
+	// Owner is the model.aibrix.ai/owner annotation of the model adapter or the oldest pod, otherwise their namespace
+	Owner string
+	// Parent is the base model of a LoRA adapter, empty for base models
+	Parent string
+	// MaxModelLen is the smallest context length reported by the engines serving the model, 0 if unknown
+	MaxModelLen int
+	// ReadyReplicas is the number of ready pods serving the model
+	ReadyReplicas int
+}
+
+// GetModelInfo returns the metadata of a model
+// Parameters:
+//
+//	modelName: Name of the model
+//
+// Returns:
+//
+//	*ModelInfo: Metadata of the model
+//	error: Error if the model doesn't exist
+func (c *Store) GetModelInfo(modelName string) (*ModelInfo, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	pods, ok := c.ModelToPodMapping[modelName]
+	if !ok {
+		return nil, fmt.Errorf("model does not exist in the cache: %s", modelName)
+	}
+
+	info := &ModelInfo{Name: modelName}
+	var owner *metav1.ObjectMeta
+	for name, pod := range pods {
+		if utils.IsPodReady(pod) {
+			info.ReadyReplicas++
+		}
+		if owner == nil || pod.CreationTimestamp.Before(&owner.CreationTimestamp) {
+			owner = &pod.ObjectMeta
+		}
+		served, ok := c.podServedModels[name][modelName]
+		if !ok {
+			continue
+		}
+		if served.MaxModelLen > 0 && (info.MaxModelLen == 0 || served.MaxModelLen < info.MaxModelLen) {
+			info.MaxModelLen = served.MaxModelLen
+		}
+		if info.Parent == "" {
+			info.Parent = served.Parent
+		}
+	}
+
+	if adapter, ok := c.modelAdapters[modelName]; ok {
+		owner = &adapter.ObjectMeta
+		if adapter.Spec.BaseModel != nil && *adapter.Spec.BaseModel != "" {
+			info.Parent = ModelKey(adapter.Namespace, *adapter.Spec.BaseModel)
+		}
+	}
+	if owner != nil {
+		info.CreationTime = owner.CreationTimestamp.Time
+		info.Owner = owner.Namespace
+		if annotation := owner.Annotations[ModelOwnerIdentifier]; annotation != "" {
+			info.Owner = annotation
+		}
+	}
+	return info, nil
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package controller
 
 import (
+	"github.com/vllm-project/aibrix/pkg/cache"
 	"github.com/vllm-project/aibrix/pkg/config"
 	"github.com/vllm-project/aibrix/pkg/controller/kvcache"
 	"github.com/vllm-project/aibrix/pkg/controller/modeladapter"
@@ -37,13 +38,17 @@ import (
 
 var controllerAddFuncs []func(manager.Manager, config.RuntimeConfig) error
 
-func Initialize() {
+// Initialize registers the enabled controllers. The cache c is used by the model adapter controller
+// to schedule adapters and may be nil if that controller is disabled.
+func Initialize(c cache.Cache) {
 	if features.IsControllerEnabled(features.PodAutoscalerController) {
 		controllerAddFuncs = append(controllerAddFuncs, podautoscaler.Add)
 	}
 
 	if features.IsControllerEnabled(features.ModelAdapterController) {
-		controllerAddFuncs = append(controllerAddFuncs, modeladapter.Add)
+		controllerAddFuncs = append(controllerAddFuncs, func(m manager.Manager, runtimeConfig config.RuntimeConfig) error {
+			return modeladapter.Add(m, runtimeConfig, c)
+		})
 	}
 
 	if features.IsControllerEnabled(features.ModelRouteController) {
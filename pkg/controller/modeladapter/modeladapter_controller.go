@@ -114,8 +114,9 @@ type URLConfig struct {
 
 // Add creates a new ModelAdapter Controller and adds it to the Manager with default RBAC.
 // The Manager will set fields on the Controller and Start it when the Manager is Started.
-func Add(mgr manager.Manager, runtimeConfig config.RuntimeConfig) error {
-	r, err := newReconciler(mgr, runtimeConfig)
+// The cache c holds the pods and metrics used to schedule the adapters.
+func Add(mgr manager.Manager, runtimeConfig config.RuntimeConfig, c cache.Cache) error {
+	r, err := newReconciler(mgr, runtimeConfig, c)
 	if err != nil {
 		return err
 	}
@@ -123,7 +124,7 @@ func Add(mgr manager.Manager, runtimeConfig config.RuntimeConfig) error {
 }
 
 // newReconciler returns a new reconcile.Reconciler
-func newReconciler(mgr manager.Manager, runtimeConfig config.RuntimeConfig) (reconcile.Reconciler, error) {
+func newReconciler(mgr manager.Manager, runtimeConfig config.RuntimeConfig, c cache.Cache) (reconcile.Reconciler, error) {
 	cacher := mgr.GetCache()
 
 	podInformer, err := cacher.GetInformer(context.TODO(), &corev1.Pod{})
@@ -147,11 +148,6 @@ func newReconciler(mgr manager.Manager, runtimeConfig config.RuntimeConfig) (rec
 	endpointSliceLister := discoverylisters.NewEndpointSliceLister(endpointSliceInformer.(toolscache.SharedIndexInformer).GetIndexer())
 
 	// init scheduler
-	c, err := cache.Get()
-	if err != nil {
-		klog.Fatal(err)
-	}
-
 	// TODO: policy should be configured by users
 	scheduler, err := scheduling.NewScheduler(defaultModelAdapterSchedulerPolicy, c)
 	if err != nil {
@@ -255,6 +251,7 @@ type ModelAdapterReconciler struct {
 //+kubebuilder:rbac:groups=discovery.k8s.io,resources=endpointslices/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=core,resources=services/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=core,resources=nodes,verbs=get;list;watch
 //+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=core,resources=pods/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=model.aibrix.ai,resources=modeladapters,verbs=get;list;watch;create;update;patch;delete
@@ -521,7 +518,7 @@ func (r *ModelAdapterReconciler) getActivePodsForModelAdapter(ctx context.Contex
 func (r *ModelAdapterReconciler) schedulePod(ctx context.Context, instance *modelv1alpha1.ModelAdapter, activePods []corev1.Pod) (*corev1.Pod, error) {
 	// Implement your scheduling logic here to select a Pod based on the instance.Spec.PodSelector
 	// For the sake of example, we will just list the Pods matching the selector and pick the first one
-	return r.scheduler.SelectPod(ctx, instance.Name, activePods)
+	return r.scheduler.SelectPod(ctx, cache.ModelKey(instance.Namespace, instance.Name), activePods)
 }
 
 func (r *ModelAdapterReconciler) reconcileLoading(ctx context.Context, instance *modelv1alpha1.ModelAdapter) error {
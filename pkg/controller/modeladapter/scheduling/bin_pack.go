@@ -42,7 +42,7 @@ func (r binPackScheduler) SelectPod(ctx context.Context, model string, pods []v1
 	podRemainCapMin := math.MaxInt
 
 	for _, pod := range pods {
-		models, err := r.cache.ListModelsByPod(pod.Name)
+		models, err := r.cache.ListModelsByPod(cache.PodKey(&pod))
 		if err != nil {
 			return nil, err
 		}
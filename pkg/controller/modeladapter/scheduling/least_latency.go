@@ -41,11 +41,11 @@ func (r leastLatencyScheduler) SelectPod(ctx context.Context, model string, pods
 	podLatencyMin := math.MaxFloat64
 
 	for _, pod := range pods {
-		queueTime, err := r.cache.GetMetricValueByPodModel(pod.Name, model, metrics.RequestQueueTimeSeconds)
+		queueTime, err := r.cache.GetMetricValueByPodModel(cache.PodKey(&pod), model, metrics.RequestQueueTimeSeconds)
 		if err != nil {
 			return nil, err
 		}
-		inferenceTime, err := r.cache.GetMetricValueByPodModel(pod.Name, model, metrics.RequestInferenceTimeSeconds)
+		inferenceTime, err := r.cache.GetMetricValueByPodModel(cache.PodKey(&pod), model, metrics.RequestInferenceTimeSeconds)
 		if err != nil {
 			return nil, err
 		}
@@ -59,3 +59,10 @@ func (r leastLatencyScheduler) SelectPod(ctx context.Context, model string, pods
 	klog.InfoS("pod selected with least latency", "pod", klog.KObj(&selectedPod))
 	return &selectedPod, nil
 }
+
+func (r leastLatencyScheduler) SubscribedMetrics() []string {
+	return []string{
+		metrics.RequestQueueTimeSeconds,
+		metrics.RequestInferenceTimeSeconds,
+	}
+}
@@ -41,11 +41,11 @@ func (r leastThroughputScheduler) SelectPod(ctx context.Context, model string, p
 	podThroughputMin := math.MaxFloat64
 
 	for _, pod := range pods {
-		promptThroughput, err := r.cache.GetMetricValueByPodModel(pod.Name, model, metrics.AvgPromptThroughputToksPerMinPod)
+		promptThroughput, err := r.cache.GetMetricValueByPodModel(cache.PodKey(&pod), model, metrics.AvgPromptThroughputToksPerMinPod)
 		if err != nil {
 			return nil, err
 		}
-		generationThroughput, err := r.cache.GetMetricValueByPodModel(pod.Name, model, metrics.AvgGenerationThroughputToksPerMinPod)
+		generationThroughput, err := r.cache.GetMetricValueByPodModel(cache.PodKey(&pod), model, metrics.AvgGenerationThroughputToksPerMinPod)
 		if err != nil {
 			return nil, err
 		}
@@ -59,3 +59,10 @@ func (r leastThroughputScheduler) SelectPod(ctx context.Context, model string, p
 	klog.InfoS("pod selected with least latency", "pod", klog.KObj(&selectedPod))
 	return &selectedPod, nil
 }
+
+func (r leastThroughputScheduler) SubscribedMetrics() []string {
+	return []string{
+		metrics.AvgPromptThroughputToksPerMinPod,
+		metrics.AvgGenerationThroughputToksPerMinPod,
+	}
+}
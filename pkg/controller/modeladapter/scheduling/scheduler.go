@@ -23,6 +23,7 @@ import (
 	v1 "k8s.io/api/core/v1"
 
 	"github.com/vllm-project/aibrix/pkg/cache"
+	"github.com/vllm-project/aibrix/pkg/metrics"
 )
 
 type Scheduler interface {
@@ -30,20 +31,26 @@ type Scheduler interface {
 	SelectPod(ctx context.Context, model string, pods []v1.Pod) (*v1.Pod, error)
 }
 
-// NewScheduler leverages the factory method to choose the right scheduler
+// NewScheduler leverages the factory method to choose the right scheduler,
+// schedulers using pod metrics subscribe to them in the cache.
 func NewScheduler(policyName string, c cache.Cache) (Scheduler, error) {
+	var scheduler Scheduler
 	switch policyName {
 	case "random":
-		return NewRandomScheduler(c), nil
+		scheduler = NewRandomScheduler(c)
 	case "leastAdapters":
-		return NewLeastAdapters(c), nil
+		scheduler = NewLeastAdapters(c)
 	case "binPack":
-		return NewBinPackScheduler(c), nil
+		scheduler = NewBinPackScheduler(c)
 	case "leastLatency":
-		return NewLeastLatencyScheduler(c), nil
+		scheduler = NewLeastLatencyScheduler(c)
 	case "leastThroughput":
-		return NewLeastThroughputScheduler(c), nil
+		scheduler = NewLeastThroughputScheduler(c)
 	default:
 		return nil, errors.New("unknown scheduler policy")
 	}
+	if subscriber, ok := scheduler.(metrics.MetricSubscriber); ok {
+		c.AddSubscriber(subscriber)
+	}
+	return scheduler, nil
 }
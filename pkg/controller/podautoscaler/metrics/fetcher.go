@@ -25,6 +25,7 @@ import (
 	"strings"
 
 	autoscalingv1alpha1 "github.com/vllm-project/aibrix/api/autoscaling/v1alpha1"
+	aibrixmetrics "github.com/vllm-project/aibrix/pkg/metrics"
 
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -80,28 +81,62 @@ func NewRestMetricsFetcher() *RestMetricsFetcher {
 }
 
 func (f *RestMetricsFetcher) FetchPodMetrics(ctx context.Context, pod v1.Pod, source autoscalingv1alpha1.MetricSource) (float64, error) {
+	endpoint := fmt.Sprintf("%s:%s", pod.Status.PodIP, source.Port)
+	// canonical metric names are translated by the engine profile of pods labeled with their engine
+	if _, canonical := aibrixmetrics.Metrics[source.TargetMetric]; canonical && pod.Labels[aibrixmetrics.EngineIdentifier] != "" {
+		engine := pod.Labels[aibrixmetrics.EngineIdentifier]
+		if rawMetric, ok := aibrixmetrics.GetEngineProfile(engine).RawMetric(source.TargetMetric); ok {
+			body, err := f.fetchBody(ctx, source.ProtocolType, endpoint, source.Path)
+			if err != nil || body == nil {
+				return 0.0, err
+			}
+			metricValue, err := rawMetric.ParseValueFromBody(body)
+			if err != nil {
+				return 0.0, fmt.Errorf("failed to parse metrics from pod %s: %v", pod.Name, err)
+			}
+			return metricValue, nil
+		}
+	}
 	// Use /metrics to fetch pod's endpoint
-	return f.FetchMetric(ctx, source.ProtocolType, fmt.Sprintf("%s:%s", pod.Status.PodIP, source.Port), source.Path, source.TargetMetric)
+	return f.FetchMetric(ctx, source.ProtocolType, endpoint, source.Path, source.TargetMetric)
 }
 
 func (f *RestMetricsFetcher) FetchMetric(ctx context.Context, protocol autoscalingv1alpha1.ProtocolType, endpoint, path, metricName string) (float64, error) {
+	url := f._get_url(protocol, endpoint, path)
+	body, err := f.fetchBody(ctx, protocol, endpoint, path)
+	if err != nil || body == nil {
+		return 0.0, err
+	}
+
+	metricValue, err := ParseMetricFromBody(body, metricName)
+	if err != nil {
+		return 0.0, fmt.Errorf("failed to parse metrics from source %s: %v", url, err)
+	}
+
+	klog.V(4).InfoS("Successfully parsed metrics", "metric", metricName, "source", url, "metricValue", metricValue)
+
+	return metricValue, nil
+}
+
+// fetchBody returns the response body of the endpoint, nil in unit tests setting the url.
+func (f *RestMetricsFetcher) fetchBody(ctx context.Context, protocol autoscalingv1alpha1.ProtocolType, endpoint, path string) ([]byte, error) {
 	// Use http to fetch endpoint
-	url := fmt.Sprintf("%s://%s/%s", protocol, endpoint, strings.TrimLeft(path, "/"))
+	url := f._get_url(protocol, endpoint, path)
 	if f.test_url_setter != nil {
 		f.test_url_setter(url)
-		return 0.0, nil
+		return nil, nil
 	}
 
 	// Create request with context, so that the request will be canceled if the context is canceled
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		return 0.0, fmt.Errorf("failed to create request to source %s: %v", url, err)
+		return nil, fmt.Errorf("failed to create request to source %s: %v", url, err)
 	}
 
 	// Send the request using the default client
 	resp, err := f.client.Do(req)
 	if err != nil {
-		return 0.0, fmt.Errorf("failed to fetch metrics from source %s: %v", url, err)
+		return nil, fmt.Errorf("failed to fetch metrics from source %s: %v", url, err)
 	}
 	defer func() {
 		if err := resp.Body.Close(); err != nil {
@@ -111,17 +146,9 @@ func (f *RestMetricsFetcher) FetchMetric(ctx context.Context, protocol autoscali
 	}()
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return 0.0, fmt.Errorf("failed to read response from source %s: %v", url, err)
+		return nil, fmt.Errorf("failed to read response from source %s: %v", url, err)
 	}
-
-	metricValue, err := ParseMetricFromBody(body, metricName)
-	if err != nil {
-		return 0.0, fmt.Errorf("failed to parse metrics from source %s: %v", url, err)
-	}
-
-	klog.V(4).InfoS("Successfully parsed metrics", "metric", metricName, "source", url, "metricValue", metricValue)
-
-	return metricValue, nil
+	return body, nil
 }
 
 func (f *RestMetricsFetcher) _get_url(protocol autoscalingv1alpha1.ProtocolType, endpoint, path string) string {
@@ -17,7 +17,6 @@ limitations under the License.
 package metadata
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
@@ -34,24 +33,32 @@ type httpServer struct {
 	cache       cache.Cache
 }
 
-func NewHTTPServer(addr string, redis *redis.Client) *http.Server {
-	c, err := cache.Get()
-	if err != nil {
-		panic(err)
-	}
-
+func NewHTTPServer(addr string, redis *redis.Client, c cache.Cache) *http.Server {
 	server := &httpServer{
 		redisClient: redis,
 		cache:       c,
 	}
 	r := mux.NewRouter()
 	// User related handlers
-	r.HandleFunc("/CreateUser", server.createUser).Methods("POST")
-	r.HandleFunc("/ReadUser", server.readUser).Methods("POST")
-	r.HandleFunc("/UpdateUser", server.updateUser).Methods("POST")
-	r.HandleFunc("/DeleteUser", server.deleteUser).Methods("POST")
+	r.HandleFunc("/v1/users", server.listUsers).Methods("GET")
+	r.HandleFunc("/v1/users", server.postUser).Methods("POST")
+	r.HandleFunc("/v1/users/{name}", server.getUser).Methods("GET")
+	r.HandleFunc("/v1/users/{name}", server.putUser).Methods("PUT")
+	r.HandleFunc("/v1/users/{name}", server.patchUser).Methods("PATCH")
+	r.HandleFunc("/v1/users/{name}", server.removeUser).Methods("DELETE")
+	// Deprecated user related handlers, superseded by the /v1/users resource
+	r.HandleFunc("/CreateUser", deprecated("/v1/users", server.createUser)).Methods("POST")
+	r.HandleFunc("/ReadUser", deprecated("/v1/users/{name}", server.readUser)).Methods("POST")
+	r.HandleFunc("/UpdateUser", deprecated("/v1/users/{name}", server.updateUser)).Methods("POST")
+	r.HandleFunc("/DeleteUser", deprecated("/v1/users/{name}", server.deleteUser)).Methods("POST")
+	// OpenAPI specification of the API
+	r.HandleFunc(OpenAPIPath, openAPI).Methods("GET")
 	// OpenAI API related handlers
 	r.HandleFunc("/v1/models", server.models).Methods("GET")
+	// model names may contain slashes, e.g. namespaced models and HuggingFace model ids
+	r.HandleFunc("/v1/models/{model:.+}", server.model).Methods("GET")
+	// Cache introspection handler for debugging
+	r.Handle(cache.DebugPath, cache.NewDebugHandler(c)).Methods("GET")
 
 	return &http.Server{
 		Addr:    addr,
@@ -59,17 +66,85 @@ func NewHTTPServer(addr string, redis *redis.Client) *http.Server {
 	}
 }
 
-// models returns base and lora adapters registered to aibrix control plane
+// models returns base and lora adapters registered to aibrix control plane, which the caller is allowed to list
 func (s *httpServer) models(w http.ResponseWriter, r *http.Request) {
-	modelNames := s.cache.ListModels()
-	response := BuildModelsResponse(modelNames)
-	jsonBytes, err := json.Marshal(response)
+	user, ok := s.caller(w, r)
+	if !ok {
+		return
+	}
+
+	var models []*cache.ModelInfo
+	for _, modelName := range s.cache.ListModels() {
+		if !user.AllowsModel(modelName) {
+			continue
+		}
+		// the model may be deleted since it was listed
+		model, err := s.cache.GetModelInfo(modelName)
+		if err != nil {
+			continue
+		}
+		models = append(models, model)
+	}
+	writeJSON(w, http.StatusOK, BuildModelsResponse(models))
+}
+
+// model returns a base model or lora adapter registered to aibrix control plane, if the caller is allowed to list it
+func (s *httpServer) model(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.caller(w, r)
+	if !ok {
+		return
+	}
+
+	modelName := mux.Vars(r)["model"]
+	// models the caller is not allowed to list are not found, like models which do not exist
+	if !user.AllowsModel(modelName) {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("model %s does not exist", modelName))
+		return
+	}
+	model, err := s.cache.GetModelInfo(modelName)
 	if err != nil {
-		http.Error(w, "error in processing model list", http.StatusInternalServerError)
+		writeError(w, http.StatusNotFound, fmt.Sprintf("model %s does not exist", modelName))
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	fmt.Fprintf(w, "%s", string(jsonBytes))
+	writeJSON(w, http.StatusOK, BuildModelInfo(model))
+}
+
+// caller returns the user named by the user header of the request, or a user allowed to list all models if the
+// header is not set. The header is not authenticated, so the models of the user filter the listing but are not
+// access control. It writes the error response and returns false if the user cannot be read.
+func (s *httpServer) caller(w http.ResponseWriter, r *http.Request) (utils.User, bool) {
+	username := r.Header.Get("user")
+	if username == "" {
+		return utils.User{}, true
+	}
+
+	user, err := utils.GetUser(r.Context(), utils.User{Name: username}, s.redisClient)
+	if errors.Is(err, redis.Nil) {
+		writeError(w, http.StatusUnauthorized, fmt.Sprintf("user %s does not exist", username))
+		return utils.User{}, false
+	}
+	if err != nil {
+		klog.ErrorS(err, "unable to read user", "username", username)
+		writeError(w, http.StatusInternalServerError, "error in reading user")
+		return utils.User{}, false
+	}
+	return user, true
+}
+
+// deprecated marks the responses of a deprecated handler and links to the endpoint superseding it
+func deprecated(successor string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		klog.V(4).InfoS("deprecated endpoint called", "path", r.URL.Path, "successor", successor)
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", successor))
+		handler(w, r)
+	}
+}
+
+// openAPI returns the OpenAPI specification of the API
+func openAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/yaml")
+	_, _ = w.Write(openAPISpec)
 }
 
 func (s *httpServer) createUser(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,84 @@
+/*
+Copyright 2025 The Aibrix Team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/vllm-project/aibrix/pkg/cache"
+	"github.com/vllm-project/aibrix/pkg/cache/cachetest"
+	"github.com/vllm-project/aibrix/pkg/utils"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestModelsHandler(t *testing.T) {
+	redisServer := miniredis.RunT(t)
+	redisClient := redis.NewClient(&redis.Options{Addr: redisServer.Addr()})
+	assert.NoError(t, utils.SetUser(context.Background(), utils.User{Name: "alice", Models: []string{"meta-llama/Llama-3.1-8B"}}, redisClient))
+
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "p1", Namespace: "team-a"},
+		Status:     v1.PodStatus{Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionTrue}}},
+	}
+	c := cachetest.New().AddPod(pod, "meta-llama/Llama-3.1-8B", "lora-1").
+		SetModelInfo(&cache.ModelInfo{Name: "lora-1", Owner: "team-a", Parent: "meta-llama/Llama-3.1-8B", ReadyReplicas: 1})
+	handler := NewHTTPServer(":0", redisClient, c).Handler
+
+	get := func(path, user string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if user != "" {
+			req.Header.Set("user", user)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	recorder := get("/v1/models", "")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	var list ModelListResponse
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &list))
+	assert.Len(t, list.Data, 2)
+	assert.Equal(t, "lora-1", list.Data[0].ID)
+	assert.Equal(t, "meta-llama/Llama-3.1-8B", list.Data[0].Parent)
+	assert.Equal(t, "team-a", list.Data[0].OwnedBy)
+
+	// the models are filtered by the models the user is allowed to list
+	recorder = get("/v1/models", "alice")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &list))
+	assert.Len(t, list.Data, 1)
+	assert.Equal(t, "meta-llama/Llama-3.1-8B", list.Data[0].ID)
+	assert.Equal(t, 1, list.Data[0].ReadyReplicas)
+	assert.Equal(t, http.StatusUnauthorized, get("/v1/models", "bob").Code)
+
+	recorder = get("/v1/models/meta-llama/Llama-3.1-8B", "alice")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	var model ModelInfo
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &model))
+	assert.Equal(t, "meta-llama/Llama-3.1-8B", model.ID)
+	assert.Equal(t, http.StatusNotFound, get("/v1/models/lora-1", "alice").Code)
+	assert.Equal(t, http.StatusNotFound, get("/v1/models/lora-2", "").Code)
+}
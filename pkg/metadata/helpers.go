@@ -25,7 +25,6 @@ import (
 	"strings"
 
 	"github.com/go-playground/validator/v10"
-	"github.com/vllm-project/aibrix/pkg/utils"
 )
 
 type malformedRequest struct {
@@ -37,11 +36,11 @@ func (mr *malformedRequest) Error() string {
 	return mr.msg
 }
 
-func decodeJSONBody(w http.ResponseWriter, r *http.Request, dst *utils.User) error {
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, dst interface{}) error {
 	ct := r.Header.Get("Content-Type")
 	if ct != "" {
 		mediaType := strings.ToLower(strings.TrimSpace(strings.Split(ct, ";")[0]))
-		if mediaType != "application/json" {
+		if mediaType != "application/json" && mediaType != "application/merge-patch+json" {
 			msg := "Content-Type header is not application/json"
 			return &malformedRequest{status: http.StatusUnsupportedMediaType, msg: msg}
 		}
@@ -52,7 +51,7 @@ func decodeJSONBody(w http.ResponseWriter, r *http.Request, dst *utils.User) err
 	dec := json.NewDecoder(r.Body)
 	dec.DisallowUnknownFields()
 
-	err := dec.Decode(&dst)
+	err := dec.Decode(dst)
 	if err != nil {
 		var syntaxError *json.SyntaxError
 		var unmarshalTypeError *json.UnmarshalTypeError
@@ -95,5 +94,33 @@ func decodeJSONBody(w http.ResponseWriter, r *http.Request, dst *utils.User) err
 	}
 
 	validate := validator.New()
-	return validate.Struct(dst)
+	if err := validate.Struct(dst); err != nil {
+		return &malformedRequest{status: http.StatusBadRequest, msg: err.Error()}
+	}
+	return nil
+}
+
+// writeJSON writes the response as JSON with the status code.
+func writeJSON(w http.ResponseWriter, status int, response interface{}) {
+	jsonBytes, err := json.Marshal(response)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "error in processing response")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "%s", string(jsonBytes))
+}
+
+// writeError writes an OpenAI compatible error response.
+func writeError(w http.ResponseWriter, status int, message string) {
+	jsonBytes, _ := json.Marshal(map[string]interface{}{
+		"error": map[string]interface{}{
+			"message": message,
+			"code":    status,
+		},
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "%s", string(jsonBytes))
 }
@@ -16,12 +16,21 @@ limitations under the License.
 
 package metadata
 
+import (
+	"sort"
+
+	"github.com/vllm-project/aibrix/pkg/cache"
+)
+
 // ModelInfo represents the information about a single model
 type ModelInfo struct {
-	ID      string `json:"id"`
-	Created int64  `json:"created"`
-	Object  string `json:"object"`
-	OwnedBy string `json:"owned_by"`
+	ID            string `json:"id"`
+	Created       int64  `json:"created"`
+	Object        string `json:"object"`
+	OwnedBy       string `json:"owned_by"`
+	Parent        string `json:"parent,omitempty"`
+	MaxModelLen   int    `json:"max_model_len,omitempty"`
+	ReadyReplicas int    `json:"ready_replicas"`
 }
 
 // ModelListResponse represents the overall response structure
@@ -30,24 +39,38 @@ type ModelListResponse struct {
 	Data   []ModelInfo `json:"data"`
 }
 
-// BuildModelsResponse converts a list of model names to the target response type
-func BuildModelsResponse(modelNames []string) ModelListResponse {
+// BuildModelInfo converts the metadata of a model in the cache to the target response type
+func BuildModelInfo(model *cache.ModelInfo) ModelInfo {
+	modelInfo := ModelInfo{
+		ID:            model.Name,
+		Object:        "model",
+		OwnedBy:       model.Owner,
+		Parent:        model.Parent,
+		MaxModelLen:   model.MaxModelLen,
+		ReadyReplicas: model.ReadyReplicas,
+	}
+	if !model.CreationTime.IsZero() {
+		modelInfo.Created = model.CreationTime.Unix()
+	}
+	if modelInfo.OwnedBy == "" {
+		modelInfo.OwnedBy = "aibrix"
+	}
+	return modelInfo
+}
+
+// BuildModelsResponse converts the metadata of the models in the cache to the target response type, sorted by id
+func BuildModelsResponse(models []*cache.ModelInfo) ModelListResponse {
 	response := ModelListResponse{
 		Object: "list",
 		Data:   []ModelInfo{},
 	}
 
-	// Iterate over the model names and create ModelInfo objects
-	// ModelCard information is reserved at this moment. It is subject to change to be more aligned with OpenAI/vLLM API.
-	for _, model := range modelNames {
-		modelInfo := ModelInfo{
-			ID:      model,
-			Created: 0,
-			Object:  "model",
-			OwnedBy: "aibrix", // TODO: get model ownership from tenants annotations in future
-		}
-		response.Data = append(response.Data, modelInfo)
+	for _, model := range models {
+		response.Data = append(response.Data, BuildModelInfo(model))
 	}
+	sort.Slice(response.Data, func(i, j int) bool {
+		return response.Data[i].ID < response.Data[j].ID
+	})
 
 	return response
 }
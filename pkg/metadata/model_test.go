@@ -20,6 +20,8 @@ import (
 	"encoding/json"
 	"testing"
 	"time"
+
+	"github.com/vllm-project/aibrix/pkg/cache"
 )
 
 // generateExpectedJSON is a helper function to generate the expected JSON
@@ -52,13 +54,13 @@ func TestBuildModelsResponse(t *testing.T) {
 			name:           "Single model",
 			modelNames:     []string{"model1"},
 			expectedLength: 1,
-			expectedJSON:   `{"object":"list","data":[{"id":"model1","created":0,"object":"model","owned_by":"aibrix"}]}`,
+			expectedJSON:   `{"object":"list","data":[{"id":"model1","created":0,"object":"model","owned_by":"aibrix","ready_replicas":0}]}`,
 		},
 		{
 			name:           "Multiple models",
 			modelNames:     []string{"model1", "model2", "model3"},
 			expectedLength: 3,
-			expectedJSON:   `{"object":"list","data":[{"id":"model1","created":0,"object":"model","owned_by":"aibrix"},{"id":"model2","created":0,"object":"model","owned_by":"aibrix"},{"id":"model3","created":0,"object":"model","owned_by":"aibrix"}]}`,
+			expectedJSON:   `{"object":"list","data":[{"id":"model1","created":0,"object":"model","owned_by":"aibrix","ready_replicas":0},{"id":"model2","created":0,"object":"model","owned_by":"aibrix","ready_replicas":0},{"id":"model3","created":0,"object":"model","owned_by":"aibrix","ready_replicas":0}]}`,
 		},
 		{
 			name:           "Empty list",
@@ -70,7 +72,11 @@ func TestBuildModelsResponse(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			response := BuildModelsResponse(tc.modelNames)
+			var models []*cache.ModelInfo
+			for _, model := range tc.modelNames {
+				models = append(models, &cache.ModelInfo{Name: model})
+			}
+			response := BuildModelsResponse(models)
 			jsonBytes, err := json.Marshal(response)
 			if err != nil {
 				t.Fatalf("Error marshaling response: %v", err)
@@ -104,3 +110,22 @@ func TestBuildModelsResponse(t *testing.T) {
 		})
 	}
 }
+
+func TestBuildModelInfo(t *testing.T) {
+	model := &cache.ModelInfo{
+		Name:          "team-a/lora-1",
+		CreationTime:  time.Unix(1700000000, 0),
+		Owner:         "team-a",
+		Parent:        "team-a/llama-8b",
+		MaxModelLen:   8192,
+		ReadyReplicas: 2,
+	}
+	jsonBytes, err := json.Marshal(BuildModelInfo(model))
+	if err != nil {
+		t.Fatalf("Error marshaling model: %v", err)
+	}
+	expectedJSON := `{"id":"team-a/lora-1","created":1700000000,"object":"model","owned_by":"team-a","parent":"team-a/llama-8b","max_model_len":8192,"ready_replicas":2}`
+	if string(jsonBytes) != expectedJSON {
+		t.Errorf("expected JSON: %s, but got: %s", expectedJSON, string(jsonBytes))
+	}
+}
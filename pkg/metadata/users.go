@@ -0,0 +1,217 @@
+/*
+Copyright 2025 The Aibrix Team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metadata
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/redis/go-redis/v9"
+	"github.com/vllm-project/aibrix/pkg/utils"
+	"k8s.io/klog/v2"
+)
+
+const (
+	defaultUserListLimit = 20
+	maxUserListLimit     = 100
+)
+
+// UserListResponse is a page of users sorted by name. The next page starts after LastID if HasMore is true.
+type UserListResponse struct {
+	Object  string       `json:"object"`
+	Data    []utils.User `json:"data"`
+	FirstID string       `json:"first_id,omitempty"`
+	LastID  string       `json:"last_id,omitempty"`
+	HasMore bool         `json:"has_more"`
+}
+
+// userPatch is the body of a user patch, the fields not set are kept.
+type userPatch struct {
+	Rpm    *int64    `json:"rpm"`
+	Tpm    *int64    `json:"tpm"`
+	Models *[]string `json:"models"`
+}
+
+// listUsers returns a page of the users, the limit and after query parameters select the page
+func (s *httpServer) listUsers(w http.ResponseWriter, r *http.Request) {
+	limit := defaultUserListLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > maxUserListLimit {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxUserListLimit))
+			return
+		}
+	}
+
+	users, hasMore, err := utils.ListUsers(r.Context(), r.URL.Query().Get("after"), limit, s.redisClient)
+	if err != nil {
+		klog.ErrorS(err, "unable to list users")
+		writeError(w, http.StatusInternalServerError, "error in listing users")
+		return
+	}
+	response := UserListResponse{Object: "list", Data: users, HasMore: hasMore}
+	if len(users) > 0 {
+		response.FirstID, response.LastID = users[0].Name, users[len(users)-1].Name
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// postUser creates a user, which must not exist
+func (s *httpServer) postUser(w http.ResponseWriter, r *http.Request) {
+	var u utils.User
+	if !decodeUser(w, r, &u) {
+		return
+	}
+
+	err := utils.CreateUser(r.Context(), u, s.redisClient)
+	if errors.Is(err, utils.ErrUserExists) {
+		writeError(w, http.StatusConflict, fmt.Sprintf("user %s already exists", u.Name))
+		return
+	}
+	if err != nil {
+		klog.ErrorS(err, "unable to create user", "username", u.Name)
+		writeError(w, http.StatusInternalServerError, "error in creating user")
+		return
+	}
+	w.Header().Set("Location", "/v1/users/"+u.Name)
+	writeJSON(w, http.StatusCreated, u)
+}
+
+// getUser returns a user
+func (s *httpServer) getUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.lookupUser(w, r, mux.Vars(r)["name"])
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, user)
+}
+
+// putUser replaces a user, whose name in the body is optional but must match the path
+func (s *httpServer) putUser(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	u := utils.User{Name: name}
+	if !decodeUser(w, r, &u) {
+		return
+	}
+	if u.Name != name {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("user name %s does not match the path", u.Name))
+		return
+	}
+	if _, ok := s.lookupUser(w, r, name); !ok {
+		return
+	}
+
+	s.storeUser(w, r, u)
+}
+
+// patchUser updates the rpm, tpm and models of a user set in the body
+func (s *httpServer) patchUser(w http.ResponseWriter, r *http.Request) {
+	var patch userPatch
+	if err := decodeJSONBody(w, r, &patch); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+	user, ok := s.lookupUser(w, r, mux.Vars(r)["name"])
+	if !ok {
+		return
+	}
+
+	if patch.Rpm != nil {
+		user.Rpm = *patch.Rpm
+	}
+	if patch.Tpm != nil {
+		user.Tpm = *patch.Tpm
+	}
+	if patch.Models != nil {
+		user.Models = *patch.Models
+	}
+	if err := user.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.storeUser(w, r, user)
+}
+
+// removeUser deletes a user
+func (s *httpServer) removeUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.lookupUser(w, r, mux.Vars(r)["name"])
+	if !ok {
+		return
+	}
+
+	if err := utils.DelUser(r.Context(), user, s.redisClient); err != nil {
+		klog.ErrorS(err, "unable to delete user", "username", user.Name)
+		writeError(w, http.StatusInternalServerError, "error in deleting user")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// lookupUser returns the user of the name. It writes the error response and returns false if the user does not
+// exist or cannot be read.
+func (s *httpServer) lookupUser(w http.ResponseWriter, r *http.Request, name string) (utils.User, bool) {
+	user, err := utils.GetUser(r.Context(), utils.User{Name: name}, s.redisClient)
+	if errors.Is(err, redis.Nil) {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("user %s does not exist", name))
+		return utils.User{}, false
+	}
+	if err != nil {
+		klog.ErrorS(err, "unable to read user", "username", name)
+		writeError(w, http.StatusInternalServerError, "error in reading user")
+		return utils.User{}, false
+	}
+	return user, true
+}
+
+// storeUser stores the user and writes it as the response.
+func (s *httpServer) storeUser(w http.ResponseWriter, r *http.Request, u utils.User) {
+	if err := utils.SetUser(r.Context(), u, s.redisClient); err != nil {
+		klog.ErrorS(err, "unable to update user", "username", u.Name)
+		writeError(w, http.StatusInternalServerError, "error in updating user")
+		return
+	}
+	writeJSON(w, http.StatusOK, u)
+}
+
+// decodeUser decodes and validates the user in the body. It writes the error response and returns false if the
+// user is invalid.
+func decodeUser(w http.ResponseWriter, r *http.Request, u *utils.User) bool {
+	if err := decodeJSONBody(w, r, u); err != nil {
+		writeDecodeError(w, err)
+		return false
+	}
+	if err := u.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return false
+	}
+	return true
+}
+
+// writeDecodeError writes the error response of a request body which cannot be decoded.
+func writeDecodeError(w http.ResponseWriter, err error) {
+	var mr *malformedRequest
+	if errors.As(err, &mr) {
+		writeError(w, mr.status, mr.msg)
+		return
+	}
+	klog.Info(err.Error())
+	writeError(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2025 The Aibrix Team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metadata
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/vllm-project/aibrix/pkg/cache/cachetest"
+	"github.com/vllm-project/aibrix/pkg/utils"
+	"sigs.k8s.io/yaml"
+)
+
+func TestUsersHandler(t *testing.T) {
+	redisServer := miniredis.RunT(t)
+	redisClient := redis.NewClient(&redis.Options{Addr: redisServer.Addr()})
+	handler := NewHTTPServer(":0", redisClient, cachetest.New()).Handler
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		return recorder
+	}
+	decodeUser := func(recorder *httptest.ResponseRecorder) utils.User {
+		var user utils.User
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &user))
+		return user
+	}
+
+	recorder := do(http.MethodPost, "/v1/users", `{"name":"alice","rpm":100,"tpm":1000}`)
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+	assert.Equal(t, "/v1/users/alice", recorder.Header().Get("Location"))
+	assert.Equal(t, utils.User{Name: "alice", Rpm: 100, Tpm: 1000}, decodeUser(recorder))
+	assert.Equal(t, http.StatusConflict, do(http.MethodPost, "/v1/users", `{"name":"alice"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/v1/users", `{"rpm":100}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/v1/users", `{"name":"bob","rpm":-1}`).Code)
+	assert.Equal(t, http.StatusCreated, do(http.MethodPost, "/v1/users", `{"name":"bob"}`).Code)
+	assert.Equal(t, http.StatusCreated, do(http.MethodPost, "/v1/users", `{"name":"carol"}`).Code)
+
+	recorder = do(http.MethodGet, "/v1/users/alice", "")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "alice", decodeUser(recorder).Name)
+	recorder = do(http.MethodGet, "/v1/users/dave", "")
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	assert.JSONEq(t, `{"error":{"message":"user dave does not exist","code":404}}`, recorder.Body.String())
+
+	// users are listed by pages sorted by name
+	var list UserListResponse
+	recorder = do(http.MethodGet, "/v1/users?limit=2", "")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &list))
+	assert.Len(t, list.Data, 2)
+	assert.Equal(t, "alice", list.FirstID)
+	assert.Equal(t, "bob", list.LastID)
+	assert.True(t, list.HasMore)
+	recorder = do(http.MethodGet, "/v1/users?limit=2&after="+list.LastID, "")
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &list))
+	assert.Len(t, list.Data, 1)
+	assert.Equal(t, "carol", list.Data[0].Name)
+	assert.False(t, list.HasMore)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodGet, "/v1/users?limit=0", "").Code)
+
+	recorder = do(http.MethodPut, "/v1/users/bob", `{"rpm":10,"models":["llama-8b"]}`)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, utils.User{Name: "bob", Rpm: 10, Models: []string{"llama-8b"}}, decodeUser(recorder))
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPut, "/v1/users/bob", `{"name":"carol"}`).Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPut, "/v1/users/dave", `{}`).Code)
+
+	recorder = do(http.MethodPatch, "/v1/users/bob", `{"tpm":500}`)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, utils.User{Name: "bob", Rpm: 10, Tpm: 500, Models: []string{"llama-8b"}}, decodeUser(recorder))
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPatch, "/v1/users/bob", `{"rpm":-1}`).Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPatch, "/v1/users/dave", `{"rpm":1}`).Code)
+
+	assert.Equal(t, http.StatusNoContent, do(http.MethodDelete, "/v1/users/bob", "").Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodDelete, "/v1/users/bob", "").Code)
+
+	// the deprecated endpoints still work and link to their successor
+	recorder = do(http.MethodPost, "/ReadUser", `{"name":"alice"}`)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "true", recorder.Header().Get("Deprecation"))
+	assert.Contains(t, recorder.Header().Get("Link"), "/v1/users/{name}")
+}
+
+func TestOpenAPIHandler(t *testing.T) {
+	handler := NewHTTPServer(":0", nil, cachetest.New()).Handler
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, OpenAPIPath, nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	var spec struct {
+		Paths map[string]interface{} `json:"paths"`
+	}
+	assert.NoError(t, yaml.Unmarshal(recorder.Body.Bytes(), &spec))
+	assert.Contains(t, spec.Paths, "/v1/users")
+	assert.Contains(t, spec.Paths, "/v1/users/{name}")
+	assert.Contains(t, spec.Paths, "/v1/models")
+	assert.Contains(t, spec.Paths, "/v1/models/{model}")
+}
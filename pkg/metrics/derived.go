@@ -0,0 +1,98 @@
+/*
+Copyright 2024 The Aibrix Team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"fmt"
+	"time"
+)
+
+// DerivationFunction defines how a derived metric is computed from the window of its source metric.
+type DerivationFunction string
+
+const (
+	// DerivationMean is the mean of the observations of a histogram in the window.
+	DerivationMean DerivationFunction = "Mean"
+	// DerivationPercentile is a percentile of the observations of a histogram in the window.
+	DerivationPercentile DerivationFunction = "Percentile"
+	// DerivationRatePerMinute is the increase of a counter per minute in the window.
+	DerivationRatePerMinute DerivationFunction = "RatePerMinute"
+)
+
+// Derivation computes a metric in-process from the samples of a raw metric, as an alternative to its PromQL query.
+type Derivation struct {
+	Source     string // Canonical name of the raw metric
+	Function   DerivationFunction
+	Percentile float64 // Optional: Only applicable for DerivationPercentile
+	Window     time.Duration
+}
+
+// MetricWindow is the earliest and the latest sample of a metric in a window.
+type MetricWindow struct {
+	Earliest MetricValue
+	Latest   MetricValue
+	Elapsed  time.Duration
+}
+
+// Compute derives the metric from the windows of its source metric, e.g. of the models of a pod for a pod
+// scope metric. Counter and histogram resets in a window are handled like in Prometheus.
+func (d *Derivation) Compute(windows []MetricWindow) (float64, error) {
+	if len(windows) == 0 {
+		return 0, fmt.Errorf("no samples of %s", d.Source)
+	}
+
+	switch d.Function {
+	case DerivationRatePerMinute:
+		var increase float64
+		var elapsed time.Duration
+		for _, window := range windows {
+			delta := window.Latest.GetSimpleValue() - window.Earliest.GetSimpleValue()
+			if delta < 0 {
+				delta = window.Latest.GetSimpleValue()
+			}
+			increase += delta
+			elapsed = max(elapsed, window.Elapsed)
+		}
+		if elapsed <= 0 {
+			return 0, fmt.Errorf("window of %s is empty", d.Source)
+		}
+		return increase / elapsed.Minutes(), nil
+	case DerivationMean, DerivationPercentile:
+		observations := &HistogramMetricValue{Buckets: map[string]float64{}}
+		for _, window := range windows {
+			latest := window.Latest.GetHistogramValue()
+			if latest == nil {
+				return 0, fmt.Errorf("metric %s is not a histogram", d.Source)
+			}
+			delta := latest.Delta(window.Earliest.GetHistogramValue())
+			observations.Sum += delta.Sum
+			observations.Count += delta.Count
+			for bound, count := range delta.Buckets {
+				observations.Buckets[bound] += count
+			}
+		}
+		if observations.Count == 0 {
+			return 0, fmt.Errorf("no observation of %s in the window", d.Source)
+		}
+		if d.Function == DerivationMean {
+			return observations.GetMean(), nil
+		}
+		return observations.GetPercentile(d.Percentile)
+	default:
+		return 0, fmt.Errorf("derivation function %s is not supported", d.Function)
+	}
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2024 The Aibrix Team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDerivationCompute(t *testing.T) {
+	histogramWindow := func(earlierFast, fast, slow float64) MetricWindow {
+		return MetricWindow{
+			Earliest: &HistogramMetricValue{Sum: earlierFast * 0.1, Count: earlierFast,
+				Buckets: map[string]float64{"0.1": earlierFast, "1.0": earlierFast, "+Inf": earlierFast}},
+			Latest: &HistogramMetricValue{Sum: fast*0.1 + slow, Count: fast + slow,
+				Buckets: map[string]float64{"0.1": fast, "1.0": fast + slow, "+Inf": fast + slow}},
+			Elapsed: time.Minute,
+		}
+	}
+	// two models of a pod observed 10 fast requests and 10 slow requests in the window
+	windows := []MetricWindow{histogramWindow(100, 110, 0), histogramWindow(50, 50, 10)}
+
+	mean, err := Metrics[AvgTTFT5mPod].Derivation.Compute(windows)
+	assert.NoError(t, err)
+	assert.InDelta(t, 0.55, mean, 1e-9)
+	p95, err := Metrics[P95TTFT5mPod].Derivation.Compute(windows)
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, p95)
+	_, err = Metrics[P95TTFT5mPod].Derivation.Compute([]MetricWindow{histogramWindow(100, 100, 0)})
+	assert.Error(t, err)
+
+	rate, err := Metrics[AvgRequestsPerMinPod].Derivation.Compute([]MetricWindow{
+		{Earliest: &SimpleMetricValue{Value: 10}, Latest: &SimpleMetricValue{Value: 40}, Elapsed: 2 * time.Minute},
+		// the counter was reset in the window
+		{Earliest: &SimpleMetricValue{Value: 100}, Latest: &SimpleMetricValue{Value: 10}, Elapsed: 2 * time.Minute},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 20.0, rate)
+
+	_, err = Metrics[AvgRequestsPerMinPod].Derivation.Compute(nil)
+	assert.Error(t, err)
+	_, err = Metrics[AvgTTFT5mPod].Derivation.Compute([]MetricWindow{
+		{Earliest: &SimpleMetricValue{}, Latest: &SimpleMetricValue{}, Elapsed: time.Minute}})
+	assert.Error(t, err)
+}
+
+func TestPromQLMetricsAreDerived(t *testing.T) {
+	for name, metric := range Metrics {
+		if metric.MetricType.Query != PromQL {
+			continue
+		}
+		if assert.NotNil(t, metric.Derivation, name) {
+			source, ok := Metrics[metric.Derivation.Source]
+			assert.True(t, ok, name)
+			assert.Equal(t, PodRawMetrics, source.MetricSource, name)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+/*
+Copyright 2024 The Aibrix Team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// EngineIdentifier is the pod label selecting the engine profile which translates the metrics of the pod,
+// pods without the label or with an unknown engine use the vLLM profile.
+const EngineIdentifier = "model.aibrix.ai/engine"
+
+const (
+	EngineVLLM        = "vllm"
+	EngineSGLang      = "sglang"
+	EngineTensorRTLLM = "tensorrt-llm"
+	EngineTGI         = "tgi"
+)
+
+// EngineMetric is the raw metric of an engine for a canonical metric.
+type EngineMetric struct {
+	// Name is the raw metric name, including the engine prefix.
+	Name string
+	// Labels selects the series of the raw metric, e.g. one request type of a metric of all request types.
+	Labels map[string]string
+	// Scale converts the raw value to the unit of the canonical metric, e.g. 0.001 for milliseconds, 0 is 1.
+	Scale float64
+}
+
+// EngineProfile translates the metric names, label keys and units of an engine to the canonical metrics.
+type EngineProfile struct {
+	Name string
+	// Prefix is prepended to canonical metric names not in Metrics, empty if the engine only exports the metrics in Metrics.
+	Prefix string
+	// ModelLabel is the label key of the model name, empty if the engine has no model label and the model of the pod is used.
+	ModelLabel string
+	// Metrics maps canonical metric names to the raw metrics of the engine.
+	Metrics map[string]EngineMetric
+}
+
+// EngineProfiles are the built-in engine profiles by engine name.
+var EngineProfiles = map[string]*EngineProfile{
+	EngineVLLM: {
+		Name:       EngineVLLM,
+		Prefix:     "vllm:",
+		ModelLabel: "model_name",
+	},
+	EngineSGLang: {
+		Name:       EngineSGLang,
+		ModelLabel: "model_name",
+		Metrics: map[string]EngineMetric{
+			NumRequestsRunning:              {Name: "sglang:num_running_reqs"},
+			NumRequestsWaiting:              {Name: "sglang:num_queue_reqs"},
+			AvgGenerationThroughputToksPerS: {Name: "sglang:gen_throughput"},
+			GPUCacheUsagePerc:               {Name: "sglang:token_usage"},
+			TimeToFirstTokenSeconds:         {Name: "sglang:time_to_first_token_seconds"},
+			TimePerOutputTokenSeconds:       {Name: "sglang:time_per_output_token_seconds"},
+			E2ERequestLatencySeconds:        {Name: "sglang:e2e_request_latency_seconds"},
+			PromptTokensTotal:               {Name: "sglang:prompt_tokens_total"},
+			GenerationTokensTotal:           {Name: "sglang:generation_tokens_total"},
+		},
+	},
+	EngineTensorRTLLM: {
+		Name: EngineTensorRTLLM,
+		Metrics: map[string]EngineMetric{
+			NumRequestsRunning:      {Name: "nv_trt_llm_request_metrics", Labels: map[string]string{"request_type": "active"}},
+			NumRequestsWaiting:      {Name: "nv_trt_llm_request_metrics", Labels: map[string]string{"request_type": "waiting"}},
+			GPUCacheUsagePerc:       {Name: "nv_trt_llm_kv_cache_block_metrics", Labels: map[string]string{"kv_cache_block_type": "fraction"}},
+			TimeToFirstTokenSeconds: {Name: "nv_inference_first_response_histogram_ms", Scale: 0.001},
+		},
+	},
+	EngineTGI: {
+		Name: EngineTGI,
+		Metrics: map[string]EngineMetric{
+			NumRequestsRunning:          {Name: "tgi_batch_current_size"},
+			NumRequestsWaiting:          {Name: "tgi_queue_size"},
+			TimePerOutputTokenSeconds:   {Name: "tgi_request_mean_time_per_token_duration"},
+			E2ERequestLatencySeconds:    {Name: "tgi_request_duration"},
+			RequestQueueTimeSeconds:     {Name: "tgi_request_queue_duration"},
+			RequestInferenceTimeSeconds: {Name: "tgi_request_inference_duration"},
+			RequestPromptTokens:         {Name: "tgi_request_input_length"},
+			RequestGenerationTokens:     {Name: "tgi_request_generated_tokens"},
+			RequestSuccessTotal:         {Name: "tgi_request_success"},
+		},
+	},
+}
+
+// GetEngineProfile returns the profile of the engine, the vLLM profile if the engine is unknown.
+func GetEngineProfile(engine string) *EngineProfile {
+	if profile, ok := EngineProfiles[engine]; ok {
+		return profile
+	}
+	return EngineProfiles[EngineVLLM]
+}
+
+// RawMetric returns the raw metric of a canonical metric, false if the engine does not export it.
+func (p *EngineProfile) RawMetric(metricName string) (EngineMetric, bool) {
+	if metric, ok := p.Metrics[metricName]; ok {
+		return metric, true
+	}
+	if p.Prefix != "" {
+		return EngineMetric{Name: p.Prefix + metricName}, true
+	}
+	return EngineMetric{}, false
+}
+
+// Matches returns whether the series has the labels of the metric.
+func (m EngineMetric) Matches(metric *dto.Metric) bool {
+	for key, value := range m.Labels {
+		if labelValue, err := GetLabelValueForKey(metric, key); err != nil || labelValue != value {
+			return false
+		}
+	}
+	return true
+}
+
+// ScaleValue converts a raw counter or gauge value to the unit of the canonical metric.
+func (m EngineMetric) ScaleValue(value float64) float64 {
+	if m.Scale == 0 {
+		return value
+	}
+	return value * m.Scale
+}
+
+// ScaleHistogram converts the sum and the bucket bounds of a raw histogram to the unit of the canonical metric.
+func (m EngineMetric) ScaleHistogram(histogram *HistogramMetricValue) *HistogramMetricValue {
+	if m.Scale == 0 {
+		return histogram
+	}
+	scaled := &HistogramMetricValue{
+		Sum:     histogram.Sum * m.Scale,
+		Count:   histogram.Count,
+		Buckets: make(map[string]float64, len(histogram.Buckets)),
+	}
+	for bound, count := range histogram.Buckets {
+		if value, err := strconv.ParseFloat(bound, 64); err == nil && bound != "+Inf" {
+			bound = fmt.Sprintf("%f", value*m.Scale)
+		}
+		scaled.Buckets[bound] = count
+	}
+	return scaled
+}
+
+// ParseValueFromBody parses the counter or gauge value of the first series of the metric in a Prometheus
+// response body, converted to the unit of the canonical metric.
+func (m EngineMetric) ParseValueFromBody(body []byte) (float64, error) {
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("error parsing metric families: %v", err)
+	}
+	family, ok := families[m.Name]
+	if !ok {
+		return 0, fmt.Errorf("metrics %s not found", m.Name)
+	}
+	for _, metric := range family.Metric {
+		if !m.Matches(metric) {
+			continue
+		}
+		value, err := GetCounterGaugeValue(metric, family.GetType())
+		if err != nil {
+			return 0, err
+		}
+		return m.ScaleValue(value), nil
+	}
+	return 0, fmt.Errorf("metrics %s with labels %v not found", m.Name, m.Labels)
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2024 The Aibrix Team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEngineProfileRawMetric(t *testing.T) {
+	rawMetric, ok := GetEngineProfile("").RawMetric(GPUCacheUsagePerc)
+	assert.True(t, ok)
+	assert.Equal(t, "vllm:gpu_cache_usage_perc", rawMetric.Name)
+	rawMetric, ok = GetEngineProfile("unknown").RawMetric("lora_requests_info")
+	assert.True(t, ok)
+	assert.Equal(t, "vllm:lora_requests_info", rawMetric.Name)
+
+	rawMetric, ok = GetEngineProfile(EngineSGLang).RawMetric(NumRequestsWaiting)
+	assert.True(t, ok)
+	assert.Equal(t, "sglang:num_queue_reqs", rawMetric.Name)
+	_, ok = GetEngineProfile(EngineSGLang).RawMetric(NumRequestsSwapped)
+	assert.False(t, ok)
+}
+
+func TestEngineMetricParseValueFromBody(t *testing.T) {
+	body := []byte(`
+# TYPE nv_trt_llm_kv_cache_block_metrics gauge
+nv_trt_llm_kv_cache_block_metrics{kv_cache_block_type="max",model="tensorrt_llm"} 4096
+nv_trt_llm_kv_cache_block_metrics{kv_cache_block_type="fraction",model="tensorrt_llm"} 0.25
+`)
+	rawMetric, _ := GetEngineProfile(EngineTensorRTLLM).RawMetric(GPUCacheUsagePerc)
+	value, err := rawMetric.ParseValueFromBody(body)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.25, value)
+
+	_, err = EngineMetric{Name: "nv_trt_llm_kv_cache_block_metrics", Labels: map[string]string{"kv_cache_block_type": "used"}}.ParseValueFromBody(body)
+	assert.Error(t, err)
+	value, err = EngineMetric{Name: "nv_trt_llm_kv_cache_block_metrics", Scale: 0.5}.ParseValueFromBody(body)
+	assert.NoError(t, err)
+	assert.Equal(t, 2048.0, value)
+}
+
+func TestEngineMetricScaleHistogram(t *testing.T) {
+	rawMetric, _ := GetEngineProfile(EngineTensorRTLLM).RawMetric(TimeToFirstTokenSeconds)
+	histogram := rawMetric.ScaleHistogram(&HistogramMetricValue{
+		Sum:     1500,
+		Count:   2,
+		Buckets: map[string]float64{"500.000000": 1, "+Inf": 2},
+	})
+	assert.Equal(t, 1.5, histogram.Sum)
+	assert.Equal(t, 2.0, histogram.Count)
+	assert.Equal(t, map[string]float64{"0.500000": 1, "+Inf": 2}, histogram.Buckets)
+
+	unscaled := &HistogramMetricValue{Sum: 1}
+	assert.Same(t, unscaled, EngineMetric{}.ScaleHistogram(unscaled))
+}
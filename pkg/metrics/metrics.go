@@ -16,6 +16,8 @@ limitations under the License.
 
 package metrics
 
+import "time"
+
 const (
 	NumRequestsRunning                   = "num_requests_running"
 	NumRequestsWaiting                   = "num_requests_waiting"
@@ -30,6 +32,11 @@ const (
 	RequestInferenceTimeSeconds          = "request_inference_time_seconds"
 	RequestDecodeTimeSeconds             = "request_decode_time_seconds"
 	RequestPrefillTimeSeconds            = "request_prefill_time_seconds"
+	RequestPromptTokens                  = "request_prompt_tokens"
+	RequestGenerationTokens              = "request_generation_tokens"
+	RequestSuccessTotal                  = "request_success_total"
+	PromptTokensTotal                    = "prompt_tokens_total"
+	GenerationTokensTotal                = "generation_tokens_total"
 	P95TTFT5m                            = "p95_ttft_5m"
 	P95TTFT5mPod                         = "p95_ttft_5m_pod"
 	AvgTTFT5mPod                         = "avg_ttft_5m_pod"
@@ -158,6 +165,46 @@ var (
 			},
 			Description: "Request prefill time in seconds",
 		},
+		RequestPromptTokens: {
+			MetricScope:  PodModelMetricScope,
+			MetricSource: PodRawMetrics,
+			MetricType: MetricType{
+				Raw: Histogram,
+			},
+			Description: "Number of prompt tokens per request",
+		},
+		RequestGenerationTokens: {
+			MetricScope:  PodModelMetricScope,
+			MetricSource: PodRawMetrics,
+			MetricType: MetricType{
+				Raw: Histogram,
+			},
+			Description: "Number of generation tokens per request",
+		},
+		RequestSuccessTotal: {
+			MetricScope:  PodModelMetricScope,
+			MetricSource: PodRawMetrics,
+			MetricType: MetricType{
+				Raw: Counter,
+			},
+			Description: "Count of successfully processed requests",
+		},
+		PromptTokensTotal: {
+			MetricScope:  PodModelMetricScope,
+			MetricSource: PodRawMetrics,
+			MetricType: MetricType{
+				Raw: Counter,
+			},
+			Description: "Number of prefill tokens processed",
+		},
+		GenerationTokensTotal: {
+			MetricScope:  PodModelMetricScope,
+			MetricSource: PodRawMetrics,
+			MetricType: MetricType{
+				Raw: Counter,
+			},
+			Description: "Number of generation tokens processed",
+		},
 		// Query-based metrics
 		P95TTFT5m: {
 			MetricScope:  PodModelMetricScope,
@@ -166,6 +213,7 @@ var (
 				Query: PromQL,
 			},
 			PromQL:      `histogram_quantile(0.95, sum by(le) (rate(vllm:time_to_first_token_seconds_bucket{instance="${instance}", model_name="${model_name}", job="pods"}[5m])))`,
+			Derivation:  &Derivation{Source: TimeToFirstTokenSeconds, Function: DerivationPercentile, Percentile: 95, Window: 5 * time.Minute},
 			Description: "95th ttft in last 5 mins",
 		},
 		P95TTFT5mPod: {
@@ -175,6 +223,7 @@ var (
 				Query: PromQL,
 			},
 			PromQL:      `histogram_quantile(0.95, sum by(le) (rate(vllm:time_to_first_token_seconds_bucket{instance="${instance}", job="pods"}[5m])))`,
+			Derivation:  &Derivation{Source: TimeToFirstTokenSeconds, Function: DerivationPercentile, Percentile: 95, Window: 5 * time.Minute},
 			Description: "95th ttft in last 5 mins",
 		},
 		AvgTTFT5mPod: {
@@ -184,6 +233,7 @@ var (
 				Query: PromQL,
 			},
 			PromQL:      `increase(vllm:time_to_first_token_seconds_sum{instance="${instance}", job="pods"}[5m]) / increase(vllm:time_to_first_token_seconds_count{instance="${instance}", job="pods"}[5m])`,
+			Derivation:  &Derivation{Source: TimeToFirstTokenSeconds, Function: DerivationMean, Window: 5 * time.Minute},
 			Description: "Average ttft in last 5 mins",
 		},
 		P95TPOT5mPod: {
@@ -193,6 +243,7 @@ var (
 				Query: PromQL,
 			},
 			PromQL:      `histogram_quantile(0.95, sum by(le) (rate(vllm:time_per_output_token_seconds_bucket{instance="${instance}", job="pods"}[5m])))`,
+			Derivation:  &Derivation{Source: TimePerOutputTokenSeconds, Function: DerivationPercentile, Percentile: 95, Window: 5 * time.Minute},
 			Description: "95th tpot in last 5 mins",
 		},
 		AvgTPOT5mPod: {
@@ -202,6 +253,7 @@ var (
 				Query: PromQL,
 			},
 			PromQL:      `increase(vllm:time_per_output_token_seconds_sum{instance="${instance}", job="pods"}[5m]) / increase(vllm:time_per_output_token_seconds_sum{instance="${instance}", job="pods"}[5m])`,
+			Derivation:  &Derivation{Source: TimePerOutputTokenSeconds, Function: DerivationMean, Window: 5 * time.Minute},
 			Description: "Average tpot in last 5 mins",
 		},
 		AvgPromptToksPerReq: {
@@ -211,6 +263,7 @@ var (
 				Query: PromQL,
 			},
 			PromQL:      `increase(vllm:request_prompt_tokens_sum{instance="${instance}", model_name="${model_name}", job="pods"}[1d]) / increase(vllm:request_prompt_tokens_count{instance="${instance}", model_name="${model_name}", job="pods"}[1d])`,
+			Derivation:  &Derivation{Source: RequestPromptTokens, Function: DerivationMean, Window: 5 * time.Minute},
 			Description: "Average prompt tokens per request in last day",
 		},
 		AvgGenerationToksPerReq: {
@@ -220,6 +273,7 @@ var (
 				Query: PromQL,
 			},
 			PromQL:      `increase(vllm:request_generation_tokens_sum{instance="${instance}", model_name="${model_name}", job="pods"}[1d]) / increase(vllm:request_generation_tokens_count{instance="${instance}", model_name="${model_name}", job="pods"}[1d])`,
+			Derivation:  &Derivation{Source: RequestGenerationTokens, Function: DerivationMean, Window: 5 * time.Minute},
 			Description: "Average generation tokens per request in last day",
 		},
 		GPUCacheUsagePerc: {
@@ -245,6 +299,7 @@ var (
 				Query: PromQL,
 			},
 			PromQL:      `increase(vllm:e2e_request_latency_seconds_sum{instance="${instance}", job="pods"}[5m]) / increase(vllm:e2e_request_latency_seconds_count{instance="${instance}", job="pods"}[5m])`,
+			Derivation:  &Derivation{Source: E2ERequestLatencySeconds, Function: DerivationMean, Window: 5 * time.Minute},
 			Description: "Average End-to-end latency in last 5 mins",
 		},
 		AvgRequestsPerMinPod: {
@@ -254,6 +309,7 @@ var (
 				Query: PromQL,
 			},
 			PromQL:      `increase(vllm:request_success_total{instance="${instance}", job="pods"}[5m]) / 5`,
+			Derivation:  &Derivation{Source: RequestSuccessTotal, Function: DerivationRatePerMinute, Window: 5 * time.Minute},
 			Description: "Average requests throughput per minute in last 5 mins",
 		},
 		AvgPromptThroughputToksPerMinPod: {
@@ -263,6 +319,7 @@ var (
 				Query: PromQL,
 			},
 			PromQL:      `increase(vllm:prompt_tokens_total{instance="${instance}", job="pods"}[5m]) / 5`,
+			Derivation:  &Derivation{Source: PromptTokensTotal, Function: DerivationRatePerMinute, Window: 5 * time.Minute},
 			Description: "Average prompt throughput in tokens per minute in last 5 mins",
 		},
 		AvgGenerationThroughputToksPerMinPod: {
@@ -272,6 +329,7 @@ var (
 				Query: PromQL,
 			},
 			PromQL:      `increase(vllm:generation_tokens_total{instance="${instance}", job="pods"}[5m]) / 5`,
+			Derivation:  &Derivation{Source: GenerationTokensTotal, Function: DerivationRatePerMinute, Window: 5 * time.Minute},
 			Description: "Average generation throughput in tokens per minute in last 5 mins",
 		},
 		MaxLora: {
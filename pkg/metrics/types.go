@@ -79,8 +79,9 @@ const (
 type Metric struct {
 	MetricSource  MetricSource
 	MetricType    MetricType
-	PromQL        string // Optional: Only applicable for PromQL-based metrics
-	RawMetricName string // Optional: Only applicable for QueryLabel-based metrics
+	PromQL        string      // Optional: Only applicable for PromQL-based metrics
+	RawMetricName string      // Optional: Only applicable for QueryLabel-based metrics
+	Derivation    *Derivation // Optional: Computes a PromQL-based metric in-process from a raw metric
 	Description   string
 	MetricScope   MetricScope
 }
@@ -166,6 +167,26 @@ func (h *HistogramMetricValue) GetMean() float64 {
 	return h.Sum / h.Count
 }
 
+// Delta returns the observations of the histogram since an earlier value of it, whose cumulative buckets
+// and counts are subtracted. The histogram itself is returned if it was reset after the earlier value.
+func (h *HistogramMetricValue) Delta(earlier *HistogramMetricValue) *HistogramMetricValue {
+	if earlier == nil || h.Count < earlier.Count {
+		return h
+	}
+	delta := &HistogramMetricValue{
+		Sum:     h.Sum - earlier.Sum,
+		Count:   h.Count - earlier.Count,
+		Buckets: make(map[string]float64, len(h.Buckets)),
+	}
+	for bound, count := range h.Buckets {
+		if earlierCount := earlier.Buckets[bound]; earlierCount <= count {
+			count -= earlierCount
+		}
+		delta.Buckets[bound] = count
+	}
+	return delta
+}
+
 func (h *HistogramMetricValue) GetPercentile(percentile float64) (float64, error) {
 	if percentile < 0 || percentile > 100 {
 		return 0, fmt.Errorf("percentile must be between 0 and 100, got: %f", percentile)
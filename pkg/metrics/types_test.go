@@ -119,6 +119,25 @@ func TestHistogramMetricValue(t *testing.T) {
 		assert.Error(t, err)
 		assert.Equal(t, "percentile must be between 0 and 100, got: 110.000000", err.Error())
 	})
+
+	t.Run("Delta", func(t *testing.T) {
+		later := &HistogramMetricValue{
+			Sum:     112.0,
+			Count:   14,
+			Buckets: map[string]float64{"0.1": 5, "0.5": 8, "1.0": 14, "+Inf": 14},
+		}
+		delta := later.Delta(&histogram)
+		assert.Equal(t, 12.0, delta.Sum)
+		assert.Equal(t, 4.0, delta.Count)
+		assert.Equal(t, map[string]float64{"0.1": 0, "0.5": 0, "1.0": 4, "+Inf": 4}, delta.Buckets)
+		p50, err := delta.GetPercentile(50)
+		assert.NoError(t, err)
+		assert.Equal(t, 1.0, p50)
+
+		// a reset histogram is returned as is
+		assert.Same(t, &histogram, histogram.Delta(later))
+		assert.Same(t, later, later.Delta(nil))
+	})
 }
 
 func TestPrometheusMetricValue(t *testing.T) {
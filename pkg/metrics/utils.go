@@ -17,6 +17,7 @@ limitations under the License.
 package metrics
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"regexp"
@@ -200,7 +201,16 @@ func GetHistogramValue(metric *dto.Metric) (*HistogramMetricValue, error) {
 }
 
 func ParseMetricsURL(url string) (map[string]*dto.MetricFamily, error) {
-	resp, err := http.Get(url)
+	return ParseMetricsURLWithContext(context.Background(), url)
+}
+
+// ParseMetricsURLWithContext fetches and parses the metrics of the url, the request is canceled with the context.
+func ParseMetricsURLWithContext(ctx context.Context, url string) (map[string]*dto.MetricFamily, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return make(map[string]*dto.MetricFamily), fmt.Errorf("Failed to create request to %s: %v", url, err)
+	}
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return make(map[string]*dto.MetricFamily), fmt.Errorf("Failed to fetch metrics from %s: %v", url, err)
 	}
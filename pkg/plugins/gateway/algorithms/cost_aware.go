@@ -0,0 +1,213 @@
+/*
+Copyright 2024 The Aibrix Team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routingalgorithms
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+
+	"github.com/vllm-project/aibrix/pkg/cache"
+	"github.com/vllm-project/aibrix/pkg/metrics"
+	"github.com/vllm-project/aibrix/pkg/plugins/gateway/profile"
+	"github.com/vllm-project/aibrix/pkg/utils"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+var (
+	RouterCostAware Algorithms = "cost-aware"
+)
+
+func init() {
+	Register(RouterCostAware, NewCostAwareRouter)
+}
+
+const (
+	defaultCostAwareCostWeight = 0.5
+)
+
+var (
+	costAwareCostWeight = getCostAwareCostWeight()
+)
+
+func getCostAwareCostWeight() float64 {
+	value := utils.LoadEnv("AIBRIX_COST_AWARE_COST_WEIGHT", "")
+	if value != "" {
+		floatValue, err := strconv.ParseFloat(value, 64)
+		if err != nil || floatValue < 0 || floatValue > 1 {
+			klog.Infof("invalid AIBRIX_COST_AWARE_COST_WEIGHT: %s, valid value between 0 and 1, falling back to default", value)
+		} else {
+			klog.Infof("using AIBRIX_COST_AWARE_COST_WEIGHT env value for cost aware routing: %v", floatValue)
+			return floatValue
+		}
+	}
+	klog.Infof("using default cost aware cost weight: %v", defaultCostAwareCostWeight)
+	return defaultCostAwareCostWeight
+}
+
+// costAwareRouter balances $/token against predicted latency across pods with
+// different GPU types. Both are predicted from the performance profile of the
+// model on the GPU type of each pod, normalized by the best candidate and
+// weighted by costWeight.
+type costAwareRouter struct {
+	cache      cache.Cache
+	profiles   *profile.Store
+	costWeight float64
+}
+
+func NewCostAwareRouter(c cache.Cache) (Router, error) {
+	return costAwareRouter{
+		cache:      c,
+		profiles:   profile.DefaultStore(),
+		costWeight: costAwareCostWeight,
+	}, nil
+}
+
+type costAwareCandidate struct {
+	pod          *v1.Pod
+	costPerToken float64
+	latency      float64
+	explanation  *CandidateExplanation
+}
+
+func (r costAwareRouter) Route(ctx context.Context, pods map[string]*v1.Pod, routingCtx RoutingContext) (string, error) {
+	return r.route(pods, routingCtx, nil)
+}
+
+func (r costAwareRouter) Explain(ctx context.Context, pods map[string]*v1.Pod, routingCtx RoutingContext) (*Explanation, error) {
+	return explain(RouterCostAware, routingCtx, func(explanation *Explanation) (string, error) {
+		return r.route(pods, routingCtx, explanation)
+	})
+}
+
+// route selects the target pod, recording the decision into the explanation if not nil
+func (r costAwareRouter) route(pods map[string]*v1.Pod, routingCtx RoutingContext, explanation *Explanation) (string, error) {
+	if len(pods) == 0 {
+		return "", fmt.Errorf("no pods to forward request")
+	}
+
+	readyPods := utils.FilterReadyPods(pods)
+	if len(readyPods) == 0 {
+		return "", fmt.Errorf("no ready pods available for fallback")
+	}
+
+	tokens, err := utils.TokenizeInputText(utils.TrimMessage(routingCtx.Message))
+	if err != nil {
+		return "", err
+	}
+	inputTokens, outputTokens := len(tokens), defaultDecodingLength
+
+	podProfiles, defaultProfile := getPodProfiles(r.cache, r.profiles, readyPods, routingCtx.Model)
+	candidates := make([]costAwareCandidate, 0, len(readyPods))
+	minCost, minLatency := math.MaxFloat64, math.MaxFloat64
+	for _, pod := range readyPods {
+		prof, ok := podProfiles[cache.PodKey(pod)]
+		if !ok {
+			prof = defaultProfile
+		}
+		candidateExplanation := explanation.addCandidate(pod)
+		if prof == nil {
+			candidateExplanation.addError(fmt.Errorf("no profile for model %s on gpu type of pod %s", routingCtx.Model, pod.Name))
+			continue
+		}
+
+		// requests ahead of this one on the pod delay it by their service time
+		queue, err := r.getQueueLength(cache.PodKey(pod), routingCtx.Model)
+		if err != nil {
+			klog.Error(err)
+			candidateExplanation.addError(err)
+			continue
+		}
+		serviceTime := prof.PrefillTime(inputTokens, inputTokens) + prof.DecodeTime(outputTokens)
+		candidate := costAwareCandidate{
+			pod:          pod,
+			costPerToken: prof.CostPerToken(inputTokens, outputTokens),
+			latency:      serviceTime * (1 + queue),
+			explanation:  candidateExplanation,
+		}
+		klog.V(4).Infof("pod: %v, podIP: %v, gpu: %v, queue: %v, costPerToken: %v, latency: %v",
+			pod.Name, pod.Status.PodIP, prof.GPU, queue, candidate.costPerToken, candidate.latency)
+
+		candidateExplanation.setMetric("gpu", prof.GPU)
+		candidateExplanation.setMetric("queue", queue)
+		candidateExplanation.setMetric("cost_per_token", candidate.costPerToken)
+		candidateExplanation.setMetric("latency", candidate.latency)
+
+		candidates = append(candidates, candidate)
+		minCost = math.Min(minCost, candidate.costPerToken)
+		minLatency = math.Min(minLatency, candidate.latency)
+	}
+
+	var targetPod *v1.Pod
+	minScore := math.MaxFloat64
+	for _, candidate := range candidates {
+		score := r.costWeight*normalize(candidate.costPerToken, minCost) +
+			(1-r.costWeight)*normalize(candidate.latency, minLatency)
+		candidate.explanation.setScore(score)
+		if score < minScore {
+			minScore = score
+			targetPod = candidate.pod
+		}
+	}
+
+	// no candidate has a profile and queue metrics, or all scores are NaN
+	if targetPod == nil {
+		klog.Warning("No pods with performance profile and valid metrics found; selecting a pod randomly as fallback")
+		targetPodIP, err := selectRandomPod(pods, rand.Intn)
+		if err != nil {
+			return "", err
+		}
+		explanation.setReason("no pods with performance profile and valid metrics found, selected randomly")
+		return getPodAddress(targetPodIP)
+	}
+
+	return getPodAddress(targetPod.Status.PodIP)
+}
+
+// getQueueLength returns the running and waiting requests of the model on the pod.
+func (r costAwareRouter) getQueueLength(podName, model string) (float64, error) {
+	queue := 0.0
+	for _, metricName := range []string{metrics.NumRequestsRunning, metrics.NumRequestsWaiting} {
+		value, err := r.cache.GetMetricValueByPodModel(podName, model, metricName)
+		if err != nil {
+			return 0, err
+		}
+		queue += value.GetSimpleValue()
+	}
+	return queue, nil
+}
+
+// normalize returns value relative to the best value, 1 for the best candidate.
+func normalize(value, best float64) float64 {
+	if best <= 0 {
+		if value <= 0 {
+			return 1
+		}
+		return value + 1
+	}
+	return value / best
+}
+
+func (r costAwareRouter) SubscribedMetrics() []string {
+	return []string{
+		metrics.NumRequestsRunning,
+		metrics.NumRequestsWaiting,
+	}
+}
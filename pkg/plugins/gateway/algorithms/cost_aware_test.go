@@ -0,0 +1,106 @@
+/*
+Copyright 2024 The Aibrix Team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routingalgorithms
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vllm-project/aibrix/pkg/cache"
+	"github.com/vllm-project/aibrix/pkg/metrics"
+	"github.com/vllm-project/aibrix/pkg/plugins/gateway/profile"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestCostAwareRouter(t *testing.T) {
+	model := "cost-aware-test-model"
+	profiles := profile.NewStore()
+	assert.NoError(t, profiles.Load([]byte(`
+- model: cost-aware-test-model
+  gpu: A100
+  cost: 4.0
+  prefillBaseTime: 0.01
+  prefillTimePerToken: 0.0001
+  timePerOutputToken: 0.01
+- model: cost-aware-test-model
+  gpu: T4
+  cost: 0.5
+  prefillBaseTime: 0.02
+  prefillTimePerToken: 0.0004
+  timePerOutputToken: 0.015
+`)))
+
+	newStore := func(a100Queue float64, t4Metrics bool) *cache.Store {
+		a100 := newRolePod("a100", "10.0.0.1", "")
+		a100.Labels[cache.PodGPUTypeIdentifier] = "NVIDIA-A100-SXM4-40GB"
+		t4 := newRolePod("t4", "10.0.0.2", "")
+		t4.Spec.NodeName = "t4-node"
+		node := &v1.Node{}
+		node.Name = "t4-node"
+		node.Labels = map[string]string{cache.NodeGPUProductIdentifier: "Tesla-T4"}
+		podModelMetrics := map[string]map[string]map[string]metrics.MetricValue{
+			"a100": {model: {
+				metrics.NumRequestsRunning: &metrics.SimpleMetricValue{Value: a100Queue},
+				metrics.NumRequestsWaiting: &metrics.SimpleMetricValue{Value: 0},
+			}},
+		}
+		if t4Metrics {
+			podModelMetrics["t4"] = map[string]map[string]metrics.MetricValue{model: {
+				metrics.NumRequestsRunning: &metrics.SimpleMetricValue{Value: 0},
+				metrics.NumRequestsWaiting: &metrics.SimpleMetricValue{Value: 0},
+			}}
+		}
+		return &cache.Store{
+			Pods:            map[string]*v1.Pod{"a100": a100, "t4": t4},
+			Nodes:           map[string]*v1.Node{"t4-node": node},
+			PodModelMetrics: podModelMetrics,
+		}
+	}
+
+	tests := []struct {
+		name       string
+		costWeight float64
+		a100Queue  float64
+		noT4Metric bool
+		expectedIP string
+	}{
+		{name: "latency only prefers fast gpu", costWeight: 0, expectedIP: "10.0.0.1"},
+		{name: "cost only prefers cheap gpu", costWeight: 1, expectedIP: "10.0.0.2"},
+		{name: "balanced prefers cheap gpu with comparable latency", costWeight: 0.5, expectedIP: "10.0.0.2"},
+		{name: "latency only avoids queued fast gpu", costWeight: 0, a100Queue: 10, expectedIP: "10.0.0.2"},
+		{name: "pods without queue metrics are skipped", costWeight: 1, a100Queue: 10, noT4Metric: true, expectedIP: "10.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newStore(tt.a100Queue, !tt.noT4Metric)
+			r := costAwareRouter{cache: c, profiles: profiles, costWeight: tt.costWeight}
+			targetPod, err := r.Route(context.TODO(), c.Pods, RoutingContext{Model: model, Message: "hello world"})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedIP+":"+podMetricPort, targetPod)
+		})
+	}
+
+	// NaN scores select no candidate, the pod is selected randomly
+	c := newStore(0, true)
+	r := costAwareRouter{cache: c, profiles: profiles, costWeight: math.NaN()}
+	targetPod, err := r.Route(context.TODO(), c.Pods, RoutingContext{Model: model, Message: "hello world"})
+	assert.NoError(t, err)
+	assert.Contains(t, []string{"10.0.0.1:" + podMetricPort, "10.0.0.2:" + podMetricPort}, targetPod)
+}
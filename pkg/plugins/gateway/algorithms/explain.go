@@ -0,0 +1,147 @@
+/*
+Copyright 2024 The Aibrix Team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routingalgorithms
+
+import (
+	"context"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// ErrExplainNotSupported is returned for routers which do not implement Explainer
+var ErrExplainNotSupported = fmt.Errorf("routing algorithm does not support explain")
+
+// Explainer is implemented by routers which can explain a routing decision.
+// Explain must not forward the request or record it in the router state, so it
+// can be used to dry run routing.
+type Explainer interface {
+	// Explain returns the decision Route would make for the request
+	Explain(ctx context.Context, pods map[string]*v1.Pod, routingCtx RoutingContext) (*Explanation, error)
+}
+
+// Explanation describes how a router selected the target pod.
+type Explanation struct {
+	Algorithm  Algorithms              `json:"algorithm"`
+	Model      string                  `json:"model"`
+	Candidates []*CandidateExplanation `json:"candidates"`
+	// TargetPod is the address the request is forwarded to
+	TargetPod string `json:"targetPod"`
+	// Reason explains fallbacks, e.g. random selection when no metrics are available
+	Reason string `json:"reason,omitempty"`
+	// Stages are explanations of routers the decision is delegated to, e.g. prefill and decode
+	Stages map[string]*Explanation `json:"stages,omitempty"`
+}
+
+// CandidateExplanation describes a pod considered by a router.
+type CandidateExplanation struct {
+	Pod   string `json:"pod"`
+	PodIP string `json:"podIP"`
+	// Metrics are the values the router read from the cache, label metrics are strings
+	Metrics map[string]interface{} `json:"metrics,omitempty"`
+	// Score is the value the router compared across candidates, nil if the pod was skipped
+	Score *float64 `json:"score,omitempty"`
+	// PrefixMatchPercent is the percent of request tokens cached on the pod
+	PrefixMatchPercent *int `json:"prefixMatchPercent,omitempty"`
+	// Errors are the errors the router hit evaluating the pod, e.g. missing metrics
+	Errors []string `json:"errors,omitempty"`
+}
+
+func newExplanation(algorithm Algorithms, routingCtx RoutingContext) *Explanation {
+	return &Explanation{
+		Algorithm:  algorithm,
+		Model:      routingCtx.Model,
+		Candidates: []*CandidateExplanation{},
+	}
+}
+
+// explain records the decision of route into a new explanation of the algorithm.
+// Routers pass a nil explanation to route when routing requests, so that Route does
+// not allocate an explanation; the helpers below do nothing on nil receivers.
+func explain(algorithm Algorithms, routingCtx RoutingContext, route func(*Explanation) (string, error)) (*Explanation, error) {
+	explanation := newExplanation(algorithm, routingCtx)
+	targetPod, err := route(explanation)
+	if err != nil {
+		return nil, err
+	}
+	explanation.TargetPod = targetPod
+	return explanation, nil
+}
+
+// addCandidate records a pod evaluated by the router, it returns nil for a nil explanation
+func (e *Explanation) addCandidate(pod *v1.Pod) *CandidateExplanation {
+	if e == nil {
+		return nil
+	}
+	candidate := &CandidateExplanation{
+		Pod:     pod.Name,
+		PodIP:   pod.Status.PodIP,
+		Metrics: map[string]interface{}{},
+	}
+	e.Candidates = append(e.Candidates, candidate)
+	return candidate
+}
+
+// setReason formats the reason of the decision
+func (e *Explanation) setReason(format string, args ...interface{}) {
+	if e == nil {
+		return
+	}
+	e.Reason = fmt.Sprintf(format, args...)
+}
+
+func (c *CandidateExplanation) setMetric(name string, value interface{}) {
+	if c == nil {
+		return
+	}
+	c.Metrics[name] = value
+}
+
+func (c *CandidateExplanation) setScore(score float64) {
+	if c == nil {
+		return
+	}
+	c.Score = &score
+}
+
+func (c *CandidateExplanation) setPrefixMatchPercent(percent int) {
+	if c == nil {
+		return
+	}
+	c.PrefixMatchPercent = &percent
+}
+
+func (c *CandidateExplanation) addError(err error) {
+	if c == nil {
+		return
+	}
+	c.Errors = append(c.Errors, err.Error())
+}
+
+// Explain explains the routing decision of the algorithm for the request.
+// It returns an error if the router does not implement Explainer.
+func (r *Routers) Explain(ctx context.Context, algorithm Algorithms, pods map[string]*v1.Pod, routingCtx RoutingContext) (*Explanation, error) {
+	router, err := r.Select(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	explainer, ok := router.(Explainer)
+	if !ok {
+		return nil, ErrExplainNotSupported
+	}
+	return explainer.Explain(ctx, pods, routingCtx)
+}
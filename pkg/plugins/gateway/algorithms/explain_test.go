@@ -0,0 +1,110 @@
+/*
+Copyright 2024 The Aibrix Team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routingalgorithms
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vllm-project/aibrix/pkg/cache"
+	"github.com/vllm-project/aibrix/pkg/cache/cachetest"
+	"github.com/vllm-project/aibrix/pkg/metrics"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestLeastRequestExplain(t *testing.T) {
+	pods := map[string]*v1.Pod{
+		"p1": newRolePod("p1", "10.0.0.1", ""),
+		"p2": newRolePod("p2", "10.0.0.2", ""),
+		"p3": newRolePod("p3", "10.0.0.3", ""),
+	}
+	running := map[string]float64{"p1": 3, "p2": 1}
+	podModelMetrics := map[string]map[string]map[string]metrics.MetricValue{}
+	for name, value := range running {
+		podModelMetrics[name] = map[string]map[string]metrics.MetricValue{
+			"m1": {
+				metrics.NumRequestsRunning: &metrics.SimpleMetricValue{Value: value},
+				metrics.NumRequestsWaiting: &metrics.SimpleMetricValue{Value: 1},
+				metrics.NumRequestsSwapped: &metrics.SimpleMetricValue{Value: 0},
+			},
+		}
+	}
+	r := leastRequestRouter{cache: &cache.Store{Pods: pods, PodModelMetrics: podModelMetrics}}
+
+	explanation, err := r.Explain(context.TODO(), pods, RoutingContext{Model: "m1"})
+	assert.NoError(t, err)
+	assert.Equal(t, RouterLeastRequest, explanation.Algorithm)
+	assert.Equal(t, "10.0.0.2:"+podMetricPort, explanation.TargetPod)
+	assert.Len(t, explanation.Candidates, 3)
+	for _, candidate := range explanation.Candidates {
+		switch candidate.Pod {
+		case "p1":
+			assert.Equal(t, 4.0, *candidate.Score)
+			assert.Equal(t, 3.0, candidate.Metrics[metrics.NumRequestsRunning])
+		case "p2":
+			assert.Equal(t, 2.0, *candidate.Score)
+		case "p3":
+			assert.Nil(t, candidate.Score)
+			assert.NotEmpty(t, candidate.Errors)
+		}
+	}
+
+	// Route makes the same decision without an explanation
+	targetPod, err := r.Route(context.TODO(), pods, RoutingContext{Model: "m1"})
+	assert.NoError(t, err)
+	assert.Equal(t, explanation.TargetPod, targetPod)
+}
+
+func TestPrefixCacheExplainIsDryRun(t *testing.T) {
+	router, err := NewPrefixCacheRouter(nil)
+	assert.NoError(t, err)
+	r := router.(prefixCacheRouter)
+	pods := map[string]*v1.Pod{
+		"p1": newRolePod("p1", "10.0.0.1", ""),
+		"p2": newRolePod("p2", "10.0.0.2", ""),
+	}
+	routingCtx := RoutingContext{Model: "m1", Message: "this is the first message of the conversation"}
+
+	for i := 0; i < 2; i++ {
+		explanation, err := r.Explain(context.TODO(), pods, routingCtx)
+		assert.NoError(t, err)
+		for _, candidate := range explanation.Candidates {
+			assert.Equal(t, 0, *candidate.PrefixMatchPercent)
+		}
+	}
+
+	targetPod, err := r.Route(context.TODO(), pods, routingCtx)
+	assert.NoError(t, err)
+
+	explanation, err := r.Explain(context.TODO(), pods, routingCtx)
+	assert.NoError(t, err)
+	assert.Equal(t, targetPod, explanation.TargetPod)
+	for _, candidate := range explanation.Candidates {
+		if candidate.PodIP+":"+podMetricPort == targetPod {
+			assert.Equal(t, 100, *candidate.PrefixMatchPercent)
+		} else {
+			assert.Equal(t, 0, *candidate.PrefixMatchPercent)
+		}
+	}
+}
+
+func TestExplainNotSupported(t *testing.T) {
+	pods := map[string]*v1.Pod{"p1": newRolePod("p1", "10.0.0.1", "")}
+	_, err := NewRouters(cachetest.New()).Explain(context.TODO(), RouterPrefixCacheAndLoad, pods, RoutingContext{Model: "m1"})
+	assert.ErrorIs(t, err, ErrExplainNotSupported)
+}
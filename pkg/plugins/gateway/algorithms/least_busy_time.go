@@ -32,26 +32,31 @@ var (
 )
 
 func init() {
-	router, err := NewLeastBusyTimeRouter()
-	Register(RouterLeastBusyTime, func() (Router, error) { return router, err })
+	Register(RouterLeastBusyTime, NewLeastBusyTimeRouter)
 }
 
 type leastBusyTimeRouter struct {
 	cache cache.Cache
 }
 
-func NewLeastBusyTimeRouter() (Router, error) {
-	c, err := cache.Get()
-	if err != nil {
-		return nil, err
-	}
-
+func NewLeastBusyTimeRouter(c cache.Cache) (Router, error) {
 	return leastBusyTimeRouter{
 		cache: c,
 	}, nil
 }
 
 func (r leastBusyTimeRouter) Route(ctx context.Context, pods map[string]*v1.Pod, routingCtx RoutingContext) (string, error) {
+	return r.route(pods, routingCtx, nil)
+}
+
+func (r leastBusyTimeRouter) Explain(ctx context.Context, pods map[string]*v1.Pod, routingCtx RoutingContext) (*Explanation, error) {
+	return explain(RouterLeastBusyTime, routingCtx, func(explanation *Explanation) (string, error) {
+		return r.route(pods, routingCtx, explanation)
+	})
+}
+
+// route selects the target pod, recording the decision into the explanation if not nil
+func (r leastBusyTimeRouter) route(pods map[string]*v1.Pod, routingCtx RoutingContext, explanation *Explanation) (string, error) {
 	var targetPodIP string
 	minBusyTimeRatio := math.MaxFloat64 // <= 1 in general
 
@@ -64,12 +69,16 @@ func (r leastBusyTimeRouter) Route(ctx context.Context, pods map[string]*v1.Pod,
 			continue
 		}
 
-		busyTimeRatio, err := r.cache.GetMetricValueByPod(pod.Name, "gpu_busy_time_ratio") // todo: replace mock
+		candidate := explanation.addCandidate(pod)
+		busyTimeRatio, err := r.cache.GetMetricValueByPod(cache.PodKey(pod), "gpu_busy_time_ratio") // todo: replace mock
 		if err != nil {
 			klog.Error(err)
+			candidate.addError(err)
 			continue
 		}
 		busyTimeRatioValue := busyTimeRatio.GetSimpleValue()
+		candidate.setMetric("gpu_busy_time_ratio", busyTimeRatioValue)
+		candidate.setScore(busyTimeRatioValue)
 		klog.V(4).Infof("pod: %v, podIP: %v, GPU busy time ratio: %v", pod.Name, pod.Status.PodIP, busyTimeRatioValue)
 
 		if busyTimeRatioValue < minBusyTimeRatio {
@@ -81,6 +90,7 @@ func (r leastBusyTimeRouter) Route(ctx context.Context, pods map[string]*v1.Pod,
 	// Use fallback if no valid metrics
 	if targetPodIP == "" {
 		klog.Warning("No pods with valid metrics found; selecting a pod randomly as fallback")
+		explanation.setReason("no pods with valid metrics found, selected randomly")
 		var err error
 		targetPodIP, err = selectRandomPod(pods, rand.Intn)
 		if err != nil {
@@ -94,3 +104,8 @@ func (r leastBusyTimeRouter) Route(ctx context.Context, pods map[string]*v1.Pod,
 
 	return targetPodIP + ":" + podMetricPort, nil
 }
+
+// SubscribedMetrics is empty until the gpu busy time ratio is defined in the metrics.
+func (r leastBusyTimeRouter) SubscribedMetrics() []string {
+	return []string{}
+}
@@ -33,26 +33,31 @@ var (
 )
 
 func init() {
-	router, err := NewLeastKvCacheRouter()
-	Register(RouterLeastKvCache, func() (Router, error) { return router, err })
+	Register(RouterLeastKvCache, NewLeastKvCacheRouter)
 }
 
 type leastKvCacheRouter struct {
 	cache cache.Cache
 }
 
-func NewLeastKvCacheRouter() (Router, error) {
-	c, err := cache.Get()
-	if err != nil {
-		return nil, err
-	}
-
+func NewLeastKvCacheRouter(c cache.Cache) (Router, error) {
 	return leastKvCacheRouter{
 		cache: c,
 	}, nil
 }
 
 func (r leastKvCacheRouter) Route(ctx context.Context, pods map[string]*v1.Pod, routingCtx RoutingContext) (string, error) {
+	return r.route(pods, routingCtx, nil)
+}
+
+func (r leastKvCacheRouter) Explain(ctx context.Context, pods map[string]*v1.Pod, routingCtx RoutingContext) (*Explanation, error) {
+	return explain(RouterLeastKvCache, routingCtx, func(explanation *Explanation) (string, error) {
+		return r.route(pods, routingCtx, explanation)
+	})
+}
+
+// route selects the target pod, recording the decision into the explanation if not nil
+func (r leastKvCacheRouter) route(pods map[string]*v1.Pod, routingCtx RoutingContext, explanation *Explanation) (string, error) {
 	var targetPodIP string
 	minKvCache := math.MaxFloat64
 
@@ -65,20 +70,26 @@ func (r leastKvCacheRouter) Route(ctx context.Context, pods map[string]*v1.Pod,
 			continue
 		}
 
+		candidate := explanation.addCandidate(pod)
 		// Due to metric refactor (pull/543) to better support lora and multi models,
 		// we change to use PodModelMetrics instead of PodMetrics in some scenarios.
 		// This works but doesn't look very promising, we can revisit this part later.
-		gpuCache, err := r.cache.GetMetricValueByPodModel(pod.Name, routingCtx.Model, metrics.GPUCacheUsagePerc)
+		gpuCache, err := r.cache.GetMetricValueByPodModel(cache.PodKey(pod), routingCtx.Model, metrics.GPUCacheUsagePerc)
 		if err != nil {
 			klog.Error(err)
+			candidate.addError(err)
 			continue
 		}
-		cpuCache, err := r.cache.GetMetricValueByPodModel(pod.Name, routingCtx.Model, metrics.CPUCacheUsagePerc)
+		candidate.setMetric(metrics.GPUCacheUsagePerc, gpuCache.GetSimpleValue())
+		cpuCache, err := r.cache.GetMetricValueByPodModel(cache.PodKey(pod), routingCtx.Model, metrics.CPUCacheUsagePerc)
 		if err != nil {
 			klog.Error(err)
+			candidate.addError(err)
 			continue
 		}
+		candidate.setMetric(metrics.CPUCacheUsagePerc, cpuCache.GetSimpleValue())
 		totalCache := gpuCache.GetSimpleValue() + cpuCache.GetSimpleValue()
+		candidate.setScore(totalCache)
 
 		klog.V(4).Infof("pod: %v, podIP: %v, gpuCache: %v, cpuCache: %v, kaCache: %v",
 			pod.Name, pod.Status.PodIP, gpuCache.GetSimpleValue(), cpuCache.GetSimpleValue(), totalCache)
@@ -92,6 +103,7 @@ func (r leastKvCacheRouter) Route(ctx context.Context, pods map[string]*v1.Pod,
 	// Use fallback if no valid metrics
 	if targetPodIP == "" {
 		klog.Warning("No pods with valid metrics found; selecting a pod randomly as fallback")
+		explanation.setReason("no pods with valid metrics found, selected randomly")
 		var err error
 		targetPodIP, err = selectRandomPod(pods, rand.Intn)
 		if err != nil {
@@ -106,3 +118,10 @@ func (r leastKvCacheRouter) Route(ctx context.Context, pods map[string]*v1.Pod,
 	klog.V(4).Infof("targetPodIP: %v", targetPodIP)
 	return targetPodIP + ":" + podMetricPort, nil
 }
+
+func (r leastKvCacheRouter) SubscribedMetrics() []string {
+	return []string{
+		metrics.GPUCacheUsagePerc,
+		metrics.CPUCacheUsagePerc,
+	}
+}
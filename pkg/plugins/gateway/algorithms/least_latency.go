@@ -33,26 +33,31 @@ var (
 )
 
 func init() {
-	router, err := NewLeastExpectedLatencyRouter()
-	Register(RouterLeastLatency, func() (Router, error) { return router, err })
+	Register(RouterLeastLatency, NewLeastExpectedLatencyRouter)
 }
 
 type leastExpectedLatencyRouter struct {
 	cache cache.Cache
 }
 
-func NewLeastExpectedLatencyRouter() (Router, error) {
-	c, err := cache.Get()
-	if err != nil {
-		return nil, err
-	}
-
+func NewLeastExpectedLatencyRouter(c cache.Cache) (Router, error) {
 	return leastExpectedLatencyRouter{
 		cache: c,
 	}, nil
 }
 
 func (r leastExpectedLatencyRouter) Route(ctx context.Context, pods map[string]*v1.Pod, routingCtx RoutingContext) (string, error) {
+	return r.route(pods, routingCtx, nil)
+}
+
+func (r leastExpectedLatencyRouter) Explain(ctx context.Context, pods map[string]*v1.Pod, routingCtx RoutingContext) (*Explanation, error) {
+	return explain(RouterLeastLatency, routingCtx, func(explanation *Explanation) (string, error) {
+		return r.route(pods, routingCtx, explanation)
+	})
+}
+
+// route selects the target pod, recording the decision into the explanation if not nil
+func (r leastExpectedLatencyRouter) route(pods map[string]*v1.Pod, routingCtx RoutingContext, explanation *Explanation) (string, error) {
 	var targetPodIP string
 	minExpectedLatency := math.MaxFloat64
 
@@ -65,12 +70,12 @@ func (r leastExpectedLatencyRouter) Route(ctx context.Context, pods map[string]*
 	cntPromt := 0
 	cntGeneration := 0
 	for _, pod := range pods {
-		avgPromptTokens, err := r.cache.GetMetricValueByPodModel(pod.Name, routingCtx.Model, metrics.AvgPromptToksPerReq)
+		avgPromptTokens, err := r.cache.GetMetricValueByPodModel(cache.PodKey(pod), routingCtx.Model, metrics.AvgPromptToksPerReq)
 		if err != nil {
 			klog.Error(err)
 			continue
 		}
-		avgGenerationTokens, err := r.cache.GetMetricValueByPodModel(pod.Name, routingCtx.Model, metrics.AvgGenerationToksPerReq)
+		avgGenerationTokens, err := r.cache.GetMetricValueByPodModel(cache.PodKey(pod), routingCtx.Model, metrics.AvgGenerationToksPerReq)
 		if err != nil {
 			klog.Error(err)
 			continue
@@ -98,40 +103,52 @@ func (r leastExpectedLatencyRouter) Route(ctx context.Context, pods map[string]*
 			continue
 		}
 
+		candidate := explanation.addCandidate(pod)
 		// expected queuing latency
-		queuingLatency, err := r.cache.GetMetricValueByPodModel(pod.Name, routingCtx.Model, metrics.RequestQueueTimeSeconds)
+		queuingLatency, err := r.cache.GetMetricValueByPodModel(cache.PodKey(pod), routingCtx.Model, metrics.RequestQueueTimeSeconds)
 		if err != nil {
 			klog.Error(err)
+			candidate.addError(err)
 			continue
 		}
+		candidate.setMetric(metrics.RequestQueueTimeSeconds, queuingLatency.GetSimpleValue())
 
 		// expected prefill latency
-		avgPromptTokens, err := r.cache.GetMetricValueByPodModel(pod.Name, routingCtx.Model, metrics.AvgPromptToksPerReq)
+		avgPromptTokens, err := r.cache.GetMetricValueByPodModel(cache.PodKey(pod), routingCtx.Model, metrics.AvgPromptToksPerReq)
 		if err != nil {
 			klog.Error(err)
+			candidate.addError(err)
 			continue
 		}
-		PrefillTime, err := r.cache.GetMetricValueByPodModel(pod.Name, routingCtx.Model, metrics.RequestPrefillTimeSeconds)
+		candidate.setMetric(metrics.AvgPromptToksPerReq, avgPromptTokens.GetSimpleValue())
+		PrefillTime, err := r.cache.GetMetricValueByPodModel(cache.PodKey(pod), routingCtx.Model, metrics.RequestPrefillTimeSeconds)
 		if err != nil {
 			klog.Error(err)
+			candidate.addError(err)
 			continue
 		}
+		candidate.setMetric(metrics.RequestPrefillTimeSeconds, PrefillTime.GetHistogramValue().GetMean())
 		prefillLatency := PrefillTime.GetHistogramValue().GetMean() / avgPromptTokens.GetSimpleValue() * guessPromptTokens
 
 		// expected decode latency
-		avgGenerationTokens, err := r.cache.GetMetricValueByPodModel(pod.Name, routingCtx.Model, metrics.AvgGenerationToksPerReq)
+		avgGenerationTokens, err := r.cache.GetMetricValueByPodModel(cache.PodKey(pod), routingCtx.Model, metrics.AvgGenerationToksPerReq)
 		if err != nil {
 			klog.Error(err)
+			candidate.addError(err)
 			continue
 		}
-		DecodeTime, err := r.cache.GetMetricValueByPodModel(pod.Name, routingCtx.Model, metrics.RequestDecodeTimeSeconds)
+		candidate.setMetric(metrics.AvgGenerationToksPerReq, avgGenerationTokens.GetSimpleValue())
+		DecodeTime, err := r.cache.GetMetricValueByPodModel(cache.PodKey(pod), routingCtx.Model, metrics.RequestDecodeTimeSeconds)
 		if err != nil {
 			klog.Error(err)
+			candidate.addError(err)
 			continue
 		}
+		candidate.setMetric(metrics.RequestDecodeTimeSeconds, DecodeTime.GetHistogramValue().GetMean())
 		decodeLatency := DecodeTime.GetHistogramValue().GetMean() / avgGenerationTokens.GetSimpleValue() * guessGenerationTokens
 
 		totalExpectedLatency := queuingLatency.GetSimpleValue() + prefillLatency + decodeLatency
+		candidate.setScore(totalExpectedLatency)
 		klog.V(4).Infof("pod: %v, podIP: %v, queuingLatency: %v, prefillLatency: %v, decodeLatency: %v, totalExpectedLatency: %v",
 			pod.Name, pod.Status.PodIP, queuingLatency.GetSimpleValue(), prefillLatency, decodeLatency, totalExpectedLatency)
 
@@ -144,6 +161,7 @@ func (r leastExpectedLatencyRouter) Route(ctx context.Context, pods map[string]*
 	// Use fallback if no valid metrics
 	if targetPodIP == "" {
 		klog.Warning("No pods with valid metrics found; selecting a pod randomly as fallback")
+		explanation.setReason("no pods with valid metrics found, selected randomly")
 		var err error
 		targetPodIP, err = selectRandomPod(pods, rand.Intn)
 		if err != nil {
@@ -157,3 +175,13 @@ func (r leastExpectedLatencyRouter) Route(ctx context.Context, pods map[string]*
 
 	return targetPodIP + ":" + podMetricPort, nil
 }
+
+func (r leastExpectedLatencyRouter) SubscribedMetrics() []string {
+	return []string{
+		metrics.RequestQueueTimeSeconds,
+		metrics.RequestPrefillTimeSeconds,
+		metrics.RequestDecodeTimeSeconds,
+		metrics.AvgPromptToksPerReq,
+		metrics.AvgGenerationToksPerReq,
+	}
+}
@@ -34,26 +34,31 @@ var (
 )
 
 func init() {
-	router, err := NewLeastRequestRouter()
-	Register(RouterLeastRequest, func() (Router, error) { return router, err })
+	Register(RouterLeastRequest, NewLeastRequestRouter)
 }
 
 type leastRequestRouter struct {
 	cache cache.Cache
 }
 
-func NewLeastRequestRouter() (Router, error) {
-	c, err := cache.Get()
-	if err != nil {
-		return nil, err
-	}
-
+func NewLeastRequestRouter(c cache.Cache) (Router, error) {
 	return leastRequestRouter{
 		cache: c,
 	}, nil
 }
 
 func (r leastRequestRouter) Route(ctx context.Context, pods map[string]*v1.Pod, routingCtx RoutingContext) (string, error) {
+	return r.route(pods, routingCtx, nil)
+}
+
+func (r leastRequestRouter) Explain(ctx context.Context, pods map[string]*v1.Pod, routingCtx RoutingContext) (*Explanation, error) {
+	return explain(RouterLeastRequest, routingCtx, func(explanation *Explanation) (string, error) {
+		return r.route(pods, routingCtx, explanation)
+	})
+}
+
+// route selects the target pod, recording the decision into the explanation if not nil
+func (r leastRequestRouter) route(pods map[string]*v1.Pod, routingCtx RoutingContext, explanation *Explanation) (string, error) {
 	var targetPodIP string
 	minCount := math.MaxFloat64
 
@@ -67,23 +72,31 @@ func (r leastRequestRouter) Route(ctx context.Context, pods map[string]*v1.Pod,
 	}
 
 	for _, pod := range readyPods {
-		runningReq, err := r.cache.GetMetricValueByPodModel(pod.Name, routingCtx.Model, metrics.NumRequestsRunning)
+		candidate := explanation.addCandidate(pod)
+		runningReq, err := r.cache.GetMetricValueByPodModel(cache.PodKey(pod), routingCtx.Model, metrics.NumRequestsRunning)
 		if err != nil {
 			klog.Error(err)
+			candidate.addError(err)
 			continue
 		}
-		waitingReq, err := r.cache.GetMetricValueByPodModel(pod.Name, routingCtx.Model, metrics.NumRequestsWaiting)
+		candidate.setMetric(metrics.NumRequestsRunning, runningReq.GetSimpleValue())
+		waitingReq, err := r.cache.GetMetricValueByPodModel(cache.PodKey(pod), routingCtx.Model, metrics.NumRequestsWaiting)
 		if err != nil {
 			klog.Error(err)
+			candidate.addError(err)
 			continue
 		}
-		swappedReq, err := r.cache.GetMetricValueByPodModel(pod.Name, routingCtx.Model, metrics.NumRequestsSwapped)
+		candidate.setMetric(metrics.NumRequestsWaiting, waitingReq.GetSimpleValue())
+		swappedReq, err := r.cache.GetMetricValueByPodModel(cache.PodKey(pod), routingCtx.Model, metrics.NumRequestsSwapped)
 		if err != nil {
 			klog.Error(err)
+			candidate.addError(err)
 			continue
 		}
+		candidate.setMetric(metrics.NumRequestsSwapped, swappedReq.GetSimpleValue())
 
 		totalReq := runningReq.GetSimpleValue() + waitingReq.GetSimpleValue() + swappedReq.GetSimpleValue()
+		candidate.setScore(totalReq)
 		klog.V(4).Infof("pod: %v, podIP: %v, runningReq: %v, waitingReq: %v, swappedReq: %v, totalReq: %v",
 			pod.Name, pod.Status.PodIP, runningReq, waitingReq, swappedReq, totalReq)
 
@@ -96,6 +109,7 @@ func (r leastRequestRouter) Route(ctx context.Context, pods map[string]*v1.Pod,
 	// Use fallback if no valid metrics
 	if targetPodIP == "" {
 		klog.Warning("No pods with valid metrics found; selecting a pod randomly as fallback")
+		explanation.setReason("no pods with valid metrics found, selected randomly")
 		var err error
 		targetPodIP, err = selectRandomPod(pods, rand.Intn)
 		if err != nil {
@@ -110,7 +124,7 @@ func (r leastRequestRouter) Route(ctx context.Context, pods map[string]*v1.Pod,
 	return targetPodIP + ":" + podMetricPort, nil
 }
 
-func (r *leastRequestRouter) SubscribedMetrics() []string {
+func (r leastRequestRouter) SubscribedMetrics() []string {
 	return []string{
 		metrics.NumRequestsRunning,
 		metrics.NumRequestsWaiting,
@@ -0,0 +1,194 @@
+/*
+Copyright 2024 The Aibrix Team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routingalgorithms
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/vllm-project/aibrix/pkg/cache"
+	"github.com/vllm-project/aibrix/pkg/metrics"
+	"github.com/vllm-project/aibrix/pkg/utils"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+var (
+	RouterLoraAffinity Algorithms = "lora-affinity"
+)
+
+func init() {
+	Register(RouterLoraAffinity, NewLoraAffinityRouter)
+}
+
+// loraAffinity ranks pods for an adapter request, lower is preferred.
+type loraAffinity int
+
+const (
+	// adapter is running in the engine, no swap required
+	loraAffinityRunning loraAffinity = iota
+	// adapter is being loaded or engine has a free adapter slot
+	loraAffinityAvailable
+	// engine is at max_lora with other adapters active, serving requires a swap
+	loraAffinitySaturated
+)
+
+// loraAffinityRouter prefers pods which already run the requested adapter in
+// the engine, avoids pods at max_lora and picks the least loaded pod within
+// the best tier.
+type loraAffinityRouter struct {
+	cache cache.Cache
+}
+
+func NewLoraAffinityRouter(c cache.Cache) (Router, error) {
+	return loraAffinityRouter{
+		cache: c,
+	}, nil
+}
+
+func (r loraAffinityRouter) Route(ctx context.Context, pods map[string]*v1.Pod, routingCtx RoutingContext) (string, error) {
+	return r.route(pods, routingCtx, nil)
+}
+
+func (r loraAffinityRouter) Explain(ctx context.Context, pods map[string]*v1.Pod, routingCtx RoutingContext) (*Explanation, error) {
+	return explain(RouterLoraAffinity, routingCtx, func(explanation *Explanation) (string, error) {
+		return r.route(pods, routingCtx, explanation)
+	})
+}
+
+// route selects the target pod, recording the decision into the explanation if not nil
+func (r loraAffinityRouter) route(pods map[string]*v1.Pod, routingCtx RoutingContext, explanation *Explanation) (string, error) {
+	if len(pods) == 0 {
+		return "", fmt.Errorf("no pods to forward request")
+	}
+
+	readyPods := utils.FilterReadyPods(pods)
+	if len(readyPods) == 0 {
+		return "", fmt.Errorf("no ready pods available for fallback")
+	}
+
+	bestAffinity := loraAffinitySaturated
+	minLoad := math.MaxFloat64
+	var candidates []*v1.Pod
+	for _, pod := range readyPods {
+		affinity := r.getLoraAffinity(cache.PodKey(pod), routingCtx.Model)
+		load := r.getPodLoad(cache.PodKey(pod))
+		klog.V(4).Infof("pod: %v, podIP: %v, model: %v, loraAffinity: %v, load: %v",
+			pod.Name, pod.Status.PodIP, routingCtx.Model, affinity, load)
+
+		candidate := explanation.addCandidate(pod)
+		candidate.setMetric("lora_affinity", int(affinity))
+		if load != math.MaxFloat64 {
+			candidate.setMetric("load", load)
+			candidate.setScore(load)
+		}
+
+		switch {
+		case affinity < bestAffinity || (affinity == bestAffinity && load < minLoad):
+			bestAffinity, minLoad = affinity, load
+			candidates = []*v1.Pod{pod}
+		case affinity == bestAffinity && load == minLoad:
+			candidates = append(candidates, pod)
+		}
+	}
+
+	targetPod := candidates[rand.Intn(len(candidates))]
+	explanation.setReason("selected randomly among %d least loaded pods with lora affinity %d", len(candidates), bestAffinity)
+	return getPodAddress(targetPod.Status.PodIP)
+}
+
+// getLoraAffinity classifies a pod by the lora_requests_info labels reported by the engine.
+// Pods without lora metrics are considered available, e.g. base model requests or engines
+// not exposing the adapter state.
+func (r loraAffinityRouter) getLoraAffinity(podName, model string) loraAffinity {
+	running := r.getLoraAdapters(podName, metrics.RunningLoraAdapters)
+	if _, ok := running[model]; ok {
+		return loraAffinityRunning
+	}
+
+	waiting := r.getLoraAdapters(podName, metrics.WaitingLoraAdapters)
+	if _, ok := waiting[model]; ok {
+		return loraAffinityAvailable
+	}
+
+	maxLoraValue, err := r.cache.GetMetricValueByPod(podName, metrics.MaxLora)
+	if err != nil {
+		return loraAffinityAvailable
+	}
+	maxLora, err := strconv.Atoi(maxLoraValue.GetLabelValue())
+	if err != nil || maxLora <= 0 {
+		return loraAffinityAvailable
+	}
+	if len(running)+len(waiting) >= maxLora {
+		return loraAffinitySaturated
+	}
+	return loraAffinityAvailable
+}
+
+// getLoraAdapters returns the adapters from a comma separated lora label metric.
+func (r loraAffinityRouter) getLoraAdapters(podName, metricName string) map[string]struct{} {
+	adapters := map[string]struct{}{}
+	value, err := r.cache.GetMetricValueByPod(podName, metricName)
+	if err != nil {
+		return adapters
+	}
+	for _, adapter := range strings.Split(value.GetLabelValue(), ",") {
+		if adapter = strings.TrimSpace(adapter); adapter != "" {
+			adapters[adapter] = struct{}{}
+		}
+	}
+	return adapters
+}
+
+// getPodLoad sums running and waiting requests of all models served by the pod.
+// It returns math.MaxFloat64 if no load metric is available.
+func (r loraAffinityRouter) getPodLoad(podName string) float64 {
+	models, err := r.cache.ListModelsByPod(podName)
+	if err != nil {
+		return math.MaxFloat64
+	}
+
+	load, found := 0.0, false
+	for model := range models {
+		for _, metricName := range []string{metrics.NumRequestsRunning, metrics.NumRequestsWaiting} {
+			value, err := r.cache.GetMetricValueByPodModel(podName, model, metricName)
+			if err != nil {
+				continue
+			}
+			load += value.GetSimpleValue()
+			found = true
+		}
+	}
+	if !found {
+		return math.MaxFloat64
+	}
+	return load
+}
+
+func (r loraAffinityRouter) SubscribedMetrics() []string {
+	return []string{
+		metrics.MaxLora,
+		metrics.RunningLoraAdapters,
+		metrics.WaitingLoraAdapters,
+		metrics.NumRequestsRunning,
+		metrics.NumRequestsWaiting,
+	}
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2024 The Aibrix Team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routingalgorithms
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vllm-project/aibrix/pkg/cache"
+	"github.com/vllm-project/aibrix/pkg/metrics"
+	v1 "k8s.io/api/core/v1"
+)
+
+func newLoraAffinityStore(pods map[string]*v1.Pod) *cache.Store {
+	podToModel := map[string]map[string]struct{}{}
+	podModelMetrics := map[string]map[string]map[string]metrics.MetricValue{}
+	load := map[string]float64{"running": 10, "saturated": 0, "free": 5}
+	for name := range pods {
+		podToModel[name] = map[string]struct{}{"base": {}, "lora-1": {}}
+		podModelMetrics[name] = map[string]map[string]metrics.MetricValue{
+			"base": {
+				metrics.NumRequestsRunning: &metrics.SimpleMetricValue{Value: load[name]},
+				metrics.NumRequestsWaiting: &metrics.SimpleMetricValue{Value: 0},
+			},
+		}
+	}
+
+	return &cache.Store{
+		Pods:              pods,
+		PodToModelMapping: podToModel,
+		PodModelMetrics:   podModelMetrics,
+		PodMetrics: map[string]map[string]metrics.MetricValue{
+			"running": {
+				metrics.MaxLora:             &metrics.LabelValueMetricValue{Value: "2"},
+				metrics.RunningLoraAdapters: &metrics.LabelValueMetricValue{Value: "lora-1,lora-2"},
+				metrics.WaitingLoraAdapters: &metrics.LabelValueMetricValue{Value: ""},
+			},
+			"saturated": {
+				metrics.MaxLora:             &metrics.LabelValueMetricValue{Value: "2"},
+				metrics.RunningLoraAdapters: &metrics.LabelValueMetricValue{Value: "lora-2,lora-3"},
+				metrics.WaitingLoraAdapters: &metrics.LabelValueMetricValue{Value: ""},
+			},
+			"free": {
+				metrics.MaxLora:             &metrics.LabelValueMetricValue{Value: "2"},
+				metrics.RunningLoraAdapters: &metrics.LabelValueMetricValue{Value: "lora-2"},
+				metrics.WaitingLoraAdapters: &metrics.LabelValueMetricValue{Value: ""},
+			},
+		},
+	}
+}
+
+func TestLoraAffinityRouter(t *testing.T) {
+	tests := []struct {
+		name       string
+		podNames   []string
+		model      string
+		expectedIP string
+	}{
+		{
+			name:       "prefer pod running the adapter over less loaded pods",
+			podNames:   []string{"running", "saturated", "free"},
+			model:      "lora-1",
+			expectedIP: "10.0.0.1",
+		},
+		{
+			name:       "avoid pod at max_lora with other adapters active",
+			podNames:   []string{"saturated", "free"},
+			model:      "lora-1",
+			expectedIP: "10.0.0.3",
+		},
+		{
+			name:       "fall back to least loaded pod when all pods are saturated",
+			podNames:   []string{"saturated"},
+			model:      "lora-1",
+			expectedIP: "10.0.0.2",
+		},
+		{
+			name:       "adapter running on all candidates falls back to least load",
+			podNames:   []string{"running", "saturated", "free"},
+			model:      "lora-2",
+			expectedIP: "10.0.0.2",
+		},
+	}
+
+	ips := map[string]string{"running": "10.0.0.1", "saturated": "10.0.0.2", "free": "10.0.0.3"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pods := map[string]*v1.Pod{}
+			for _, name := range tt.podNames {
+				pods[name] = newRolePod(name, ips[name], "")
+			}
+			r := loraAffinityRouter{cache: newLoraAffinityStore(pods)}
+
+			targetPod, err := r.Route(context.TODO(), pods, RoutingContext{Model: tt.model})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedIP+":"+podMetricPort, targetPod)
+		})
+	}
+}
+
+func TestLoraAffinityRouterWithoutMetrics(t *testing.T) {
+	pods := map[string]*v1.Pod{
+		"p1": newRolePod("p1", "10.0.0.1", ""),
+		"p2": newRolePod("p2", "10.0.0.2", ""),
+	}
+	r := loraAffinityRouter{cache: &cache.Store{Pods: pods}}
+
+	targetPod, err := r.Route(context.TODO(), pods, RoutingContext{Model: "lora-1"})
+	assert.NoError(t, err)
+	assert.Contains(t, []string{"10.0.0.1:" + podMetricPort, "10.0.0.2:" + podMetricPort}, targetPod)
+}
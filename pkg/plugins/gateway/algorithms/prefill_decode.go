@@ -0,0 +1,299 @@
+/*
+Copyright 2024 The Aibrix Team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routingalgorithms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/vllm-project/aibrix/pkg/cache"
+	"github.com/vllm-project/aibrix/pkg/utils"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+var (
+	RouterPrefillDecode Algorithms = "prefill-decode"
+)
+
+func init() {
+	Register(RouterPrefillDecode, NewPrefillDecodeRouter)
+}
+
+const (
+	// HeaderKVTransferParams carries the kv_transfer_params returned by the prefill pod to the decode pod.
+	HeaderKVTransferParams = "x-kv-transfer-params"
+	// HeaderPrefillTargetPod is the prefill pod which computed the KV cache for the request.
+	HeaderPrefillTargetPod = "prefill-target-pod"
+
+	defaultPrefillRequestTimeoutSeconds = 60
+)
+
+var (
+	prefillRoutingAlgorithm = getPoolRoutingAlgorithm("AIBRIX_PREFILL_ROUTING_ALGORITHM", RouterRandom)
+	decodeRoutingAlgorithm  = getPoolRoutingAlgorithm("AIBRIX_DECODE_ROUTING_ALGORITHM", RouterLeastRequest)
+	prefillRequestTimeout   = getPrefillRequestTimeout()
+)
+
+func getPoolRoutingAlgorithm(env string, defaultAlgorithm Algorithms) Algorithms {
+	value := utils.LoadEnv(env, "")
+	if value == "" {
+		klog.Infof("using default %s: %s", env, defaultAlgorithm)
+		return defaultAlgorithm
+	}
+	if Algorithms(value) == RouterPrefillDecode {
+		klog.Infof("invalid %s: %s, falling back to default %s", env, value, defaultAlgorithm)
+		return defaultAlgorithm
+	}
+	klog.Infof("using %s env value: %s", env, value)
+	return Algorithms(value)
+}
+
+func getPrefillRequestTimeout() time.Duration {
+	value := utils.LoadEnv("AIBRIX_PREFILL_REQUEST_TIMEOUT_SECONDS", "")
+	if value != "" {
+		intValue, err := strconv.Atoi(value)
+		if err != nil || intValue <= 0 {
+			klog.Infof("invalid AIBRIX_PREFILL_REQUEST_TIMEOUT_SECONDS: %s, falling back to default", value)
+		} else {
+			klog.Infof("using AIBRIX_PREFILL_REQUEST_TIMEOUT_SECONDS env value for prefill request timeout: %d", intValue)
+			return time.Duration(intValue) * time.Second
+		}
+	}
+	klog.Infof("using default prefill request timeout seconds: %d", defaultPrefillRequestTimeoutSeconds)
+	return defaultPrefillRequestTimeoutSeconds * time.Second
+}
+
+// prefillDecodeRouter routes a request to a prefill pod first and then hands it off
+// to a decode pod of the same model. The prefill and decode pools are recognized by
+// the model.aibrix.ai/role pod label and each pool uses its own routing algorithm.
+type prefillDecodeRouter struct {
+	cache            cache.Cache
+	routers          *Routers // Routers of the prefill and decode pools
+	prefillAlgorithm Algorithms
+	decodeAlgorithm  Algorithms
+	prefillPort      string
+	httpClient       *http.Client
+}
+
+func NewPrefillDecodeRouter(c cache.Cache) (Router, error) {
+	return prefillDecodeRouter{
+		cache:            c,
+		routers:          NewRouters(c),
+		prefillAlgorithm: prefillRoutingAlgorithm,
+		decodeAlgorithm:  decodeRoutingAlgorithm,
+		prefillPort:      podMetricPort,
+		httpClient:       &http.Client{Timeout: prefillRequestTimeout},
+	}, nil
+}
+
+func (r prefillDecodeRouter) Route(ctx context.Context, pods map[string]*v1.Pod, routingCtx RoutingContext) (string, error) {
+	if len(pods) == 0 {
+		return "", fmt.Errorf("no pods to forward request")
+	}
+
+	prefillPods := podsWithRole(pods, cache.PodRolePrefill)
+	decodePods := podsWithRole(pods, cache.PodRoleDecode)
+
+	// Model is not deployed in disaggregated mode, route within all pods as a regular request.
+	if len(utils.FilterReadyPods(prefillPods)) == 0 || len(utils.FilterReadyPods(decodePods)) == 0 {
+		klog.V(4).InfoS("no ready prefill or decode pods, routing without disaggregation",
+			"requestID", routingCtx.RequestID, "model", routingCtx.Model)
+		return r.routeWithAlgorithm(ctx, r.decodeAlgorithm, pods, routingCtx)
+	}
+
+	prefillPodAddress, err := r.routeWithAlgorithm(ctx, r.prefillAlgorithm, prefillPods, routingCtx)
+	if err != nil {
+		return "", fmt.Errorf("failed to select prefill pod: %w", err)
+	}
+
+	kvTransferParams, err := r.doPrefill(ctx, prefillPodAddress, routingCtx)
+	if err != nil {
+		return "", fmt.Errorf("prefill request to %s failed: %w", prefillPodAddress, err)
+	}
+
+	decodePodAddress, err := r.routeWithAlgorithm(ctx, r.decodeAlgorithm, decodePods, routingCtx)
+	if err != nil {
+		return "", fmt.Errorf("failed to select decode pod: %w", err)
+	}
+
+	if routingCtx.Headers != nil {
+		routingCtx.Headers[HeaderPrefillTargetPod] = prefillPodAddress
+		if len(kvTransferParams) > 0 {
+			routingCtx.Headers[HeaderKVTransferParams] = string(kvTransferParams)
+		}
+	}
+	klog.V(4).InfoS("prefill decode routing", "requestID", routingCtx.RequestID, "model", routingCtx.Model,
+		"prefillPod", prefillPodAddress, "decodePod", decodePodAddress)
+
+	return decodePodAddress, nil
+}
+
+// Explain selects the prefill and decode pods like Route without sending the prefill request.
+func (r prefillDecodeRouter) Explain(ctx context.Context, pods map[string]*v1.Pod, routingCtx RoutingContext) (*Explanation, error) {
+	if len(pods) == 0 {
+		return nil, fmt.Errorf("no pods to forward request")
+	}
+
+	prefillPods := podsWithRole(pods, cache.PodRolePrefill)
+	decodePods := podsWithRole(pods, cache.PodRoleDecode)
+
+	explanation := newExplanation(RouterPrefillDecode, routingCtx)
+	if len(utils.FilterReadyPods(prefillPods)) == 0 || len(utils.FilterReadyPods(decodePods)) == 0 {
+		decode, err := r.explainWithAlgorithm(ctx, r.decodeAlgorithm, pods, routingCtx)
+		if err != nil {
+			return nil, err
+		}
+		explanation.Stages = map[string]*Explanation{cache.PodRoleDecode: decode}
+		explanation.TargetPod = decode.TargetPod
+		explanation.Reason = "no ready prefill or decode pods, routed without disaggregation"
+		return explanation, nil
+	}
+
+	prefill, err := r.explainWithAlgorithm(ctx, r.prefillAlgorithm, prefillPods, routingCtx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select prefill pod: %w", err)
+	}
+	decode, err := r.explainWithAlgorithm(ctx, r.decodeAlgorithm, decodePods, routingCtx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select decode pod: %w", err)
+	}
+	explanation.Stages = map[string]*Explanation{
+		cache.PodRolePrefill: prefill,
+		cache.PodRoleDecode:  decode,
+	}
+	explanation.TargetPod = decode.TargetPod
+	return explanation, nil
+}
+
+// podsWithRole returns the pods labeled with the serving role, the pods have already been filtered for the request.
+func podsWithRole(pods map[string]*v1.Pod, role string) map[string]*v1.Pod {
+	rolePods := make(map[string]*v1.Pod)
+	for name, pod := range pods {
+		if pod.Labels[cache.PodRoleIdentifier] == role {
+			rolePods[name] = pod
+		}
+	}
+	return rolePods
+}
+
+// doPrefill sends the request to the prefill pod with a single output token and
+// returns the kv_transfer_params which the decode pod needs to pull the KV cache.
+func (r prefillDecodeRouter) doPrefill(ctx context.Context, prefillPodAddress string, routingCtx RoutingContext) (json.RawMessage, error) {
+	var reqBody map[string]interface{}
+	if err := json.Unmarshal(routingCtx.ReqBody, &reqBody); err != nil {
+		return nil, err
+	}
+
+	path := "/v1/completions"
+	if _, ok := reqBody["messages"]; ok {
+		path = "/v1/chat/completions"
+	}
+
+	reqBody["max_tokens"] = 1
+	if _, ok := reqBody["max_completion_tokens"]; ok {
+		reqBody["max_completion_tokens"] = 1
+	}
+	reqBody["stream"] = false
+	delete(reqBody, "stream_options")
+	reqBody["kv_transfer_params"] = map[string]interface{}{
+		"do_remote_decode":  true,
+		"do_remote_prefill": false,
+		"remote_engine_id":  nil,
+		"remote_block_ids":  nil,
+		"remote_host":       nil,
+		"remote_port":       nil,
+	}
+	body, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, err
+	}
+
+	host, _, err := net.SplitHostPort(prefillPodAddress)
+	if err != nil {
+		return nil, err
+	}
+	url := fmt.Sprintf("http://%s%s", net.JoinHostPort(host, r.prefillPort), path)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if routingCtx.RequestID != "" {
+		req.Header.Set("x-request-id", routingCtx.RequestID)
+	}
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			klog.ErrorS(err, "error closing prefill response body", "requestID", routingCtx.RequestID)
+		}
+	}()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	var prefillResp struct {
+		KVTransferParams json.RawMessage `json:"kv_transfer_params"`
+	}
+	if err := json.Unmarshal(respBody, &prefillResp); err != nil {
+		return nil, err
+	}
+	if string(prefillResp.KVTransferParams) == "null" {
+		return nil, nil
+	}
+	return prefillResp.KVTransferParams, nil
+}
+
+// routeWithAlgorithm routes within the given pods using another registered routing algorithm.
+func (r prefillDecodeRouter) routeWithAlgorithm(ctx context.Context, algorithm Algorithms, pods map[string]*v1.Pod, routingCtx RoutingContext) (string, error) {
+	if algorithm == RouterPrefillDecode {
+		algorithm = RouterRandom
+	}
+	router, err := r.routers.Select(algorithm)
+	if err != nil {
+		return "", err
+	}
+	return router.Route(ctx, pods, routingCtx)
+}
+
+// explainWithAlgorithm explains the routing decision of another registered routing algorithm.
+func (r prefillDecodeRouter) explainWithAlgorithm(ctx context.Context, algorithm Algorithms, pods map[string]*v1.Pod, routingCtx RoutingContext) (*Explanation, error) {
+	if algorithm == RouterPrefillDecode {
+		algorithm = RouterRandom
+	}
+	return r.routers.Explain(ctx, algorithm, pods, routingCtx)
+}
+
+func (r prefillDecodeRouter) SubscribedMetrics() []string {
+	return []string{}
+}
@@ -0,0 +1,202 @@
+/*
+Copyright 2024 The Aibrix Team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routingalgorithms
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vllm-project/aibrix/pkg/cache"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newRolePod(name, ip, role string) *v1.Pod {
+	labels := map[string]string{}
+	if role != "" {
+		labels[cache.PodRoleIdentifier] = role
+	}
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: labels,
+		},
+		Status: v1.PodStatus{
+			PodIP: ip,
+			Conditions: []v1.PodCondition{
+				{
+					Type:   v1.PodReady,
+					Status: v1.ConditionTrue,
+				},
+			},
+		},
+	}
+}
+
+func TestPrefillDecodeRouter(t *testing.T) {
+	var prefillPath string
+	var prefillBody map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		prefillPath = r.URL.Path
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&prefillBody))
+		_, _ = w.Write([]byte(`{"id":"cmpl-1","kv_transfer_params":{"remote_engine_id":"engine-1","remote_block_ids":[1,2]}}`))
+	}))
+	defer server.Close()
+	serverURL, err := url.Parse(server.URL)
+	assert.NoError(t, err)
+	_, port, err := net.SplitHostPort(serverURL.Host)
+	assert.NoError(t, err)
+
+	pods := map[string]*v1.Pod{
+		"prefill": newRolePod("prefill", "127.0.0.1", cache.PodRolePrefill),
+		"decode":  newRolePod("decode", "10.0.0.2", cache.PodRoleDecode),
+	}
+	c := cache.Store{
+		ModelToPodMapping: map[string]map[string]*v1.Pod{"m1": pods},
+	}
+	r := prefillDecodeRouter{
+		cache:            &c,
+		routers:          NewRouters(&c),
+		prefillAlgorithm: RouterRandom,
+		decodeAlgorithm:  RouterRandom,
+		prefillPort:      port,
+		httpClient:       server.Client(),
+	}
+
+	routingCtx := RoutingContext{
+		RequestID: "req-1",
+		Model:     "m1",
+		ReqBody:   []byte(`{"model":"m1","messages":[{"role":"user","content":"hi"}],"max_tokens":100,"stream":true,"stream_options":{"include_usage":true}}`),
+		Headers:   map[string]string{},
+	}
+	targetPod, err := r.Route(context.TODO(), pods, routingCtx)
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.2:"+podMetricPort, targetPod)
+
+	assert.Equal(t, "/v1/chat/completions", prefillPath)
+	assert.Equal(t, float64(1), prefillBody["max_tokens"])
+	assert.Equal(t, false, prefillBody["stream"])
+	assert.NotContains(t, prefillBody, "stream_options")
+	assert.Equal(t, true, prefillBody["kv_transfer_params"].(map[string]interface{})["do_remote_decode"])
+
+	assert.Equal(t, "127.0.0.1:"+podMetricPort, routingCtx.Headers[HeaderPrefillTargetPod])
+	assert.JSONEq(t, `{"remote_engine_id":"engine-1","remote_block_ids":[1,2]}`, routingCtx.Headers[HeaderKVTransferParams])
+}
+
+func TestPrefillDecodeRouterPrefillFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "engine error", http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	serverURL, err := url.Parse(server.URL)
+	assert.NoError(t, err)
+	_, port, err := net.SplitHostPort(serverURL.Host)
+	assert.NoError(t, err)
+
+	pods := map[string]*v1.Pod{
+		"prefill": newRolePod("prefill", "127.0.0.1", cache.PodRolePrefill),
+		"decode":  newRolePod("decode", "10.0.0.2", cache.PodRoleDecode),
+	}
+	c := cache.Store{
+		ModelToPodMapping: map[string]map[string]*v1.Pod{"m1": pods},
+	}
+	r := prefillDecodeRouter{
+		cache:            &c,
+		routers:          NewRouters(&c),
+		prefillAlgorithm: RouterRandom,
+		decodeAlgorithm:  RouterRandom,
+		prefillPort:      port,
+		httpClient:       server.Client(),
+	}
+
+	routingCtx := RoutingContext{
+		Model:   "m1",
+		ReqBody: []byte(`{"model":"m1","prompt":"hi"}`),
+		Headers: map[string]string{},
+	}
+	targetPod, err := r.Route(context.TODO(), pods, routingCtx)
+	assert.Error(t, err)
+	assert.Empty(t, targetPod)
+	assert.Empty(t, routingCtx.Headers)
+}
+
+func TestPrefillDecodeRouterWithoutRoles(t *testing.T) {
+	pods := map[string]*v1.Pod{
+		"p1": newRolePod("p1", "10.0.0.1", ""),
+		"p2": newRolePod("p2", "10.0.0.2", cache.PodRoleDecode),
+	}
+	c := cache.Store{
+		ModelToPodMapping: map[string]map[string]*v1.Pod{"m1": pods},
+	}
+	r := prefillDecodeRouter{
+		cache:            &c,
+		routers:          NewRouters(&c),
+		prefillAlgorithm: RouterRandom,
+		decodeAlgorithm:  RouterRandom,
+		prefillPort:      podMetricPort,
+		httpClient:       http.DefaultClient,
+	}
+
+	routingCtx := RoutingContext{
+		Model:   "m1",
+		ReqBody: []byte(`{"model":"m1","prompt":"hi"}`),
+		Headers: map[string]string{},
+	}
+	targetPod, err := r.Route(context.TODO(), pods, routingCtx)
+	assert.NoError(t, err)
+	assert.Contains(t, []string{"10.0.0.1:" + podMetricPort, "10.0.0.2:" + podMetricPort}, targetPod)
+	assert.Empty(t, routingCtx.Headers)
+}
+
+func TestPrefillDecodeRouterFilteredPods(t *testing.T) {
+	pods := map[string]*v1.Pod{
+		"prefill": newRolePod("prefill", "10.0.0.1", cache.PodRolePrefill),
+		"decode1": newRolePod("decode1", "10.0.0.2", cache.PodRoleDecode),
+		"decode2": newRolePod("decode2", "10.0.0.3", cache.PodRoleDecode),
+	}
+	c := cache.Store{
+		ModelToPodMapping: map[string]map[string]*v1.Pod{"m1": pods},
+	}
+	r := prefillDecodeRouter{
+		cache:            &c,
+		routers:          NewRouters(&c),
+		prefillAlgorithm: RouterRandom,
+		decodeAlgorithm:  RouterRandom,
+		prefillPort:      podMetricPort,
+		httpClient:       http.DefaultClient,
+	}
+
+	// the prefill pod is filtered out of the candidates, so the request is not disaggregated
+	// and only routed to the remaining decode pod
+	routingCtx := RoutingContext{
+		Model:   "m1",
+		ReqBody: []byte(`{"model":"m1","prompt":"hi"}`),
+		Headers: map[string]string{},
+	}
+	for i := 0; i < 10; i++ {
+		targetPod, err := r.Route(context.TODO(), map[string]*v1.Pod{"decode2": pods["decode2"]}, routingCtx)
+		assert.NoError(t, err)
+		assert.Equal(t, "10.0.0.3:"+podMetricPort, targetPod)
+	}
+	assert.Empty(t, routingCtx.Headers)
+}
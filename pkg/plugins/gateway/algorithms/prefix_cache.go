@@ -20,8 +20,11 @@ import (
 	"context"
 	"fmt"
 	"math/rand"
+	"os"
 	"strconv"
+	"time"
 
+	"github.com/vllm-project/aibrix/pkg/cache"
 	"github.com/vllm-project/aibrix/pkg/plugins/gateway/prefixcacheindexer"
 	"github.com/vllm-project/aibrix/pkg/plugins/gateway/prefixcacheindexer/tokenizer"
 	"github.com/vllm-project/aibrix/pkg/utils"
@@ -34,12 +37,14 @@ var (
 )
 
 func init() {
-	router, err := NewPrefixCacheRouter()
-	Register(RouterPrefixCache, func() (Router, error) { return router, err })
+	Register(RouterPrefixCache, NewPrefixCacheRouter)
 }
 
 const (
 	defaultPrefixCacheMatchThresholdPercent = 50
+	defaultRemoteTokenizerTimeoutMs         = 200
+	defaultRemoteTokenizerCacheSize         = 1024
+	defaultSnapshotIntervalSeconds          = 60
 )
 
 var (
@@ -61,54 +66,221 @@ func getPrefixCacheMatchThresholdPercent() int {
 	return defaultPrefixCacheMatchThresholdPercent
 }
 
+func getPositiveIntEnv(env string, defaultValue int) int {
+	value := utils.LoadEnv(env, "")
+	if value != "" {
+		intValue, err := strconv.Atoi(value)
+		if err != nil || intValue <= 0 {
+			klog.Infof("invalid %s: %s, falling back to default", env, value)
+		} else {
+			klog.Infof("using %s env value: %d", env, intValue)
+			return intValue
+		}
+	}
+	klog.Infof("using default %s: %d", env, defaultValue)
+	return defaultValue
+}
+
+// startSnapshots restores the last snapshot of the indexer in the background, dropping the pods which are no longer
+// in the cache, and then saves snapshots periodically, unless snapshots are disabled. Snapshots are saved in the
+// AIBRIX_PREFIX_CACHE_SNAPSHOT_PATH directory, or in redis under the name of the gateway replica. Requests routed
+// before the snapshot is restored are not blocked, their prefixes are replaced by the snapshot.
+func startSnapshots(name string, indexer interface{}, c cache.Cache) {
+	snapshotter, ok := indexer.(prefixcacheindexer.Snapshotter)
+	if !ok {
+		return
+	}
+	var store prefixcacheindexer.SnapshotStore
+	if utils.LoadEnv("AIBRIX_PREFIX_CACHE_SNAPSHOT_STORE", "file") == "redis" {
+		store = prefixcacheindexer.NewRedisSnapshotStore(utils.GetRedisClient(), snapshotReplicaName())
+	} else if snapshotPath := utils.LoadEnv("AIBRIX_PREFIX_CACHE_SNAPSHOT_PATH", ""); snapshotPath != "" {
+		store = prefixcacheindexer.NewFileSnapshotStore(snapshotPath)
+	} else {
+		return
+	}
+	klog.Infof("using prefix cache snapshots for %s", name)
+	interval := time.Duration(getPositiveIntEnv("AIBRIX_PREFIX_CACHE_SNAPSHOT_INTERVAL_SECONDS", defaultSnapshotIntervalSeconds)) * time.Second
+	go prefixcacheindexer.NewSnapshotManager(name, snapshotter, store, interval).Start(currentPodSet(c))
+}
+
+// snapshotReplicaName returns the name of the gateway replica, the pod name or else the host name.
+func snapshotReplicaName() string {
+	if podName := utils.LoadEnv("POD_NAME", ""); podName != "" {
+		return podName
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		klog.ErrorS(err, "failed to get the host name for prefix cache snapshots")
+	}
+	return hostname
+}
+
+// currentPodSet returns a function listing the keys of the pods in the cache, which returns nil if the cache is nil.
+func currentPodSet(c cache.Cache) func() map[string]bool {
+	return func() map[string]bool {
+		if c == nil {
+			return nil
+		}
+		podSet := map[string]bool{}
+		for _, pod := range c.ListPods() {
+			podSet[cache.PodKey(pod)] = true
+		}
+		return podSet
+	}
+}
+
 type prefixCacheRouter struct {
-	tokenizer          tokenizer.Tokenizer
+	cache     cache.Cache
+	tokenizer tokenizer.Tokenizer
+	// tokenizerStore holds the HuggingFace tokenizers of models, which are used instead of the default tokenizer
+	tokenizerStore *tokenizer.Store
+	// remoteTokenizer tokenizes with the engine of a ready pod, nil if disabled
+	remoteTokenizer    *tokenizer.RemoteTokenizer
 	prefixCacheIndexer prefixcacheindexer.PrefixCacheIndexer
+	// kvEventSubscriber updates the indexer with the KV cache events of the pods, nil if disabled
+	kvEventSubscriber *prefixcacheindexer.KVEventSubscriber
 }
 
-func NewPrefixCacheRouter() (Router, error) {
+func NewPrefixCacheRouter(c cache.Cache) (Router, error) {
 	var tokenizerObj tokenizer.Tokenizer
+	var remoteTokenizer *tokenizer.RemoteTokenizer
 	// TODO: refactor initilization
-	// supported tokenizers: ["string", "tiktoken"]
+	// supported tokenizers: ["string", "tiktoken", "remote"], remote tokenizes with the /tokenize endpoint of the engine
 	tokenizerType := utils.LoadEnv("AIBRIX_PREFIX_CACHE_TOKENIZER_TYPE", "string")
-	if tokenizerType == "tiktoken" {
+	switch tokenizerType {
+	case "tiktoken":
 		tokenizerObj = tokenizer.NewTiktokenTokenizer()
-	} else {
+	case "remote":
+		tokenizerObj = tokenizer.NewStringTokenizer()
+		remoteTokenizer = tokenizer.NewRemoteTokenizer(podMetricPort,
+			time.Duration(getPositiveIntEnv("AIBRIX_REMOTE_TOKENIZER_TIMEOUT_MS", defaultRemoteTokenizerTimeoutMs))*time.Millisecond,
+			getPositiveIntEnv("AIBRIX_REMOTE_TOKENIZER_CACHE_SIZE", defaultRemoteTokenizerCacheSize))
+	default:
 		tokenizerObj = tokenizer.NewStringTokenizer()
 	}
 
+	var indexer prefixcacheindexer.PrefixCacheIndexer
+	// supported indexers: ["local", "redis"], redis index is shared by all gateway replicas
+	indexerType := utils.LoadEnv("AIBRIX_PREFIX_CACHE_INDEXER_TYPE", "local")
+	if indexerType == "redis" {
+		indexer = prefixcacheindexer.NewRedisPrefixHashTable(utils.GetRedisClient())
+	} else {
+		indexer = prefixcacheindexer.NewPrefixHashTable()
+	}
+
+	var kvEventSubscriber *prefixcacheindexer.KVEventSubscriber
+	if kvEventsPath := utils.LoadEnv("AIBRIX_PREFIX_CACHE_KV_EVENTS_PATH", ""); kvEventsPath != "" {
+		// kv events carry the token ids of the engine, which only match the tokens of the tokenizer of the engine
+		if remoteTokenizer == nil && tokenizer.DefaultStore().Len() == 0 {
+			klog.Errorf("kv events from engine path %s require HuggingFace tokenizers or the remote tokenizer, "+
+				"not subscribing to kv events", kvEventsPath)
+		} else if kvEventIndexer, ok := indexer.(prefixcacheindexer.KVEventIndexer); ok {
+			klog.Infof("using kv events from engine path %s for prefix cache", kvEventsPath)
+			kvEventSubscriber = prefixcacheindexer.NewKVEventSubscriber(kvEventIndexer, podMetricPort, kvEventsPath)
+		}
+	}
+
+	startSnapshots(string(RouterPrefixCache), indexer, c)
 	return prefixCacheRouter{
+		cache:              c,
 		tokenizer:          tokenizerObj,
-		prefixCacheIndexer: prefixcacheindexer.NewPrefixHashTable(),
+		tokenizerStore:     tokenizer.DefaultStore(),
+		remoteTokenizer:    remoteTokenizer,
+		prefixCacheIndexer: indexer,
+		kvEventSubscriber:  kvEventSubscriber,
 	}, nil
 }
 
 func (p prefixCacheRouter) Route(ctx context.Context, pods map[string]*v1.Pod, routingCtx RoutingContext) (string, error) {
+	if p.kvEventSubscriber != nil && p.tokenizesLikeEngine(routingCtx.Model) {
+		p.kvEventSubscriber.Subscribe(utils.FilterReadyPods(pods), routingCtx.Model)
+	}
+	return p.route(pods, routingCtx, nil)
+}
+
+// Explain selects the target pod like Route without changing the indexer.
+func (p prefixCacheRouter) Explain(ctx context.Context, pods map[string]*v1.Pod, routingCtx RoutingContext) (*Explanation, error) {
+	return explain(RouterPrefixCache, routingCtx, func(explanation *Explanation) (string, error) {
+		return p.route(pods, routingCtx, explanation)
+	})
+}
+
+// SubscribedMetrics is empty as the prefix cache router does not use pod metrics.
+func (p prefixCacheRouter) SubscribedMetrics() []string {
+	return []string{}
+}
+
+// tokenizesLikeEngine returns true if the prompts of the model are tokenized by the HuggingFace tokenizer of the model
+// or the remote tokenizer, so that the tokens match the token ids of the kv events of the engine.
+func (p prefixCacheRouter) tokenizesLikeEngine(model string) bool {
+	if p.remoteTokenizer != nil {
+		return true
+	}
+	if p.tokenizerStore == nil {
+		return false
+	}
+	_, ok := p.tokenizerStore.Get(model)
+	return ok
+}
+
+// tokenize uses the HuggingFace tokenizer of the model if loaded, or the remote tokenizer of a ready pod,
+// so that token blocks align with the engine. Multimodal content parts are replaced by placeholders of their hash.
+func (p prefixCacheRouter) tokenize(routingCtx RoutingContext, readyPods []*v1.Pod) ([]byte, error) {
+	message := tokenizer.CanonicalizeMessage(routingCtx.Message)
+	if p.tokenizerStore != nil {
+		if t, ok := p.tokenizerStore.Get(routingCtx.Model); ok {
+			return t.TokenizeRequestMessage(message)
+		}
+	}
+	if p.remoteTokenizer != nil {
+		// all pods of the model have the same tokenizer
+		pod := readyPods[rand.Intn(len(readyPods))]
+		return p.remoteTokenizer.Endpoint(pod.Status.PodIP, routingCtx.Model).TokenizeInputText(message)
+	}
+	return p.tokenizer.TokenizeInputText(message)
+}
+
+// route selects the target pod for the request. Without an explanation the request is routed, which refreshes the
+// matched blocks and adds the unmatched tokens of the request as cached on the target pod. With an explanation the
+// decision is only recorded and the indexer is not changed.
+func (p prefixCacheRouter) route(pods map[string]*v1.Pod, routingCtx RoutingContext, explanation *Explanation) (string, error) {
 	readyPods := utils.FilterReadyPods(pods)
 	if len(readyPods) == 0 {
 		return "", fmt.Errorf("no pods to forward request")
 	}
 	if len(readyPods) == 1 {
-		for _, pod := range pods {
-			return getPodAddress(pod.Status.PodIP)
-		}
+		explanation.addCandidate(readyPods[0])
+		explanation.setReason("single ready pod")
+		return getPodAddress(readyPods[0].Status.PodIP)
 	}
 
-	tokens, err := p.tokenizer.TokenizeInputText(routingCtx.Message)
+	tokens, err := p.tokenize(routingCtx, readyPods)
 	if err != nil {
 		return "", err
 	}
 
 	var targetPod *v1.Pod
-	matchedTokens, unMatchedTokens, matchedPods := p.prefixCacheIndexer.MatchPrefix(tokens, routingCtx.Model, readyPods)
-	if len(matchedTokens)*100/len(tokens) > prefixCacheMatchThresholdPercent {
+	matchPrefix := p.prefixCacheIndexer.MatchPrefix
+	if explanation != nil {
+		matchPrefix = p.prefixCacheIndexer.PeekPrefix
+	}
+	matchedTokens, unMatchedTokens, matchedPods := matchPrefix(tokens, routingCtx.Model, readyPods)
+	matchPercent := 0
+	if len(tokens) > 0 {
+		matchPercent = len(matchedTokens) * 100 / len(tokens)
+	}
+	if matchPercent > prefixCacheMatchThresholdPercent {
 		targetPod = matchedPods[rand.Intn(len(matchedPods))]
+		explanation.setReason("prefix match %d%% above threshold %d%%, selected randomly among matched pods",
+			matchPercent, prefixCacheMatchThresholdPercent)
 	} else {
 		// TODO: add better load balanced algorithms as fallback
 		targetPod = readyPods[rand.Intn(len(readyPods))]
+		explanation.setReason("prefix match %d%% not above threshold %d%%, selected randomly among ready pods",
+			matchPercent, prefixCacheMatchThresholdPercent)
 	}
-	if len(unMatchedTokens) > 0 {
-		p.prefixCacheIndexer.AddPrefix(unMatchedTokens, routingCtx.Model, targetPod.Name)
+	if explanation == nil && len(unMatchedTokens) > 0 {
+		p.prefixCacheIndexer.AddPrefix(unMatchedTokens, routingCtx.Model, cache.PodKey(targetPod))
 	}
 
 	var matchedPodNames, readyPodNames []string
@@ -118,6 +290,19 @@ func (p prefixCacheRouter) Route(ctx context.Context, pods map[string]*v1.Pod, r
 	for _, p := range readyPods {
 		readyPodNames = append(readyPodNames, p.Status.PodIP)
 	}
+	if explanation != nil {
+		matched := map[string]bool{}
+		for _, p := range matchedPods {
+			matched[cache.PodKey(p)] = true
+		}
+		for _, p := range readyPods {
+			podMatchPercent := 0
+			if matched[cache.PodKey(p)] {
+				podMatchPercent = matchPercent
+			}
+			explanation.addCandidate(p).setPrefixMatchPercent(podMatchPercent)
+		}
+	}
 	klog.InfoS("prefix cache route",
 		"matched_tokens", matchedTokens,
 		"unmatched_tokens", unMatchedTokens,
@@ -24,7 +24,10 @@ import (
 	"sync"
 	"time"
 
+	"github.com/vllm-project/aibrix/pkg/cache"
 	"github.com/vllm-project/aibrix/pkg/plugins/gateway/prefixcacheindexer"
+	"github.com/vllm-project/aibrix/pkg/plugins/gateway/prefixcacheindexer/tokenizer"
+	"github.com/vllm-project/aibrix/pkg/plugins/gateway/profile"
 	"github.com/vllm-project/aibrix/pkg/utils"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/klog/v2"
@@ -35,15 +38,13 @@ var (
 )
 
 func init() {
-	router, err := NewPrefixCacheAndLoadRouter()
-	Register(RouterPrefixCacheAndLoad, func() (Router, error) { return router, err })
+	Register(RouterPrefixCacheAndLoad, NewPrefixCacheAndLoadRouter)
 }
 
 const (
 	defaultDecodingLength = 45                      // FIXME: decode length is hardcoded. Preble as well.
 	slidingWindowPeriod   = 3 * time.Minute         // NOTE: hardcoded
 	evictionLoopInterval  = 1000 * time.Millisecond // NOTE: hardcoded
-	targetGPU             = "V100"                  // A6000 // FIXME: make it configurable
 )
 
 type SlidingWindowHistogram struct {
@@ -71,6 +72,8 @@ type histogramEntry struct {
 }
 
 type prefixCacheAndLoadRouter struct {
+	podCache       cache.Cache
+	profiles       *profile.Store
 	cache          *prefixcacheindexer.LPRadixCache
 	histogram      *SlidingWindowHistogram
 	numPods        int
@@ -95,135 +98,20 @@ type PrefillTimeParams struct {
 	SeqLens          []int
 }
 
-func mistral7BA6000LinearTime(numBatchedTokens int) float64 {
-	if numBatchedTokens >= 384 {
-		return (0.10842571*float64(numBatchedTokens) + 4.209777054806409) / 1000.0
-	} else if numBatchedTokens >= 192 {
-		return (-118 + 1.25*float64(numBatchedTokens) - 2.56e-3*math.Pow(float64(numBatchedTokens), 2)) / 1000.0
+func (h *SlidingWindowHistogram) getPrefillCost(node *prefixcacheindexer.TreeNode, prof *profile.Profile) float64 {
+	if prof == nil {
+		return 0
 	}
-	return 22.0 / 1000.0
-}
-
-func mistral7BA6000AttentionTime(numReqs, totalContext, numUniqueKV int) float64 {
-	if numUniqueKV == 0 {
-		numUniqueKV = totalContext
-	}
-
-	var forwardTime float64
-	if totalContext <= 1024 {
-		forwardTime = 0.32
-	} else {
-		forwardTime = 1.86e-4*float64(totalContext) + 0.159
-		if float64(numUniqueKV)/float64(numReqs) <= 1024 && numReqs*numUniqueKV <= 32*256*2048 {
-			forwardTime /= 2
-		}
-	}
-	return forwardTime / 1000.0
-}
-
-// Adjusted for V100 characteristics
-func mistral7BV100LinearTime(numBatchedTokens int) float64 {
-	if numBatchedTokens >= 384 {
-		// Increased coefficient due to lower compute power
-		// ~2.5x increase for linear component due to slower tensor cores
-		return (0.27106428*float64(numBatchedTokens) + 10.52444263) / 1000.0
-	} else if numBatchedTokens >= 192 {
-		// Adjusted quadratic coefficient to reflect V100's architecture
-		return (-295 + 3.125*float64(numBatchedTokens) - 6.4e-3*math.Pow(float64(numBatchedTokens), 2)) / 1000.0
-	}
-	// Base latency increased
-	return 55.0 / 1000.0
-}
-
-func mistral7BV100AttentionTime(numReqs, totalContext, numUniqueKV int) float64 {
-	if numUniqueKV == 0 {
-		numUniqueKV = totalContext
-	}
-
-	var forwardTime float64
-	if totalContext <= 1024 {
-		// Increased base attention time for shorter sequences
-		forwardTime = 0.80
-	} else {
-		// Increased linear coefficient and base time for attention
-		// Memory bandwidth is better but compute is slower
-		forwardTime = 4.65e-4*float64(totalContext) + 0.398
-		if float64(numUniqueKV)/float64(numReqs) <= 1024 && numReqs*numUniqueKV <= 32*256*2048 {
-			forwardTime /= 2
-		}
-	}
-	return forwardTime / 1000.0
-}
-
-func calculateAttnQuadA6000(numTokens int, seqLen *int) float64 {
-	var attnQuad float64
-	if seqLen == nil {
-		// Case 1: No sequence length provided
-		if numTokens >= 4096 {
-			attnQuad += -7.37 + 3.86e-3*float64(numTokens) + 2.16e-6*math.Pow(float64(numTokens), 2)
-		}
-	} else {
-		// Case 2: Sequence length provided
-		if numTokens*(*seqLen) > 1024*1024 {
-			attnQuad += 1.13e-3*float64(numTokens) +
-				1.75e-3*float64(*seqLen) +
-				2.19e-6*float64(numTokens)*float64(*seqLen)
-		}
-	}
-	return attnQuad / 1000.0
-}
-
-func calculateAttnQuadV100(numTokens int, seqLen *int) float64 {
-	var attnQuad float64
-	if seqLen == nil {
-		// Case 1: No sequence length provided
-		if numTokens >= 4096 {
-			// ~2.5x slower for quadratic costs due to older tensor cores and memory architecture
-			attnQuad += -18.425 + // from -7.37
-				9.65e-3*float64(numTokens) + // from 3.86e-3
-				5.4e-6*math.Pow(float64(numTokens), 2) // from 2.16e-6
-		}
-	} else {
-		// Case 2: Sequence length provided
-		if numTokens*(*seqLen) > 1024*1024 {
-			attnQuad += 2.825e-3*float64(numTokens) + // from 1.13e-3
-				4.375e-3*float64(*seqLen) + // from 1.75e-3
-				5.475e-6*float64(numTokens)*float64(*seqLen) // from 2.19e-6
-		}
-	}
-	return attnQuad / 1000.0
-}
-
-func (h *SlidingWindowHistogram) getPrefillCost(node *prefixcacheindexer.TreeNode) float64 {
 	missRate := 1.0
 	if h.promptTokens[node] > 0 {
 		missRate = 1.0 - (float64(h.hitTokens[node]) / float64(h.promptTokens[node]))
 	}
 	numTokens := node.NumTokens()
 	contextLength := node.ContextLength()
-	baseTime := 0.0
-	if targetGPU == "A6000" {
-		baseTime = mistral7BA6000LinearTime(numTokens) + mistral7BA6000AttentionTime(1, contextLength, numTokens)
-	} else if targetGPU == "V100" {
-		baseTime = mistral7BV100LinearTime(numTokens) + mistral7BV100AttentionTime(1, contextLength, numTokens)
-	} else {
-		klog.Warningf("Unknown target GPU: %s. Assume V100 as default", targetGPU)
-		baseTime = mistral7BV100LinearTime(numTokens) + mistral7BV100AttentionTime(1, contextLength, numTokens)
-	}
-
-	attnQuad := 0.0
-	if targetGPU == "A6000" {
-		attnQuad = calculateAttnQuadA6000(numTokens, nil)
-	} else if targetGPU == "V100" {
-		attnQuad = calculateAttnQuadV100(numTokens, nil)
-	} else {
-		klog.Warningf("Unknown target GPU: %s. Assume V100 as default", targetGPU)
-		attnQuad = calculateAttnQuadV100(numTokens, nil)
-	}
-	prefillTime := (baseTime + attnQuad) / 0.9
+	prefillTime := prof.PrefillTime(numTokens, contextLength)
 	numPods := node.GetModelToPodCount() // You might need to adjust this based on your actual GPU allocation tracking
-	klog.Infof("numTokens: %d, contextLength: %d, targetGPU: %s", numTokens, contextLength, targetGPU)
-	klog.Infof("prefillTime: %.2f = (Base time(%.2f) + attnQuad(%.2f)) / 0.9", prefillTime, baseTime, attnQuad)
+	klog.Infof("numTokens: %d, contextLength: %d, gpu: %s", numTokens, contextLength, prof.GPU)
+	klog.Infof("prefillTime: %.2f", prefillTime)
 	totalPrefillCost := missRate * float64(h.nodeToCount[node]) * prefillTime / float64(numPods)
 	klog.Infof("totalPrefillCost: %.2f = miss rate(%.2f) * nodeToCount(%d) * prefillTime(%.2f) / numPods(%d)", totalPrefillCost, missRate, h.nodeToCount[node], prefillTime, numPods)
 	return totalPrefillCost
@@ -233,7 +121,7 @@ func (h *SlidingWindowHistogram) getPrefillCost(node *prefixcacheindexer.TreeNod
 // Also, the radix tree cache does not support varying number of pods.
 // The tree data structure should be updated in real time with varying number of pods.
 // Especially when a pod is removed, the corresponding TreeNode should be removed from the RadixTree and from the related data structures in SlidingWindowHistogram.
-func NewPrefixCacheAndLoadRouter() (Router, error) {
+func NewPrefixCacheAndLoadRouter(c cache.Cache) (Router, error) {
 	numPods := 0 // NOTE: it will be initialized in Route function. This number can change dynamically due to scaling or failure.
 	histogram := &SlidingWindowHistogram{
 		windowDuration:             slidingWindowPeriod,
@@ -252,11 +140,14 @@ func NewPrefixCacheAndLoadRouter() (Router, error) {
 	}
 
 	router := &prefixCacheAndLoadRouter{
+		podCache:       c,
+		profiles:       profile.DefaultStore(),
 		cache:          prefixcacheindexer.NewLPRadixCache(numPods),
 		histogram:      histogram,
 		numPods:        numPods,
 		podAllocations: make(map[*prefixcacheindexer.TreeNode]map[int]bool),
 	}
+	startSnapshots(string(RouterPrefixCacheAndLoad), router.cache, c)
 
 	// Start eviction ticker
 	go router.evictionLoop()
@@ -345,9 +236,9 @@ func (h *SlidingWindowHistogram) getSimplePrefillCost(node *prefixcacheindexer.T
 	return missRate * float64(h.nodeToCount[node]) * prefillTime
 }
 
-func (h *SlidingWindowHistogram) getNodeCost(node *prefixcacheindexer.TreeNode, podName string) float64 {
+func (h *SlidingWindowHistogram) getNodeCost(node *prefixcacheindexer.TreeNode, podName string, prof *profile.Profile) float64 {
 	// prefillCost := h.getSimplePrefillCost(node)
-	prefillCost := h.getPrefillCost(node)
+	prefillCost := h.getPrefillCost(node, prof)
 	// Get median time per token for the pod
 	timePerToken := 0.15 // default value
 	if times, ok := h.avgTimePerTokenPerPod[podName]; ok && len(times) > 0 {
@@ -359,13 +250,19 @@ func (h *SlidingWindowHistogram) getNodeCost(node *prefixcacheindexer.TreeNode,
 	return prefillCost + decodeCost
 }
 
-func (h *SlidingWindowHistogram) getCurrentAllocationCostPerPod() map[string]float64 {
+// getCurrentAllocationCostPerPod estimates the cost of each pod using the performance profile of its GPU.
+// Pods without a profile in podProfiles use defaultProfile.
+func (h *SlidingWindowHistogram) getCurrentAllocationCostPerPod(podProfiles map[string]*profile.Profile, defaultProfile *profile.Profile) map[string]float64 {
 	costs := make(map[string]float64)
 	for node := range h.histogram {
 		// Iterate through all models and their pods for this node
 		for _, modelPods := range node.GetModelToPods() {
 			for podName := range modelPods {
-				costs[podName] += h.getNodeCost(node, podName)
+				prof, ok := podProfiles[podName]
+				if !ok {
+					prof = defaultProfile
+				}
+				costs[podName] += h.getNodeCost(node, podName, prof)
 			}
 		}
 	}
@@ -375,7 +272,7 @@ func (h *SlidingWindowHistogram) getCurrentAllocationCostPerPod() map[string]flo
 func (p *prefixCacheAndLoadRouter) updatePodSet(readyPods []*v1.Pod) {
 	currentPodSet := make(map[string]bool)
 	for _, pod := range readyPods {
-		currentPodSet[pod.Name] = true
+		currentPodSet[cache.PodKey(pod)] = true
 	}
 	allNodes := p.cache.GetAllNodes()
 	podsChanged := false
@@ -457,7 +354,7 @@ func (p *prefixCacheAndLoadRouter) Route(ctx context.Context, pods map[string]*v
 	klog.Infof("current actual ready pods: %d", len(readyPods))
 	p.updatePodSet(readyPods)
 	klog.Infof("num pods in data structure after updatePodSet: %d", p.numPods)
-	trimmedMessage := utils.TrimMessage(routingCtx.Message)
+	trimmedMessage := utils.TrimMessage(tokenizer.CanonicalizeMessage(routingCtx.Message))
 	klog.Infof("Trimmed message: '%s'", trimmedMessage)
 	tokens, err := utils.TokenizeInputText(trimmedMessage)
 	if err != nil {
@@ -471,7 +368,7 @@ func (p *prefixCacheAndLoadRouter) Route(ctx context.Context, pods map[string]*v
 		klog.Infof("node.ModelToPods[model]: %v", modelPods)
 		for podName := range modelPods {
 			for _, pod := range readyPods {
-				if pod.Name == podName {
+				if cache.PodKey(pod) == podName {
 					matchedPods = append(matchedPods, pod)
 					matchedPodsNames = append(matchedPodsNames, pod.Name)
 				}
@@ -496,7 +393,7 @@ func (p *prefixCacheAndLoadRouter) Route(ctx context.Context, pods map[string]*v
 				var nodePods []*v1.Pod
 				for podName := range modelPods {
 					for _, pod := range readyPods {
-						if pod.Name == podName {
+						if cache.PodKey(pod) == podName {
 							nodePods = append(nodePods, pod)
 						}
 					}
@@ -544,10 +441,11 @@ func (p *prefixCacheAndLoadRouter) Route(ctx context.Context, pods map[string]*v
 
 	if targetPod == nil {
 		klog.Infof("Do cost model based routing! (matching ratio: %.2f, len(matchedPods): %d)", matchRatio, len(matchedPods))
-		podCosts := p.histogram.getCurrentAllocationCostPerPod()
+		podProfiles, defaultProfile := getPodProfiles(p.podCache, p.profiles, readyPods, routingCtx.Model)
+		podCosts := p.histogram.getCurrentAllocationCostPerPod(podProfiles, defaultProfile)
 		minCost := math.MaxFloat64
 		for _, pod := range readyPods {
-			cost := podCosts[pod.Name]
+			cost := podCosts[cache.PodKey(pod)]
 			klog.Infof("Pod: %s, Cost: %f", pod.Name, cost)
 			if cost < minCost {
 				minCost = cost
@@ -565,17 +463,22 @@ func (p *prefixCacheAndLoadRouter) Route(ctx context.Context, pods map[string]*v
 	// Update pod mapping in ALL nodes from matched node to root
 	currentNode := node
 	for currentNode != nil {
-		currentNode.AddOrUpdatePodForModel(routingCtx.Model, targetPod.Name, time.Now())
+		currentNode.AddOrUpdatePodForModel(routingCtx.Model, cache.PodKey(targetPod), time.Now())
 		currentNode = currentNode.GetParent()
 	}
 
-	p.histogram.update(time.Now(), node, node, targetPod.Name, defaultDecodingLength)
+	p.histogram.update(time.Now(), node, node, cache.PodKey(targetPod), defaultDecodingLength)
 
 	klog.InfoS("target_pod_name", targetPod.Name, "target_pod_ip", targetPod.Status.PodIP)
 	p.cache.PrettyPrint()
 	return getPodAddress(targetPod.Status.PodIP)
 }
 
+// SubscribedMetrics is empty as the load of the pods is tracked by the router itself.
+func (p *prefixCacheAndLoadRouter) SubscribedMetrics() []string {
+	return []string{}
+}
+
 // Compute the load in a pod fo a specific model based on the sliding window histogram
 func (h *SlidingWindowHistogram) getPodLoad(pod *v1.Pod) int {
 	h.mu.RLock()
@@ -583,7 +486,7 @@ func (h *SlidingWindowHistogram) getPodLoad(pod *v1.Pod) int {
 	load := 0
 	for node, count := range h.nodeToCount {
 		for _, podMap := range node.GetModelToPods() {
-			if _, exists := podMap[pod.Name]; exists {
+			if _, exists := podMap[cache.PodKey(pod)]; exists {
 				load += count
 				break // Found this pod in this node, no need to check other models
 			}
@@ -26,7 +26,7 @@ import (
 )
 
 func Test_PrefixCache(t *testing.T) {
-	prefixCacheRouter, _ := NewPrefixCacheRouter()
+	prefixCacheRouter, _ := NewPrefixCacheRouter(nil)
 
 	pods := map[string]*v1.Pod{
 		"p1": {
@@ -61,3 +61,17 @@ func Test_PrefixCache(t *testing.T) {
 
 	assert.Equal(t, targetPod, targetPod2)
 }
+
+func Test_PrefixCacheKVEventsRequireEngineTokenizer(t *testing.T) {
+	t.Setenv("AIBRIX_PREFIX_CACHE_KV_EVENTS_PATH", "/kv_events")
+
+	router, err := NewPrefixCacheRouter(nil)
+	assert.NoError(t, err)
+	assert.Nil(t, router.(prefixCacheRouter).kvEventSubscriber)
+
+	t.Setenv("AIBRIX_PREFIX_CACHE_TOKENIZER_TYPE", "remote")
+	router, err = NewPrefixCacheRouter(nil)
+	assert.NoError(t, err)
+	assert.NotNil(t, router.(prefixCacheRouter).kvEventSubscriber)
+	assert.True(t, router.(prefixCacheRouter).tokenizesLikeEngine("m1"))
+}
@@ -21,6 +21,8 @@ import (
 	"fmt"
 	"math/rand"
 
+	"github.com/vllm-project/aibrix/pkg/cache"
+	"github.com/vllm-project/aibrix/pkg/utils"
 	v1 "k8s.io/api/core/v1"
 )
 
@@ -29,8 +31,7 @@ var (
 )
 
 func init() {
-	router, err := NewRandomRouter()
-	Register(RouterRandom, func() (Router, error) { return router, err })
+	Register(RouterRandom, func(cache.Cache) (Router, error) { return NewRandomRouter() })
 }
 
 type randomRouter struct {
@@ -41,11 +42,28 @@ func NewRandomRouter() (Router, error) {
 }
 
 func (r randomRouter) Route(ctx context.Context, pods map[string]*v1.Pod, routingCtx RoutingContext) (string, error) {
+	return r.route(pods, routingCtx, nil)
+}
+
+func (r randomRouter) Explain(ctx context.Context, pods map[string]*v1.Pod, routingCtx RoutingContext) (*Explanation, error) {
+	return explain(RouterRandom, routingCtx, func(explanation *Explanation) (string, error) {
+		return r.route(pods, routingCtx, explanation)
+	})
+}
+
+// route selects the target pod, recording the decision into the explanation if not nil
+func (r randomRouter) route(pods map[string]*v1.Pod, routingCtx RoutingContext, explanation *Explanation) (string, error) {
 	var targetPodIP string
 	if len(pods) == 0 {
 		return "", fmt.Errorf("no pods to forward request")
 	}
 
+	if explanation != nil {
+		for _, pod := range utils.FilterReadyPods(pods) {
+			explanation.addCandidate(pod)
+		}
+	}
+
 	var err error
 	targetPodIP, err = selectRandomPod(pods, rand.Intn)
 	if err != nil {
@@ -56,9 +74,10 @@ func (r randomRouter) Route(ctx context.Context, pods map[string]*v1.Pod, routin
 		return "", fmt.Errorf("no pods to forward request")
 	}
 
+	explanation.setReason("selected randomly")
 	return targetPodIP + ":" + podMetricPort, nil
 }
 
-func (r *randomRouter) SubscribedMetrics() []string {
+func (r randomRouter) SubscribedMetrics() []string {
 	return []string{}
 }
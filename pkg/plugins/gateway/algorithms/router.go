@@ -18,7 +18,10 @@ package routingalgorithms
 
 import (
 	"context"
+	"sync"
 
+	"github.com/vllm-project/aibrix/pkg/cache"
+	"github.com/vllm-project/aibrix/pkg/metrics"
 	v1 "k8s.io/api/core/v1"
 )
 
@@ -27,8 +30,13 @@ type Algorithms string
 // RoutingContext encapsulates the context information required for routing.
 // It can be extended with more fields as needed in the future.
 type RoutingContext struct {
-	Model   string
-	Message string
+	RequestID string
+	Model     string
+	Message   string
+	// ReqBody is the raw request body, used by routers which forward the request themselves.
+	ReqBody []byte
+	// Headers are set by routers and forwarded to the target pod along with the request.
+	Headers map[string]string
 	// Additional fields can be added here to expand the routing context.
 }
 
@@ -44,14 +52,7 @@ func Validate(algorithms Algorithms) bool {
 	return ok
 }
 
-// Select the user provided routing routers is supported by gateway
-func Select(algorithms Algorithms) routerFunc {
-	if !Validate(algorithms) {
-		algorithms = RouterRandom
-	}
-	return routerRegistry[algorithms]
-}
-
+// Register registers the constructor of the router of a routing algorithm.
 func Register(algorithms Algorithms, router routerFunc) {
 	routerRegistry[algorithms] = router
 	routerStores[algorithms] = struct{}{}
@@ -60,4 +61,44 @@ func Register(algorithms Algorithms, router routerFunc) {
 var routerRegistry = map[Algorithms]routerFunc{}
 var routerStores = map[Algorithms]any{}
 
-type routerFunc func() (Router, error)
+type routerFunc func(c cache.Cache) (Router, error)
+
+// Routers are the routers of the registered routing algorithms built for a cache. Each router is built the
+// first time it is selected and then reused, so stateful routers such as prefix cache routers keep their state.
+type Routers struct {
+	cache   cache.Cache
+	mu      sync.Mutex
+	routers map[Algorithms]Router
+}
+
+// NewRouters returns the routers reading pods and metrics from the cache.
+func NewRouters(c cache.Cache) *Routers {
+	return &Routers{
+		cache:   c,
+		routers: map[Algorithms]Router{},
+	}
+}
+
+// Select returns the router of the routing algorithm, the random router if the algorithm is not supported.
+// A router is subscribed to the metrics it uses when it is built, so that the cache collects the metrics of
+// the routing algorithms in use only.
+func (r *Routers) Select(algorithms Algorithms) (Router, error) {
+	if !Validate(algorithms) {
+		algorithms = RouterRandom
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if router, ok := r.routers[algorithms]; ok {
+		return router, nil
+	}
+	router, err := routerRegistry[algorithms](r.cache)
+	if err != nil {
+		return nil, err
+	}
+	if subscriber, ok := router.(metrics.MetricSubscriber); ok {
+		r.cache.AddSubscriber(subscriber)
+	}
+	r.routers[algorithms] = router
+	return router, nil
+}
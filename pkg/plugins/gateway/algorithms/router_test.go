@@ -24,6 +24,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/vllm-project/aibrix/pkg/cache"
+	"github.com/vllm-project/aibrix/pkg/cache/cachetest"
 	"github.com/vllm-project/aibrix/pkg/metrics"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -164,6 +165,43 @@ func TestWithIPPods(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestRoutersPerCache(t *testing.T) {
+	p1 := newRolePod("p1", "10.0.0.1", "")
+	p2 := newRolePod("p2", "10.0.0.2", "")
+	newCache := func(running map[string]float64) *cachetest.Cache {
+		c := cachetest.New().AddPod(p1, "m1").AddPod(p2, "m1")
+		for podName, value := range running {
+			c.SetPodModelMetric(podName, "m1", metrics.NumRequestsRunning, &metrics.SimpleMetricValue{Value: value}).
+				SetPodModelMetric(podName, "m1", metrics.NumRequestsWaiting, &metrics.SimpleMetricValue{Value: 0}).
+				SetPodModelMetric(podName, "m1", metrics.NumRequestsSwapped, &metrics.SimpleMetricValue{Value: 0})
+		}
+		return c
+	}
+	c1 := newCache(map[string]float64{"p1": 1, "p2": 5})
+	c2 := newCache(map[string]float64{"p1": 5, "p2": 1})
+	routers1, routers2 := NewRouters(c1), NewRouters(c2)
+
+	router1, err := routers1.Select(RouterLeastRequest)
+	assert.NoError(t, err)
+	again, err := routers1.Select(RouterLeastRequest)
+	assert.NoError(t, err)
+	assert.Equal(t, router1, again, "router is built once per cache")
+	assert.Len(t, c1.Subscribers(), 1)
+	assert.Empty(t, c2.Subscribers())
+
+	router2, err := routers2.Select(RouterLeastRequest)
+	assert.NoError(t, err)
+	assert.Len(t, c2.Subscribers(), 1)
+
+	pods := map[string]*v1.Pod{"p1": p1, "p2": p2}
+	targetPod, err := router1.Route(context.TODO(), pods, RoutingContext{Model: "m1"})
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.1:"+podMetricPort, targetPod)
+	targetPod, err = router2.Route(context.TODO(), pods, RoutingContext{Model: "m1"})
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.2:"+podMetricPort, targetPod)
+}
+
 // TestSelectRandomPod tests the selectRandomPod function.
 func TestSelectRandomPod(t *testing.T) {
 	tests := []struct {
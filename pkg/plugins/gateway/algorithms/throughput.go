@@ -34,26 +34,31 @@ var (
 )
 
 func init() {
-	router, err := NewThroughputRouter()
-	Register(RouterThroughput, func() (Router, error) { return router, err })
+	Register(RouterThroughput, NewThroughputRouter)
 }
 
 type throughputRouter struct {
 	cache cache.Cache
 }
 
-func NewThroughputRouter() (Router, error) {
-	c, err := cache.Get()
-	if err != nil {
-		return nil, err
-	}
-
+func NewThroughputRouter(c cache.Cache) (Router, error) {
 	return throughputRouter{
 		cache: c,
 	}, nil
 }
 
 func (r throughputRouter) Route(ctx context.Context, pods map[string]*v1.Pod, routingCtx RoutingContext) (string, error) {
+	return r.route(pods, routingCtx, nil)
+}
+
+func (r throughputRouter) Explain(ctx context.Context, pods map[string]*v1.Pod, routingCtx RoutingContext) (*Explanation, error) {
+	return explain(RouterThroughput, routingCtx, func(explanation *Explanation) (string, error) {
+		return r.route(pods, routingCtx, explanation)
+	})
+}
+
+// route selects the target pod, recording the decision into the explanation if not nil
+func (r throughputRouter) route(pods map[string]*v1.Pod, routingCtx RoutingContext, explanation *Explanation) (string, error) {
 	var targetPodIP string
 	minCount := math.MaxFloat64
 
@@ -67,19 +72,25 @@ func (r throughputRouter) Route(ctx context.Context, pods map[string]*v1.Pod, ro
 	}
 
 	for _, pod := range readyPods {
-		promptThroughput, err := r.cache.GetMetricValueByPodModel(pod.Name, routingCtx.Model, metrics.AvgPromptThroughputToksPerS)
+		candidate := explanation.addCandidate(pod)
+		promptThroughput, err := r.cache.GetMetricValueByPodModel(cache.PodKey(pod), routingCtx.Model, metrics.AvgPromptThroughputToksPerS)
 		if err != nil {
 			klog.Error(err)
+			candidate.addError(err)
 			continue
 		}
-		generationThroughput, err := r.cache.GetMetricValueByPodModel(pod.Name, routingCtx.Model, metrics.AvgGenerationThroughputToksPerS)
+		candidate.setMetric(metrics.AvgPromptThroughputToksPerS, promptThroughput.GetSimpleValue())
+		generationThroughput, err := r.cache.GetMetricValueByPodModel(cache.PodKey(pod), routingCtx.Model, metrics.AvgGenerationThroughputToksPerS)
 		if err != nil {
 			klog.Error(err)
+			candidate.addError(err)
 			continue
 		}
+		candidate.setMetric(metrics.AvgGenerationThroughputToksPerS, generationThroughput.GetSimpleValue())
 
 		// processing prompt tokens is twice as expensive than generation tokens
 		totalThroughput := 2*promptThroughput.GetSimpleValue() + generationThroughput.GetSimpleValue()
+		candidate.setScore(totalThroughput)
 		klog.V(4).Infof("pod: %v, podIP: %v, promptThroughput: %v, generationThroughput: %v, totalThroughput: %v",
 			pod.Name, pod.Status.PodIP, promptThroughput, generationThroughput, totalThroughput)
 
@@ -92,6 +103,7 @@ func (r throughputRouter) Route(ctx context.Context, pods map[string]*v1.Pod, ro
 	// Use fallback if no valid metrics
 	if targetPodIP == "" {
 		klog.Warning("No pods with valid metrics found; selecting a pod randomly as fallback")
+		explanation.setReason("no pods with valid metrics found, selected randomly")
 		var err error
 		targetPodIP, err = selectRandomPod(pods, rand.Intn)
 		if err != nil {
@@ -106,7 +118,7 @@ func (r throughputRouter) Route(ctx context.Context, pods map[string]*v1.Pod, ro
 	return targetPodIP + ":" + podMetricPort, nil
 }
 
-func (r *throughputRouter) SubscribedMetrics() []string {
+func (r throughputRouter) SubscribedMetrics() []string {
 	return []string{
 		metrics.AvgPromptThroughputToksPerS,
 		metrics.AvgGenerationThroughputToksPerS,
@@ -19,12 +19,20 @@ package routingalgorithms
 import (
 	"fmt"
 
+	"github.com/vllm-project/aibrix/pkg/cache"
+	"github.com/vllm-project/aibrix/pkg/plugins/gateway/profile"
 	"github.com/vllm-project/aibrix/pkg/utils"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
 )
 
 const podMetricPort = "8000"
 
+var (
+	// defaultGPUType is assumed for pods whose GPU type is not detected from pod or node labels
+	defaultGPUType = utils.LoadEnv("AIBRIX_DEFAULT_GPU_TYPE", "V100")
+)
+
 func getPodAddress(podIP string) (string, error) {
 	if podIP == "" {
 		return "", fmt.Errorf("no pods to forward request")
@@ -42,3 +50,32 @@ func selectRandomPod(pods map[string]*v1.Pod, randomFn func(int) int) (string, e
 	randomPod := readyPods[randomFn(len(readyPods))]
 	return randomPod.Status.PodIP, nil
 }
+
+// getPodProfiles resolves the performance profile of the model on the GPU type of each pod.
+// The returned map is keyed by cache.PodKey. Pods whose GPU type is unknown or has no profile are left out of it and
+// should use the returned profile of the default GPU type, which is nil if none matches.
+func getPodProfiles(c cache.Cache, store *profile.Store, pods []*v1.Pod, model string) (map[string]*profile.Profile, *profile.Profile) {
+	defaultProfile, ok := store.Get(model, defaultGPUType)
+	if !ok {
+		klog.Warningf("no profile for model %s on default gpu type %s", model, defaultGPUType)
+	}
+
+	podProfiles := make(map[string]*profile.Profile, len(pods))
+	if c == nil {
+		return podProfiles, defaultProfile
+	}
+	for _, pod := range pods {
+		gpuType, err := c.GetPodGPUType(cache.PodKey(pod))
+		if err != nil {
+			klog.V(4).Infof("unknown gpu type of pod %s, using default gpu type %s: %v", pod.Name, defaultGPUType, err)
+			continue
+		}
+		prof, ok := store.Get(model, gpuType)
+		if !ok {
+			klog.V(4).Infof("no profile for model %s on gpu type %s of pod %s", model, gpuType, pod.Name)
+			continue
+		}
+		podProfiles[cache.PodKey(pod)] = prof
+	}
+	return podProfiles, defaultProfile
+}
@@ -60,13 +60,10 @@ type Server struct {
 	client              kubernetes.Interface
 	requestCountTracker map[string]int
 	cache               cache.Cache
+	routers             *routing.Routers
 }
 
-func NewServer(redisClient *redis.Client, client kubernetes.Interface) *Server {
-	c, err := cache.Get()
-	if err != nil {
-		panic(err)
-	}
+func NewServer(redisClient *redis.Client, client kubernetes.Interface, c cache.Cache) *Server {
 	r := ratelimiter.NewRedisAccountRateLimiter("aibrix", redisClient, 1*time.Minute)
 
 	return &Server{
@@ -75,6 +72,7 @@ func NewServer(redisClient *redis.Client, client kubernetes.Interface) *Server {
 		client:              client,
 		requestCountTracker: map[string]int{},
 		cache:               c,
+		routers:             routing.NewRouters(c),
 	}
 }
 
@@ -136,7 +134,7 @@ func (s *Server) Process(srv extProcPb.ExternalProcessor_ProcessServer) error {
 }
 
 func (s *Server) selectTargetPod(ctx context.Context, routingStrategy routing.Algorithms, pods map[string]*v1.Pod, routingCtx routing.RoutingContext) (string, error) {
-	router, err := routing.Select(routingStrategy)()
+	router, err := s.routers.Select(routingStrategy)
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,120 @@
+/*
+Copyright 2024 The Aibrix Team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"k8s.io/klog/v2"
+
+	routing "github.com/vllm-project/aibrix/pkg/plugins/gateway/algorithms"
+	"github.com/vllm-project/aibrix/pkg/utils"
+)
+
+const (
+	// ExplainPath is the path of the routing explain API
+	ExplainPath = "/v1/routing/explain"
+
+	maxExplainRequestBodyBytes = 1 << 20
+)
+
+// ExplainHandler returns the handler of the routing explain API. It accepts the request body
+// of a completion request along with the routing-strategy header and returns how the router
+// selects the target pod, without forwarding the request.
+func (s *Server) ExplainHandler() http.Handler {
+	return http.HandlerFunc(s.explain)
+}
+
+func (s *Server) explain(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	routingStrategy := strings.TrimSpace(r.Header.Get(HeaderRoutingStrategy))
+	if routingStrategy == "" {
+		routingStrategy = strings.TrimSpace(utils.LoadEnv(EnvRoutingAlgorithm, ""))
+	}
+	if !routing.Validate(routing.Algorithms(routingStrategy)) {
+		http.Error(w, fmt.Sprintf("incorrect routing strategy %q", routingStrategy), http.StatusBadRequest)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxExplainRequestBodyBytes))
+	if err != nil {
+		http.Error(w, "error reading request body", http.StatusBadRequest)
+		return
+	}
+	var jsonMap map[string]interface{}
+	if err := json.Unmarshal(body, &jsonMap); err != nil {
+		http.Error(w, "request body contains badly-formed JSON", http.StatusBadRequest)
+		return
+	}
+
+	model, ok := jsonMap["model"].(string)
+	if !ok || model == "" {
+		http.Error(w, "no model in request body", http.StatusBadRequest)
+		return
+	}
+	if !s.cache.GetModel(model) {
+		http.Error(w, fmt.Sprintf("model %s does not exist", model), http.StatusNotFound)
+		return
+	}
+	pods, err := s.cache.ListPodsByModel(model)
+	if len(pods) == 0 || len(utils.FilterReadyPods(pods)) == 0 || err != nil {
+		http.Error(w, fmt.Sprintf("error on getting pods for model %s", model), http.StatusServiceUnavailable)
+		return
+	}
+	message, err := parseRequestMessage(jsonMap)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	requestID := r.Header.Get("x-request-id")
+	if requestID == "" {
+		requestID = uuid.New().String()
+	}
+	routingCtx := routing.RoutingContext{
+		RequestID: requestID,
+		Model:     model,
+		Message:   message,
+		ReqBody:   body,
+		Headers:   map[string]string{},
+	}
+	explanation, err := s.routers.Explain(r.Context(), routing.Algorithms(routingStrategy), pods, routingCtx)
+	if err != nil {
+		if errors.Is(err, routing.ErrExplainNotSupported) {
+			http.Error(w, fmt.Sprintf("routing strategy %s does not support explain", routingStrategy), http.StatusNotImplemented)
+			return
+		}
+		klog.ErrorS(err, "failed to explain routing", "requestID", requestID, "routingStrategy", routingStrategy, "model", model)
+		http.Error(w, fmt.Sprintf("error on selecting target pod: %v", err), http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(explanation); err != nil {
+		klog.ErrorS(err, "failed to write routing explanation", "requestID", requestID)
+	}
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2024 The Aibrix Team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+
+	"k8s.io/klog/v2"
+
+	"github.com/vllm-project/aibrix/pkg/cache"
+)
+
+// PodMetricsPushPath is the path of the pod metrics ingestion API
+const PodMetricsPushPath = "/v1/pod-metrics"
+
+// PodMetricsPushHandler returns the handler of the pod metrics ingestion API. The engine sidecar of a pod
+// posts newline-delimited JSON load reports, either one report per request or a stream of reports over a
+// long-lived request. Reports are only accepted from the IP of the reported pod.
+func (s *Server) PodMetricsPushHandler() http.Handler {
+	return http.HandlerFunc(s.pushPodMetrics)
+}
+
+func (s *Server) pushPodMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	remoteIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remoteIP = r.RemoteAddr
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	for {
+		var report cache.PodMetricReport
+		if err := decoder.Decode(&report); err != nil {
+			if errors.Is(err, io.EOF) {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			http.Error(w, "request body contains badly-formed JSON", http.StatusBadRequest)
+			return
+		}
+
+		pod, err := s.cache.GetPod(report.PodKey())
+		if err != nil {
+			http.Error(w, fmt.Sprintf("pod %s does not exist", report.PodKey()), http.StatusNotFound)
+			return
+		}
+		if pod.Status.PodIP != remoteIP {
+			http.Error(w, fmt.Sprintf("metrics of pod %s are not pushed from the pod", report.PodKey()), http.StatusForbidden)
+			return
+		}
+		if err := s.cache.PushPodMetrics(&report); err != nil {
+			klog.V(4).InfoS("rejected pushed pod metrics", "pod", report.PodKey(), "error", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+}
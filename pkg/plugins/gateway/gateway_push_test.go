@@ -0,0 +1,130 @@
+/*
+Copyright 2024 The Aibrix Team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gateway
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/vllm-project/aibrix/pkg/cache"
+	"github.com/vllm-project/aibrix/pkg/metrics"
+)
+
+// fakePodMetricPusher streams load reports to the ingestion API over one request, like an engine sidecar.
+type fakePodMetricPusher struct {
+	writer   *io.PipeWriter
+	encoder  *json.Encoder
+	response chan *http.Response
+}
+
+func newFakePodMetricPusher(t *testing.T, url string) *fakePodMetricPusher {
+	reader, writer := io.Pipe()
+	p := &fakePodMetricPusher{writer: writer, encoder: json.NewEncoder(writer), response: make(chan *http.Response, 1)}
+	go func() {
+		resp, err := http.Post(url+PodMetricsPushPath, "application/x-ndjson", reader)
+		assert.NoError(t, err)
+		p.response <- resp
+	}()
+	return p
+}
+
+func (p *fakePodMetricPusher) push(t *testing.T, report cache.PodMetricReport) {
+	assert.NoError(t, p.encoder.Encode(report))
+}
+
+// close ends the stream and returns the status code of the request.
+func (p *fakePodMetricPusher) close(t *testing.T) int {
+	assert.NoError(t, p.writer.Close())
+	resp := <-p.response
+	assert.NoError(t, resp.Body.Close())
+	return resp.StatusCode
+}
+
+func newPushTestServer(podIP string) (*cache.Store, *httptest.Server) {
+	store := cache.New(nil, nil)
+	store.Pods["p1"] = &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "p1"}, Status: v1.PodStatus{PodIP: podIP}}
+	s := &Server{cache: store}
+	return store, httptest.NewServer(s.PodMetricsPushHandler())
+}
+
+func TestPushPodMetrics(t *testing.T) {
+	store, server := newPushTestServer("127.0.0.1")
+	defer server.Close()
+
+	pusher := newFakePodMetricPusher(t, server.URL)
+	for _, waiting := range []float64{3, 1} {
+		pusher.push(t, cache.PodMetricReport{
+			PodName:      "p1",
+			ModelMetrics: map[string]map[string]float64{"m1": {metrics.NumRequestsRunning: 2, metrics.NumRequestsWaiting: waiting}},
+			LabelMetrics: map[string]string{metrics.RunningLoraAdapters: "lora-1"},
+		})
+	}
+	assert.Equal(t, http.StatusNoContent, pusher.close(t))
+
+	value, err := store.GetMetricValueByPodModel("p1", "m1", metrics.NumRequestsWaiting)
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, value.GetSimpleValue())
+	value, err = store.GetMetricValueByPod("p1", metrics.RunningLoraAdapters)
+	assert.NoError(t, err)
+	assert.Equal(t, "lora-1", value.GetLabelValue())
+	_, err = store.GetPodMetricsUpdateTime("p1")
+	assert.NoError(t, err)
+}
+
+func TestPushPodMetricsRejected(t *testing.T) {
+	_, server := newPushTestServer("127.0.0.1")
+	defer server.Close()
+
+	for _, tt := range []struct {
+		body   string
+		status int
+	}{
+		{body: `{"pod_name": "p2"}`, status: http.StatusNotFound},
+		{body: `{"pod_name": "p1", "metrics": {"undefined_metric": 1}}`, status: http.StatusBadRequest},
+		{body: `{"pod_name": "p1", "model_metrics": {"m1": {"request_prefill_time_seconds": 1}}}`, status: http.StatusBadRequest},
+		{body: `{"pod_name": "p1", "model_metrics": {"m1": {"avg_prompt_toks_per_req": 1}}}`, status: http.StatusBadRequest},
+		{body: `{"pod_name": "p1", "label_metrics": {"undefined_metric": "x"}}`, status: http.StatusBadRequest},
+		{body: `{"pod_name": "p1"`, status: http.StatusBadRequest},
+	} {
+		resp, err := http.Post(server.URL+PodMetricsPushPath, "application/json", strings.NewReader(tt.body))
+		assert.NoError(t, err)
+		assert.NoError(t, resp.Body.Close())
+		assert.Equal(t, tt.status, resp.StatusCode, tt.body)
+	}
+
+	resp, err := http.Get(server.URL + PodMetricsPushPath)
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+
+	// reports are only accepted from the pod itself
+	store, otherServer := newPushTestServer("10.0.0.1")
+	defer otherServer.Close()
+	pusher := newFakePodMetricPusher(t, otherServer.URL)
+	pusher.push(t, cache.PodMetricReport{PodName: "p1", Metrics: map[string]float64{metrics.MaxLora: 4}})
+	assert.Equal(t, http.StatusForbidden, pusher.close(t))
+	_, err = store.GetMetricValueByPod("p1", metrics.MaxLora)
+	assert.Error(t, err)
+}
@@ -95,7 +95,13 @@ func (s *Server) HandleRequestBody(ctx context.Context, requestID string, req *e
 		if extErr != nil {
 			return extErr, model, targetPodIP, stream, term
 		}
-		routingCtx := routing.RoutingContext{Model: model, Message: message}
+		routingCtx := routing.RoutingContext{
+			RequestID: requestID,
+			Model:     model,
+			Message:   message,
+			ReqBody:   body.RequestBody.GetBody(),
+			Headers:   map[string]string{},
+		}
 		targetPodIP, err = s.selectTargetPod(ctx, routing.Algorithms(routingStrategy), pods, routingCtx)
 		if targetPodIP == "" || err != nil {
 			klog.ErrorS(err, "failed to select target pod", "requestID", requestID, "routingStrategy", routingStrategy, "model", model)
@@ -119,6 +125,7 @@ func (s *Server) HandleRequestBody(ctx context.Context, requestID string, req *e
 					RawValue: []byte(targetPodIP),
 				},
 			})
+		headers = appendRoutingHeaders(headers, routingCtx.Headers)
 		klog.InfoS("request start", "requestID", requestID, "model", model, "routingStrategy", routingStrategy, "targetPodIP", targetPodIP)
 	}
 
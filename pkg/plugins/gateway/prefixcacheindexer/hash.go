@@ -17,12 +17,18 @@ limitations under the License.
 package prefixcacheindexer
 
 import (
+	"container/list"
+	"fmt"
+	"io"
+	"math/bits"
 	"math/rand"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/cespare/xxhash/v2"
+	"github.com/vllm-project/aibrix/pkg/cache"
 	"github.com/vllm-project/aibrix/pkg/utils"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/klog/v2"
@@ -32,13 +38,16 @@ const (
 	defaultPrefixCacheBlockSize              = 16
 	defaultPrefixCacheEvictionInternalInMS   = 50
 	defaultPrefixCacheEvictionDurationInMins = 60
+	defaultPrefixCacheMaxBlocksPerModel      = 1000000
+	defaultPrefixCacheShards                 = 64
 )
 
 var (
 	// TODO: add a helper function for get methods.
-	prefixCacheBlockSize        = getPrefixCacheBlockSize()
-	prefixCacheEvictionInterval = getPrefixCacheEvictionInterval()
-	prefixCacheEvictionDuration = getPrefixCacheEvictionDuration()
+	prefixCacheBlockSize         = getPrefixCacheBlockSize()
+	prefixCacheEvictionInterval  = getPrefixCacheEvictionInterval()
+	prefixCacheEvictionDuration  = getPrefixCacheEvictionDuration()
+	prefixCacheMaxBlocksPerModel = getPrefixCacheMaxBlocksPerModel()
 )
 
 func getPrefixCacheBlockSize() int {
@@ -86,26 +95,58 @@ func getPrefixCacheEvictionDuration() time.Duration {
 	return defaultPrefixCacheEvictionDurationInMins * time.Minute
 }
 
+func getPrefixCacheMaxBlocksPerModel() int {
+	value := utils.LoadEnv("AIBRIX_PREFIX_CACHE_MAX_BLOCKS_PER_MODEL", "")
+	if value != "" {
+		intValue, err := strconv.Atoi(value)
+		if err != nil || intValue < 0 {
+			klog.Infof("invalid AIBRIX_PREFIX_CACHE_MAX_BLOCKS_PER_MODEL: %s, falling back to default", value)
+		} else {
+			klog.Infof("using AIBRIX_PREFIX_CACHE_MAX_BLOCKS_PER_MODEL env value for prefix cache max blocks per model: %d", intValue)
+			return intValue
+		}
+	}
+	klog.Infof("using default prefix cache max blocks per model: %d", defaultPrefixCacheMaxBlocksPerModel)
+	return defaultPrefixCacheMaxBlocksPerModel
+}
+
+// PrefixHashTable indexes the blocks of each model in shards by block hash range, each shard
+// has its own lock and LRU list, so that routings of different models or blocks do not contend.
 type PrefixHashTable struct {
-	mu     sync.RWMutex
-	blocks map[uint64]Block
-	hash   *xxhash.Digest
-	seed   uint64
+	seed uint64
+	// numShards is the number of shards per model
+	numShards int
+	// maxBlocksPerModel caps the blocks of each model, the least recently used blocks are evicted first, 0 is unbounded
+	maxBlocksPerModel int
+
+	mu      sync.RWMutex
+	models  map[string]*modelBlocks
+	hashers sync.Pool
+}
+
+// modelBlocks holds the blocks of a model.
+type modelBlocks struct {
+	shards []*blockShard
+	blocks atomic.Int64 // number of blocks
+	pods   atomic.Int64 // number of (block, pod) entries
+}
+
+// blockShard holds the blocks of a model in a range of block hashes.
+type blockShard struct {
+	mu     sync.Mutex
+	blocks map[uint64]*Block
+	order  *list.List // block hashes, front is the most recently used
 }
 
 type Block struct {
-	modelToPods    map[string]map[string]time.Time // model_name: map[pod_name]pod_last_access_time
-	lastAccessTime time.Time                       // block_last_access_time
+	pods           map[string]time.Time // map[pod_name]pod_last_access_time
+	lastAccessTime time.Time            // block_last_access_time
+	element        *list.Element        // element of the block in the LRU list of its shard
 }
 
 func NewPrefixHashTable() PrefixCacheIndexer {
 	r := rand.New(rand.NewSource(time.Now().Unix()))
-	seed := r.Uint64()
-	instance := &PrefixHashTable{
-		blocks: map[uint64]Block{},
-		hash:   xxhash.NewWithSeed(seed),
-		seed:   seed,
-	}
+	instance := newPrefixHashTable(r.Uint64(), defaultPrefixCacheShards, prefixCacheMaxBlocksPerModel)
 
 	ticker := time.NewTicker(prefixCacheEvictionInterval)
 	go func() {
@@ -117,100 +158,381 @@ func NewPrefixHashTable() PrefixCacheIndexer {
 	return instance
 }
 
+func newPrefixHashTable(seed uint64, numShards, maxBlocksPerModel int) *PrefixHashTable {
+	c := &PrefixHashTable{
+		seed:              seed,
+		numShards:         numShards,
+		maxBlocksPerModel: maxBlocksPerModel,
+		models:            map[string]*modelBlocks{},
+	}
+	c.hashers.New = func() interface{} {
+		return xxhash.New()
+	}
+	return c
+}
+
 // returns matchedTokens, unMatchedTokens, matchedPods
 func (c *PrefixHashTable) MatchPrefix(tokens []byte, model string, pods []*v1.Pod) ([]byte, []byte, []*v1.Pod) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	var block, lastMatchedBlock Block
-	var ok bool
-	var lastTokenMatchIndex int
+	return c.matchPrefix(tokens, model, pods, true)
+}
 
-	for i := 0; i < len(tokens); i += prefixCacheBlockSize {
-		end := i + prefixCacheBlockSize
-		if end > len(tokens) {
-			end = len(tokens)
-		}
+// PeekPrefix matches like MatchPrefix without moving the matched blocks in the LRU lists.
+func (c *PrefixHashTable) PeekPrefix(tokens []byte, model string, pods []*v1.Pod) ([]byte, []byte, []*v1.Pod) {
+	return c.matchPrefix(tokens, model, pods, false)
+}
 
-		_, _ = c.hash.Write(tokens[i:end])
-		prefixHash := c.hash.Sum64()
-		c.hash.ResetWithSeed(c.seed)
+// matchPrefix matches the blocks of the tokens, touch marks the matched blocks as recently used.
+func (c *PrefixHashTable) matchPrefix(tokens []byte, model string, pods []*v1.Pod, touch bool) ([]byte, []byte, []*v1.Pod) {
+	m := c.getModel(model, false)
+	if m == nil {
+		return tokens[0:0], tokens, nil
+	}
 
-		block, ok = c.blocks[prefixHash]
-		if !ok || len(block.modelToPods[model]) == 0 || len(matchPods(block.modelToPods[model], pods)) == 0 {
-			lastTokenMatchIndex = i
+	var matchedPods []*v1.Pod
+	lastTokenMatchIndex := 0
+	now := time.Now()
+	for i, prefixHash := range c.blockHashes(tokens) {
+		shard := m.shard(prefixHash)
+		shard.mu.Lock()
+		block, ok := shard.blocks[prefixHash]
+		var blockMatchedPods []*v1.Pod
+		if ok {
+			blockMatchedPods = matchPods(block.pods, pods)
+		}
+		if len(blockMatchedPods) == 0 {
+			shard.mu.Unlock()
 			break
 		}
+		if touch {
+			block.lastAccessTime = now
+			shard.order.MoveToFront(block.element)
+		}
+		shard.mu.Unlock()
 
-		lastTokenMatchIndex = end
-		lastMatchedBlock = block
-		block.lastAccessTime = time.Now()
-		c.blocks[prefixHash] = block
+		matchedPods = blockMatchedPods
+		lastTokenMatchIndex = (i + 1) * prefixCacheBlockSize
+	}
+	if lastTokenMatchIndex > len(tokens) {
+		lastTokenMatchIndex = len(tokens)
 	}
 
-	matchedTokens := tokens[0:lastTokenMatchIndex]
-	unMatchedTokens := tokens[lastTokenMatchIndex:]
+	return tokens[0:lastTokenMatchIndex], tokens[lastTokenMatchIndex:], matchedPods
+}
 
-	var matchedPods []*v1.Pod
-	if len(matchedTokens) > 0 {
-		matchedPods = matchPods(lastMatchedBlock.modelToPods[model], pods)
+func (c *PrefixHashTable) AddPrefix(unMatchedTokens []byte, model, pod string) {
+	m := c.getModel(model, true)
+	now := time.Now()
+	for _, prefixHash := range c.blockHashes(unMatchedTokens) {
+		shard := m.shard(prefixHash)
+		shard.mu.Lock()
+		block, ok := shard.blocks[prefixHash]
+		if !ok {
+			block = &Block{
+				pods:    map[string]time.Time{},
+				element: shard.order.PushFront(prefixHash),
+			}
+			shard.blocks[prefixHash] = block
+			m.blocks.Add(1)
+		}
+		if _, ok := block.pods[pod]; !ok {
+			m.pods.Add(1)
+		}
+		block.pods[pod] = now
+		block.lastAccessTime = now
+		shard.order.MoveToFront(block.element)
+		if !ok && c.maxBlocksPerModel > 0 && m.blocks.Load() > int64(c.maxBlocksPerModel) {
+			// evict the least recently used block of the shard, which approximates the least recently used block
+			// of the model as the block hashes spread evenly over the shards, without locking the other shards
+			back := shard.order.Back().Value.(uint64)
+			if shard.blocks[back].lastAccessTime.Before(now) {
+				m.removeBlock(shard, back)
+				prefixCacheEvictedBlocks.WithLabelValues(model, evictionReasonCapacity).Inc()
+			}
+		}
+		shard.mu.Unlock()
 	}
+	m.updateMetrics(model)
+}
 
-	return matchedTokens, unMatchedTokens, matchedPods
+func (c *PrefixHashTable) RemovePrefix(tokens []byte, model, pod string) {
+	m := c.getModel(model, false)
+	if m == nil {
+		return
+	}
+	for _, prefixHash := range c.blockHashes(tokens) {
+		shard := m.shard(prefixHash)
+		shard.mu.Lock()
+		if block, ok := shard.blocks[prefixHash]; ok {
+			m.removePod(shard, prefixHash, block, pod)
+		}
+		shard.mu.Unlock()
+	}
+	m.updateMetrics(model)
 }
 
-func (c *PrefixHashTable) AddPrefix(unMatchedTokens []byte, model, pod string) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+func (c *PrefixHashTable) RemovePod(pod string) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 
-	for i := 0; i < len(unMatchedTokens); i += prefixCacheBlockSize {
-		end := i + prefixCacheBlockSize
-		if end > len(unMatchedTokens) {
-			end = len(unMatchedTokens)
+	for model, m := range c.models {
+		for _, shard := range m.shards {
+			shard.mu.Lock()
+			for hash, block := range shard.blocks {
+				m.removePod(shard, hash, block, pod)
+			}
+			shard.mu.Unlock()
 		}
+		m.updateMetrics(model)
+	}
+}
 
-		_, _ = c.hash.Write(unMatchedTokens[i:end])
-		prefixHash := c.hash.Sum64()
-		c.hash.ResetWithSeed(c.seed)
-		block, ok := c.blocks[prefixHash]
-		if !ok {
-			block = Block{
-				modelToPods: map[string]map[string]time.Time{
-					model: {
-						pod: time.Now(),
-					},
-				},
+func (c *PrefixHashTable) Evict(now time.Time) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for model, m := range c.models {
+		for _, shard := range m.shards {
+			shard.mu.Lock()
+			// blocks are ordered by access time, the least recently used are at the back
+			for shard.order.Len() > 0 {
+				hash := shard.order.Back().Value.(uint64)
+				if now.Sub(shard.blocks[hash].lastAccessTime) <= prefixCacheEvictionDuration {
+					break
+				}
+				m.removeBlock(shard, hash)
+				prefixCacheEvictedBlocks.WithLabelValues(model, evictionReasonExpired).Inc()
+				klog.V(4).InfoS("prefix cache block evicted", "model", model, "hash", hash)
 			}
-		} else {
-			blockPods, ok := block.modelToPods[model]
-			if !ok {
-				blockPods = map[string]time.Time{}
+			shard.mu.Unlock()
+		}
+		// blocks above the cap which AddPrefix could not evict from their shards, e.g. shards without older blocks
+		for c.maxBlocksPerModel > 0 && m.blocks.Load() > int64(c.maxBlocksPerModel) && m.evictOldest() {
+			prefixCacheEvictedBlocks.WithLabelValues(model, evictionReasonCapacity).Inc()
+		}
+		m.updateMetrics(model)
+	}
+}
+
+// RemovePodsNotInCurrentPodSet removes the pods which no longer exist from all blocks.
+func (c *PrefixHashTable) RemovePodsNotInCurrentPodSet(currentPodSet map[string]bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for model, m := range c.models {
+		for _, shard := range m.shards {
+			shard.mu.Lock()
+			for hash, block := range shard.blocks {
+				for pod := range block.pods {
+					if !currentPodSet[pod] {
+						m.removePod(shard, hash, block, pod)
+					}
+				}
 			}
-			blockPods[pod] = time.Now()
-			block.modelToPods[model] = blockPods
+			shard.mu.Unlock()
 		}
+		m.updateMetrics(model)
+	}
+}
+
+// WriteSnapshot writes the hash seed and the blocks of each model shard from the least to the most recently used.
+func (c *PrefixHashTable) WriteSnapshot(w io.Writer) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 
-		block.lastAccessTime = time.Now()
-		c.blocks[prefixHash] = block
+	sw := newSnapshotWriter(w, snapshotKindPrefixHashTable)
+	sw.uint64(c.seed)
+	sw.uvarint(uint64(prefixCacheBlockSize))
+	sw.uvarint(uint64(len(c.models)))
+	for model, m := range c.models {
+		sw.string(model)
+		sw.uvarint(uint64(len(m.shards)))
+		for _, shard := range m.shards {
+			shard.mu.Lock()
+			sw.uvarint(uint64(shard.order.Len()))
+			for element := shard.order.Back(); element != nil; element = element.Prev() {
+				hash := element.Value.(uint64)
+				block := shard.blocks[hash]
+				sw.uint64(hash)
+				sw.time(block.lastAccessTime)
+				sw.pods(block.pods)
+			}
+			shard.mu.Unlock()
+		}
 	}
+	return sw.flush()
 }
 
-func (c *PrefixHashTable) Evict(now time.Time) {
+// ReadSnapshot replaces the blocks and the hash seed, since block hashes depend on the seed. The snapshot is
+// read into new blocks, which replace the blocks only if the whole snapshot is valid.
+func (c *PrefixHashTable) ReadSnapshot(r io.Reader) error {
+	sr, err := newSnapshotReader(r, snapshotKindPrefixHashTable)
+	if err != nil {
+		return err
+	}
+	seed := sr.uint64()
+	if blockSize := sr.length(); sr.err == nil && blockSize != prefixCacheBlockSize {
+		return fmt.Errorf("prefix cache snapshot of block size %d, expected %d", blockSize, prefixCacheBlockSize)
+	}
+
+	restored := newPrefixHashTable(seed, c.numShards, c.maxBlocksPerModel)
+	numModels := sr.length()
+	for i := 0; i < numModels && sr.err == nil; i++ {
+		model := sr.string()
+		m := restored.getModel(model, true)
+		numShards := sr.length()
+		for j := 0; j < numShards && sr.err == nil; j++ {
+			numBlocks := sr.length()
+			for k := 0; k < numBlocks && sr.err == nil; k++ {
+				hash := sr.uint64()
+				lastAccessTime := sr.time()
+				pods := sr.pods()
+				if len(pods) == 0 {
+					continue
+				}
+				shard := m.shard(hash)
+				if _, ok := shard.blocks[hash]; ok {
+					continue
+				}
+				shard.blocks[hash] = &Block{
+					pods:           pods,
+					lastAccessTime: lastAccessTime,
+					element:        shard.order.PushFront(hash),
+				}
+				m.blocks.Add(1)
+				m.pods.Add(int64(len(pods)))
+			}
+		}
+		for restored.maxBlocksPerModel > 0 && m.blocks.Load() > int64(restored.maxBlocksPerModel) {
+			if !m.evictOldest() {
+				break
+			}
+		}
+	}
+	if sr.err != nil {
+		return fmt.Errorf("invalid prefix cache snapshot: %w", sr.err)
+	}
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	c.seed = seed
+	c.models = restored.models
+	for model, m := range c.models {
+		m.updateMetrics(model)
+	}
+	return nil
+}
 
-	for hash, block := range c.blocks {
-		if now.Sub(block.lastAccessTime) > prefixCacheEvictionDuration {
-			delete(c.blocks, hash)
-			klog.InfoS("prefix cache block evicted", "hash", hash)
+// getModel returns the blocks of the model, create adds them if missing.
+func (c *PrefixHashTable) getModel(model string, create bool) *modelBlocks {
+	c.mu.RLock()
+	m, ok := c.models[model]
+	c.mu.RUnlock()
+	if ok || !create {
+		return m
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if m, ok := c.models[model]; ok {
+		return m
+	}
+	m = &modelBlocks{shards: make([]*blockShard, c.numShards)}
+	for i := range m.shards {
+		m.shards[i] = &blockShard{blocks: map[uint64]*Block{}, order: list.New()}
+	}
+	c.models[model] = m
+	return m
+}
+
+// blockHashes returns the hashes of the token blocks, using a hasher of the pool so that calls run concurrently.
+func (c *PrefixHashTable) blockHashes(tokens []byte) []uint64 {
+	hasher := c.hashers.Get().(*xxhash.Digest)
+	defer c.hashers.Put(hasher)
+	// the seed is replaced by ReadSnapshot
+	c.mu.RLock()
+	seed := c.seed
+	c.mu.RUnlock()
+
+	hashes := make([]uint64, 0, (len(tokens)+prefixCacheBlockSize-1)/prefixCacheBlockSize)
+	for i := 0; i < len(tokens); i += prefixCacheBlockSize {
+		end := i + prefixCacheBlockSize
+		if end > len(tokens) {
+			end = len(tokens)
 		}
+		hasher.ResetWithSeed(seed)
+		_, _ = hasher.Write(tokens[i:end])
+		hashes = append(hashes, hasher.Sum64())
+	}
+	return hashes
+}
+
+// shard returns the shard of the hash range of the block.
+func (m *modelBlocks) shard(hash uint64) *blockShard {
+	index, _ := bits.Mul64(hash, uint64(len(m.shards)))
+	return m.shards[index]
+}
+
+// removePod removes the pod from the block and the block once no pod remains, the shard must be locked.
+func (m *modelBlocks) removePod(shard *blockShard, hash uint64, block *Block, pod string) {
+	if _, ok := block.pods[pod]; !ok {
+		return
 	}
+	delete(block.pods, pod)
+	m.pods.Add(-1)
+	if len(block.pods) == 0 {
+		m.removeBlock(shard, hash)
+	}
+}
+
+// evictOldest removes the least recently used block of the model, which is the least recently used block of one of
+// its shards. It locks the shards one by one and returns false if the model has no blocks.
+func (m *modelBlocks) evictOldest() bool {
+	var oldest *blockShard
+	var oldestAccessTime time.Time
+	for _, shard := range m.shards {
+		shard.mu.Lock()
+		if back := shard.order.Back(); back != nil {
+			lastAccessTime := shard.blocks[back.Value.(uint64)].lastAccessTime
+			if oldest == nil || lastAccessTime.Before(oldestAccessTime) {
+				oldest, oldestAccessTime = shard, lastAccessTime
+			}
+		}
+		shard.mu.Unlock()
+	}
+	if oldest == nil {
+		return false
+	}
+
+	oldest.mu.Lock()
+	defer oldest.mu.Unlock()
+	// the block may have been used or removed since, the shard still holds one of the oldest blocks
+	if back := oldest.order.Back(); back != nil {
+		m.removeBlock(oldest, back.Value.(uint64))
+	}
+	return true
+}
+
+// removeBlock removes the block, the shard must be locked.
+func (m *modelBlocks) removeBlock(shard *blockShard, hash uint64) {
+	block := shard.blocks[hash]
+	shard.order.Remove(block.element)
+	delete(shard.blocks, hash)
+	m.blocks.Add(-1)
+	m.pods.Add(-int64(len(block.pods)))
+}
+
+func (m *modelBlocks) updateMetrics(model string) {
+	blocks, pods := m.blocks.Load(), m.pods.Load()
+	prefixCacheBlocks.WithLabelValues(model).Set(float64(blocks))
+	prefixCacheMemoryBytes.WithLabelValues(model).Set(float64(blocks*estimatedModelBlockBytes + pods*estimatedPodEntryBytes))
 }
 
-// matchPods returns ready pods that intersect with pods on which prefix tokens are catched.
+// matchPods returns ready pods that intersect with pods on which prefix tokens are catched,
+// the pods of the blocks are keyed by cache.PodKey.
 func matchPods(blockPods map[string]time.Time, readyPods []*v1.Pod) []*v1.Pod {
 	var matchedPods []*v1.Pod
 	for _, pod := range readyPods {
-		if _, ok := blockPods[pod.Name]; ok {
+		if _, ok := blockPods[cache.PodKey(pod)]; ok {
 			matchedPods = append(matchedPods, pod)
 		}
 	}
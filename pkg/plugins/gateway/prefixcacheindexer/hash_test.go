@@ -19,10 +19,11 @@ package prefixcacheindexer
 import (
 	"fmt"
 	"math/rand"
+	"runtime"
+	"sync/atomic"
 	"testing"
 	"time"
 
-	"github.com/cespare/xxhash/v2"
 	"github.com/stretchr/testify/assert"
 	"github.com/vllm-project/aibrix/pkg/plugins/gateway/prefixcacheindexer/tokenizer"
 	v1 "k8s.io/api/core/v1"
@@ -32,11 +33,7 @@ import (
 func Test_PrefixHashTableE2E(t *testing.T) {
 	r := rand.New(rand.NewSource(time.Now().Unix()))
 	seed := r.Uint64()
-	cache := PrefixHashTable{
-		blocks: map[uint64]Block{},
-		hash:   xxhash.NewWithSeed(seed),
-		seed:   seed,
-	}
+	cache := newPrefixHashTable(seed, defaultPrefixCacheShards, 0)
 	pods := []*v1.Pod{
 		{ObjectMeta: metav1.ObjectMeta{Name: "p1"}},
 		{ObjectMeta: metav1.ObjectMeta{Name: "p2"}},
@@ -77,7 +74,7 @@ func Test_MatchPrefix(t *testing.T) {
 	tests := []*struct {
 		name          string
 		inputText     string
-		cache         PrefixHashTable
+		cache         *PrefixHashTable
 		model         string
 		pods          []*v1.Pod
 		matchTokens   []byte
@@ -87,12 +84,8 @@ func Test_MatchPrefix(t *testing.T) {
 		{
 			name:      "token length more than prefix block size, no prefix blocks exist in the cache",
 			inputText: "Hello World! What a Good Day! 你好世界！多么美好的一天啊！",
-			cache: PrefixHashTable{
-				blocks: map[uint64]Block{},
-				hash:   xxhash.NewWithSeed(seed),
-				seed:   seed,
-			},
-			model: "m1",
+			cache:     newPrefixHashTable(seed, defaultPrefixCacheShards, 0),
+			model:     "m1",
 			pods: []*v1.Pod{
 				{ObjectMeta: metav1.ObjectMeta{Name: "p1"}},
 				{ObjectMeta: metav1.ObjectMeta{Name: "p2"}},
@@ -104,28 +97,11 @@ func Test_MatchPrefix(t *testing.T) {
 		{
 			name:      "token length more than prefix block size, one prefix block exist in the cache",
 			inputText: "Hello World! What a Good Day! Good day to code and learn new things in LLM!! 你好世界！多么美好的一天啊！",
-			cache: PrefixHashTable{
-				blocks: map[uint64]Block{
-					14691102025703449771: {
-						modelToPods: map[string]map[string]time.Time{
-							"m1": {
-								"p1": time.Now(),
-							},
-						},
-						lastAccessTime: time.Now(),
-					},
-					8713185073040773989: {
-						modelToPods: map[string]map[string]time.Time{
-							"m1": {
-								"p1": time.Now(),
-							},
-						},
-						lastAccessTime: time.Now(),
-					},
-				},
-				hash: xxhash.NewWithSeed(0),
-				seed: 0,
-			},
+			cache: func() *PrefixHashTable {
+				cache := newPrefixHashTable(seed, defaultPrefixCacheShards, 0)
+				cache.AddPrefix([]byte("HelloWorld!WhataGoodDay!Gooddayt"), "m1", "p1")
+				return cache
+			}(),
 			model: "m1",
 			pods: []*v1.Pod{
 				{ObjectMeta: metav1.ObjectMeta{Name: "p1"}},
@@ -149,3 +125,150 @@ func Test_MatchPrefix(t *testing.T) {
 		assert.Equal(t, tt.matchPods, matchPods, tt.name)
 	}
 }
+
+func Test_PrefixHashTableLRUEviction(t *testing.T) {
+	seed := uint64(0)
+	// the cap applies to all shards of a model, blocks above the cap in other shards are evicted by Evict
+	cache := newPrefixHashTable(seed, defaultPrefixCacheShards, 2)
+	pods := []*v1.Pod{{ObjectMeta: metav1.ObjectMeta{Name: "p1"}}}
+	block := func(i int) []byte {
+		return []byte(fmt.Sprintf("block %010d", i))[:prefixCacheBlockSize]
+	}
+
+	cache.AddPrefix(block(1), "m1", "p1")
+	cache.AddPrefix(block(2), "m1", "p1")
+	cache.AddPrefix(block(1), "m2", "p1")
+	// block 1 is used more recently than block 2
+	matchedTokens, _, _ := cache.MatchPrefix(block(1), "m1", pods)
+	assert.Equal(t, block(1), matchedTokens)
+	// peeking block 2 does not make it more recently used
+	matchedTokens, _, _ = cache.PeekPrefix(block(2), "m1", pods)
+	assert.Equal(t, block(2), matchedTokens)
+
+	cache.AddPrefix(block(3), "m1", "p1")
+	cache.Evict(time.Now())
+	for i, matched := range map[int]bool{1: true, 2: false, 3: true} {
+		matchedTokens, _, _ = cache.MatchPrefix(block(i), "m1", pods)
+		assert.Equal(t, matched, len(matchedTokens) > 0, "block %d", i)
+	}
+	// blocks of other models are capped separately
+	matchedTokens, _, _ = cache.MatchPrefix(block(1), "m2", pods)
+	assert.Equal(t, block(1), matchedTokens)
+	assert.Equal(t, int64(2), cache.models["m1"].blocks.Load())
+	assert.Equal(t, int64(2), cache.models["m1"].pods.Load())
+	assert.Equal(t, int64(1), cache.models["m2"].blocks.Load())
+
+	cache.RemovePod("p1")
+	assert.Equal(t, int64(0), cache.models["m1"].blocks.Load())
+	assert.Equal(t, int64(0), cache.models["m1"].pods.Load())
+	for _, shard := range cache.models["m1"].shards {
+		assert.Equal(t, 0, shard.order.Len())
+	}
+}
+
+func Test_PrefixHashTableShardEviction(t *testing.T) {
+	// a new block above the cap evicts the least recently used block of its shard
+	cache := newPrefixHashTable(0, 1, 2)
+	pods := []*v1.Pod{{ObjectMeta: metav1.ObjectMeta{Name: "p1"}}}
+	block := func(i int) []byte {
+		return []byte(fmt.Sprintf("block %010d", i))[:prefixCacheBlockSize]
+	}
+	cache.AddPrefix(block(1), "m1", "p1")
+	time.Sleep(time.Millisecond)
+	cache.AddPrefix(append(block(2), block(3)...), "m1", "p1")
+	assert.Equal(t, int64(2), cache.models["m1"].blocks.Load())
+	matchedTokens, _, _ := cache.MatchPrefix(block(1), "m1", pods)
+	assert.Empty(t, matchedTokens)
+
+	// blocks of the same AddPrefix are not evicted by each other, Evict enforces the cap
+	time.Sleep(time.Millisecond)
+	cache.AddPrefix(append(append(block(4), block(5)...), block(6)...), "m1", "p1")
+	assert.Equal(t, int64(3), cache.models["m1"].blocks.Load())
+	cache.Evict(time.Now())
+	assert.Equal(t, int64(2), cache.models["m1"].blocks.Load())
+}
+
+// newBenchmarkPrefixHashTable returns a table of numBlocks blocks added by prompts of 64 blocks.
+func newBenchmarkPrefixHashTable(numBlocks int) (*PrefixHashTable, [][]byte) {
+	r := rand.New(rand.NewSource(0))
+	cache := newPrefixHashTable(0, defaultPrefixCacheShards, numBlocks)
+	prompts := make([][]byte, 0, numBlocks/64)
+	for i := 0; i < numBlocks/64; i++ {
+		prompt := make([]byte, 64*prefixCacheBlockSize)
+		_, _ = r.Read(prompt)
+		cache.AddPrefix(prompt, "m1", fmt.Sprintf("p%d", i%8))
+		prompts = append(prompts, prompt)
+	}
+	return cache, prompts
+}
+
+func BenchmarkPrefixHashTableMatchPrefix1MBlocks(b *testing.B) {
+	cache, prompts := newBenchmarkPrefixHashTable(1 << 20)
+	pods := make([]*v1.Pod, 8)
+	for i := range pods {
+		pods[i] = &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("p%d", i)}}
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cache.MatchPrefix(prompts[i%len(prompts)], "m1", pods)
+	}
+}
+
+func BenchmarkPrefixHashTableAddPrefix1MBlocks(b *testing.B) {
+	cache, _ := newBenchmarkPrefixHashTable(1 << 20)
+	r := rand.New(rand.NewSource(1))
+	prompt := make([]byte, 64*prefixCacheBlockSize)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// new blocks at the cap evict the least recently used blocks
+		_, _ = r.Read(prompt)
+		cache.AddPrefix(prompt, "m1", "p0")
+	}
+}
+
+// BenchmarkPrefixHashTableConcurrentRouting routes from 10k+ goroutines, a single shard serializes all routings
+// like a table wide lock.
+func BenchmarkPrefixHashTableConcurrentRouting(b *testing.B) {
+	r := rand.New(rand.NewSource(0))
+	prompts := make([][]byte, 4096)
+	for i := range prompts {
+		prompts[i] = make([]byte, 32*prefixCacheBlockSize)
+		_, _ = r.Read(prompts[i])
+	}
+	models := []string{"m1", "m2", "m3", "m4"}
+	pods := make([]*v1.Pod, 8)
+	for i := range pods {
+		pods[i] = &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("p%d", i)}}
+	}
+
+	for _, numShards := range []int{1, defaultPrefixCacheShards} {
+		b.Run(fmt.Sprintf("shards=%d", numShards), func(b *testing.B) {
+			cache := newPrefixHashTable(0, numShards, 0)
+			var seed atomic.Int64
+			b.SetParallelism(10000/runtime.GOMAXPROCS(0) + 1)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				r := rand.New(rand.NewSource(seed.Add(1)))
+				for pb.Next() {
+					model := models[r.Intn(len(models))]
+					_, unMatchedTokens, _ := cache.MatchPrefix(prompts[r.Intn(len(prompts))], model, pods)
+					cache.AddPrefix(unMatchedTokens, model, pods[r.Intn(len(pods))].Name)
+				}
+			})
+		})
+	}
+}
+
+func Test_PrefixHashTablePodKeys(t *testing.T) {
+	cache := newPrefixHashTable(0, defaultPrefixCacheShards, 0)
+	pods := []*v1.Pod{
+		{ObjectMeta: metav1.ObjectMeta{Name: "p1", Namespace: "team-a"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "p1", Namespace: "team-b"}},
+	}
+	tokens := []byte("a prompt of a few blocks")
+
+	// pods of the same name in different namespaces are matched separately
+	cache.AddPrefix(tokens, "m1", "team-b/p1")
+	_, _, matchedPods := cache.MatchPrefix(tokens, "m1", pods)
+	assert.Equal(t, []*v1.Pod{pods[1]}, matchedPods)
+}
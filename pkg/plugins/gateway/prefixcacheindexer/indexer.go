@@ -27,10 +27,26 @@ type PrefixCacheIndexer interface {
 	// and returns matched prefix (as tokens), remaining unmatched input request (as tokens) and pods matching the prefix
 	MatchPrefix(inputTokens []byte, model string, pods []*v1.Pod) (matchedTokens []byte, unMatchedTokens []byte, matchedPods []*v1.Pod)
 
+	// PeekPrefix matches like MatchPrefix without refreshing the access time of the matched blocks,
+	// so that explaining a routing decision does not change which blocks are evicted
+	PeekPrefix(inputTokens []byte, model string, pods []*v1.Pod) (matchedTokens []byte, unMatchedTokens []byte, matchedPods []*v1.Pod)
+
 	// AddPrefix adds tokens in internal prefix cache indexer to be used by future requests
 	AddPrefix(tokens []byte, model, pod string)
 
 	// Evict is invoked at fixed internal to clean up expired tokens from prefix cache.
-	// TODO: Add max blocks to cache, add LRU policy along with TTL and add performance benchmark tests.
+	// Indexers bound their memory by evicting the least recently used blocks on AddPrefix.
 	Evict(now time.Time)
 }
+
+// KVEventIndexer is a PrefixCacheIndexer which can be updated by the KV cache events
+// reported by inference engines, e.g. blocks evicted on the engine side.
+type KVEventIndexer interface {
+	PrefixCacheIndexer
+
+	// RemovePrefix removes the pod from the blocks of tokens
+	RemovePrefix(tokens []byte, model, pod string)
+
+	// RemovePod removes the pod from all blocks
+	RemovePod(pod string)
+}
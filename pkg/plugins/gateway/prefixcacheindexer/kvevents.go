@@ -0,0 +1,283 @@
+/*
+Copyright 2024 The Aibrix Team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package prefixcacheindexer
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/vllm-project/aibrix/pkg/cache"
+	"github.com/vllm-project/aibrix/pkg/plugins/gateway/prefixcacheindexer/tokenizer"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	KVEventBlockStored      = "BlockStored"
+	KVEventBlockRemoved     = "BlockRemoved"
+	KVEventAllBlocksCleared = "AllBlocksCleared"
+
+	maxKVEventLineBytes  = 16 << 20
+	kvEventRetryInterval = 5 * time.Second
+)
+
+// KVEventBatch is a batch of KV cache events published by an engine, one JSON object per line
+// of the event stream. Events follow the vLLM KV cache events, which vLLM publishes as msgpack
+// over ZMQ, so the engine needs a sidecar relaying them as an HTTP stream of JSON lines.
+type KVEventBatch struct {
+	Timestamp float64   `json:"ts"`
+	Events    []KVEvent `json:"events"`
+}
+
+// KVEvent is a block stored, block removed or all blocks cleared event.
+type KVEvent struct {
+	Type            string   `json:"type"`
+	BlockHashes     []uint64 `json:"block_hashes,omitempty"`
+	ParentBlockHash *uint64  `json:"parent_block_hash,omitempty"`
+	// TokenIDs are the tokens of all stored blocks, BlockSize tokens per block
+	TokenIDs  []int  `json:"token_ids,omitempty"`
+	BlockSize int    `json:"block_size,omitempty"`
+	LoraName  string `json:"lora_name,omitempty"`
+}
+
+// KVEventSubscriber consumes the KV cache event stream of each pod and applies the
+// events to the indexer, so blocks evicted by the engine are no longer matched.
+type KVEventSubscriber struct {
+	indexer KVEventIndexer
+	port    string
+	path    string
+	client  *http.Client
+
+	mu            sync.Mutex
+	subscriptions map[string]*kvEventSubscription // pod key -> subscription
+}
+
+type kvEventSubscription struct {
+	cancel context.CancelFunc
+}
+
+func NewKVEventSubscriber(indexer KVEventIndexer, port, path string) *KVEventSubscriber {
+	return &KVEventSubscriber{
+		indexer:       indexer,
+		port:          port,
+		path:          path,
+		client:        &http.Client{},
+		subscriptions: map[string]*kvEventSubscription{},
+	}
+}
+
+// Subscribe starts consuming the event stream of the pods which are not subscribed yet.
+// Blocks of LoRA adapters are indexed under the adapter, other blocks under the base model of the pod,
+// or the routed model for pods without a model label.
+// A subscription ends when its stream fails, e.g. the pod is deleted, and the pod can be subscribed
+// again after a retry interval. The blocks of the pod are kept, since the indexer may be shared by
+// other gateway replicas still subscribed to the pod, and expire like blocks added by routing.
+func (s *KVEventSubscriber) Subscribe(pods []*v1.Pod, model string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, pod := range pods {
+		podKey := cache.PodKey(pod)
+		if _, ok := s.subscriptions[podKey]; ok || pod.Status.PodIP == "" {
+			continue
+		}
+		baseModel := model
+		if podModel, ok := cache.PodModelKey(pod); ok {
+			baseModel = podModel
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		subscription := &kvEventSubscription{cancel: cancel}
+		s.subscriptions[podKey] = subscription
+		go s.subscribe(ctx, subscription, podKey, pod.Namespace, pod.Status.PodIP, baseModel)
+	}
+}
+
+// Stop ends all subscriptions.
+func (s *KVEventSubscriber) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for pod, subscription := range s.subscriptions {
+		subscription.cancel()
+		delete(s.subscriptions, pod)
+	}
+}
+
+func (s *KVEventSubscriber) subscribe(ctx context.Context, subscription *kvEventSubscription, podName, namespace, podIP, baseModel string) {
+	if err := s.consume(ctx, podName, namespace, podIP, baseModel); ctx.Err() == nil {
+		klog.ErrorS(err, "kv event subscription ended", "pod", podName)
+	}
+
+	// back off before the pod can be subscribed again
+	select {
+	case <-ctx.Done():
+	case <-time.After(kvEventRetryInterval):
+	}
+	s.mu.Lock()
+	if s.subscriptions[podName] == subscription {
+		delete(s.subscriptions, podName)
+	}
+	s.mu.Unlock()
+	subscription.cancel()
+}
+
+// consume applies the events of the pod stream until it fails.
+func (s *KVEventSubscriber) consume(ctx context.Context, podName, namespace, podIP, baseModel string) error {
+	url := fmt.Sprintf("http://%s%s", net.JoinHostPort(podIP, s.port), s.path)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			klog.ErrorS(err, "error closing kv event stream", "pod", podName)
+		}
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	klog.InfoS("subscribed to kv events", "pod", podName, "url", url)
+
+	blocks := newKVBlocks()
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxKVEventLineBytes)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var batch KVEventBatch
+		if err := json.Unmarshal(scanner.Bytes(), &batch); err != nil {
+			klog.ErrorS(err, "invalid kv event batch", "pod", podName)
+			continue
+		}
+		for _, event := range batch.Events {
+			s.apply(event, podName, namespace, baseModel, blocks)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("kv event stream closed")
+}
+
+type kvBlock struct {
+	model  string
+	tokens []byte
+}
+
+// kvBlockKey is a block of the indexer, which hashes the tokens of each block regardless of its prefix.
+type kvBlockKey struct {
+	model  string
+	tokens string
+}
+
+// kvBlocks tracks the blocks stored by the engine of a pod. The engine keys blocks by hashes chained
+// with their prefix, while the indexer keys them by their tokens only, so the same indexer block may be
+// stored by the engine under several prefixes and is removed from the pod once none of them is left.
+type kvBlocks struct {
+	blocks map[uint64]kvBlock // engine block hash -> block
+	refs   map[kvBlockKey]int // indexer block -> number of engine blocks containing it
+}
+
+func newKVBlocks() *kvBlocks {
+	return &kvBlocks{blocks: map[uint64]kvBlock{}, refs: map[kvBlockKey]int{}}
+}
+
+// store records the engine block, a block stored again is counted once.
+func (b *kvBlocks) store(hash uint64, block kvBlock) {
+	if _, ok := b.blocks[hash]; ok {
+		return
+	}
+	b.blocks[hash] = block
+	for _, tokens := range indexerBlocks(block.tokens) {
+		b.refs[kvBlockKey{model: block.model, tokens: string(tokens)}]++
+	}
+}
+
+// remove forgets the engine block and returns the indexer blocks no longer stored by the engine.
+func (b *kvBlocks) remove(hash uint64) (kvBlock, [][]byte) {
+	block, ok := b.blocks[hash]
+	if !ok {
+		return block, nil
+	}
+	delete(b.blocks, hash)
+	var removed [][]byte
+	for _, tokens := range indexerBlocks(block.tokens) {
+		key := kvBlockKey{model: block.model, tokens: string(tokens)}
+		if b.refs[key]--; b.refs[key] <= 0 {
+			delete(b.refs, key)
+			removed = append(removed, tokens)
+		}
+	}
+	return block, removed
+}
+
+func (b *kvBlocks) clear() {
+	b.blocks = map[uint64]kvBlock{}
+	b.refs = map[kvBlockKey]int{}
+}
+
+// indexerBlocks splits the tokens into the blocks hashed by the indexer.
+func indexerBlocks(tokens []byte) [][]byte {
+	blocks := make([][]byte, 0, (len(tokens)+prefixCacheBlockSize-1)/prefixCacheBlockSize)
+	for i := 0; i < len(tokens); i += prefixCacheBlockSize {
+		blocks = append(blocks, tokens[i:min(i+prefixCacheBlockSize, len(tokens))])
+	}
+	return blocks
+}
+
+func (s *KVEventSubscriber) apply(event KVEvent, podName, namespace, baseModel string, blocks *kvBlocks) {
+	switch event.Type {
+	case KVEventBlockStored:
+		model := baseModel
+		if event.LoraName != "" {
+			model = cache.EngineModelKey(namespace, event.LoraName)
+		}
+		if event.BlockSize <= 0 || len(event.TokenIDs) < len(event.BlockHashes)*event.BlockSize {
+			klog.ErrorS(nil, "invalid block stored event", "pod", podName, "blocks", len(event.BlockHashes),
+				"blockSize", event.BlockSize, "tokens", len(event.TokenIDs))
+			return
+		}
+		for i, hash := range event.BlockHashes {
+			tokens := tokenizer.TokenIDsToBytes(event.TokenIDs[i*event.BlockSize : (i+1)*event.BlockSize])
+			blocks.store(hash, kvBlock{model: model, tokens: tokens})
+			s.indexer.AddPrefix(tokens, model, podName)
+		}
+	case KVEventBlockRemoved:
+		for _, hash := range event.BlockHashes {
+			block, removed := blocks.remove(hash)
+			for _, tokens := range removed {
+				s.indexer.RemovePrefix(tokens, block.model, podName)
+			}
+		}
+	case KVEventAllBlocksCleared:
+		blocks.clear()
+		s.indexer.RemovePod(podName)
+	default:
+		klog.V(4).InfoS("unknown kv event", "pod", podName, "type", event.Type)
+	}
+}
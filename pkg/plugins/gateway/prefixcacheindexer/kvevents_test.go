@@ -0,0 +1,149 @@
+/*
+Copyright 2024 The Aibrix Team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package prefixcacheindexer
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vllm-project/aibrix/pkg/plugins/gateway/prefixcacheindexer/tokenizer"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// fakeKVEventPublisher streams the published event batches to a single subscriber.
+type fakeKVEventPublisher struct {
+	server  *httptest.Server
+	batches chan KVEventBatch
+}
+
+func newFakeKVEventPublisher(t *testing.T) *fakeKVEventPublisher {
+	p := &fakeKVEventPublisher{batches: make(chan KVEventBatch)}
+	p.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		encoder := json.NewEncoder(w)
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case batch, ok := <-p.batches:
+				if !ok {
+					return
+				}
+				_ = encoder.Encode(batch)
+				w.(http.Flusher).Flush()
+			}
+		}
+	}))
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+func (p *fakeKVEventPublisher) publish(events ...KVEvent) {
+	p.batches <- KVEventBatch{Timestamp: float64(time.Now().Unix()), Events: events}
+}
+
+func Test_KVEventSubscriber(t *testing.T) {
+	publisher := newFakeKVEventPublisher(t)
+	host, port, err := net.SplitHostPort(publisher.server.Listener.Addr().String())
+	assert.NoError(t, err)
+
+	cache := newPrefixHashTable(0, defaultPrefixCacheShards, 0)
+	subscriber := NewKVEventSubscriber(cache, port, "/kv_events")
+	defer subscriber.Stop()
+
+	pods := []*v1.Pod{
+		{ObjectMeta: metav1.ObjectMeta{Name: "p1"}, Status: v1.PodStatus{PodIP: host}},
+	}
+	subscriber.Subscribe(pods, "m1")
+
+	// 4 tokens of 4 bytes each fill a prefix cache block
+	block1, block2 := []int{1, 2, 3, 4}, []int{5, 6, 7, 8}
+	tokens := tokenizer.TokenIDsToBytes(concatTokenIDs(block1, block2))
+	matchedTokens := func() int {
+		matched, _, _ := cache.MatchPrefix(tokens, "m1", pods)
+		return len(matched)
+	}
+
+	publisher.publish(KVEvent{Type: KVEventBlockStored, BlockHashes: []uint64{11, 12}, TokenIDs: concatTokenIDs(block1, block2), BlockSize: 4})
+	assert.Eventually(t, func() bool { return matchedTokens() == len(tokens) }, time.Second, 10*time.Millisecond)
+
+	publisher.publish(KVEvent{Type: KVEventBlockRemoved, BlockHashes: []uint64{12}})
+	assert.Eventually(t, func() bool { return matchedTokens() == len(tokens)/2 }, time.Second, 10*time.Millisecond)
+
+	publisher.publish(KVEvent{Type: KVEventAllBlocksCleared})
+	assert.Eventually(t, func() bool { return matchedTokens() == 0 }, time.Second, 10*time.Millisecond)
+
+	// blocks of the pod are kept when the stream ends, as other gateway replicas may still be subscribed
+	publisher.publish(KVEvent{Type: KVEventBlockStored, BlockHashes: []uint64{11}, TokenIDs: block1, BlockSize: 4})
+	assert.Eventually(t, func() bool { return matchedTokens() == len(tokens)/2 }, time.Second, 10*time.Millisecond)
+	close(publisher.batches)
+	assert.Never(t, func() bool { return matchedTokens() != len(tokens)/2 }, 200*time.Millisecond, 10*time.Millisecond)
+}
+
+func concatTokenIDs(blocks ...[]int) []int {
+	var ids []int
+	for _, block := range blocks {
+		ids = append(ids, block...)
+	}
+	return ids
+}
+
+func Test_KVEventSubscriberSharedBlocks(t *testing.T) {
+	publisher := newFakeKVEventPublisher(t)
+	host, port, err := net.SplitHostPort(publisher.server.Listener.Addr().String())
+	assert.NoError(t, err)
+
+	cache := newPrefixHashTable(0, defaultPrefixCacheShards, 0)
+	subscriber := NewKVEventSubscriber(cache, port, "/kv_events")
+	defer subscriber.Stop()
+
+	// the pod serves the base model and a LoRA adapter, the first routed request is for the adapter
+	pods := []*v1.Pod{
+		{ObjectMeta: metav1.ObjectMeta{Name: "p1", Labels: map[string]string{"model.aibrix.ai/name": "base"}}, Status: v1.PodStatus{PodIP: host}},
+	}
+	subscriber.Subscribe(pods, "lora-1")
+
+	block1, block2, block3 := []int{1, 2, 3, 4}, []int{5, 6, 7, 8}, []int{9, 10, 11, 12}
+	matchedTokens := func(model string, blocks ...[]int) int {
+		matched, _, _ := cache.MatchPrefix(tokenizer.TokenIDsToBytes(concatTokenIDs(blocks...)), model, pods)
+		return len(matched) / prefixCacheBlockSize
+	}
+
+	// block2 is stored by the engine after block1 and after block3 under different chained hashes
+	publisher.publish(
+		KVEvent{Type: KVEventBlockStored, BlockHashes: []uint64{11, 12}, TokenIDs: concatTokenIDs(block1, block2), BlockSize: 4},
+		KVEvent{Type: KVEventBlockStored, BlockHashes: []uint64{21, 22}, TokenIDs: concatTokenIDs(block3, block2), BlockSize: 4},
+		KVEvent{Type: KVEventBlockStored, BlockHashes: []uint64{31}, TokenIDs: block1, BlockSize: 4, LoraName: "lora-1"},
+	)
+	assert.Eventually(t, func() bool { return matchedTokens("base", block1, block2) == 2 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 2, matchedTokens("base", block3, block2))
+	assert.Equal(t, 1, matchedTokens("lora-1", block1, block2))
+
+	// removing block2 of one prefix keeps it for the other prefix
+	publisher.publish(KVEvent{Type: KVEventBlockRemoved, BlockHashes: []uint64{22}})
+	assert.Never(t, func() bool { return matchedTokens("base", block1, block2) != 2 }, 200*time.Millisecond, 10*time.Millisecond)
+	publisher.publish(KVEvent{Type: KVEventBlockRemoved, BlockHashes: []uint64{12}})
+	assert.Eventually(t, func() bool { return matchedTokens("base", block1, block2) == 1 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 1, matchedTokens("lora-1", block1))
+}
@@ -0,0 +1,51 @@
+/*
+Copyright 2024 The Aibrix Team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package prefixcacheindexer
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	evictionReasonExpired  = "expired"
+	evictionReasonCapacity = "capacity"
+
+	// estimatedModelBlockBytes is the estimated memory of a block of a model: the block hash, the
+	// block and its pod map, and the LRU list element.
+	estimatedModelBlockBytes = 256
+	// estimatedPodEntryBytes is the estimated memory of a pod entry of a block.
+	estimatedPodEntryBytes = 64
+)
+
+var (
+	prefixCacheBlocks = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "aibrix_prefix_cache_blocks",
+		Help: "Number of prefix cache blocks indexed in memory per model.",
+	}, []string{"model"})
+	prefixCacheMemoryBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "aibrix_prefix_cache_memory_bytes",
+		Help: "Estimated memory of the in-memory prefix cache index per model.",
+	}, []string{"model"})
+	prefixCacheEvictedBlocks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "aibrix_prefix_cache_evicted_blocks_total",
+		Help: "Number of prefix cache blocks evicted per model, by expiration or by the max blocks per model.",
+	}, []string{"model", "reason"})
+)
+
+func init() {
+	prometheus.MustRegister(prefixCacheBlocks, prefixCacheMemoryBytes, prefixCacheEvictedBlocks)
+}
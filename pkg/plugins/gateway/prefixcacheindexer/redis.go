@@ -0,0 +1,194 @@
+/*
+Copyright 2024 The Aibrix Team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package prefixcacheindexer
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/vllm-project/aibrix/pkg/cache"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	redisPrefixCacheKeyPrefix = "aibrix:prefix-cache"
+	redisPrefixCacheTimeout   = 100 * time.Millisecond
+)
+
+// RedisPrefixHashTable is a PrefixCacheIndexer shared by all gateway replicas.
+// Each block of a model is stored as a redis hash of pod name to last access time
+// under a key of the block hash. Blocks expire after the eviction duration without access,
+// pods of a block expire after the eviction duration since their last access time.
+type RedisPrefixHashTable struct {
+	client *redis.Client
+	name   string
+	ttl    time.Duration
+}
+
+func NewRedisPrefixHashTable(client *redis.Client) PrefixCacheIndexer {
+	return &RedisPrefixHashTable{
+		client: client,
+		name:   redisPrefixCacheKeyPrefix,
+		ttl:    prefixCacheEvictionDuration,
+	}
+}
+
+// MatchPrefix reads all blocks of the input tokens in one round trip and refreshes the ttl of matched blocks.
+// A redis failure is logged and treated as no match.
+func (c *RedisPrefixHashTable) MatchPrefix(tokens []byte, model string, pods []*v1.Pod) ([]byte, []byte, []*v1.Pod) {
+	return c.matchPrefix(tokens, model, pods, true)
+}
+
+// PeekPrefix matches like MatchPrefix without refreshing the ttl of matched blocks and the access time of their pods.
+func (c *RedisPrefixHashTable) PeekPrefix(tokens []byte, model string, pods []*v1.Pod) ([]byte, []byte, []*v1.Pod) {
+	return c.matchPrefix(tokens, model, pods, false)
+}
+
+// matchPrefix matches the blocks of the tokens, ignoring the pods of a block not accessed within the ttl.
+// refresh refreshes the ttl of the matched blocks and the access time of their matched pods, and removes
+// the expired pods of the matched blocks.
+func (c *RedisPrefixHashTable) matchPrefix(tokens []byte, model string, pods []*v1.Pod, refresh bool) ([]byte, []byte, []*v1.Pod) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisPrefixCacheTimeout)
+	defer cancel()
+
+	keys := c.blockKeys(tokens, model)
+	pipe := c.client.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipe.HGetAll(ctx, key)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		klog.ErrorS(err, "failed to match prefix in redis", "model", model)
+		return nil, tokens, nil
+	}
+
+	now := time.Now()
+	var lastMatchedPods []*v1.Pod
+	var matchedKeys []string
+	refreshPipe := c.client.Pipeline()
+	for i, cmd := range cmds {
+		blockPods := map[string]time.Time{}
+		var expiredPods []string
+		for pod, value := range cmd.Val() {
+			lastAccessTime, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || now.Sub(time.Unix(lastAccessTime, 0)) > c.ttl {
+				expiredPods = append(expiredPods, pod)
+				continue
+			}
+			blockPods[pod] = time.Unix(lastAccessTime, 0)
+		}
+		blockMatchedPods := matchPods(blockPods, pods)
+		if len(blockMatchedPods) == 0 {
+			break
+		}
+		lastMatchedPods = blockMatchedPods
+		matchedKeys = append(matchedKeys, keys[i])
+
+		if !refresh {
+			continue
+		}
+		if len(expiredPods) > 0 {
+			refreshPipe.HDel(ctx, keys[i], expiredPods...)
+		}
+		values := make([]interface{}, 0, 2*len(blockMatchedPods))
+		for _, pod := range blockMatchedPods {
+			values = append(values, cache.PodKey(pod), now.Unix())
+		}
+		refreshPipe.HSet(ctx, keys[i], values...)
+		refreshPipe.Expire(ctx, keys[i], c.ttl)
+	}
+
+	if refresh && len(matchedKeys) > 0 {
+		if _, err := refreshPipe.Exec(ctx); err != nil {
+			klog.ErrorS(err, "failed to refresh prefix cache blocks in redis", "model", model)
+		}
+	}
+
+	lastTokenMatchIndex := len(matchedKeys) * prefixCacheBlockSize
+	if lastTokenMatchIndex > len(tokens) {
+		lastTokenMatchIndex = len(tokens)
+	}
+	return tokens[0:lastTokenMatchIndex], tokens[lastTokenMatchIndex:], lastMatchedPods
+}
+
+// AddPrefix records the pod for all blocks of the tokens and refreshes their ttl.
+func (c *RedisPrefixHashTable) AddPrefix(unMatchedTokens []byte, model, pod string) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisPrefixCacheTimeout)
+	defer cancel()
+
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	pipe := c.client.Pipeline()
+	for _, key := range c.blockKeys(unMatchedTokens, model) {
+		pipe.HSet(ctx, key, pod, now)
+		pipe.Expire(ctx, key, c.ttl)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		klog.ErrorS(err, "failed to add prefix to redis", "model", model, "pod", pod)
+	}
+}
+
+// RemovePrefix removes the pod from all blocks of the tokens.
+func (c *RedisPrefixHashTable) RemovePrefix(tokens []byte, model, pod string) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisPrefixCacheTimeout)
+	defer cancel()
+
+	pipe := c.client.Pipeline()
+	for _, key := range c.blockKeys(tokens, model) {
+		pipe.HDel(ctx, key, pod)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		klog.ErrorS(err, "failed to remove prefix from redis", "model", model, "pod", pod)
+	}
+}
+
+// RemovePod removes the pod from the blocks of all models, scanning all prefix cache keys.
+func (c *RedisPrefixHashTable) RemovePod(pod string) {
+	ctx := context.Background()
+	iter := c.client.Scan(ctx, 0, c.name+":*", 0).Iterator()
+	pipe := c.client.Pipeline()
+	for iter.Next(ctx) {
+		pipe.HDel(ctx, iter.Val(), pod)
+	}
+	if err := iter.Err(); err != nil {
+		klog.ErrorS(err, "failed to scan prefix cache blocks in redis", "pod", pod)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		klog.ErrorS(err, "failed to remove pod from redis", "pod", pod)
+	}
+}
+
+// Evict is a no-op, blocks are evicted by redis key expiration.
+func (c *RedisPrefixHashTable) Evict(now time.Time) {}
+
+// blockKeys returns the redis keys of the token blocks. The hash is unseeded so that
+// all gateway replicas generate the same keys.
+func (c *RedisPrefixHashTable) blockKeys(tokens []byte, model string) []string {
+	var keys []string
+	for i := 0; i < len(tokens); i += prefixCacheBlockSize {
+		end := i + prefixCacheBlockSize
+		if end > len(tokens) {
+			end = len(tokens)
+		}
+		keys = append(keys, fmt.Sprintf("%s:%s:%d", c.name, model, xxhash.Sum64(tokens[i:end])))
+	}
+	return keys
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2024 The Aibrix Team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package prefixcacheindexer
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/vllm-project/aibrix/pkg/plugins/gateway/prefixcacheindexer/tokenizer"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newRedisPrefixHashTable(t *testing.T, mr *miniredis.Miniredis) PrefixCacheIndexer {
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	return NewRedisPrefixHashTable(client)
+}
+
+func Test_RedisPrefixHashTableSharedAcrossReplicas(t *testing.T) {
+	mr := miniredis.RunT(t)
+	replica1 := newRedisPrefixHashTable(t, mr)
+	replica2 := newRedisPrefixHashTable(t, mr)
+	pods := []*v1.Pod{
+		{ObjectMeta: metav1.ObjectMeta{Name: "p1"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "p2"}},
+	}
+
+	tokens, err := tokenizer.NewStringTokenizer().TokenizeInputText("this is first message, which will be shared by all gateway replicas")
+	assert.NoError(t, err)
+
+	matchedTokens, unMatchedTokens, matchedPods := replica1.MatchPrefix(tokens, "m1", pods)
+	assert.Empty(t, matchedTokens)
+	assert.Equal(t, tokens, unMatchedTokens)
+	assert.Empty(t, matchedPods)
+	replica1.AddPrefix(unMatchedTokens, "m1", "p1")
+
+	// prefix added by one replica is matched by the other one
+	matchedTokens, unMatchedTokens, matchedPods = replica2.MatchPrefix(tokens, "m1", pods)
+	assert.Equal(t, tokens, matchedTokens)
+	assert.Empty(t, unMatchedTokens)
+	assert.Equal(t, []*v1.Pod{pods[0]}, matchedPods)
+
+	// other models and pods which are not ready do not match
+	matchedTokens, _, _ = replica2.MatchPrefix(tokens, "m2", pods)
+	assert.Empty(t, matchedTokens)
+	matchedTokens, _, _ = replica2.MatchPrefix(tokens, "m1", pods[1:])
+	assert.Empty(t, matchedTokens)
+
+	// partial prefix match
+	extended := append(append([]byte{}, tokens...), []byte(" with an extended suffix that is longer than a block")...)
+	matchedTokens, unMatchedTokens, matchedPods = replica2.MatchPrefix(extended, "m1", pods)
+	assert.Equal(t, len(tokens)/prefixCacheBlockSize*prefixCacheBlockSize, len(matchedTokens))
+	assert.Equal(t, extended[len(matchedTokens):], unMatchedTokens)
+	assert.Equal(t, []*v1.Pod{pods[0]}, matchedPods)
+}
+
+func Test_RedisPrefixHashTableExpiration(t *testing.T) {
+	mr := miniredis.RunT(t)
+	cache := newRedisPrefixHashTable(t, mr)
+	pods := []*v1.Pod{{ObjectMeta: metav1.ObjectMeta{Name: "p1"}}}
+	tokens := []byte("a message of a single block")
+
+	cache.AddPrefix(tokens, "m1", "p1")
+	mr.FastForward(prefixCacheEvictionDuration / 2)
+	matchedTokens, _, _ := cache.MatchPrefix(tokens, "m1", pods)
+	assert.Equal(t, tokens, matchedTokens)
+
+	// match refreshes the ttl
+	mr.FastForward(prefixCacheEvictionDuration * 3 / 4)
+	matchedTokens, _, _ = cache.MatchPrefix(tokens, "m1", pods)
+	assert.Equal(t, tokens, matchedTokens)
+
+	mr.FastForward(prefixCacheEvictionDuration + 1)
+	matchedTokens, _, _ = cache.MatchPrefix(tokens, "m1", pods)
+	assert.Empty(t, matchedTokens)
+
+	// peek does not refresh the ttl
+	cache.AddPrefix(tokens, "m1", "p1")
+	mr.FastForward(prefixCacheEvictionDuration / 2)
+	matchedTokens, _, _ = cache.PeekPrefix(tokens, "m1", pods)
+	assert.Equal(t, tokens, matchedTokens)
+	mr.FastForward(prefixCacheEvictionDuration * 3 / 4)
+	matchedTokens, _, _ = cache.PeekPrefix(tokens, "m1", pods)
+	assert.Empty(t, matchedTokens)
+}
+
+func Test_RedisPrefixHashTablePodExpiration(t *testing.T) {
+	mr := miniredis.RunT(t)
+	cache := newRedisPrefixHashTable(t, mr).(*RedisPrefixHashTable)
+	pods := []*v1.Pod{
+		{ObjectMeta: metav1.ObjectMeta{Name: "p1"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "p2"}},
+	}
+	tokens := []byte("a message of a single block")
+	cache.AddPrefix(tokens, "m1", "p1")
+	cache.AddPrefix(tokens, "m1", "p2")
+
+	// p2 was last accessed before the ttl while p1 kept the blocks alive
+	keys := cache.blockKeys(tokens, "m1")
+	expired := strconv.FormatInt(time.Now().Add(-prefixCacheEvictionDuration-time.Minute).Unix(), 10)
+	for _, key := range keys {
+		mr.HSet(key, "p2", expired)
+	}
+	_, _, matchedPods := cache.PeekPrefix(tokens, "m1", pods)
+	assert.Equal(t, []*v1.Pod{pods[0]}, matchedPods)
+	fields, err := mr.HKeys(keys[0])
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"p1", "p2"}, fields)
+
+	// match removes the expired pods of the blocks
+	_, _, matchedPods = cache.MatchPrefix(tokens, "m1", pods)
+	assert.Equal(t, []*v1.Pod{pods[0]}, matchedPods)
+	for _, key := range keys {
+		fields, err = mr.HKeys(key)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"p1"}, fields)
+	}
+}
+
+func Test_RedisPrefixHashTableUnavailable(t *testing.T) {
+	mr := miniredis.RunT(t)
+	cache := newRedisPrefixHashTable(t, mr)
+	pods := []*v1.Pod{{ObjectMeta: metav1.ObjectMeta{Name: "p1"}}}
+	tokens := []byte("a message of a single block")
+	cache.AddPrefix(tokens, "m1", "p1")
+
+	mr.Close()
+	matchedTokens, unMatchedTokens, matchedPods := cache.MatchPrefix(tokens, "m1", pods)
+	assert.Empty(t, matchedTokens)
+	assert.Equal(t, tokens, unMatchedTokens)
+	assert.Empty(t, matchedPods)
+}
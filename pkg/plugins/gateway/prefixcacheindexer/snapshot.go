@@ -0,0 +1,391 @@
+/*
+Copyright 2024 The Aibrix Team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package prefixcacheindexer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"k8s.io/klog/v2"
+)
+
+// Snapshot format: the magic, the format version and the kind of indexer, followed by the state of
+// the indexer. Integers are varints, strings are length prefixed.
+const (
+	snapshotMagic   = "APCS"
+	snapshotVersion = uint16(1)
+
+	snapshotKindPrefixHashTable = byte(1)
+	snapshotKindLPRadixCache    = byte(2)
+
+	maxSnapshotLength     = 1 << 28 // upper bound of any length in a snapshot, to reject corrupted snapshots
+	redisSnapshotKey      = "aibrix:prefix-cache-snapshot"
+	redisSnapshotTimeout  = 10 * time.Second
+	redisSnapshotTTL      = 24 * time.Hour // snapshots of replicas which stopped saving expire
+	snapshotFileExtension = ".snapshot"
+)
+
+var ErrSnapshotNotFound = errors.New("prefix cache snapshot not found")
+
+// Snapshotter is an indexer whose state can be saved and restored across gateway restarts.
+type Snapshotter interface {
+	// WriteSnapshot writes the state of the indexer.
+	WriteSnapshot(w io.Writer) error
+
+	// ReadSnapshot replaces the state of the indexer with a snapshot, it can be called concurrently with
+	// other methods of the indexer. The state is kept if the snapshot is invalid.
+	ReadSnapshot(r io.Reader) error
+
+	// RemovePodsNotInCurrentPodSet removes the pods which no longer exist from all blocks.
+	RemovePodsNotInCurrentPodSet(currentPodSet map[string]bool)
+}
+
+// SnapshotStore saves snapshots by name.
+type SnapshotStore interface {
+	Save(name string, data []byte) error
+	// Load returns ErrSnapshotNotFound if no snapshot of the name is saved.
+	Load(name string) ([]byte, error)
+}
+
+// fileSnapshotStore saves snapshots as files of a directory.
+type fileSnapshotStore struct {
+	dir string
+}
+
+func NewFileSnapshotStore(dir string) SnapshotStore {
+	return &fileSnapshotStore{dir: dir}
+}
+
+// Save writes a temporary file first, so that a crash does not leave a partial snapshot.
+func (s *fileSnapshotStore) Save(name string, data []byte) error {
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(s.dir, name+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(s.dir, name+snapshotFileExtension))
+}
+
+func (s *fileSnapshotStore) Load(name string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, name+snapshotFileExtension))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrSnapshotNotFound
+	}
+	return data, err
+}
+
+// redisSnapshotStore saves the snapshots of each gateway replica in redis under its own key, so that replicas
+// do not overwrite the snapshots of each other. A replica without a snapshot, e.g. a new pod of a deployment,
+// loads the last snapshot saved by any replica.
+type redisSnapshotStore struct {
+	client  *redis.Client
+	replica string
+}
+
+func NewRedisSnapshotStore(client *redis.Client, replica string) SnapshotStore {
+	return &redisSnapshotStore{client: client, replica: replica}
+}
+
+func (s *redisSnapshotStore) key(name, replica string) string {
+	return redisSnapshotKey + ":" + name + ":" + replica
+}
+
+// replicasKey is the key of the replicas which saved a snapshot of the name, scored by their last save time.
+func (s *redisSnapshotStore) replicasKey(name string) string {
+	return redisSnapshotKey + ":" + name + ":replicas"
+}
+
+func (s *redisSnapshotStore) Save(name string, data []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisSnapshotTimeout)
+	defer cancel()
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, s.key(name, s.replica), data, redisSnapshotTTL)
+		pipe.ZAdd(ctx, s.replicasKey(name), redis.Z{Score: float64(time.Now().UnixMilli()), Member: s.replica})
+		return nil
+	})
+	return err
+}
+
+func (s *redisSnapshotStore) Load(name string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisSnapshotTimeout)
+	defer cancel()
+	data, err := s.client.Get(ctx, s.key(name, s.replica)).Bytes()
+	if !errors.Is(err, redis.Nil) {
+		return data, err
+	}
+
+	replicas, err := s.client.ZRevRange(ctx, s.replicasKey(name), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	for _, replica := range replicas {
+		data, err := s.client.Get(ctx, s.key(name, replica)).Bytes()
+		if errors.Is(err, redis.Nil) {
+			// the snapshot of the replica expired
+			s.client.ZRem(ctx, s.replicasKey(name), replica)
+			continue
+		}
+		return data, err
+	}
+	return nil, ErrSnapshotNotFound
+}
+
+// SnapshotManager restores an indexer from its last snapshot and then saves snapshots periodically.
+type SnapshotManager struct {
+	name     string
+	indexer  Snapshotter
+	store    SnapshotStore
+	interval time.Duration
+	once     sync.Once
+}
+
+func NewSnapshotManager(name string, indexer Snapshotter, store SnapshotStore, interval time.Duration) *SnapshotManager {
+	return &SnapshotManager{
+		name:     name,
+		indexer:  indexer,
+		store:    store,
+		interval: interval,
+	}
+}
+
+// Start restores the last snapshot, drops the pods not in the current pod set unless it is nil, and starts
+// saving snapshots. Only the first call has effect, concurrent calls wait for the restore to finish.
+func (m *SnapshotManager) Start(currentPodSet func() map[string]bool) {
+	m.once.Do(func() {
+		if err := m.Restore(); err != nil {
+			klog.ErrorS(err, "failed to restore prefix cache snapshot", "name", m.name)
+		} else if podSet := currentPodSet(); podSet != nil {
+			m.indexer.RemovePodsNotInCurrentPodSet(podSet)
+		}
+
+		go func() {
+			ticker := time.NewTicker(m.interval)
+			for range ticker.C {
+				if err := m.Save(); err != nil {
+					klog.ErrorS(err, "failed to save prefix cache snapshot", "name", m.name)
+				}
+			}
+		}()
+	})
+}
+
+// Save writes a snapshot of the indexer to the store.
+func (m *SnapshotManager) Save() error {
+	var buf bytes.Buffer
+	if err := m.indexer.WriteSnapshot(&buf); err != nil {
+		return err
+	}
+	if err := m.store.Save(m.name, buf.Bytes()); err != nil {
+		return err
+	}
+	klog.V(4).InfoS("saved prefix cache snapshot", "name", m.name, "bytes", buf.Len())
+	return nil
+}
+
+// Restore reads the last snapshot from the store into the indexer, a missing snapshot is not an error.
+func (m *SnapshotManager) Restore() error {
+	data, err := m.store.Load(m.name)
+	if errors.Is(err, ErrSnapshotNotFound) {
+		klog.InfoS("no prefix cache snapshot to restore", "name", m.name)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if err := m.indexer.ReadSnapshot(bytes.NewReader(data)); err != nil {
+		return err
+	}
+	klog.InfoS("restored prefix cache snapshot", "name", m.name, "bytes", len(data))
+	return nil
+}
+
+// snapshotWriter writes the snapshot encoding, keeping the first error.
+type snapshotWriter struct {
+	w   *bufio.Writer
+	buf [binary.MaxVarintLen64]byte
+	err error
+}
+
+func newSnapshotWriter(w io.Writer, kind byte) *snapshotWriter {
+	sw := &snapshotWriter{w: bufio.NewWriter(w)}
+	sw.write([]byte(snapshotMagic))
+	sw.write(binary.BigEndian.AppendUint16(nil, snapshotVersion))
+	sw.write([]byte{kind})
+	return sw
+}
+
+func (sw *snapshotWriter) write(p []byte) {
+	if sw.err == nil {
+		_, sw.err = sw.w.Write(p)
+	}
+}
+
+func (sw *snapshotWriter) uint64(v uint64) {
+	sw.write(binary.BigEndian.AppendUint64(sw.buf[:0], v))
+}
+
+func (sw *snapshotWriter) uvarint(v uint64) {
+	n := binary.PutUvarint(sw.buf[:], v)
+	sw.write(sw.buf[:n])
+}
+
+func (sw *snapshotWriter) varint(v int64) {
+	n := binary.PutVarint(sw.buf[:], v)
+	sw.write(sw.buf[:n])
+}
+
+func (sw *snapshotWriter) string(s string) {
+	sw.uvarint(uint64(len(s)))
+	sw.write([]byte(s))
+}
+
+func (sw *snapshotWriter) ints(values []int) {
+	sw.uvarint(uint64(len(values)))
+	for _, v := range values {
+		sw.varint(int64(v))
+	}
+}
+
+func (sw *snapshotWriter) time(t time.Time) {
+	sw.varint(t.UnixNano())
+}
+
+func (sw *snapshotWriter) pods(pods map[string]time.Time) {
+	sw.uvarint(uint64(len(pods)))
+	for pod, t := range pods {
+		sw.string(pod)
+		sw.time(t)
+	}
+}
+
+func (sw *snapshotWriter) flush() error {
+	if sw.err != nil {
+		return sw.err
+	}
+	return sw.w.Flush()
+}
+
+// snapshotReader reads the snapshot encoding, keeping the first error.
+type snapshotReader struct {
+	r   *bufio.Reader
+	err error
+}
+
+func newSnapshotReader(r io.Reader, kind byte) (*snapshotReader, error) {
+	sr := &snapshotReader{r: bufio.NewReader(r)}
+	header := make([]byte, len(snapshotMagic)+3)
+	if _, err := io.ReadFull(sr.r, header); err != nil {
+		return nil, fmt.Errorf("invalid prefix cache snapshot header: %w", err)
+	}
+	if string(header[:len(snapshotMagic)]) != snapshotMagic {
+		return nil, fmt.Errorf("invalid prefix cache snapshot magic")
+	}
+	if version := binary.BigEndian.Uint16(header[len(snapshotMagic):]); version != snapshotVersion {
+		return nil, fmt.Errorf("unsupported prefix cache snapshot version %d", version)
+	}
+	if header[len(header)-1] != kind {
+		return nil, fmt.Errorf("prefix cache snapshot of kind %d, expected %d", header[len(header)-1], kind)
+	}
+	return sr, nil
+}
+
+func (sr *snapshotReader) uint64() uint64 {
+	var buf [8]byte
+	if sr.err == nil {
+		_, sr.err = io.ReadFull(sr.r, buf[:])
+	}
+	return binary.BigEndian.Uint64(buf[:])
+}
+
+func (sr *snapshotReader) uvarint() uint64 {
+	if sr.err != nil {
+		return 0
+	}
+	var v uint64
+	v, sr.err = binary.ReadUvarint(sr.r)
+	return v
+}
+
+func (sr *snapshotReader) varint() int64 {
+	if sr.err != nil {
+		return 0
+	}
+	var v int64
+	v, sr.err = binary.ReadVarint(sr.r)
+	return v
+}
+
+// length reads a length and rejects values out of bound.
+func (sr *snapshotReader) length() int {
+	v := sr.uvarint()
+	if sr.err == nil && v > maxSnapshotLength {
+		sr.err = fmt.Errorf("invalid length %d in prefix cache snapshot", v)
+	}
+	if sr.err != nil {
+		return 0
+	}
+	return int(v)
+}
+
+func (sr *snapshotReader) string() string {
+	buf := make([]byte, sr.length())
+	if sr.err == nil {
+		_, sr.err = io.ReadFull(sr.r, buf)
+	}
+	return string(buf)
+}
+
+func (sr *snapshotReader) ints() []int {
+	values := make([]int, sr.length())
+	for i := range values {
+		values[i] = int(sr.varint())
+	}
+	return values
+}
+
+func (sr *snapshotReader) time() time.Time {
+	return time.Unix(0, sr.varint())
+}
+
+func (sr *snapshotReader) pods() map[string]time.Time {
+	n := sr.length()
+	pods := make(map[string]time.Time, n)
+	for i := 0; i < n && sr.err == nil; i++ {
+		pod := sr.string()
+		pods[pod] = sr.time()
+	}
+	return pods
+}
@@ -0,0 +1,204 @@
+/*
+Copyright 2024 The Aibrix Team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package prefixcacheindexer
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func snapshotTestPods() []*v1.Pod {
+	return []*v1.Pod{
+		{ObjectMeta: metav1.ObjectMeta{Name: "p1"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "p2"}},
+	}
+}
+
+func TestPrefixHashTableSnapshot(t *testing.T) {
+	tokens := []byte("HelloWorld!WhataGoodDay!Gooddayt")
+	cache := newPrefixHashTable(42, 4, 0)
+	cache.AddPrefix(tokens, "m1", "p1")
+	cache.AddPrefix(tokens, "m2", "p2")
+
+	manager := NewSnapshotManager("prefix-cache", cache, NewFileSnapshotStore(t.TempDir()), time.Hour)
+	assert.NoError(t, manager.Save())
+
+	restored := newPrefixHashTable(0, defaultPrefixCacheShards, 0)
+	manager = NewSnapshotManager("prefix-cache", restored, manager.store, time.Hour)
+	assert.NoError(t, manager.Restore())
+
+	matched, unMatched, pods := restored.MatchPrefix(tokens, "m1", snapshotTestPods())
+	assert.Equal(t, tokens, matched)
+	assert.Empty(t, unMatched)
+	assert.Equal(t, "p1", pods[0].Name)
+	_, _, pods = restored.MatchPrefix(tokens, "m2", snapshotTestPods())
+	assert.Equal(t, "p2", pods[0].Name)
+	assert.Equal(t, int64(len(tokens)/prefixCacheBlockSize), restored.models["m1"].blocks.Load())
+
+	// the blocks of each model are capped on restore
+	capped := newPrefixHashTable(0, defaultPrefixCacheShards, 1)
+	assert.NoError(t, NewSnapshotManager("prefix-cache", capped, manager.store, time.Hour).Restore())
+	assert.Equal(t, int64(1), capped.models["m1"].blocks.Load())
+	assert.Equal(t, int64(1), capped.models["m2"].blocks.Load())
+}
+
+func TestSnapshotManagerStart(t *testing.T) {
+	tokens := []byte("HelloWorld!WhataGoodDay!Gooddayt")
+	cache := newPrefixHashTable(42, 4, 0)
+	cache.AddPrefix(tokens, "m1", "p1")
+	cache.AddPrefix(tokens, "m1", "p2")
+	store := NewFileSnapshotStore(t.TempDir())
+	assert.NoError(t, NewSnapshotManager("prefix-cache", cache, store, time.Hour).Save())
+
+	// pods deleted while the gateway was down are dropped on restore
+	restored := newPrefixHashTable(0, defaultPrefixCacheShards, 0)
+	NewSnapshotManager("prefix-cache", restored, store, time.Hour).Start(func() map[string]bool {
+		return map[string]bool{"p2": true}
+	})
+	_, _, pods := restored.MatchPrefix(tokens, "m1", snapshotTestPods())
+	assert.Len(t, pods, 1)
+	assert.Equal(t, "p2", pods[0].Name)
+
+	// a missing snapshot is not an error
+	empty := newPrefixHashTable(0, defaultPrefixCacheShards, 0)
+	assert.NoError(t, NewSnapshotManager("missing", empty, store, time.Hour).Restore())
+	assert.Empty(t, empty.models)
+}
+
+func TestSnapshotRestoreWhileRouting(t *testing.T) {
+	tokens := []byte("HelloWorld!WhataGoodDay!Gooddayt")
+	var hashBuf, treeBuf bytes.Buffer
+	hashTable := newPrefixHashTable(42, 4, 0)
+	hashTable.AddPrefix(tokens, "m1", "p1")
+	assert.NoError(t, hashTable.WriteSnapshot(&hashBuf))
+	tree := NewLPRadixCache(2)
+	tree.AddPrefix([]int{1, 2, 3, 4}, "m1", "p1")
+	assert.NoError(t, tree.WriteSnapshot(&treeBuf))
+
+	restoredHashTable := newPrefixHashTable(0, defaultPrefixCacheShards, 0)
+	restoredTree := NewLPRadixCache(2)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.NoError(t, restoredHashTable.ReadSnapshot(bytes.NewReader(hashBuf.Bytes())))
+		assert.NoError(t, restoredTree.ReadSnapshot(bytes.NewReader(treeBuf.Bytes())))
+	}()
+	for i := 0; i < 100; i++ {
+		restoredHashTable.AddPrefix(tokens, "m1", "p2")
+		restoredHashTable.MatchPrefix(tokens, "m1", snapshotTestPods())
+		restoredTree.AddPrefix([]int{5, 6}, "m1", "p2")
+		restoredTree.MatchPrefix([]int{1, 2, 3, 4}, "m1", snapshotTestPods())
+	}
+	wg.Wait()
+
+	_, _, pods := restoredTree.MatchPrefix([]int{1, 2, 3, 4}, "m1", snapshotTestPods())
+	assert.Len(t, pods, 1)
+}
+
+func TestSnapshotInvalid(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, newPrefixHashTable(42, 4, 0).WriteSnapshot(&buf))
+	data := buf.Bytes()
+
+	for name, corrupt := range map[string]func([]byte) []byte{
+		"magic":     func(b []byte) []byte { b[0] = 'X'; return b },
+		"version":   func(b []byte) []byte { b[len(snapshotMagic)+1]++; return b },
+		"kind":      func(b []byte) []byte { b[len(snapshotMagic)+2] = snapshotKindLPRadixCache; return b },
+		"truncated": func(b []byte) []byte { return b[:len(b)-1] },
+	} {
+		t.Run(name, func(t *testing.T) {
+			cache := newPrefixHashTable(0, defaultPrefixCacheShards, 0)
+			cache.AddPrefix([]byte("HelloWorld!WhataGoodDay!Gooddayt"), "m1", "p1")
+			assert.Error(t, cache.ReadSnapshot(bytes.NewReader(corrupt(bytes.Clone(data)))))
+			// the state is kept on error
+			assert.Len(t, cache.models, 1)
+		})
+	}
+
+	var treeBuf bytes.Buffer
+	assert.NoError(t, NewLPRadixCache(2).WriteSnapshot(&treeBuf))
+	tree := NewLPRadixCache(2)
+	tree.AddPrefix([]int{1, 2, 3, 4}, "m1", "p1")
+	assert.Error(t, tree.ReadSnapshot(bytes.NewReader(treeBuf.Bytes()[:treeBuf.Len()-1])))
+	_, _, pods := tree.MatchPrefix([]int{1, 2, 3, 4}, "m1", snapshotTestPods())
+	assert.Len(t, pods, 1)
+}
+
+func TestLPRadixCacheSnapshot(t *testing.T) {
+	cache := NewLPRadixCache(2)
+	cache.AddPrefix([]int{1, 2, 3, 4}, "m1", "p1")
+	cache.AddPrefix([]int{1, 2, 5, 6}, "m1", "p2")
+
+	var buf bytes.Buffer
+	assert.NoError(t, cache.WriteSnapshot(&buf))
+	restored := NewLPRadixCache(2)
+	restored.AddPrefix([]int{7, 8}, "m1", "p1")
+	assert.NoError(t, restored.ReadSnapshot(&buf))
+	assert.Len(t, restored.GetAllNodes(), len(cache.GetAllNodes()))
+
+	matched, unMatched, pods := restored.MatchPrefix([]int{1, 2, 5, 6}, "m1", snapshotTestPods())
+	assert.Equal(t, []int{1, 2, 5, 6}, matched)
+	assert.Empty(t, unMatched)
+	assert.Len(t, pods, 1)
+	assert.Equal(t, "p2", pods[0].Name)
+	_, _, pods = restored.MatchPrefix([]int{7, 8}, "m1", snapshotTestPods())
+	assert.Empty(t, pods)
+
+	restored.RemovePodsNotInCurrentPodSet(map[string]bool{"p1": true})
+	_, _, pods = restored.MatchPrefix([]int{1, 2, 3, 4}, "m1", snapshotTestPods())
+	assert.Len(t, pods, 1)
+	assert.Equal(t, "p1", pods[0].Name)
+}
+
+func TestRedisSnapshotStore(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	store := NewRedisSnapshotStore(client, "gateway-1")
+
+	_, err := store.Load("prefix-cache")
+	assert.ErrorIs(t, err, ErrSnapshotNotFound)
+	assert.NoError(t, store.Save("prefix-cache", []byte("snapshot")))
+	data, err := store.Load("prefix-cache")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("snapshot"), data)
+
+	// replicas do not overwrite the snapshots of each other
+	other := NewRedisSnapshotStore(client, "gateway-2")
+	assert.NoError(t, other.Save("prefix-cache", []byte("other snapshot")))
+	data, err = store.Load("prefix-cache")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("snapshot"), data)
+
+	// a new replica loads the last saved snapshot, skipping expired ones
+	newReplica := NewRedisSnapshotStore(client, "gateway-3")
+	data, err = newReplica.Load("prefix-cache")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("other snapshot"), data)
+	mr.Del(redisSnapshotKey + ":prefix-cache:gateway-2")
+	data, err = newReplica.Load("prefix-cache")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("snapshot"), data)
+}
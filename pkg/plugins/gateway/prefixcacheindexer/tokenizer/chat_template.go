@@ -0,0 +1,203 @@
+/*
+Copyright 2024 The Aibrix Team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tokenizer
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Built-in chat templates, jinja templates are not evaluated but matched to one of them.
+const (
+	ChatTemplateChatML  = "chatml"
+	ChatTemplateLlama3  = "llama3"
+	ChatTemplateLlama2  = "llama2"
+	ChatTemplateMistral = "mistral"
+)
+
+// ChatMessage is a message of a chat completion request, content is a string or a list of content parts.
+type ChatMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+// text returns the text content of the message, joining the text parts.
+func (m ChatMessage) text() string {
+	var content string
+	if err := json.Unmarshal(m.Content, &content); err == nil {
+		return content
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(m.Content, &parts); err != nil {
+		return ""
+	}
+	texts := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part.Type == "text" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// chatTemplate is a built-in chat template with the defaults which the jinja template of the model renders.
+type chatTemplate struct {
+	// name is the built-in template, empty if the template of the model is unknown
+	name string
+	// defaultSystem is the system message rendered when the messages have none, e.g. by Qwen2.5
+	defaultSystem string
+	// knowledgeDate is the "Cutting Knowledge Date" of the system header of Llama 3.1 and later, empty if none
+	knowledgeDate string
+	// todayDate is the "Today Date" of the system header, empty for the current date of strftime_now
+	todayDate string
+}
+
+var (
+	// chatMLDefaultSystemRegexp matches the default system message of ChatML templates, e.g.
+	// '<|im_start|>system\nYou are a helpful assistant.<|im_end|>\n'
+	chatMLDefaultSystemRegexp = regexp.MustCompile(`'<\|im_start\|>system(?:\\n|\n)([^']+?)<\|im_end\|>(?:\\n|\n)'`)
+	knowledgeDateRegexp       = regexp.MustCompile(`Cutting Knowledge Date: ([^"'\\\n]+)`)
+	dateStringRegexp          = regexp.MustCompile(`set date_string = "([^"]+)"`)
+)
+
+// strftimeNowLayout is the layout of strftime_now("%d %b %Y") of Llama 3.2 templates.
+const strftimeNowLayout = "02 Jan 2006"
+
+// detectChatTemplate returns the built-in template of the chat_template of tokenizer_config.json, which is
+// either a template name or a jinja template. Jinja templates are not evaluated, they are matched to a built-in
+// template and their defaults are extracted. An unknown template returns an empty name.
+func detectChatTemplate(raw json.RawMessage) chatTemplate {
+	var template string
+	if err := json.Unmarshal(raw, &template); err != nil {
+		// a list of named templates, use the default one
+		var templates []struct {
+			Name     string `json:"name"`
+			Template string `json:"template"`
+		}
+		if err := json.Unmarshal(raw, &templates); err != nil {
+			return chatTemplate{}
+		}
+		for _, t := range templates {
+			if t.Name == "default" {
+				template = t.Template
+			}
+		}
+	}
+
+	switch {
+	case template == ChatTemplateChatML, template == ChatTemplateLlama3, template == ChatTemplateLlama2, template == ChatTemplateMistral:
+		return chatTemplate{name: template}
+	case strings.Contains(template, "<|im_start|>"):
+		t := chatTemplate{name: ChatTemplateChatML}
+		if match := chatMLDefaultSystemRegexp.FindStringSubmatch(template); match != nil {
+			t.defaultSystem = match[1]
+		}
+		return t
+	case strings.Contains(template, "<|start_header_id|>"):
+		t := chatTemplate{name: ChatTemplateLlama3}
+		if match := knowledgeDateRegexp.FindStringSubmatch(template); match != nil {
+			t.knowledgeDate = match[1]
+			// Llama 3.2 uses the current date if strftime_now is defined, as by vLLM, and Llama 3.1 a fixed date
+			if match := dateStringRegexp.FindStringSubmatch(template); match != nil && !strings.Contains(template, "strftime_now") {
+				t.todayDate = match[1]
+			}
+		}
+		return t
+	case strings.Contains(template, "<<SYS>>"):
+		return chatTemplate{name: ChatTemplateLlama2}
+	case strings.Contains(template, "[INST]"):
+		return chatTemplate{name: ChatTemplateMistral}
+	}
+	return chatTemplate{}
+}
+
+// applyChatTemplate renders the messages with the generation prompt of the assistant, as the engine does for
+// chat completion requests.
+func applyChatTemplate(template chatTemplate, messages []ChatMessage) (string, error) {
+	var builder strings.Builder
+	switch template.name {
+	case ChatTemplateChatML:
+		if template.defaultSystem != "" && (len(messages) == 0 || messages[0].Role != "system") {
+			builder.WriteString("<|im_start|>system\n" + template.defaultSystem + "<|im_end|>\n")
+		}
+		for _, m := range messages {
+			builder.WriteString("<|im_start|>" + m.Role + "\n" + m.text() + "<|im_end|>\n")
+		}
+		builder.WriteString("<|im_start|>assistant\n")
+	case ChatTemplateLlama3:
+		builder.WriteString("<|begin_of_text|>")
+		if template.knowledgeDate != "" {
+			// the system header is rendered with the system message, if any
+			system := ""
+			if len(messages) > 0 && messages[0].Role == "system" {
+				system = strings.TrimSpace(messages[0].text())
+				messages = messages[1:]
+			}
+			todayDate := template.todayDate
+			if todayDate == "" {
+				todayDate = time.Now().Format(strftimeNowLayout)
+			}
+			builder.WriteString("<|start_header_id|>system<|end_header_id|>\n\nCutting Knowledge Date: " + template.knowledgeDate +
+				"\nToday Date: " + todayDate + "\n\n" + system + "<|eot_id|>")
+		}
+		for _, m := range messages {
+			builder.WriteString("<|start_header_id|>" + m.Role + "<|end_header_id|>\n\n" + strings.TrimSpace(m.text()) + "<|eot_id|>")
+		}
+		builder.WriteString("<|start_header_id|>assistant<|end_header_id|>\n\n")
+	case ChatTemplateLlama2, ChatTemplateMistral:
+		// the system message is merged into the first user message
+		system := ""
+		if len(messages) > 0 && messages[0].Role == "system" {
+			system = strings.TrimSpace(messages[0].text())
+			messages = messages[1:]
+		}
+		for i, m := range messages {
+			content := strings.TrimSpace(m.text())
+			switch m.Role {
+			case "user":
+				if i == 0 && system != "" {
+					if template.name == ChatTemplateLlama2 {
+						content = "<<SYS>>\n" + system + "\n<</SYS>>\n\n" + content
+					} else {
+						content = system + "\n\n" + content
+					}
+				}
+				if template.name == ChatTemplateLlama2 || i == 0 {
+					builder.WriteString("<s>")
+				}
+				builder.WriteString("[INST] " + content + " [/INST]")
+			case "assistant":
+				if template.name == ChatTemplateLlama2 {
+					builder.WriteString(" " + content + " </s>")
+				} else {
+					builder.WriteString(content + "</s>")
+				}
+			default:
+				return "", fmt.Errorf("unsupported role %s for chat template %s", m.Role, template.name)
+			}
+		}
+	default:
+		return "", fmt.Errorf("unsupported chat template %s", template.name)
+	}
+	return builder.String(), nil
+}
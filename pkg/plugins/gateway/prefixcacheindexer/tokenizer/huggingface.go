@@ -0,0 +1,599 @@
+/*
+Copyright 2024 The Aibrix Team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tokenizer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/dlclark/regexp2"
+	"golang.org/x/text/unicode/norm"
+)
+
+// HuggingFaceTokenizer encodes text like the HuggingFace tokenizers library using the
+// tokenizer.json of a model, so that token blocks align with the blocks of the engine.
+// BPE, including byte-level and SentencePiece BPE with byte fallback, and Unigram models
+// are supported.
+type HuggingFaceTokenizer struct {
+	addedTokens   *addedTokenTrie // nil if the tokenizer has no added tokens
+	normalizers   []normalizer
+	preTokenizers []preTokenizer
+	postProcessor *templateProcessor
+	model         tokenizerModel
+	// chatTemplate is the built-in chat template of the model, its name is empty if none
+	chatTemplate chatTemplate
+}
+
+// addedTokenTrie is a trie of the contents of the added tokens, which finds the longest added token at a
+// position of a text in the length of the token rather than the number of added tokens.
+type addedTokenTrie struct {
+	children map[byte]*addedTokenTrie
+	id       int // id of the added token ending at the node, -1 if none
+}
+
+func newAddedTokenTrie() *addedTokenTrie {
+	return &addedTokenTrie{children: map[byte]*addedTokenTrie{}, id: -1}
+}
+
+func (n *addedTokenTrie) add(content string, id int) {
+	for i := 0; i < len(content); i++ {
+		child, ok := n.children[content[i]]
+		if !ok {
+			child = newAddedTokenTrie()
+			n.children[content[i]] = child
+		}
+		n = child
+	}
+	n.id = id
+}
+
+// longestMatch returns the id and the length of the longest added token at the start of the text, -1 and 0 if none.
+func (n *addedTokenTrie) longestMatch(text string) (int, int) {
+	id, length := -1, 0
+	for i := 0; i < len(text); i++ {
+		child, ok := n.children[text[i]]
+		if !ok {
+			break
+		}
+		n = child
+		if n.id >= 0 {
+			id, length = n.id, i+1
+		}
+	}
+	return id, length
+}
+
+type normalizer func(string) string
+
+type preTokenizer func(pieces []string) []string
+
+type tokenizerModel interface {
+	tokenize(word string) []int
+}
+
+type hfTokenizerJSON struct {
+	AddedTokens []struct {
+		ID      int    `json:"id"`
+		Content string `json:"content"`
+	} `json:"added_tokens"`
+	Normalizer    *hfComponent `json:"normalizer"`
+	PreTokenizer  *hfComponent `json:"pre_tokenizer"`
+	PostProcessor *hfComponent `json:"post_processor"`
+	Model         hfModel      `json:"model"`
+}
+
+type hfComponent struct {
+	Type          string         `json:"type"`
+	Normalizers   []*hfComponent `json:"normalizers"`
+	PreTokenizers []*hfComponent `json:"pretokenizers"`
+	Processors    []*hfComponent `json:"processors"`
+	// Prepend, Replace
+	Prepend string     `json:"prepend"`
+	Pattern *hfPattern `json:"pattern"`
+	Content string     `json:"content"`
+	// Split
+	Behavior string `json:"behavior"`
+	Invert   bool   `json:"invert"`
+	// ByteLevel, Metaspace
+	AddPrefixSpace *bool  `json:"add_prefix_space"`
+	UseRegex       *bool  `json:"use_regex"`
+	Replacement    string `json:"replacement"`
+	PrependScheme  string `json:"prepend_scheme"`
+	Split          *bool  `json:"split"`
+	// Digits
+	IndividualDigits bool `json:"individual_digits"`
+	// TemplateProcessing
+	Single        []hfTemplatePiece `json:"single"`
+	SpecialTokens map[string]struct {
+		IDs []int `json:"ids"`
+	} `json:"special_tokens"`
+}
+
+type hfPattern struct {
+	String *string `json:"String"`
+	Regex  *string `json:"Regex"`
+}
+
+type hfTemplatePiece struct {
+	SpecialToken *struct {
+		ID string `json:"id"`
+	} `json:"SpecialToken"`
+	Sequence *struct {
+		ID string `json:"id"`
+	} `json:"Sequence"`
+}
+
+type hfModel struct {
+	Type         string          `json:"type"`
+	Vocab        json.RawMessage `json:"vocab"`
+	Merges       json.RawMessage `json:"merges"`
+	UnkToken     *string         `json:"unk_token"`
+	UnkID        *int            `json:"unk_id"`
+	ByteFallback bool            `json:"byte_fallback"`
+	IgnoreMerges bool            `json:"ignore_merges"`
+}
+
+// hfTokenizerConfig is the part of tokenizer_config.json used to select the chat template.
+type hfTokenizerConfig struct {
+	ChatTemplate json.RawMessage `json:"chat_template"`
+}
+
+// NewHuggingFaceTokenizer creates a tokenizer from the tokenizer.json of a model. The optional
+// tokenizer_config.json selects the chat template, its chat_template is either the name of a
+// built-in template or a jinja template which is matched to a built-in one.
+func NewHuggingFaceTokenizer(tokenizerJSON, tokenizerConfigJSON []byte) (*HuggingFaceTokenizer, error) {
+	var config hfTokenizerJSON
+	if err := json.Unmarshal(tokenizerJSON, &config); err != nil {
+		return nil, fmt.Errorf("invalid tokenizer.json: %w", err)
+	}
+
+	t := &HuggingFaceTokenizer{}
+	for _, token := range config.AddedTokens {
+		if token.Content == "" {
+			continue
+		}
+		if t.addedTokens == nil {
+			t.addedTokens = newAddedTokenTrie()
+		}
+		t.addedTokens.add(token.Content, token.ID)
+	}
+
+	var err error
+	if t.normalizers, err = newNormalizers(config.Normalizer); err != nil {
+		return nil, err
+	}
+	if t.preTokenizers, err = newPreTokenizers(config.PreTokenizer); err != nil {
+		return nil, err
+	}
+	if t.postProcessor, err = newPostProcessor(config.PostProcessor); err != nil {
+		return nil, err
+	}
+
+	switch config.Model.Type {
+	case "BPE", "":
+		t.model, err = newBPEModel(config.Model)
+	case "Unigram":
+		t.model, err = newUnigramModel(config.Model)
+	default:
+		err = fmt.Errorf("unsupported tokenizer model %s", config.Model.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tokenizerConfigJSON) > 0 {
+		var tokenizerConfig hfTokenizerConfig
+		if err := json.Unmarshal(tokenizerConfigJSON, &tokenizerConfig); err != nil {
+			return nil, fmt.Errorf("invalid tokenizer_config.json: %w", err)
+		}
+		t.chatTemplate = detectChatTemplate(tokenizerConfig.ChatTemplate)
+	}
+	return t, nil
+}
+
+// TokenizeInputText encodes the text with special tokens and returns the token ids as bytes.
+func (t *HuggingFaceTokenizer) TokenizeInputText(text string) ([]byte, error) {
+	return TokenIDsToBytes(t.Encode(text, true)), nil
+}
+
+// TokenizeRequestMessage encodes the messages or prompt of a completion request, in JSON as
+// extracted by the gateway. Messages are rendered by the chat template of the model first.
+func (t *HuggingFaceTokenizer) TokenizeRequestMessage(message string) ([]byte, error) {
+	var prompt string
+	if err := json.Unmarshal([]byte(message), &prompt); err == nil {
+		return t.TokenizeInputText(prompt)
+	}
+
+	var messages []ChatMessage
+	if err := json.Unmarshal([]byte(message), &messages); err != nil {
+		// not a request message, e.g. a batch of prompts
+		return t.TokenizeInputText(message)
+	}
+	if t.chatTemplate.name == "" {
+		texts := make([]string, 0, len(messages))
+		for _, m := range messages {
+			texts = append(texts, m.text())
+		}
+		return t.TokenizeInputText(strings.Join(texts, "\n"))
+	}
+	rendered, err := applyChatTemplate(t.chatTemplate, messages)
+	if err != nil {
+		return nil, err
+	}
+	// the chat template renders the special tokens itself
+	return TokenIDsToBytes(t.Encode(rendered, false)), nil
+}
+
+// Encode returns the token ids of the text, addSpecialTokens applies the post processor, e.g. adding a bos token.
+func (t *HuggingFaceTokenizer) Encode(text string, addSpecialTokens bool) []int {
+	var ids []int
+	for _, segment := range t.splitAddedTokens(text) {
+		if segment.id >= 0 {
+			ids = append(ids, segment.id)
+			continue
+		}
+		normalized := segment.text
+		for _, n := range t.normalizers {
+			normalized = n(normalized)
+		}
+		words := []string{normalized}
+		for _, p := range t.preTokenizers {
+			words = p(words)
+		}
+		for _, word := range words {
+			if word != "" {
+				ids = append(ids, t.model.tokenize(word)...)
+			}
+		}
+	}
+
+	if addSpecialTokens && t.postProcessor != nil {
+		ids = t.postProcessor.process(ids)
+	}
+	return ids
+}
+
+type textSegment struct {
+	text string
+	id   int // id of the added token, -1 for text
+}
+
+// splitAddedTokens splits the text into added tokens, e.g. chat template special tokens, and text in between.
+func (t *HuggingFaceTokenizer) splitAddedTokens(text string) []textSegment {
+	if t.addedTokens == nil {
+		return []textSegment{{text: text, id: -1}}
+	}
+
+	var segments []textSegment
+	start := 0
+	for i := 0; i < len(text); {
+		id, length := t.addedTokens.longestMatch(text[i:])
+		if length == 0 {
+			i++
+			continue
+		}
+		if start < i {
+			segments = append(segments, textSegment{text: text[start:i], id: -1})
+		}
+		segments = append(segments, textSegment{id: id})
+		i += length
+		start = i
+	}
+	if start < len(text) {
+		segments = append(segments, textSegment{text: text[start:], id: -1})
+	}
+	return segments
+}
+
+func newNormalizers(c *hfComponent) ([]normalizer, error) {
+	if c == nil {
+		return nil, nil
+	}
+	switch c.Type {
+	case "Sequence":
+		var normalizers []normalizer
+		for _, child := range c.Normalizers {
+			n, err := newNormalizers(child)
+			if err != nil {
+				return nil, err
+			}
+			normalizers = append(normalizers, n...)
+		}
+		return normalizers, nil
+	case "NFC":
+		return []normalizer{norm.NFC.String}, nil
+	case "NFKC":
+		return []normalizer{norm.NFKC.String}, nil
+	case "NFD":
+		return []normalizer{norm.NFD.String}, nil
+	case "NFKD":
+		return []normalizer{norm.NFKD.String}, nil
+	case "Lowercase":
+		return []normalizer{strings.ToLower}, nil
+	case "Prepend":
+		prepend := c.Prepend
+		return []normalizer{func(s string) string {
+			if s == "" {
+				return s
+			}
+			return prepend + s
+		}}, nil
+	case "Replace":
+		re, err := compilePattern(c.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		content := c.Content
+		return []normalizer{func(s string) string {
+			replaced, err := re.Replace(s, content, -1, -1)
+			if err != nil {
+				return s
+			}
+			return replaced
+		}}, nil
+	}
+	return nil, fmt.Errorf("unsupported normalizer %s", c.Type)
+}
+
+const (
+	// gpt2Pattern is the default split pattern of the ByteLevel pre tokenizer
+	gpt2Pattern = `'s|'t|'re|'ve|'m|'ll|'d| ?\p{L}+| ?\p{N}+| ?[^\s\p{L}\p{N}]+|\s+(?!\S)|\s+`
+)
+
+func newPreTokenizers(c *hfComponent) ([]preTokenizer, error) {
+	if c == nil {
+		return nil, nil
+	}
+	switch c.Type {
+	case "Sequence":
+		var preTokenizers []preTokenizer
+		for _, child := range c.PreTokenizers {
+			p, err := newPreTokenizers(child)
+			if err != nil {
+				return nil, err
+			}
+			preTokenizers = append(preTokenizers, p...)
+		}
+		return preTokenizers, nil
+	case "ByteLevel":
+		var split preTokenizer
+		if c.UseRegex == nil || *c.UseRegex {
+			split = newSplitPreTokenizer(regexp2.MustCompile(gpt2Pattern, regexp2.None), "Isolated", false)
+		}
+		addPrefixSpace := c.AddPrefixSpace != nil && *c.AddPrefixSpace
+		return []preTokenizer{func(pieces []string) []string {
+			if addPrefixSpace && len(pieces) > 0 && !strings.HasPrefix(pieces[0], " ") {
+				pieces[0] = " " + pieces[0]
+			}
+			if split != nil {
+				pieces = split(pieces)
+			}
+			for i, piece := range pieces {
+				pieces[i] = byteLevelEncode(piece)
+			}
+			return pieces
+		}}, nil
+	case "Split":
+		re, err := compilePattern(c.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		switch c.Behavior {
+		case "Isolated", "Removed", "MergedWithPrevious", "MergedWithNext":
+		default:
+			return nil, fmt.Errorf("unsupported split behavior %s", c.Behavior)
+		}
+		return []preTokenizer{newSplitPreTokenizer(re, c.Behavior, c.Invert)}, nil
+	case "Digits":
+		pattern := `\p{N}+`
+		if c.IndividualDigits {
+			pattern = `\p{N}`
+		}
+		return []preTokenizer{newSplitPreTokenizer(regexp2.MustCompile(pattern, regexp2.None), "Isolated", false)}, nil
+	case "Whitespace":
+		return []preTokenizer{newSplitPreTokenizer(regexp2.MustCompile(`\w+|[^\w\s]+`, regexp2.None), "Removed", true)}, nil
+	case "Metaspace":
+		return []preTokenizer{newMetaspacePreTokenizer(c)}, nil
+	}
+	return nil, fmt.Errorf("unsupported pre tokenizer %s", c.Type)
+}
+
+func compilePattern(pattern *hfPattern) (*regexp2.Regexp, error) {
+	switch {
+	case pattern == nil:
+		return nil, fmt.Errorf("pattern is required")
+	case pattern.String != nil:
+		return regexp2.Compile(regexp2.Escape(*pattern.String), regexp2.None)
+	case pattern.Regex != nil:
+		return regexp2.Compile(*pattern.Regex, regexp2.None)
+	}
+	return nil, fmt.Errorf("pattern is required")
+}
+
+// newSplitPreTokenizer splits pieces by the matches of re, invert splits by the text between matches.
+func newSplitPreTokenizer(re *regexp2.Regexp, behavior string, invert bool) preTokenizer {
+	return func(pieces []string) []string {
+		var result []string
+		for _, piece := range pieces {
+			runes := []rune(piece)
+			type span struct {
+				start, end int
+				match      bool
+			}
+			var spans []span
+			last := 0
+			m, _ := re.FindRunesMatch(runes)
+			for m != nil {
+				if m.Length == 0 {
+					m, _ = re.FindNextMatch(m)
+					continue
+				}
+				if m.Index > last {
+					spans = append(spans, span{last, m.Index, invert})
+				}
+				spans = append(spans, span{m.Index, m.Index + m.Length, !invert})
+				last = m.Index + m.Length
+				m, _ = re.FindNextMatch(m)
+			}
+			if last < len(runes) {
+				spans = append(spans, span{last, len(runes), invert})
+			}
+
+			var words []string
+			for i := 0; i < len(spans); i++ {
+				s := spans[i]
+				text := string(runes[s.start:s.end])
+				switch {
+				case !s.match:
+					words = append(words, text)
+				case behavior == "Removed":
+				case behavior == "MergedWithPrevious" && len(words) > 0:
+					words[len(words)-1] += text
+				case behavior == "MergedWithNext" && i+1 < len(spans) && !spans[i+1].match:
+					words = append(words, text+string(runes[spans[i+1].start:spans[i+1].end]))
+					i++
+				default:
+					words = append(words, text)
+				}
+			}
+			result = append(result, words...)
+		}
+		return result
+	}
+}
+
+func newMetaspacePreTokenizer(c *hfComponent) preTokenizer {
+	replacement := c.Replacement
+	if replacement == "" {
+		replacement = "▁"
+	}
+	prependScheme := c.PrependScheme
+	if prependScheme == "" {
+		prependScheme = "always"
+		if c.AddPrefixSpace != nil && !*c.AddPrefixSpace {
+			prependScheme = "never"
+		}
+	}
+	split := c.Split == nil || *c.Split
+
+	return func(pieces []string) []string {
+		var result []string
+		for i, piece := range pieces {
+			piece = strings.ReplaceAll(piece, " ", replacement)
+			if (prependScheme == "always" || (prependScheme == "first" && i == 0)) && !strings.HasPrefix(piece, replacement) {
+				piece = replacement + piece
+			}
+			if !split {
+				result = append(result, piece)
+				continue
+			}
+			// split before each replacement, which starts a new word
+			start := 0
+			for j := len(replacement); j <= len(piece)-len(replacement); j++ {
+				if strings.HasPrefix(piece[j:], replacement) {
+					result = append(result, piece[start:j])
+					start = j
+					j += len(replacement) - 1
+				}
+			}
+			result = append(result, piece[start:])
+		}
+		return result
+	}
+}
+
+var byteLevelAlphabet = newByteLevelAlphabet()
+
+// newByteLevelAlphabet maps each byte to a printable rune like the GPT-2 byte level BPE.
+func newByteLevelAlphabet() [256]rune {
+	var alphabet [256]rune
+	n := 0
+	for b := 0; b < 256; b++ {
+		if (b >= '!' && b <= '~') || (b >= 0xA1 && b <= 0xAC) || (b >= 0xAE && b <= 0xFF) {
+			alphabet[b] = rune(b)
+		} else {
+			alphabet[b] = rune(256 + n)
+			n++
+		}
+	}
+	return alphabet
+}
+
+func byteLevelEncode(s string) string {
+	var builder strings.Builder
+	for i := 0; i < len(s); i++ {
+		builder.WriteRune(byteLevelAlphabet[s[i]])
+	}
+	return builder.String()
+}
+
+// templateProcessor adds the special tokens of the TemplateProcessing post processor to a single sequence.
+type templateProcessor struct {
+	prefix []int
+	suffix []int
+}
+
+func newPostProcessor(c *hfComponent) (*templateProcessor, error) {
+	if c == nil {
+		return nil, nil
+	}
+	switch c.Type {
+	case "ByteLevel":
+		return nil, nil
+	case "Sequence":
+		var processor *templateProcessor
+		for _, child := range c.Processors {
+			p, err := newPostProcessor(child)
+			if err != nil {
+				return nil, err
+			}
+			if p != nil {
+				processor = p
+			}
+		}
+		return processor, nil
+	case "TemplateProcessing":
+		processor := &templateProcessor{}
+		sequenceSeen := false
+		for _, piece := range c.Single {
+			switch {
+			case piece.Sequence != nil:
+				sequenceSeen = true
+			case piece.SpecialToken != nil:
+				special, ok := c.SpecialTokens[piece.SpecialToken.ID]
+				if !ok {
+					return nil, fmt.Errorf("unknown special token %s in post processor", piece.SpecialToken.ID)
+				}
+				if sequenceSeen {
+					processor.suffix = append(processor.suffix, special.IDs...)
+				} else {
+					processor.prefix = append(processor.prefix, special.IDs...)
+				}
+			}
+		}
+		return processor, nil
+	}
+	return nil, fmt.Errorf("unsupported post processor %s", c.Type)
+}
+
+func (p *templateProcessor) process(ids []int) []int {
+	result := make([]int, 0, len(p.prefix)+len(ids)+len(p.suffix))
+	result = append(result, p.prefix...)
+	result = append(result, ids...)
+	return append(result, p.suffix...)
+}
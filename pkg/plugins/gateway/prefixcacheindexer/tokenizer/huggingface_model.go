@@ -0,0 +1,296 @@
+/*
+Copyright 2024 The Aibrix Team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tokenizer
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+const maxWordCacheSize = 100000
+
+type bpePair struct {
+	left, right string
+}
+
+// bpeModel is a BPE model, with byte fallback for SentencePiece BPE models.
+type bpeModel struct {
+	vocab        map[string]int
+	ranks        map[bpePair]int
+	unkID        int // -1 if unknown characters are dropped
+	byteFallback bool
+	ignoreMerges bool
+
+	mu    sync.RWMutex
+	cache map[string][]int // word -> ids
+}
+
+func newBPEModel(m hfModel) (*bpeModel, error) {
+	model := &bpeModel{
+		ranks:        map[bpePair]int{},
+		unkID:        -1,
+		byteFallback: m.ByteFallback,
+		ignoreMerges: m.IgnoreMerges,
+		cache:        map[string][]int{},
+	}
+	if err := json.Unmarshal(m.Vocab, &model.vocab); err != nil {
+		return nil, fmt.Errorf("invalid bpe vocab: %w", err)
+	}
+
+	// merges are either "left right" strings or [left, right] pairs
+	var merges []json.RawMessage
+	if len(m.Merges) > 0 {
+		if err := json.Unmarshal(m.Merges, &merges); err != nil {
+			return nil, fmt.Errorf("invalid bpe merges: %w", err)
+		}
+	}
+	for rank, merge := range merges {
+		var pair bpePair
+		var s string
+		var parts []string
+		if err := json.Unmarshal(merge, &s); err == nil {
+			left, right, found := strings.Cut(s, " ")
+			if !found {
+				return nil, fmt.Errorf("invalid bpe merge %q", s)
+			}
+			pair = bpePair{left, right}
+		} else if err := json.Unmarshal(merge, &parts); err == nil && len(parts) == 2 {
+			pair = bpePair{parts[0], parts[1]}
+		} else {
+			return nil, fmt.Errorf("invalid bpe merge %s", string(merge))
+		}
+		if _, ok := model.ranks[pair]; !ok {
+			model.ranks[pair] = rank
+		}
+	}
+
+	if m.UnkToken != nil {
+		id, ok := model.vocab[*m.UnkToken]
+		if !ok {
+			return nil, fmt.Errorf("unk token %s is not in vocab", *m.UnkToken)
+		}
+		model.unkID = id
+	}
+	return model, nil
+}
+
+func (m *bpeModel) tokenize(word string) []int {
+	if m.ignoreMerges {
+		if id, ok := m.vocab[word]; ok {
+			return []int{id}
+		}
+	}
+	m.mu.RLock()
+	ids, ok := m.cache[word]
+	m.mu.RUnlock()
+	if ok {
+		return ids
+	}
+
+	ids = m.merge(word)
+	m.mu.Lock()
+	if len(m.cache) >= maxWordCacheSize {
+		m.cache = map[string][]int{}
+	}
+	m.cache[word] = ids
+	m.mu.Unlock()
+	return ids
+}
+
+// merge splits the word into characters and applies the merge with the lowest rank until none applies.
+func (m *bpeModel) merge(word string) []int {
+	type symbol struct {
+		text string
+		ids  []int // set for characters out of vocab, which are not merged
+	}
+	symbols := make([]symbol, 0, utf8.RuneCountInString(word))
+	for _, r := range word {
+		char := string(r)
+		if _, ok := m.vocab[char]; ok {
+			symbols = append(symbols, symbol{text: char})
+			continue
+		}
+		symbols = append(symbols, symbol{text: char, ids: m.unknown(char)})
+	}
+
+	for len(symbols) > 1 {
+		best, bestRank := -1, math.MaxInt
+		for i := 0; i < len(symbols)-1; i++ {
+			if symbols[i].ids != nil || symbols[i+1].ids != nil {
+				continue
+			}
+			if rank, ok := m.ranks[bpePair{symbols[i].text, symbols[i+1].text}]; ok && rank < bestRank {
+				best, bestRank = i, rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+		symbols[best].text += symbols[best+1].text
+		symbols = append(symbols[:best+1], symbols[best+2:]...)
+	}
+
+	ids := make([]int, 0, len(symbols))
+	for _, s := range symbols {
+		if s.ids != nil {
+			ids = append(ids, s.ids...)
+		} else if id, ok := m.vocab[s.text]; ok {
+			ids = append(ids, id)
+		} else {
+			ids = append(ids, m.unknown(s.text)...)
+		}
+	}
+	return ids
+}
+
+// unknown returns the byte tokens of text out of vocab with byte fallback, the unk token otherwise.
+func (m *bpeModel) unknown(text string) []int {
+	if m.byteFallback {
+		if ids, ok := byteFallbackIDs(m.vocab, text); ok {
+			return ids
+		}
+	}
+	if m.unkID >= 0 {
+		return []int{m.unkID}
+	}
+	return []int{}
+}
+
+func byteFallbackIDs(vocab map[string]int, text string) ([]int, bool) {
+	ids := make([]int, 0, len(text))
+	for i := 0; i < len(text); i++ {
+		id, ok := vocab[fmt.Sprintf("<0x%02X>", text[i])]
+		if !ok {
+			return nil, false
+		}
+		ids = append(ids, id)
+	}
+	return ids, true
+}
+
+// unigramModel is a SentencePiece Unigram model, words are segmented by the pieces with the highest total score.
+type unigramModel struct {
+	vocab        map[string]int
+	scores       []float64
+	maxPieceLen  int // in runes
+	unkID        int
+	unkScore     float64
+	byteFallback bool
+}
+
+// unigramUnkPenalty is the score penalty of an unknown character relative to the lowest piece score, as in SentencePiece.
+const unigramUnkPenalty = 10.0
+
+func newUnigramModel(m hfModel) (*unigramModel, error) {
+	var pieces [][2]interface{}
+	if err := json.Unmarshal(m.Vocab, &pieces); err != nil {
+		return nil, fmt.Errorf("invalid unigram vocab: %w", err)
+	}
+
+	model := &unigramModel{
+		vocab:        make(map[string]int, len(pieces)),
+		scores:       make([]float64, len(pieces)),
+		unkID:        -1,
+		byteFallback: m.ByteFallback,
+	}
+	minScore := math.MaxFloat64
+	for id, piece := range pieces {
+		text, ok1 := piece[0].(string)
+		score, ok2 := piece[1].(float64)
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("invalid unigram piece %v", piece)
+		}
+		if _, ok := model.vocab[text]; !ok {
+			model.vocab[text] = id
+		}
+		model.scores[id] = score
+		minScore = math.Min(minScore, score)
+		if n := utf8.RuneCountInString(text); n > model.maxPieceLen {
+			model.maxPieceLen = n
+		}
+	}
+	model.unkScore = minScore - unigramUnkPenalty
+	if m.UnkID != nil {
+		if *m.UnkID < 0 || *m.UnkID >= len(pieces) {
+			return nil, fmt.Errorf("unk id %d is out of vocab", *m.UnkID)
+		}
+		model.unkID = *m.UnkID
+	}
+	return model, nil
+}
+
+func (m *unigramModel) tokenize(word string) []int {
+	runes := []rune(word)
+	n := len(runes)
+	type node struct {
+		score float64
+		start int
+		id    int // -1 for an unknown character
+		set   bool
+	}
+	best := make([]node, n+1)
+	best[0].set = true
+	for start := 0; start < n; start++ {
+		if !best[start].set {
+			continue
+		}
+		matched := false
+		for end := start + 1; end <= n && end-start <= m.maxPieceLen; end++ {
+			id, ok := m.vocab[string(runes[start:end])]
+			if !ok {
+				continue
+			}
+			if end == start+1 {
+				matched = true
+			}
+			score := best[start].score + m.scores[id]
+			if !best[end].set || score > best[end].score {
+				best[end] = node{score: score, start: start, id: id, set: true}
+			}
+		}
+		if !matched {
+			score := best[start].score + m.unkScore
+			if !best[start+1].set || score > best[start+1].score {
+				best[start+1] = node{score: score, start: start, id: -1, set: true}
+			}
+		}
+	}
+
+	var reversed [][]int
+	for end := n; end > 0; end = best[end].start {
+		if best[end].id >= 0 {
+			reversed = append(reversed, []int{best[end].id})
+			continue
+		}
+		char := string(runes[best[end].start:end])
+		if ids, ok := byteFallbackIDs(m.vocab, char); m.byteFallback && ok {
+			reversed = append(reversed, ids)
+		} else if m.unkID >= 0 {
+			reversed = append(reversed, []int{m.unkID})
+		}
+	}
+
+	ids := make([]int, 0, len(reversed))
+	for i := len(reversed) - 1; i >= 0; i-- {
+		ids = append(ids, reversed[i]...)
+	}
+	return ids
+}
@@ -0,0 +1,264 @@
+/*
+Copyright 2024 The Aibrix Team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tokenizer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// byteLevelBPE is a byte level BPE tokenizer like Llama 3 and Qwen, "Ġ" is the byte level space.
+const byteLevelBPE = `{
+  "added_tokens": [
+    {"id": 100, "content": "<|im_start|>", "special": true},
+    {"id": 101, "content": "<|im_end|>", "special": true}
+  ],
+  "normalizer": null,
+  "pre_tokenizer": {
+    "type": "Sequence",
+    "pretokenizers": [
+      {"type": "Split", "pattern": {"Regex": "(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\\r\\n\\p{L}\\p{N}]?\\p{L}+|\\p{N}{1,3}| ?[^\\s\\p{L}\\p{N}]+[\\r\\n]*|\\s*[\\r\\n]+|\\s+(?!\\S)|\\s+"}, "behavior": "Isolated", "invert": false},
+      {"type": "ByteLevel", "add_prefix_space": false, "trim_offsets": false, "use_regex": false}
+    ]
+  },
+  "post_processor": {"type": "ByteLevel"},
+  "model": {
+    "type": "BPE",
+    "vocab": {"h": 0, "e": 1, "l": 2, "o": 3, "Ġ": 4, "w": 5, "r": 6, "d": 7, "Ċ": 8, "u": 9, "s": 10, "a": 11, "t": 12, "n": 13, "i": 14,
+      "he": 20, "ll": 21, "hell": 22, "hello": 23, "Ġw": 24, "or": 25, "Ġwor": 26, "Ġworld": 27, "as": 28, "ss": 29, "ld": 30},
+    "merges": [["h", "e"], ["l", "l"], ["he", "ll"], ["hell", "o"], ["Ġ", "w"], ["o", "r"], ["Ġw", "or"], ["l", "d"], ["Ġwor", "ld"], ["a", "s"]]
+  }
+}`
+
+// sentencePieceBPE is a SentencePiece BPE tokenizer with byte fallback like Llama 2 and Mistral.
+const sentencePieceBPE = `{
+  "added_tokens": [
+    {"id": 1, "content": "<s>", "special": true},
+    {"id": 2, "content": "</s>", "special": true}
+  ],
+  "normalizer": {
+    "type": "Sequence",
+    "normalizers": [
+      {"type": "Prepend", "prepend": "▁"},
+      {"type": "Replace", "pattern": {"String": " "}, "content": "▁"}
+    ]
+  },
+  "pre_tokenizer": null,
+  "post_processor": {
+    "type": "TemplateProcessing",
+    "single": [{"SpecialToken": {"id": "<s>", "type_id": 0}}, {"Sequence": {"id": "A", "type_id": 0}}],
+    "special_tokens": {"<s>": {"id": "<s>", "ids": [1], "tokens": ["<s>"]}}
+  },
+  "model": {
+    "type": "BPE",
+    "unk_token": "<unk>",
+    "byte_fallback": true,
+    "vocab": {"<unk>": 0, "<s>": 1, "</s>": 2, "<0xE2>": 3, "<0x9C>": 4, "<0x93>": 5,
+      "▁": 10, "h": 11, "i": 12, "▁h": 13, "▁hi": 14, "[": 15, "I": 16, "N": 17, "S": 18, "T": 19, "]": 20, "/": 21,
+      "IN": 22, "INS": 23, "INST": 24, "[INST": 25, "[INST]": 26, "▁[": 27, "▁[/": 28, "▁[/INST": 29, "▁[/INST]": 30},
+    "merges": ["▁ h", "▁h i", "I N", "IN S", "INS T", "[ INST", "[INST ]", "▁ [", "▁[ /", "▁[/ INST", "▁[/INST ]"]
+  }
+}`
+
+// unigram is a SentencePiece Unigram tokenizer like T5.
+const unigram = `{
+  "added_tokens": [{"id": 1, "content": "</s>", "special": true}],
+  "normalizer": null,
+  "pre_tokenizer": {"type": "Metaspace", "replacement": "▁", "prepend_scheme": "always", "split": true},
+  "post_processor": {
+    "type": "TemplateProcessing",
+    "single": [{"Sequence": {"id": "A", "type_id": 0}}, {"SpecialToken": {"id": "</s>", "type_id": 0}}],
+    "special_tokens": {"</s>": {"id": "</s>", "ids": [1], "tokens": ["</s>"]}}
+  },
+  "model": {
+    "type": "Unigram",
+    "unk_id": 2,
+    "vocab": [["<pad>", 0.0], ["</s>", 0.0], ["<unk>", 0.0],
+      ["▁", -2.0], ["▁the", -3.0], ["▁th", -4.0], ["e", -4.0], ["▁cat", -5.0], ["▁c", -6.0], ["at", -6.0], ["s", -3.0]]
+  }
+}`
+
+func TestHuggingFaceTokenizerByteLevelBPE(t *testing.T) {
+	tokenizer, err := NewHuggingFaceTokenizer([]byte(byteLevelBPE), nil)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []int{23, 27}, tokenizer.Encode("hello world", true))
+	// newline is the byte level "Ċ", merges with the lowest rank apply first
+	assert.Equal(t, []int{23, 8, 28, 10}, tokenizer.Encode("hello\nass", true))
+	// added tokens are split before the pre tokenizer
+	assert.Equal(t, []int{100, 23, 101}, tokenizer.Encode("<|im_start|>hello<|im_end|>", true))
+}
+
+func TestHuggingFaceTokenizerSentencePieceBPE(t *testing.T) {
+	tokenizer, err := NewHuggingFaceTokenizer([]byte(sentencePieceBPE), nil)
+	assert.NoError(t, err)
+
+	// the bos token is added by the post processor only with special tokens
+	assert.Equal(t, []int{1, 14}, tokenizer.Encode("hi", true))
+	assert.Equal(t, []int{14, 14}, tokenizer.Encode("hi hi", false))
+	// characters out of vocab fall back to bytes
+	assert.Equal(t, []int{1, 14, 10, 3, 4, 5}, tokenizer.Encode("hi ✓", true))
+}
+
+func TestHuggingFaceTokenizerUnigram(t *testing.T) {
+	tokenizer, err := NewHuggingFaceTokenizer([]byte(unigram), nil)
+	assert.NoError(t, err)
+
+	// "▁the" scores higher than "▁th" + "e" and "▁cat" higher than "▁c" + "at"
+	assert.Equal(t, []int{4, 7, 10, 1}, tokenizer.Encode("the cats", true))
+	// unknown characters are unk
+	assert.Equal(t, []int{7, 3, 2}, tokenizer.Encode("cat x", false))
+}
+
+func TestHuggingFaceTokenizerUnsupported(t *testing.T) {
+	_, err := NewHuggingFaceTokenizer([]byte(`{"model": {"type": "WordPiece", "vocab": {}}}`), nil)
+	assert.Error(t, err)
+	_, err = NewHuggingFaceTokenizer([]byte(`{"normalizer": {"type": "BertNormalizer"}, "model": {"type": "BPE", "vocab": {}, "merges": []}}`), nil)
+	assert.Error(t, err)
+}
+
+func TestHuggingFaceTokenizerChatTemplate(t *testing.T) {
+	config := `{"chat_template": "{% for message in messages %}{{'<|im_start|>' + message['role'] + '\n' + message['content'] + '<|im_end|>' + '\n'}}{% endfor %}"}`
+	tokenizer, err := NewHuggingFaceTokenizer([]byte(byteLevelBPE), []byte(config))
+	assert.NoError(t, err)
+	assert.Equal(t, chatTemplate{name: ChatTemplateChatML}, tokenizer.chatTemplate)
+
+	messages := `[{"role": "user", "content": "hello"}, {"role": "user", "content": [{"type": "text", "text": "world"}]}]`
+	rendered, err := applyChatTemplate(chatTemplate{name: ChatTemplateChatML}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "<|im_start|>assistant\n", rendered)
+
+	tokens, err := tokenizer.TokenizeRequestMessage(messages)
+	assert.NoError(t, err)
+	expected := tokenizer.Encode("<|im_start|>user\nhello<|im_end|>\n<|im_start|>user\nworld<|im_end|>\n<|im_start|>assistant\n", false)
+	assert.Equal(t, TokenIDsToBytes(expected), tokens)
+
+	// a prompt is tokenized without the chat template
+	tokens, err = tokenizer.TokenizeRequestMessage(`"hello world"`)
+	assert.NoError(t, err)
+	assert.Equal(t, TokenIDsToBytes([]int{23, 27}), tokens)
+}
+
+func TestApplyChatTemplate(t *testing.T) {
+	messages := []ChatMessage{
+		{Role: "system", Content: []byte(`"be brief"`)},
+		{Role: "user", Content: []byte(`"hi"`)},
+		{Role: "assistant", Content: []byte(`"hello"`)},
+		{Role: "user", Content: []byte(`"bye"`)},
+	}
+	testCases := []struct {
+		template string
+		expected string
+	}{
+		{ChatTemplateLlama3, "<|begin_of_text|><|start_header_id|>system<|end_header_id|>\n\nbe brief<|eot_id|>" +
+			"<|start_header_id|>user<|end_header_id|>\n\nhi<|eot_id|><|start_header_id|>assistant<|end_header_id|>\n\nhello<|eot_id|>" +
+			"<|start_header_id|>user<|end_header_id|>\n\nbye<|eot_id|><|start_header_id|>assistant<|end_header_id|>\n\n"},
+		{ChatTemplateLlama2, "<s>[INST] <<SYS>>\nbe brief\n<</SYS>>\n\nhi [/INST] hello </s><s>[INST] bye [/INST]"},
+		{ChatTemplateMistral, "<s>[INST] be brief\n\nhi [/INST]hello</s>[INST] bye [/INST]"},
+	}
+	for _, tc := range testCases {
+		rendered, err := applyChatTemplate(chatTemplate{name: tc.template}, messages)
+		assert.NoError(t, err, tc.template)
+		assert.Equal(t, tc.expected, rendered, tc.template)
+	}
+}
+
+// TestChatTemplateGolden renders the chat templates of the tokenizer_config.json of models as the engine does
+// with add_generation_prompt, including the system messages which the templates render by default.
+func TestChatTemplateGolden(t *testing.T) {
+	system := ChatMessage{Role: "system", Content: []byte(`"be brief "`)}
+	user := ChatMessage{Role: "user", Content: []byte(`" hi"`)}
+	assistant := ChatMessage{Role: "assistant", Content: []byte(`"hello"`)}
+	today := time.Now().Format(strftimeNowLayout)
+	testCases := []struct {
+		model    string
+		messages []ChatMessage
+		expected string
+	}{
+		{"Llama-3.1-8B-Instruct", []ChatMessage{user},
+			"<|begin_of_text|><|start_header_id|>system<|end_header_id|>\n\nCutting Knowledge Date: December 2023\nToday Date: 26 Jul 2024\n\n<|eot_id|>" +
+				"<|start_header_id|>user<|end_header_id|>\n\nhi<|eot_id|><|start_header_id|>assistant<|end_header_id|>\n\n"},
+		{"Llama-3.1-8B-Instruct", []ChatMessage{system, user, assistant, user},
+			"<|begin_of_text|><|start_header_id|>system<|end_header_id|>\n\nCutting Knowledge Date: December 2023\nToday Date: 26 Jul 2024\n\nbe brief<|eot_id|>" +
+				"<|start_header_id|>user<|end_header_id|>\n\nhi<|eot_id|><|start_header_id|>assistant<|end_header_id|>\n\nhello<|eot_id|>" +
+				"<|start_header_id|>user<|end_header_id|>\n\nhi<|eot_id|><|start_header_id|>assistant<|end_header_id|>\n\n"},
+		{"Llama-3.2-1B-Instruct", []ChatMessage{user},
+			"<|begin_of_text|><|start_header_id|>system<|end_header_id|>\n\nCutting Knowledge Date: December 2023\nToday Date: " + today + "\n\n<|eot_id|>" +
+				"<|start_header_id|>user<|end_header_id|>\n\nhi<|eot_id|><|start_header_id|>assistant<|end_header_id|>\n\n"},
+		{"Qwen2.5-7B-Instruct", []ChatMessage{user},
+			"<|im_start|>system\nYou are Qwen, created by Alibaba Cloud. You are a helpful assistant.<|im_end|>\n" +
+				"<|im_start|>user\n hi<|im_end|>\n<|im_start|>assistant\n"},
+		{"Qwen2.5-7B-Instruct", []ChatMessage{system, user, assistant, user},
+			"<|im_start|>system\nbe brief <|im_end|>\n<|im_start|>user\n hi<|im_end|>\n<|im_start|>assistant\nhello<|im_end|>\n" +
+				"<|im_start|>user\n hi<|im_end|>\n<|im_start|>assistant\n"},
+	}
+	for _, tc := range testCases {
+		data, err := os.ReadFile(filepath.Join("testdata", tc.model, tokenizerConfigFile))
+		assert.NoError(t, err)
+		var config hfTokenizerConfig
+		assert.NoError(t, json.Unmarshal(data, &config))
+		rendered, err := applyChatTemplate(detectChatTemplate(config.ChatTemplate), tc.messages)
+		assert.NoError(t, err, tc.model)
+		assert.Equal(t, tc.expected, rendered, tc.model)
+	}
+}
+
+func TestSplitAddedTokens(t *testing.T) {
+	// Llama 3 has 256 added tokens, most of them reserved special tokens
+	addedTokens := []string{`{"id": 128000, "content": "<|begin_of_text|>"}`, `{"id": 128006, "content": "<|start_header_id|>"}`}
+	for i := 0; i < 250; i++ {
+		addedTokens = append(addedTokens, fmt.Sprintf(`{"id": %d, "content": "<|reserved_special_token_%d|>"}`, 128010+i, i))
+	}
+	// the longest added token matches
+	addedTokens = append(addedTokens, `{"id": 5, "content": "<|"}`)
+	tokenizer, err := NewHuggingFaceTokenizer([]byte(`{"added_tokens": [`+strings.Join(addedTokens, ",")+`], "model": {"type": "BPE", "vocab": {}, "merges": []}}`), nil)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []textSegment{
+		{id: 128000}, {id: 128006}, {text: "system", id: -1}, {id: 128011}, {id: 5}, {text: "reserved", id: -1},
+	}, tokenizer.splitAddedTokens("<|begin_of_text|><|start_header_id|>system<|reserved_special_token_1|><|reserved"))
+	assert.Equal(t, []textSegment{{text: "no added tokens", id: -1}}, tokenizer.splitAddedTokens("no added tokens"))
+}
+
+func TestStoreLoadFromPath(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "llama-2-7b"), 0o755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "llama-2-7b", tokenizerFile), []byte(sentencePieceBPE), 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "llama-2-7b", tokenizerConfigFile), []byte(`{"chat_template": "llama2"}`), 0o644))
+	// directories without tokenizer.json are skipped
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "other"), 0o755))
+
+	store := NewStore()
+	assert.NoError(t, store.LoadFromPath(dir))
+	tokenizer, ok := store.Get("llama-2-7b")
+	assert.True(t, ok)
+	assert.Equal(t, ChatTemplateLlama2, tokenizer.chatTemplate.name)
+	_, ok = store.Get("other")
+	assert.False(t, ok)
+
+	// "▁" is prepended to each text segment between special tokens, as by the legacy Llama 2 tokenizer
+	tokens, err := tokenizer.TokenizeRequestMessage(`[{"role": "user", "content": "hi"}]`)
+	assert.NoError(t, err)
+	assert.Equal(t, TokenIDsToBytes([]int{1, 10, 26, 14, 30}), tokens)
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2024 The Aibrix Team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tokenizer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// multimodalPlaceholderNames are the placeholder names of the non-text content parts of the OpenAI API,
+// other part types use the type as the name.
+var multimodalPlaceholderNames = map[string]string{
+	"image_url":   "image",
+	"input_image": "image",
+	"input_audio": "audio",
+	"audio_url":   "audio",
+	"video_url":   "video",
+}
+
+// CanonicalizeMessage re-encodes chat messages in a canonical JSON form, with sorted keys and without HTML
+// escaping, and replaces their non-text content parts, e.g. image urls or base64 audio, by a text part with a
+// placeholder of the hash of the part payload. Every message goes through the same encoding, so requests sharing
+// text and media up to some point share the tokens up to the same point, whether or not later messages have
+// non-text parts. Messages which are not a JSON array are returned unchanged.
+func CanonicalizeMessage(message string) string {
+	decoder := json.NewDecoder(strings.NewReader(message))
+	decoder.UseNumber()
+	var messages []interface{}
+	if err := decoder.Decode(&messages); err != nil {
+		return message
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return message
+	}
+
+	for _, m := range messages {
+		fields, ok := m.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		parts, ok := fields["content"].([]interface{})
+		if !ok {
+			continue
+		}
+		for i, part := range parts {
+			partFields, ok := part.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if partType, _ := partFields["type"].(string); partType != "" && partType != "text" {
+				parts[i] = placeholderPart(partType, partFields)
+			}
+		}
+	}
+
+	canonical, err := marshalJSON(messages)
+	if err != nil {
+		return message
+	}
+	return string(canonical)
+}
+
+// marshalJSON marshals without escaping HTML characters, which are in the placeholders and chat messages.
+func marshalJSON(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// placeholderPart returns a text part of the placeholder of a non-text part. The payload is the field named
+// by the part type, or the whole part if there is no such field, and is hashed in its canonical JSON, so that
+// whitespace and key order do not change the placeholder.
+func placeholderPart(partType string, part map[string]interface{}) map[string]interface{} {
+	var payload interface{} = part
+	if v, ok := part[partType]; ok {
+		payload = v
+	}
+	data, _ := json.Marshal(payload)
+	name, ok := multimodalPlaceholderNames[partType]
+	if !ok {
+		name = partType
+	}
+	return map[string]interface{}{
+		"type": "text",
+		"text": fmt.Sprintf("<|%s:%016x|>", name, xxhash.Sum64(data)),
+	}
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2024 The Aibrix Team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tokenizer
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func multimodalMessage(image, question string) string {
+	return `[{"role": "system", "content": "You are a helpful assistant."},
+		{"role": "user", "content": [
+			{"type": "text", "text": "Describe the image."},
+			{"type": "image_url", "image_url": {"url": "` + image + `"}},
+			{"type": "text", "text": "` + question + `"}]}]`
+}
+
+func TestCanonicalizeMessage(t *testing.T) {
+	// prompts which are not chat messages are unchanged
+	for _, message := range []string{`"a prompt"`, `a prompt`, `[{"role": "user"}] trailing`} {
+		assert.Equal(t, message, CanonicalizeMessage(message))
+	}
+	// chat messages are re-encoded with sorted keys and without HTML escaping
+	assert.Equal(t, `[{"content":"<b> & c","role":"user"}]`, CanonicalizeMessage(`[{"role": "user", "content": "<b> & c"}]`))
+	assert.Equal(t, `[{"content":"<b> & c","role":"user"}]`,
+		CanonicalizeMessage(`[{"role":"user","content":"\u003cb\u003e \u0026 c"}]`))
+
+	canonical := CanonicalizeMessage(multimodalMessage("data:image/png;base64,iVBORw0KGgo", "What is it?"))
+	assert.NotContains(t, canonical, "iVBORw0KGgo")
+	var messages []ChatMessage
+	assert.NoError(t, json.Unmarshal([]byte(canonical), &messages))
+	text := messages[1].text()
+	assert.True(t, strings.HasPrefix(text, "Describe the image.\n<|image:"), text)
+	assert.True(t, strings.HasSuffix(text, "|>\nWhat is it?"), text)
+
+	// the placeholder depends on the payload only, not on its formatting
+	assert.Equal(t, canonical, CanonicalizeMessage(strings.ReplaceAll(
+		multimodalMessage("data:image/png;base64,iVBORw0KGgo", "What is it?"), `{"url": `, `{ "url":`)))
+	assert.NotEqual(t, canonical, CanonicalizeMessage(multimodalMessage("https://example.com/cat.png", "What is it?")))
+
+	audio := CanonicalizeMessage(`[{"role": "user", "content": [{"type": "input_audio", "input_audio": {"data": "UklGRg", "format": "wav"}}]}]`)
+	assert.Contains(t, audio, "<|audio:")
+	assert.NotContains(t, audio, "UklGRg")
+}
+
+func TestCanonicalizeMessagePrefix(t *testing.T) {
+	tokenizer := NewStringTokenizer()
+	tokenize := func(message string) []byte {
+		tokens, err := tokenizer.TokenizeInputText(CanonicalizeMessage(message))
+		assert.NoError(t, err)
+		return tokens
+	}
+
+	// requests with the same image share the prefix up to the diverging question
+	image := "data:image/png;base64," + strings.Repeat("A", 4096)
+	first := tokenize(multimodalMessage(image, "What is it?"))
+	second := tokenize(multimodalMessage(image, "Which color is it?"))
+	placeholderEnd := bytes.Index(first, []byte("|>"))
+	assert.Greater(t, placeholderEnd, 0)
+	assert.Less(t, len(first), 512)
+	assert.Greater(t, commonPrefixLength(first, second), placeholderEnd)
+
+	// a different image diverges at the placeholder
+	third := tokenize(multimodalMessage("data:image/png;base64,"+strings.Repeat("B", 4096), "What is it?"))
+	assert.Less(t, commonPrefixLength(first, third), placeholderEnd)
+}
+
+func TestCanonicalizeMessageLaterMedia(t *testing.T) {
+	// text only messages are encoded the same whether or not a later message has non-text parts
+	history := `[{"role": "system", "content": "Answer in <html> & markdown."}, {"role": "user", "content": [{"type": "text", "text": "hi"}]}`
+	textOnly := CanonicalizeMessage(history + `]`)
+	withImage := CanonicalizeMessage(history + `, {"role": "user", "content": [{"type": "image_url", "image_url": {"url": "https://example.com/cat.png"}}]}]`)
+	assert.True(t, strings.HasPrefix(withImage, strings.TrimSuffix(textOnly, "]")), withImage)
+}
+
+func commonPrefixLength(a, b []byte) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return n
+}
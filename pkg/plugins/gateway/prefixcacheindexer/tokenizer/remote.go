@@ -0,0 +1,294 @@
+/*
+Copyright 2024 The Aibrix Team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tokenizer
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/singleflight"
+	"k8s.io/klog/v2"
+)
+
+// RemoteTokenizer tokenizes with the vLLM compatible /tokenize endpoint of the serving pods, so that no
+// tokenizer files are needed by the gateway. Results are cached by model and message, concurrent requests
+// of the same message are coalesced, and failures fall back to the string tokenizer. Chat messages extending
+// a cached conversation, e.g. the next turn of a chat, only send the messages after the cached ones.
+type RemoteTokenizer struct {
+	client   *http.Client
+	port     string
+	fallback Tokenizer
+	cache    *lruCache
+	group    singleflight.Group
+}
+
+func NewRemoteTokenizer(port string, timeout time.Duration, cacheSize int) *RemoteTokenizer {
+	return &RemoteTokenizer{
+		client:   &http.Client{Timeout: timeout},
+		port:     port,
+		fallback: NewStringTokenizer(),
+		cache:    newLRUCache(cacheSize),
+	}
+}
+
+// Endpoint returns a Tokenizer of the model served by the pod.
+func (t *RemoteTokenizer) Endpoint(podIP, model string) Tokenizer {
+	return &remoteEndpointTokenizer{tokenizer: t, podIP: podIP, model: model}
+}
+
+type remoteEndpointTokenizer struct {
+	tokenizer *RemoteTokenizer
+	podIP     string
+	model     string
+}
+
+// TokenizeInputText tokenizes the messages or prompt of a request, in JSON as extracted by the gateway.
+func (e *remoteEndpointTokenizer) TokenizeInputText(message string) ([]byte, error) {
+	return e.tokenizer.tokenize(e.podIP, e.model, message)
+}
+
+type tokenizeRequest struct {
+	Model               string          `json:"model"`
+	Prompt              string          `json:"prompt,omitempty"`
+	Messages            json.RawMessage `json:"messages,omitempty"`
+	AddGenerationPrompt bool            `json:"add_generation_prompt,omitempty"`
+}
+
+type tokenizeResponse struct {
+	Tokens []int `json:"tokens"`
+}
+
+func (t *RemoteTokenizer) tokenize(podIP, model, message string) ([]byte, error) {
+	key := xxhash.Sum64String(model + "\x00" + message)
+	if tokens, ok := t.cache.get(key); ok {
+		return tokens, nil
+	}
+
+	v, err, _ := t.group.Do(strconv.FormatUint(key, 10), func() (interface{}, error) {
+		tokens, ok := t.tokenizeAfterCachedPrefix(podIP, model, message)
+		if !ok {
+			var err error
+			if tokens, err = t.request(podIP, model, message); err != nil {
+				return nil, err
+			}
+		}
+		t.cache.add(key, tokens)
+		return tokens, nil
+	})
+	if err != nil {
+		klog.ErrorS(err, "remote tokenization failed, falling back to string tokenizer", "pod", podIP, "model", model)
+		return t.fallback.TokenizeInputText(message)
+	}
+	return v.([]byte), nil
+}
+
+// tokenizeAfterCachedPrefix tokenizes chat messages of which the first messages are cached, sending the last
+// cached message and the messages after it. It returns false if no prefix of the messages is cached, or the
+// tokens cannot be joined.
+func (t *RemoteTokenizer) tokenizeAfterCachedPrefix(podIP, model, message string) ([]byte, bool) {
+	var messages []json.RawMessage
+	if err := json.Unmarshal([]byte(message), &messages); err != nil || len(messages) < 2 {
+		return nil, false
+	}
+
+	keys := conversationKeys(model, messages)
+	for k := len(messages) - 1; k > 0; k-- {
+		prefix, ok := t.cache.get(keys[k-1])
+		if !ok {
+			continue
+		}
+
+		// the last cached message anchors the tokens of the next messages to the cached tokens
+		anchor := messages[k-1 : k]
+		var anchorTokens, suffixTokens []byte
+		var g errgroup.Group
+		g.Go(func() error {
+			anchorKey := conversationKeys(model, anchor)[0]
+			if tokens, ok := t.cache.get(anchorKey); ok {
+				anchorTokens = tokens
+				return nil
+			}
+			tokens, err := t.request(podIP, model, joinMessages(anchor))
+			if err != nil {
+				return err
+			}
+			t.cache.add(anchorKey, tokens)
+			anchorTokens = tokens
+			return nil
+		})
+		g.Go(func() error {
+			var err error
+			suffixTokens, err = t.request(podIP, model, joinMessages(messages[k-1:]))
+			return err
+		})
+		if err := g.Wait(); err != nil {
+			klog.V(4).InfoS("unable to tokenize the messages after the cached messages", "pod", podIP, "model", model, "err", err)
+			return nil, false
+		}
+		return spliceTokens(prefix, anchorTokens, suffixTokens)
+	}
+	return nil, false
+}
+
+// spliceTokens joins the tokens of a cached conversation with the tokens of the conversation of its last
+// message and the next messages. The last message tokenized alone, the anchor, ends like the cached conversation
+// after the tokens the chat template adds at the start of a conversation, e.g. bos or a default system prompt,
+// which are skipped in the next messages. It returns false if the anchor does not match the cached conversation.
+func spliceTokens(prefix, anchor, suffix []byte) ([]byte, bool) {
+	for start := 0; start < len(anchor); start += tokenBytes {
+		if !bytes.HasSuffix(prefix, anchor[start:]) || !bytes.HasPrefix(suffix, anchor[:start]) {
+			continue
+		}
+		end := len(prefix) - (len(anchor) - start)
+		tokens := make([]byte, 0, end+len(suffix)-start)
+		tokens = append(tokens, prefix[:end]...)
+		return append(tokens, suffix[start:]...), true
+	}
+	return nil, false
+}
+
+// conversationKeys returns the cache keys of the conversations of the first messages, the key of the first
+// k messages at k-1. A key is the key of the messages as a JSON array without spaces.
+func conversationKeys(model string, messages []json.RawMessage) []uint64 {
+	keys := make([]uint64, len(messages))
+	digest := xxhash.New()
+	_, _ = digest.WriteString(model + "\x00[")
+	for i, message := range messages {
+		if i > 0 {
+			_, _ = digest.WriteString(",")
+		}
+		_, _ = digest.Write(message)
+		conversation := *digest
+		_, _ = conversation.WriteString("]")
+		keys[i] = conversation.Sum64()
+	}
+	return keys
+}
+
+// joinMessages returns the messages as a JSON array without spaces.
+func joinMessages(messages []json.RawMessage) string {
+	var b strings.Builder
+	b.WriteByte('[')
+	for i, message := range messages {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.Write(message)
+	}
+	b.WriteByte(']')
+	return b.String()
+}
+
+func (t *RemoteTokenizer) request(podIP, model, message string) ([]byte, error) {
+	tokenizeReq := tokenizeRequest{Model: model}
+	var prompt string
+	var messages []ChatMessage
+	if err := json.Unmarshal([]byte(message), &prompt); err == nil {
+		tokenizeReq.Prompt = prompt
+	} else if err := json.Unmarshal([]byte(message), &messages); err == nil {
+		// the engine applies the chat template of the model
+		tokenizeReq.Messages = json.RawMessage(message)
+		tokenizeReq.AddGenerationPrompt = true
+	} else {
+		tokenizeReq.Prompt = message
+	}
+	body, err := json.Marshal(tokenizeReq)
+	if err != nil {
+		return nil, err
+	}
+
+	url := fmt.Sprintf("http://%s/tokenize", net.JoinHostPort(podIP, t.port))
+	resp, err := t.client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			klog.ErrorS(err, "error closing tokenize response", "url", url)
+		}
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d from %s", resp.StatusCode, url)
+	}
+
+	var tokenizeResp tokenizeResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tokenizeResp); err != nil {
+		return nil, fmt.Errorf("invalid tokenize response from %s: %w", url, err)
+	}
+	return TokenIDsToBytes(tokenizeResp.Tokens), nil
+}
+
+// lruCache is a fixed size cache of tokens, the least recently used entry is evicted first.
+type lruCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[uint64]*list.Element
+	order   *list.List // front is the most recently used
+}
+
+type lruEntry struct {
+	key    uint64
+	tokens []byte
+}
+
+func newLRUCache(size int) *lruCache {
+	return &lruCache{
+		size:    size,
+		entries: map[uint64]*list.Element{},
+		order:   list.New(),
+	}
+}
+
+func (c *lruCache) get(key uint64) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*lruEntry).tokens, true
+}
+
+func (c *lruCache) add(key uint64, tokens []byte) {
+	if c.size <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*lruEntry).tokens = tokens
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, tokens: tokens})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).key)
+	}
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2024 The Aibrix Team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tokenizer
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeChatTemplate renders chat messages as bos, the bytes of the content and an end token per message, and the
+// generation prompt.
+func fakeChatTemplate(contents ...string) []int {
+	tokens := []int{1}
+	for _, content := range contents {
+		for _, b := range []byte(content) {
+			tokens = append(tokens, int(b))
+		}
+		tokens = append(tokens, 2)
+	}
+	return append(tokens, 3)
+}
+
+// newFakeEngine serves /tokenize with one token per prompt byte, or the fake chat template for chat requests.
+func newFakeEngine(t *testing.T, delay time.Duration, requests *int32) (string, string) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		var req tokenizeRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		time.Sleep(delay)
+
+		var tokens []int
+		if req.Messages != nil {
+			assert.True(t, req.AddGenerationPrompt)
+			var messages []ChatMessage
+			assert.NoError(t, json.Unmarshal(req.Messages, &messages))
+			contents := make([]string, 0, len(messages))
+			for _, message := range messages {
+				contents = append(contents, message.text())
+			}
+			tokens = fakeChatTemplate(contents...)
+		} else {
+			for _, b := range []byte(req.Prompt) {
+				tokens = append(tokens, int(b))
+			}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"tokens": tokens, "count": len(tokens)})
+	}))
+	t.Cleanup(server.Close)
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	assert.NoError(t, err)
+	return host, port
+}
+
+func TestRemoteTokenizer(t *testing.T) {
+	var requests int32
+	host, port := newFakeEngine(t, 0, &requests)
+	tokenizer := NewRemoteTokenizer(port, time.Second, 2).Endpoint(host, "m1")
+
+	tokens, err := tokenizer.TokenizeInputText(`"ab"`)
+	assert.NoError(t, err)
+	assert.Equal(t, TokenIDsToBytes([]int{'a', 'b'}), tokens)
+
+	tokens, err = tokenizer.TokenizeInputText(`[{"role": "system", "content": "s"}, {"role": "user", "content": "u"}]`)
+	assert.NoError(t, err)
+	assert.Equal(t, TokenIDsToBytes(fakeChatTemplate("s", "u")), tokens)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+
+	// cached messages are not tokenized again until evicted
+	_, _ = tokenizer.TokenizeInputText(`"ab"`)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+	_, _ = tokenizer.TokenizeInputText(`"c"`)
+	_, _ = tokenizer.TokenizeInputText(`[{"role": "user", "content": "u"}]`)
+	_, _ = tokenizer.TokenizeInputText(`"ab"`)
+	assert.Equal(t, int32(5), atomic.LoadInt32(&requests))
+}
+
+func TestRemoteTokenizerCoalescing(t *testing.T) {
+	var requests int32
+	host, port := newFakeEngine(t, 100*time.Millisecond, &requests)
+	tokenizer := NewRemoteTokenizer(port, time.Second, 16).Endpoint(host, "m1")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tokens, err := tokenizer.TokenizeInputText(`"ab"`)
+			assert.NoError(t, err)
+			assert.Equal(t, TokenIDsToBytes([]int{'a', 'b'}), tokens)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+}
+
+func TestRemoteTokenizerFallback(t *testing.T) {
+	var requests int32
+	host, port := newFakeEngine(t, 200*time.Millisecond, &requests)
+	tokenizer := NewRemoteTokenizer(port, 50*time.Millisecond, 16).Endpoint(host, "m1")
+
+	// the string tokenizer is used on timeout, and its result is not cached
+	expected, _ := NewStringTokenizer().TokenizeInputText(`"a b"`)
+	tokens, err := tokenizer.TokenizeInputText(`"a b"`)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, tokens)
+	_, _ = tokenizer.TokenizeInputText(`"a b"`)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+}
+
+func TestRemoteTokenizerConversation(t *testing.T) {
+	var requests int32
+	host, port := newFakeEngine(t, 0, &requests)
+	tokenizer := NewRemoteTokenizer(port, time.Second, 16).Endpoint(host, "m1")
+
+	tokens, err := tokenizer.TokenizeInputText(`[{"role":"system","content":"s"},{"role":"user","content":"u1"}]`)
+	assert.NoError(t, err)
+	assert.Equal(t, TokenIDsToBytes(fakeChatTemplate("s", "u1")), tokens)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	// the next turn sends the last cached message alone and with the new messages
+	tokens, err = tokenizer.TokenizeInputText(
+		`[{"role":"system","content":"s"},{"role":"user","content":"u1"},{"role":"assistant","content":"a1"},{"role":"user","content":"u2"}]`)
+	assert.NoError(t, err)
+	assert.Equal(t, TokenIDsToBytes(fakeChatTemplate("s", "u1", "a1", "u2")), tokens)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+}
+
+func TestSpliceTokens(t *testing.T) {
+	prefix := TokenIDsToBytes([]int{1, 10, 2, 11, 2, 3})
+	// the anchor and the suffix start with bos, which is skipped
+	tokens, ok := spliceTokens(prefix, TokenIDsToBytes([]int{1, 11, 2, 3}), TokenIDsToBytes([]int{1, 11, 2, 12, 2, 3}))
+	assert.True(t, ok)
+	assert.Equal(t, TokenIDsToBytes([]int{1, 10, 2, 11, 2, 12, 2, 3}), tokens)
+
+	// tokens of a chat template rendering the last message differently are not joined
+	_, ok = spliceTokens(prefix, TokenIDsToBytes([]int{1, 11, 2, 4}), TokenIDsToBytes([]int{1, 11, 2, 12, 2, 4}))
+	assert.False(t, ok)
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2024 The Aibrix Team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tokenizer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/vllm-project/aibrix/pkg/utils"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+const (
+	tokenizerFile       = "tokenizer.json"
+	tokenizerConfigFile = "tokenizer_config.json"
+)
+
+// Store holds the HuggingFace tokenizers indexed by model.
+type Store struct {
+	mu         sync.RWMutex
+	tokenizers map[string]*HuggingFaceTokenizer
+}
+
+func NewStore() *Store {
+	return &Store{tokenizers: map[string]*HuggingFaceTokenizer{}}
+}
+
+var defaultStore = NewStore()
+
+// DefaultStore returns the process wide tokenizer store used by routers.
+func DefaultStore() *Store {
+	return defaultStore
+}
+
+// Add adds or replaces the tokenizer of the model.
+func (s *Store) Add(model string, t *HuggingFaceTokenizer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokenizers[model] = t
+}
+
+// Get returns the tokenizer of the model.
+func (s *Store) Get(model string) (*HuggingFaceTokenizer, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.tokenizers[model]
+	return t, ok
+}
+
+// Len returns the number of models with a tokenizer.
+func (s *Store) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.tokenizers)
+}
+
+// LoadFromPath loads the tokenizers of a directory with a sub directory per model, named by the model,
+// containing tokenizer.json and optionally tokenizer_config.json.
+func (s *Store) LoadFromPath(path string) error {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		model := entry.Name()
+		dir := filepath.Join(path, model)
+		data, err := os.ReadFile(filepath.Join(dir, tokenizerFile))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		config, err := os.ReadFile(filepath.Join(dir, tokenizerConfigFile))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+
+		t, err := NewHuggingFaceTokenizer(data, config)
+		if err != nil {
+			return fmt.Errorf("failed to load tokenizer %s: %w", dir, err)
+		}
+		s.Add(model, t)
+		klog.InfoS("loaded tokenizer", "model", model, "dir", dir, "chatTemplate", t.chatTemplate.name)
+	}
+	return nil
+}
+
+// LoadFromConfigMap loads the tokenizers of a ConfigMap with keys <model>.tokenizer.json and optionally
+// <model>.tokenizer_config.json, as data or binary data.
+func (s *Store) LoadFromConfigMap(ctx context.Context, client kubernetes.Interface, namespace, name string) error {
+	cm, err := client.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	files := map[string][]byte{}
+	for key, value := range cm.Data {
+		files[key] = []byte(value)
+	}
+	for key, value := range cm.BinaryData {
+		files[key] = value
+	}
+
+	models := []string{}
+	for key := range files {
+		if model, found := strings.CutSuffix(key, "."+tokenizerFile); found {
+			models = append(models, model)
+		}
+	}
+	sort.Strings(models)
+	for _, model := range models {
+		t, err := NewHuggingFaceTokenizer(files[model+"."+tokenizerFile], files[model+"."+tokenizerConfigFile])
+		if err != nil {
+			return fmt.Errorf("failed to load tokenizer %s/%s[%s]: %w", namespace, name, model, err)
+		}
+		s.Add(model, t)
+		klog.InfoS("loaded tokenizer", "model", model, "configmap", namespace+"/"+name, "chatTemplate", t.chatTemplate.name)
+	}
+	return nil
+}
+
+// InitDefaultStore loads tokenizers into the default store from the directory set by AIBRIX_TOKENIZER_PATH
+// and the ConfigMap set by AIBRIX_TOKENIZER_CONFIGMAP as namespace/name.
+func InitDefaultStore(ctx context.Context, client kubernetes.Interface) error {
+	if path := utils.LoadEnv("AIBRIX_TOKENIZER_PATH", ""); path != "" {
+		if err := defaultStore.LoadFromPath(path); err != nil {
+			return err
+		}
+	}
+
+	if configMap := utils.LoadEnv("AIBRIX_TOKENIZER_CONFIGMAP", ""); configMap != "" {
+		namespace, name, found := strings.Cut(configMap, "/")
+		if !found {
+			return fmt.Errorf("invalid AIBRIX_TOKENIZER_CONFIGMAP: %s, expected namespace/name", configMap)
+		}
+		if err := defaultStore.LoadFromConfigMap(ctx, client, namespace, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
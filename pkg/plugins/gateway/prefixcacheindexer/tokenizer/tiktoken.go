@@ -47,6 +47,14 @@ func (s tiktokenTokenizer) TokenizeInputText(text string) ([]byte, error) {
 	return intToByteArray(token), nil
 }
 
+// tokenBytes is the size of a token id in the tokens of TokenIDsToBytes
+const tokenBytes = 4
+
+// TokenIDsToBytes encodes token ids reported by an engine as the tiktoken tokenizer encodes its tokens.
+func TokenIDsToBytes(tokenIDs []int) []byte {
+	return intToByteArray(tokenIDs)
+}
+
 func intToByteArray(intArray []int) []byte {
 	var buf bytes.Buffer
 	for _, num := range intArray {
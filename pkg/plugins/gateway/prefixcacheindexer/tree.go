@@ -17,10 +17,15 @@ limitations under the License.
 package prefixcacheindexer
 
 import (
+	"container/list"
+	"fmt"
+	"io"
 	"sort"
+	"strconv"
 	"sync"
 	"time"
 
+	"github.com/vllm-project/aibrix/pkg/cache"
 	"github.com/vllm-project/aibrix/pkg/utils"
 
 	v1 "k8s.io/api/core/v1"
@@ -29,8 +34,27 @@ import (
 
 const (
 	evictionDuration = 5 * time.Minute // NOTE: hardcoded eviction period
+
+	defaultPrefixCacheMaxTreeNodes = 1000000
 )
 
+var prefixCacheMaxTreeNodes = getPrefixCacheMaxTreeNodes()
+
+func getPrefixCacheMaxTreeNodes() int {
+	value := utils.LoadEnv("AIBRIX_PREFIX_CACHE_MAX_TREE_NODES", "")
+	if value != "" {
+		intValue, err := strconv.Atoi(value)
+		if err != nil || intValue < 0 {
+			klog.Infof("invalid AIBRIX_PREFIX_CACHE_MAX_TREE_NODES: %s, falling back to default", value)
+		} else {
+			klog.Infof("using AIBRIX_PREFIX_CACHE_MAX_TREE_NODES env value for prefix cache max tree nodes: %d", intValue)
+			return intValue
+		}
+	}
+	klog.Infof("using default prefix cache max tree nodes: %d", defaultPrefixCacheMaxTreeNodes)
+	return defaultPrefixCacheMaxTreeNodes
+}
+
 type TreeNode struct {
 	mu            sync.RWMutex // Add mutex for thread safety
 	id            int
@@ -47,6 +71,7 @@ type TreeNode struct {
 	contextLength int // total length from root to this node
 	depth         int
 	modelToPods   map[string]map[string]time.Time // model -> {podName -> lastAccessTime}
+	element       *list.Element                   // element of the node in the LRU list of the cache, nil for the root
 }
 
 func (n *TreeNode) GetModelToPods() map[string]map[string]time.Time {
@@ -333,6 +358,11 @@ type LPRadixCache struct {
 	allNodes   map[int]*TreeNode
 	nextNodeID int
 	startTime  time.Time
+	// maxNodes caps the nodes of the tree besides the root, the least recently accessed nodes are evicted first
+	// on Evict, 0 is unbounded
+	maxNodes int
+	// order holds the nodes besides the root, front is the most recently accessed
+	order *list.List
 }
 
 func NewLPRadixCache(numPods int) *LPRadixCache {
@@ -342,6 +372,7 @@ func NewLPRadixCache(numPods int) *LPRadixCache {
 		allNodes:   make(map[int]*TreeNode),
 		nextNodeID: 0,
 		startTime:  time.Now(),
+		maxNodes:   prefixCacheMaxTreeNodes,
 	}
 	cache.reset()
 	return cache
@@ -355,6 +386,22 @@ func (c *LPRadixCache) reset() {
 	c.rootNode = root
 	c.allNodes = make(map[int]*TreeNode)
 	c.allNodes[root.id] = root
+	c.order = list.New()
+}
+
+// addNode adds a new node besides the root to the cache as the most recently accessed node.
+func (c *LPRadixCache) addNode(node *TreeNode) {
+	c.allNodes[node.id] = node
+	node.element = c.order.PushFront(node)
+}
+
+// touch updates the last access time of the node and moves it to the front of the LRU list, the cache must be
+// locked for writing.
+func (c *LPRadixCache) touch(node *TreeNode, now time.Time) {
+	node.lastAccess = now
+	if node.element != nil {
+		c.order.MoveToFront(node.element)
+	}
 }
 
 // matchLen returns the length of matching prefix between two slices
@@ -392,7 +439,7 @@ func (c *LPRadixCache) MatchPrefix(inputTokens []int, model string, pods []*v1.P
 	var matchedPods []*v1.Pod
 	if modelPods, ok := node.modelToPods[model]; ok {
 		for _, pod := range pods {
-			if _, ok := modelPods[pod.Name]; ok {
+			if _, ok := modelPods[cache.PodKey(pod)]; ok {
 				if matchedPods == nil {
 					matchedPods = make([]*v1.Pod, 0, len(pods))
 				}
@@ -414,7 +461,7 @@ func (c *LPRadixCache) matchPrefixHelper(node *TreeNode, tokens []int) (*TreeNod
 		return node, nil
 	}
 
-	node.lastAccess = time.Now()
+	// the last access time is only updated by AddPrefix, which holds the write lock
 	if child, ok := node.children[tokens[0]]; ok {
 		prefixLen := matchLen(child.key, tokens)
 		if prefixLen > 0 {
@@ -458,7 +505,7 @@ func (c *LPRadixCache) AddPrefix(tokens []int, model string, podName string) (*T
 }
 
 func (c *LPRadixCache) insertHelper(node *TreeNode, key []int, value []int) (*TreeNode, []int, []int) {
-	node.lastAccess = time.Now()
+	c.touch(node, time.Now())
 	node.load++
 	klog.Infof("Trying to insert key: %v into node(%d)", key, node.id)
 	timePassed := node.lastAccess.Sub(c.startTime).Seconds()
@@ -476,7 +523,7 @@ func (c *LPRadixCache) insertHelper(node *TreeNode, key []int, value []int) (*Tr
 		if prefixLen == len(child.key) {
 			if prefixLen == len(key) {
 				klog.Infof("Entire input tokens match the child node(%d): %v", child.id, key)
-				child.lastAccess = time.Now()
+				c.touch(child, time.Now())
 				child.load++
 				return child, key, nil // Return the original key for exact match
 			}
@@ -505,7 +552,7 @@ func (c *LPRadixCache) insertHelper(node *TreeNode, key []int, value []int) (*Tr
 	klog.Info("No child matches any of the prefix: ", key)
 	newNode := c.NewTreeNode(c.numPods, node, key, value)
 	node.children[key[0]] = newNode
-	c.allNodes[newNode.id] = newNode
+	c.addNode(newNode)
 	return newNode, nil, key
 }
 
@@ -519,29 +566,26 @@ func (c *LPRadixCache) doesExceededTTL(node *TreeNode, now time.Time) bool {
 	return false
 }
 
+// Evict evicts the nodes not accessed within the eviction duration, and then the least recently accessed nodes
+// while the tree has more than maxNodes nodes besides the root, with their children. Both are taken from the back
+// of the LRU list, so that the cost is proportional to the evicted nodes rather than the nodes of the tree.
 func (c *LPRadixCache) Evict(now time.Time) []*TreeNode {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	var nodesToEvict []*TreeNode
-	for _, node := range c.allNodes {
-		if node != c.rootNode {
-			if c.doesExceededTTL(node, now) {
-				// timePassed := now.Sub(node.lastAccess).Seconds()
-				// klog.Infof("Node(%d) exceeded TTL(%ds), time since last access: %.2f",
-				// 	node.id, int(evictionDuration.Seconds()), timePassed)
-				if collected := c.collectNodeAndChildren(node); collected != nil {
-					nodesToEvict = append(nodesToEvict, collected...)
-				}
-			}
+	for element := c.order.Back(); element != nil; element = c.order.Back() {
+		node := element.Value.(*TreeNode)
+		if !c.doesExceededTTL(node, now) && (c.maxNodes <= 0 || len(c.allNodes)-1 <= c.maxNodes) {
+			break
 		}
-	}
-	// Actually perform the eviction
-	for _, node := range nodesToEvict {
-		c.evictNode(node)
+		collected := c.collectNodeAndChildren(node)
+		for _, n := range collected {
+			c.evictNode(n)
+		}
+		nodesToEvict = append(nodesToEvict, collected...)
 	}
 	if len(nodesToEvict) > 0 {
-		klog.Infof("Evicted %d nodes", len(nodesToEvict))
-		c.PrettyPrint()
+		klog.Infof("Evicted %d nodes, %d nodes left", len(nodesToEvict), len(c.allNodes)-1)
 	}
 	return nodesToEvict
 }
@@ -592,9 +636,13 @@ func (c *LPRadixCache) evictNode(node *TreeNode) {
 		delete(node.parent.children, node.key[0])
 	}
 
-	// Remove from allNodes map
+	// Remove from allNodes map and the LRU list
 	delete(c.allNodes, node.id)
-	klog.Infof("Evict node(%d)!, Key: %v", node.id, node.key)
+	if node.element != nil {
+		c.order.Remove(node.element)
+		node.element = nil
+	}
+	klog.V(5).Infof("Evict node(%d)!, Key: %v", node.id, node.key)
 
 	// Clean up the node's references
 	node.parent = nil
@@ -659,6 +707,118 @@ func (c *LPRadixCache) splitNode(key []int, child *TreeNode, splitLen int) *Tree
 	klog.Infof("Split complete - Child node(%d) key: %v, modelToPods: %v",
 		child.id, child.key, child.modelToPods)
 
-	c.allNodes[newNode.id] = newNode
+	c.addNode(newNode)
 	return newNode
 }
+
+// RemovePodsNotInCurrentPodSet removes the pods which no longer exist from all nodes.
+func (c *LPRadixCache) RemovePodsNotInCurrentPodSet(currentPodSet map[string]bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, node := range c.allNodes {
+		node.RemovePodsNotInCurrentPodSet(currentPodSet)
+	}
+}
+
+// WriteSnapshot writes the tree in pre-order, children in key order.
+func (c *LPRadixCache) WriteSnapshot(w io.Writer) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	sw := newSnapshotWriter(w, snapshotKindLPRadixCache)
+	c.writeNodeSnapshot(sw, c.rootNode)
+	return sw.flush()
+}
+
+func (c *LPRadixCache) writeNodeSnapshot(sw *snapshotWriter, node *TreeNode) {
+	sw.ints(node.key)
+	sw.ints(node.value)
+	sw.varint(int64(node.load))
+	sw.time(node.lastAccess)
+	node.mu.RLock()
+	sw.uvarint(uint64(len(node.modelToPods)))
+	for model, pods := range node.modelToPods {
+		sw.string(model)
+		sw.pods(pods)
+	}
+	node.mu.RUnlock()
+
+	childKeys := make([]int, 0, len(node.children))
+	for k := range node.children {
+		childKeys = append(childKeys, k)
+	}
+	sort.Ints(childKeys)
+	sw.uvarint(uint64(len(childKeys)))
+	for _, k := range childKeys {
+		c.writeNodeSnapshot(sw, node.children[k])
+	}
+}
+
+// ReadSnapshot replaces the tree, nodes get new ids. The snapshot is read into a new tree, which replaces
+// the tree only if the whole snapshot is valid, so that it can be called while the cache is in use.
+func (c *LPRadixCache) ReadSnapshot(r io.Reader) error {
+	sr, err := newSnapshotReader(r, snapshotKindLPRadixCache)
+	if err != nil {
+		return err
+	}
+
+	restored := &LPRadixCache{numPods: c.numPods, maxNodes: c.maxNodes, startTime: c.startTime}
+	restored.reset()
+	// the root has no key and value
+	_, _ = sr.ints(), sr.ints()
+	restored.readNodeSnapshot(sr, restored.rootNode)
+	if sr.err != nil {
+		return fmt.Errorf("invalid prefix cache snapshot: %w", sr.err)
+	}
+	restored.sortOrder()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rootNode = restored.rootNode
+	c.allNodes = restored.allNodes
+	c.nextNodeID = restored.nextNodeID
+	c.order = restored.order
+	return nil
+}
+
+// sortOrder orders the LRU list by the last access times of the nodes, which are read from a snapshot.
+func (c *LPRadixCache) sortOrder() {
+	nodes := make([]*TreeNode, 0, c.order.Len())
+	for element := c.order.Front(); element != nil; element = element.Next() {
+		nodes = append(nodes, element.Value.(*TreeNode))
+	}
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return nodes[i].lastAccess.After(nodes[j].lastAccess)
+	})
+	c.order.Init()
+	for _, node := range nodes {
+		node.element = c.order.PushBack(node)
+	}
+}
+
+// readNodeSnapshot reads the state and the children of the node.
+func (c *LPRadixCache) readNodeSnapshot(sr *snapshotReader, node *TreeNode) {
+	node.load = int(sr.varint())
+	node.lastAccess = sr.time()
+	numModels := sr.length()
+	for i := 0; i < numModels && sr.err == nil; i++ {
+		model := sr.string()
+		node.modelToPods[model] = sr.pods()
+	}
+
+	numChildren := sr.length()
+	for i := 0; i < numChildren && sr.err == nil; i++ {
+		key, value := sr.ints(), sr.ints()
+		if sr.err != nil {
+			return
+		}
+		if len(key) == 0 {
+			sr.err = fmt.Errorf("empty key of a child node")
+			return
+		}
+		child := c.NewTreeNode(c.numPods, node, key, value)
+		node.children[key[0]] = child
+		c.addNode(child)
+		c.readNodeSnapshot(sr, child)
+	}
+}
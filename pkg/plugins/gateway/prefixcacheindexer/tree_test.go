@@ -17,6 +17,7 @@ limitations under the License.
 package prefixcacheindexer
 
 import (
+	"io"
 	"testing"
 	"time"
 
@@ -24,6 +25,7 @@ import (
 	"github.com/vllm-project/aibrix/pkg/utils"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
 )
 
 func Test_LPRadixCacheE2E(t *testing.T) {
@@ -125,3 +127,50 @@ func Test_RadixMatchPrefix(t *testing.T) {
 		})
 	}
 }
+
+func Test_LPRadixCacheMaxNodes(t *testing.T) {
+	cache := NewLPRadixCache(2)
+	cache.maxNodes = 2
+	pods := []*v1.Pod{{ObjectMeta: metav1.ObjectMeta{Name: "p1"}}}
+
+	cache.AddPrefix([]int{1, 2}, "m1", "p1")
+	cache.AddPrefix([]int{3, 4}, "m1", "p1")
+	cache.AddPrefix([]int{5, 6}, "m1", "p1")
+	// adding the prefix again makes it more recently used than [3, 4]
+	cache.AddPrefix([]int{1, 2}, "m1", "p1")
+
+	evicted := cache.Evict(time.Now())
+	assert.Len(t, evicted, 1)
+	assert.Len(t, cache.GetAllNodes(), 3)
+	for tokens, matched := range map[int]bool{1: true, 3: false, 5: true} {
+		matchedTokens, _, _ := cache.MatchPrefix([]int{tokens, tokens + 1}, "m1", pods)
+		assert.Equal(t, matched, len(matchedTokens) > 0, "prefix %d", tokens)
+	}
+}
+
+// newBenchmarkLPRadixCache returns a tree of about numNodes nodes capped at numNodes, the prefixes share their
+// first token by 1024.
+func newBenchmarkLPRadixCache(numNodes int) *LPRadixCache {
+	cache := NewLPRadixCache(8)
+	cache.maxNodes = numNodes
+	for i := 0; i < numNodes; i++ {
+		cache.AddPrefix([]int{i / 1024, i % 1024}, "m1", "p0")
+	}
+	return cache
+}
+
+// BenchmarkLPRadixCacheAddPrefix1MNodes adds a new prefix at the node cap and evicts, which only visits the
+// evicted nodes at the back of the LRU list.
+func BenchmarkLPRadixCacheAddPrefix1MNodes(b *testing.B) {
+	klog.LogToStderr(false)
+	klog.SetOutput(io.Discard)
+	defer klog.LogToStderr(true)
+
+	cache := newBenchmarkLPRadixCache(1 << 20)
+	cache.Evict(time.Now())
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cache.AddPrefix([]int{-1 - i, 0}, "m1", "p0")
+		cache.Evict(time.Now())
+	}
+}
@@ -0,0 +1,43 @@
+/*
+Copyright 2024 The Aibrix Team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package profile
+
+import (
+	"embed"
+	"path"
+)
+
+//go:embed builtin/*.yaml
+var builtinFS embed.FS
+
+// loadBuiltinProfiles adds the profiles shipped with the gateway, they apply
+// to any model unless a model specific profile is loaded.
+func (s *Store) loadBuiltinProfiles() {
+	entries, err := builtinFS.ReadDir("builtin")
+	if err != nil {
+		panic(err)
+	}
+	for _, entry := range entries {
+		data, err := builtinFS.ReadFile(path.Join("builtin", entry.Name()))
+		if err != nil {
+			panic(err)
+		}
+		if err := s.Load(data); err != nil {
+			panic(err)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+/*
+Copyright 2024 The Aibrix Team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package profile
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ReadSamples reads the xColumn and yColumn of a CSV file with a header row.
+// Rows with empty values in either column are skipped.
+func ReadSamples(r io.Reader, xColumn, yColumn string) ([]float64, []float64, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read csv header: %w", err)
+	}
+	xIndex, yIndex := -1, -1
+	for i, column := range header {
+		switch strings.TrimSpace(column) {
+		case xColumn:
+			xIndex = i
+		case yColumn:
+			yIndex = i
+		}
+	}
+	if xIndex < 0 || yIndex < 0 {
+		return nil, nil, fmt.Errorf("csv header %v does not contain columns %s and %s", header, xColumn, yColumn)
+	}
+
+	var xs, ys []float64
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		xValue, yValue := strings.TrimSpace(record[xIndex]), strings.TrimSpace(record[yIndex])
+		if xValue == "" || yValue == "" {
+			continue
+		}
+		x, err := strconv.ParseFloat(xValue, 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d: invalid %s: %w", line, xColumn, err)
+		}
+		y, err := strconv.ParseFloat(yValue, 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d: invalid %s: %w", line, yColumn, err)
+		}
+		xs = append(xs, x)
+		ys = append(ys, y)
+	}
+	if len(xs) == 0 {
+		return nil, nil, fmt.Errorf("no samples in csv")
+	}
+	return xs, ys, nil
+}
+
+// FitPiecewisePolynomial fits a polynomial of the degree by least squares to the
+// samples of each segment split at the breakpoints. The first piece starts at the
+// smallest sample.
+func FitPiecewisePolynomial(xs, ys []float64, breakpoints []float64, degree int) (*Term, error) {
+	if len(xs) != len(ys) || len(xs) == 0 {
+		return nil, fmt.Errorf("x and y must have the same non zero length")
+	}
+	if degree < 0 {
+		return nil, fmt.Errorf("degree must not be negative")
+	}
+
+	starts := []float64{math.Inf(-1)}
+	sorted := append([]float64(nil), breakpoints...)
+	sort.Float64s(sorted)
+	starts = append(starts, sorted...)
+
+	term := &Term{}
+	for i, start := range starts {
+		end := math.Inf(1)
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+		var segmentXs, segmentYs []float64
+		for j, x := range xs {
+			if x >= start && x < end {
+				segmentXs = append(segmentXs, x)
+				segmentYs = append(segmentYs, ys[j])
+			}
+		}
+		if len(segmentXs) <= degree {
+			return nil, fmt.Errorf("segment [%v, %v) has %d samples, at least %d are required for degree %d",
+				start, end, len(segmentXs), degree+1, degree)
+		}
+
+		coefficients, err := fitPolynomial(segmentXs, segmentYs, degree)
+		if err != nil {
+			return nil, fmt.Errorf("segment [%v, %v): %w", start, end, err)
+		}
+		from := start
+		if i == 0 {
+			from = minFloat64(segmentXs)
+		}
+		term.Pieces = append(term.Pieces, Piece{From: from, Coefficients: coefficients})
+	}
+	return term, nil
+}
+
+// FitLookupTable builds a lookup table from the mean of the samples at each x.
+func FitLookupTable(xs, ys []float64) (*Term, error) {
+	if len(xs) != len(ys) || len(xs) == 0 {
+		return nil, fmt.Errorf("x and y must have the same non zero length")
+	}
+
+	sums, counts := map[float64]float64{}, map[float64]int{}
+	for i, x := range xs {
+		sums[x] += ys[i]
+		counts[x]++
+	}
+	table := &LookupTable{}
+	for x := range sums {
+		table.X = append(table.X, x)
+	}
+	sort.Float64s(table.X)
+	for _, x := range table.X {
+		table.Y = append(table.Y, sums[x]/float64(counts[x]))
+	}
+	return &Term{Table: table}, nil
+}
+
+// fitPolynomial solves the least squares normal equations of a polynomial fit.
+// x is scaled to [-1, 1] for numerical stability and the coefficients are mapped back.
+func fitPolynomial(xs, ys []float64, degree int) ([]float64, error) {
+	lo, hi := minFloat64(xs), maxFloat64(xs)
+	center, scale := (hi+lo)/2, (hi-lo)/2
+	if scale == 0 {
+		// all samples at the same x, only a constant can be fitted
+		if degree > 0 {
+			return nil, fmt.Errorf("samples at a single x can not fit degree %d", degree)
+		}
+		scale = 1
+	}
+
+	n := degree + 1
+	a := make([][]float64, n)
+	for i := range a {
+		a[i] = make([]float64, n+1)
+	}
+	for k, x := range xs {
+		t := (x - center) / scale
+		powers := make([]float64, 2*n-1)
+		powers[0] = 1
+		for i := 1; i < len(powers); i++ {
+			powers[i] = powers[i-1] * t
+		}
+		for i := 0; i < n; i++ {
+			for j := 0; j < n; j++ {
+				a[i][j] += powers[i+j]
+			}
+			a[i][n] += powers[i] * ys[k]
+		}
+	}
+
+	scaled, err := solveLinearSystem(a)
+	if err != nil {
+		return nil, err
+	}
+
+	// expand sum(c_i * ((x - center) / scale)^i) into coefficients of x
+	coefficients := make([]float64, n)
+	for i, c := range scaled {
+		c /= math.Pow(scale, float64(i))
+		for j := 0; j <= i; j++ {
+			coefficients[j] += c * binomial(i, j) * math.Pow(-center, float64(i-j))
+		}
+	}
+	return coefficients, nil
+}
+
+// solveLinearSystem solves the augmented matrix by Gaussian elimination with partial pivoting.
+func solveLinearSystem(a [][]float64) ([]float64, error) {
+	n := len(a)
+	for col := 0; col < n; col++ {
+		pivot := col
+		for row := col + 1; row < n; row++ {
+			if math.Abs(a[row][col]) > math.Abs(a[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(a[pivot][col]) < 1e-12 {
+			return nil, fmt.Errorf("samples do not determine the polynomial, use more distinct x values or a lower degree")
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+		for row := col + 1; row < n; row++ {
+			factor := a[row][col] / a[col][col]
+			for k := col; k <= n; k++ {
+				a[row][k] -= factor * a[col][k]
+			}
+		}
+	}
+
+	solution := make([]float64, n)
+	for row := n - 1; row >= 0; row-- {
+		sum := a[row][n]
+		for k := row + 1; k < n; k++ {
+			sum -= a[row][k] * solution[k]
+		}
+		solution[row] = sum / a[row][row]
+	}
+	return solution, nil
+}
+
+func binomial(n, k int) float64 {
+	result := 1.0
+	for i := 1; i <= k; i++ {
+		result = result * float64(n-k+i) / float64(i)
+	}
+	return result
+}
+
+func minFloat64(values []float64) float64 {
+	result := math.Inf(1)
+	for _, v := range values {
+		result = math.Min(result, v)
+	}
+	return result
+}
+
+func maxFloat64(values []float64) float64 {
+	result := math.Inf(-1)
+	for _, v := range values {
+		result = math.Max(result, v)
+	}
+	return result
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2024 The Aibrix Team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package profile
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadSamples(t *testing.T) {
+	csv := `num_batched_tokens, context_length, latency_ms
+128, 128, 22.0
+256, 256,
+512, 1024, 60.5
+`
+	xs, ys, err := ReadSamples(strings.NewReader(csv), "num_batched_tokens", "latency_ms")
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{128, 512}, xs)
+	assert.Equal(t, []float64{22.0, 60.5}, ys)
+
+	_, _, err = ReadSamples(strings.NewReader(csv), "missing", "latency_ms")
+	assert.Error(t, err)
+	_, _, err = ReadSamples(strings.NewReader("x,y\n1,abc\n"), "x", "y")
+	assert.Error(t, err)
+	_, _, err = ReadSamples(strings.NewReader("x,y\n"), "x", "y")
+	assert.Error(t, err)
+}
+
+func TestFitPiecewisePolynomial(t *testing.T) {
+	// constant below 192, quadratic below 384 and linear above, as the built-in A6000 linear term
+	expected := &Term{Pieces: []Piece{
+		{From: 0, Coefficients: []float64{0.022}},
+		{From: 192, Coefficients: []float64{-0.118, 0.00125, -2.56e-6}},
+		{From: 384, Coefficients: []float64{0.0042, 0.000108}},
+	}}
+	var xs, ys []float64
+	for x := 16.0; x <= 8192; x += 16 {
+		xs = append(xs, x)
+		ys = append(ys, expected.Eval(x))
+	}
+
+	term, err := FitPiecewisePolynomial(xs, ys, []float64{384, 192}, 2)
+	assert.NoError(t, err)
+	assert.Len(t, term.Pieces, 3)
+	assert.Equal(t, []float64{16, 192, 384}, []float64{term.Pieces[0].From, term.Pieces[1].From, term.Pieces[2].From})
+	for _, x := range []float64{16, 100, 192, 300, 384, 1000, 8000} {
+		assert.InDelta(t, expected.Eval(x), term.Eval(x), 1e-9, "x=%v", x)
+	}
+	assert.InDelta(t, 0.000108, term.Pieces[2].Coefficients[1], 1e-9)
+	assert.InDelta(t, 0, term.Pieces[2].Coefficients[2], 1e-12)
+
+	_, err = FitPiecewisePolynomial(xs, ys, []float64{10000}, 2)
+	assert.Error(t, err, "no samples above the last breakpoint")
+	_, err = FitPiecewisePolynomial([]float64{1, 1, 1}, []float64{1, 2, 3}, nil, 1)
+	assert.Error(t, err, "degree can not be determined from a single x")
+}
+
+func TestFitNoisyLinear(t *testing.T) {
+	var xs, ys []float64
+	for i := 0; i < 200; i++ {
+		x := float64(1024 + i*64)
+		noise := 1e-5 * math.Sin(float64(i))
+		xs = append(xs, x)
+		ys = append(ys, 0.159e-3+1.86e-7*x+noise)
+	}
+	term, err := FitPiecewisePolynomial(xs, ys, nil, 1)
+	assert.NoError(t, err)
+	assert.InDelta(t, 1.86e-7, term.Pieces[0].Coefficients[1], 1e-9)
+}
+
+func TestFitLookupTable(t *testing.T) {
+	term, err := FitLookupTable([]float64{2048, 1024, 1024, 4096}, []float64{0.002, 0.001, 0.003, 0.004})
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{1024, 2048, 4096}, term.Table.X)
+	assert.Equal(t, []float64{0.002, 0.002, 0.004}, term.Table.Y)
+	assert.InDelta(t, 0.003, term.Eval(3072), 1e-12)
+	assert.InDelta(t, 0.002, term.Eval(512), 1e-12)
+	assert.InDelta(t, 0.006, term.Eval(6144), 1e-12)
+}
@@ -0,0 +1,171 @@
+/*
+Copyright 2024 The Aibrix Team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package profile
+
+import (
+	"fmt"
+	"sort"
+)
+
+// PrefillModel predicts prefill latency as the sum of a linear term of the
+// uncached tokens, an attention term of the context length and a quadratic
+// attention term of the uncached tokens, divided by the GPU utilization.
+// Short prefills of at most ShortPrefillTokens uncached tokens use the
+// ShortAttention term instead of Attention if it is set.
+type PrefillModel struct {
+	// Linear is the latency of the linear layers over the number of uncached tokens.
+	Linear *Term `json:"linear,omitempty"`
+	// Attention is the latency of attention over the context length.
+	Attention *Term `json:"attention,omitempty"`
+	// ShortAttention is the latency of attention over the context length for short prefills.
+	ShortAttention *Term `json:"shortAttention,omitempty"`
+	// ShortPrefillTokens is the largest number of uncached tokens of a short prefill.
+	ShortPrefillTokens int `json:"shortPrefillTokens,omitempty"`
+	// Quadratic is the quadratic attention latency over the number of uncached tokens.
+	Quadratic *Term `json:"quadratic,omitempty"`
+	// Utilization is the fraction of time the GPU spends in the modeled kernels, defaults to 1.
+	Utilization float64 `json:"utilization,omitempty"`
+}
+
+// PrefillTime predicts the prefill latency in seconds.
+func (m *PrefillModel) PrefillTime(numTokens, contextLength int) float64 {
+	attention := m.Attention
+	if m.ShortAttention != nil && numTokens <= m.ShortPrefillTokens {
+		attention = m.ShortAttention
+	}
+	total := m.Linear.Eval(float64(numTokens)) +
+		attention.Eval(float64(contextLength)) +
+		m.Quadratic.Eval(float64(numTokens))
+	if m.Utilization > 0 {
+		total /= m.Utilization
+	}
+	return total
+}
+
+func (m *PrefillModel) validate() error {
+	if m.Utilization < 0 || m.Utilization > 1 {
+		return fmt.Errorf("utilization %v must be between 0 and 1", m.Utilization)
+	}
+	if m.ShortPrefillTokens < 0 || (m.ShortAttention != nil) != (m.ShortPrefillTokens > 0) {
+		return fmt.Errorf("shortAttention and a positive shortPrefillTokens must be set together")
+	}
+	for name, term := range map[string]*Term{
+		"linear": m.Linear, "attention": m.Attention, "shortAttention": m.ShortAttention, "quadratic": m.Quadratic,
+	} {
+		if err := term.validate(); err != nil {
+			return fmt.Errorf("invalid %s term: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Term is a latency function in seconds of one variable, either a piecewise
+// polynomial or a lookup table. A nil Term evaluates to 0.
+type Term struct {
+	// Pieces are polynomials ordered by their start, each applies from its start
+	// until the next one. The term is 0 before the first piece.
+	Pieces []Piece `json:"pieces,omitempty"`
+	// Table is a lookup table linearly interpolated between its points.
+	Table *LookupTable `json:"table,omitempty"`
+}
+
+// Piece is a polynomial applied for values from From on.
+type Piece struct {
+	From float64 `json:"from"`
+	// Coefficients of the polynomial, lowest degree first.
+	Coefficients []float64 `json:"coefficients"`
+}
+
+// LookupTable holds measured latencies Y at increasing values X. Values outside
+// of the table are extrapolated from the first or last segment.
+type LookupTable struct {
+	X []float64 `json:"x"`
+	Y []float64 `json:"y"`
+}
+
+// Eval evaluates the term at x.
+func (t *Term) Eval(x float64) float64 {
+	if t == nil {
+		return 0
+	}
+	if t.Table != nil {
+		return t.Table.Eval(x)
+	}
+
+	i := sort.Search(len(t.Pieces), func(i int) bool { return t.Pieces[i].From > x }) - 1
+	if i < 0 {
+		return 0
+	}
+	return evalPolynomial(t.Pieces[i].Coefficients, x)
+}
+
+func (t *Term) validate() error {
+	if t == nil {
+		return nil
+	}
+	if (t.Table == nil) == (len(t.Pieces) == 0) {
+		return fmt.Errorf("exactly one of pieces and table is required")
+	}
+	if t.Table != nil {
+		return t.Table.validate()
+	}
+	for i, piece := range t.Pieces {
+		if len(piece.Coefficients) == 0 {
+			return fmt.Errorf("piece %d has no coefficients", i)
+		}
+		if i > 0 && piece.From <= t.Pieces[i-1].From {
+			return fmt.Errorf("pieces must be ordered by increasing from")
+		}
+	}
+	return nil
+}
+
+// Eval interpolates the table at x.
+func (l *LookupTable) Eval(x float64) float64 {
+	if len(l.X) == 1 {
+		return l.Y[0]
+	}
+	i := sort.SearchFloat64s(l.X, x)
+	switch {
+	case i == 0:
+		i = 1
+	case i == len(l.X):
+		i = len(l.X) - 1
+	}
+	x0, x1, y0, y1 := l.X[i-1], l.X[i], l.Y[i-1], l.Y[i]
+	return y0 + (y1-y0)*(x-x0)/(x1-x0)
+}
+
+func (l *LookupTable) validate() error {
+	if len(l.X) == 0 || len(l.X) != len(l.Y) {
+		return fmt.Errorf("table x and y must have the same non zero length")
+	}
+	for i := 1; i < len(l.X); i++ {
+		if l.X[i] <= l.X[i-1] {
+			return fmt.Errorf("table x must be strictly increasing")
+		}
+	}
+	return nil
+}
+
+func evalPolynomial(coefficients []float64, x float64) float64 {
+	y := 0.0
+	for i := len(coefficients) - 1; i >= 0; i-- {
+		y = y*x + coefficients[i]
+	}
+	return y
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2024 The Aibrix Team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package profile
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTermEval(t *testing.T) {
+	var nilTerm *Term
+	assert.Equal(t, 0.0, nilTerm.Eval(100))
+
+	term := &Term{Pieces: []Piece{
+		{From: 10, Coefficients: []float64{1}},
+		{From: 20, Coefficients: []float64{1, 2, 3}},
+	}}
+	assert.Equal(t, 0.0, term.Eval(5))
+	assert.Equal(t, 1.0, term.Eval(10))
+	assert.Equal(t, 1.0, term.Eval(19.9))
+	assert.Equal(t, 1.0+2*20+3*400, term.Eval(20))
+
+	table := &Term{Table: &LookupTable{X: []float64{0, 10}, Y: []float64{1, 2}}}
+	assert.Equal(t, 1.5, table.Eval(5))
+	assert.Equal(t, 3.0, table.Eval(20))
+	single := &Term{Table: &LookupTable{X: []float64{10}, Y: []float64{2}}}
+	assert.Equal(t, 2.0, single.Eval(100))
+}
+
+func TestPrefillModelValidate(t *testing.T) {
+	s := NewStore()
+	assert.Error(t, s.Load([]byte(`{"gpu": "A10", "prefill": {"utilization": 2}}`)))
+	assert.Error(t, s.Load([]byte(`{"gpu": "A10", "prefill": {"linear": {}}}`)))
+	assert.Error(t, s.Load([]byte(`{"gpu": "A10", "prefill": {"linear": {"pieces": [{"from": 10, "coefficients": [1]}, {"from": 5, "coefficients": [1]}]}}}`)))
+	assert.Error(t, s.Load([]byte(`{"gpu": "A10", "prefill": {"attention": {"table": {"x": [2, 1], "y": [1, 2]}}}}`)))
+	assert.NoError(t, s.Load([]byte(`{"gpu": "A10", "prefill": {"attention": {"table": {"x": [1, 2], "y": [1, 2]}}}}`)))
+	assert.Error(t, s.Load([]byte(`{"gpu": "A10", "prefill": {"shortAttention": {"table": {"x": [1], "y": [1]}}}}`)))
+	assert.Error(t, s.Load([]byte(`{"gpu": "A10", "prefill": {"shortPrefillTokens": 1024}}`)))
+}
+
+// TestBuiltinProfiles checks the built-in profiles against the Mistral-7B latency
+// model they were derived from.
+func TestBuiltinProfiles(t *testing.T) {
+	a6000Linear := func(n float64) float64 {
+		if n >= 384 {
+			return (0.10842571*n + 4.209777054806409) / 1000.0
+		} else if n >= 192 {
+			return (-118 + 1.25*n - 2.56e-3*math.Pow(n, 2)) / 1000.0
+		}
+		return 22.0 / 1000.0
+	}
+	a6000Attention := func(n, context float64) float64 {
+		if context <= 1024 {
+			return 0.32 / 1000.0
+		}
+		if n <= 1024 {
+			return (1.86e-4*context + 0.159) / 2 / 1000.0
+		}
+		return (1.86e-4*context + 0.159) / 1000.0
+	}
+	v100Linear := func(n float64) float64 {
+		if n >= 384 {
+			return (0.27106428*n + 10.52444263) / 1000.0
+		} else if n >= 192 {
+			return (-295 + 3.125*n - 6.4e-3*math.Pow(n, 2)) / 1000.0
+		}
+		return 55.0 / 1000.0
+	}
+	v100Attention := func(n, context float64) float64 {
+		if context <= 1024 {
+			return 0.80 / 1000.0
+		}
+		if n <= 1024 {
+			return (4.65e-4*context + 0.398) / 2 / 1000.0
+		}
+		return (4.65e-4*context + 0.398) / 1000.0
+	}
+
+	s := NewStore()
+	a6000, ok := s.Get("mistral-7b", "NVIDIA-RTX-A6000")
+	assert.True(t, ok)
+	v100, ok := s.Get("mistral-7b", "Tesla-V100-SXM2-32GB")
+	assert.True(t, ok)
+	for _, tc := range []struct{ tokens, context int }{{16, 16}, {200, 1024}, {300, 5000}, {1024, 8192}, {2048, 8192}} {
+		n, c := float64(tc.tokens), float64(tc.context)
+		assert.InDelta(t, (a6000Linear(n)+a6000Attention(n, c))/0.9, a6000.PrefillTime(tc.tokens, tc.context), 1e-9, "%+v", tc)
+		assert.InDelta(t, (v100Linear(n)+v100Attention(n, c))/0.9, v100.PrefillTime(tc.tokens, tc.context), 1e-9, "%+v", tc)
+	}
+
+	// quadratic attention term applies from 4096 uncached tokens
+	n := 5000.0
+	quad := (-7.37 + 3.86e-3*n + 2.16e-6*math.Pow(n, 2)) / 1000.0
+	assert.InDelta(t, (a6000Linear(n)+a6000Attention(n, n)+quad)/0.9, a6000.PrefillTime(5000, 5000), 1e-9)
+}
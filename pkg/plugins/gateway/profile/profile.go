@@ -0,0 +1,307 @@
+/*
+Copyright 2024 The Aibrix Team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package profile provides per-(model, GPU) performance profiles used by
+// routers to predict latency and cost of serving a request on a pod.
+package profile
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/vllm-project/aibrix/pkg/utils"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+)
+
+// Profile describes the performance and price of serving a model on a GPU type.
+// Profiles are loaded from JSON or YAML files, e.g.
+//
+//	model: mistral-7b
+//	gpu: A100
+//	cost: 1.0
+//	timePerOutputToken: 0.015
+//	prefill:
+//	  linear:
+//	    pieces:
+//	    - from: 0
+//	      coefficients: [0.004, 0.0001]
+//	  attention:
+//	    table:
+//	      x: [1024, 4096]
+//	      y: [0.0003, 0.0009]
+type Profile struct {
+	// Model is the model name the profile applies to, empty matches any model.
+	Model string `json:"model,omitempty"`
+	// GPU is the GPU type, matched against the GPU product of the pod.
+	GPU string `json:"gpu"`
+	// Cost is the price of one GPU in dollars per hour.
+	Cost float64 `json:"cost"`
+	// PrefillBaseTime is the fixed prefill latency in seconds, used without Prefill.
+	PrefillBaseTime float64 `json:"prefillBaseTime,omitempty"`
+	// PrefillTimePerToken is the prefill latency per prompt token in seconds, used without Prefill.
+	PrefillTimePerToken float64 `json:"prefillTimePerToken,omitempty"`
+	// TimePerOutputToken is the decode latency per output token in seconds.
+	TimePerOutputToken float64 `json:"timePerOutputToken,omitempty"`
+	// Prefill is the fitted prefill latency model, e.g. generated by cmd/profile-fit.
+	Prefill *PrefillModel `json:"prefill,omitempty"`
+}
+
+// PrefillTime predicts the prefill latency in seconds of numTokens uncached
+// tokens with a total context of contextLength tokens.
+func (p *Profile) PrefillTime(numTokens, contextLength int) float64 {
+	if p.Prefill != nil {
+		return p.Prefill.PrefillTime(numTokens, contextLength)
+	}
+	return p.PrefillBaseTime + p.PrefillTimePerToken*float64(numTokens)
+}
+
+// DecodeTime predicts the decode latency in seconds of outputTokens tokens.
+func (p *Profile) DecodeTime(outputTokens int) float64 {
+	return p.TimePerOutputToken * float64(outputTokens)
+}
+
+// CostPerToken returns the dollars spent per token for a request of
+// inputTokens prompt tokens and outputTokens output tokens.
+func (p *Profile) CostPerToken(inputTokens, outputTokens int) float64 {
+	totalTokens := inputTokens + outputTokens
+	if totalTokens == 0 {
+		return 0
+	}
+	serviceTime := p.PrefillTime(inputTokens, inputTokens) + p.DecodeTime(outputTokens)
+	return p.Cost / 3600 * serviceTime / float64(totalTokens)
+}
+
+func (p *Profile) validate() error {
+	if p.GPU == "" {
+		return fmt.Errorf("gpu is required")
+	}
+	if p.Cost < 0 || p.PrefillBaseTime < 0 || p.PrefillTimePerToken < 0 || p.TimePerOutputToken < 0 {
+		return fmt.Errorf("profile %s/%s has negative values", p.Model, p.GPU)
+	}
+	if p.Prefill != nil {
+		if err := p.Prefill.validate(); err != nil {
+			return fmt.Errorf("profile %s/%s: %w", p.Model, p.GPU, err)
+		}
+	}
+	return nil
+}
+
+// Store holds profiles indexed by model and GPU type.
+type Store struct {
+	mu       sync.RWMutex
+	profiles map[string]map[string]*Profile // model -> gpu -> profile
+}
+
+// NewStore creates a store with the built-in profiles.
+func NewStore() *Store {
+	s := &Store{profiles: map[string]map[string]*Profile{}}
+	s.loadBuiltinProfiles()
+	return s
+}
+
+var defaultStore = NewStore()
+
+// DefaultStore returns the process wide profile store used by routers.
+func DefaultStore() *Store {
+	return defaultStore
+}
+
+// Add adds or replaces the profile of its (model, GPU) pair.
+func (s *Store) Add(p *Profile) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	gpus, ok := s.profiles[p.Model]
+	if !ok {
+		gpus = map[string]*Profile{}
+		s.profiles[p.Model] = gpus
+	}
+	gpus[strings.ToLower(p.GPU)] = p
+}
+
+// Get returns the profile for the model on the GPU type. Profiles of the model
+// are preferred over profiles matching any model. The GPU type matches a profile
+// exactly or by containing all parts of its GPU name, e.g. NVIDIA-A100-SXM4-80GB
+// matches A100-80GB and A100, the most specific one is used.
+func (s *Store) Get(model, gpu string) (*Profile, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if gpu == "" {
+		return nil, false
+	}
+	gpu = strings.ToLower(gpu)
+	for _, m := range []string{model, ""} {
+		if p := matchGPU(s.profiles[m], gpu); p != nil {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+func matchGPU(gpus map[string]*Profile, gpu string) *Profile {
+	if p, ok := gpus[gpu]; ok {
+		return p
+	}
+
+	gpuParts := map[string]struct{}{}
+	for _, part := range splitGPUName(gpu) {
+		gpuParts[part] = struct{}{}
+	}
+	var best *Profile
+	bestParts := 0
+	for name, p := range gpus {
+		parts := splitGPUName(name)
+		matched := len(parts) > 0
+		for _, part := range parts {
+			if _, ok := gpuParts[part]; !ok {
+				matched = false
+				break
+			}
+		}
+		if matched && (len(parts) > bestParts || (len(parts) == bestParts && name < strings.ToLower(best.GPU))) {
+			best, bestParts = p, len(parts)
+		}
+	}
+	return best
+}
+
+func splitGPUName(name string) []string {
+	return strings.FieldsFunc(name, func(r rune) bool {
+		return r == '-' || r == '_' || r == ' '
+	})
+}
+
+// Load parses one profile or a list of profiles in JSON or YAML and adds them to the store.
+func (s *Store) Load(data []byte) error {
+	var profiles []*Profile
+	if trimmed := bytes.TrimSpace(data); bytes.HasPrefix(trimmed, []byte("[")) || bytes.HasPrefix(trimmed, []byte("-")) {
+		if err := yaml.Unmarshal(data, &profiles); err != nil {
+			return err
+		}
+	} else {
+		p := &Profile{}
+		if err := yaml.Unmarshal(data, p); err != nil {
+			return err
+		}
+		profiles = append(profiles, p)
+	}
+
+	for _, p := range profiles {
+		if err := p.validate(); err != nil {
+			return err
+		}
+	}
+	for _, p := range profiles {
+		s.Add(p)
+	}
+	return nil
+}
+
+// LoadFromPath loads profiles from a file, or from all .json, .yaml and .yml files of a directory.
+func (s *Store) LoadFromPath(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	files := []string{path}
+	if info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return err
+		}
+		files = files[:0]
+		for _, entry := range entries {
+			if entry.IsDir() || !isProfileFile(entry.Name()) {
+				continue
+			}
+			files = append(files, filepath.Join(path, entry.Name()))
+		}
+		sort.Strings(files)
+	}
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		if err := s.Load(data); err != nil {
+			return fmt.Errorf("failed to load profile %s: %w", file, err)
+		}
+		klog.InfoS("loaded gpu profile", "file", file)
+	}
+	return nil
+}
+
+// LoadFromConfigMap loads profiles from all keys of a ConfigMap.
+func (s *Store) LoadFromConfigMap(ctx context.Context, client kubernetes.Interface, namespace, name string) error {
+	cm, err := client.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(cm.Data))
+	for key := range cm.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := s.Load([]byte(cm.Data[key])); err != nil {
+			return fmt.Errorf("failed to load profile %s/%s[%s]: %w", namespace, name, key, err)
+		}
+		klog.InfoS("loaded gpu profile", "configmap", namespace+"/"+name, "key", key)
+	}
+	return nil
+}
+
+func isProfileFile(name string) bool {
+	switch filepath.Ext(name) {
+	case ".json", ".yaml", ".yml":
+		return true
+	}
+	return false
+}
+
+// InitDefaultStore loads profiles into the default store from the file or directory set by
+// AIBRIX_GPU_PROFILE_PATH and the ConfigMap set by AIBRIX_GPU_PROFILE_CONFIGMAP as namespace/name.
+func InitDefaultStore(ctx context.Context, client kubernetes.Interface) error {
+	if path := utils.LoadEnv("AIBRIX_GPU_PROFILE_PATH", ""); path != "" {
+		if err := defaultStore.LoadFromPath(path); err != nil {
+			return err
+		}
+	}
+
+	if configMap := utils.LoadEnv("AIBRIX_GPU_PROFILE_CONFIGMAP", ""); configMap != "" {
+		namespace, name, found := strings.Cut(configMap, "/")
+		if !found {
+			return fmt.Errorf("invalid AIBRIX_GPU_PROFILE_CONFIGMAP: %s, expected namespace/name", configMap)
+		}
+		if err := defaultStore.LoadFromConfigMap(ctx, client, namespace, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
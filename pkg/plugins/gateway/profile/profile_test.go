@@ -0,0 +1,121 @@
+/*
+Copyright 2024 The Aibrix Team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package profile
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestStoreGet(t *testing.T) {
+	s := NewStore()
+	assert.NoError(t, s.Load([]byte(`
+- model: llama-8b
+  gpu: A100
+  cost: 1.2
+  timePerOutputToken: 0.01
+- model: llama-8b
+  gpu: A100-80GB
+  cost: 1.5
+- gpu: L4
+  cost: 0.3
+`)))
+
+	p, ok := s.Get("llama-8b", "NVIDIA-A100-SXM4-80GB")
+	assert.True(t, ok)
+	assert.Equal(t, "A100-80GB", p.GPU)
+
+	p, ok = s.Get("llama-8b", "NVIDIA-A100-SXM4-40GB")
+	assert.True(t, ok)
+	assert.Equal(t, "A100", p.GPU)
+
+	// model specific profile is missing, any model profile is used
+	p, ok = s.Get("llama-8b", "NVIDIA-L4")
+	assert.True(t, ok)
+	assert.Equal(t, "", p.Model)
+
+	// built-in profiles
+	p, ok = s.Get("unknown", "Tesla-V100-SXM2-16GB")
+	assert.True(t, ok)
+	assert.Equal(t, "V100", p.GPU)
+	assert.Greater(t, p.PrefillTime(512, 512), 0.0)
+
+	_, ok = s.Get("llama-8b", "H100")
+	assert.False(t, ok)
+	_, ok = s.Get("llama-8b", "")
+	assert.False(t, ok)
+}
+
+func TestProfilePredictions(t *testing.T) {
+	p := &Profile{GPU: "A10", Cost: 3.6, PrefillBaseTime: 0.01, PrefillTimePerToken: 0.001, TimePerOutputToken: 0.02}
+	assert.InDelta(t, 0.11, p.PrefillTime(100, 100), 1e-9)
+	assert.InDelta(t, 0.2, p.DecodeTime(10), 1e-9)
+	// $0.001 per second for 0.31s over 110 tokens
+	assert.InDelta(t, 0.001*0.31/110, p.CostPerToken(100, 10), 1e-12)
+	assert.Equal(t, 0.0, p.CostPerToken(0, 0))
+}
+
+func TestLoadInvalidProfile(t *testing.T) {
+	s := NewStore()
+	assert.Error(t, s.Load([]byte(`{"model": "m", "cost": 1}`)))
+	assert.Error(t, s.Load([]byte(`{"gpu": "A10", "cost": -1}`)))
+	assert.Error(t, s.Load([]byte(`not: [valid`)))
+	_, ok := s.Get("m", "A10")
+	assert.False(t, ok)
+}
+
+func TestLoadFromPath(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "a10.json"), []byte(`{"model": "m", "gpu": "A10", "cost": 0.8}`), 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "l4.yaml"), []byte("model: m\ngpu: L4\ncost: 0.4\n"), 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("not a profile"), 0o644))
+
+	s := NewStore()
+	assert.NoError(t, s.LoadFromPath(dir))
+	p, ok := s.Get("m", "A10")
+	assert.True(t, ok)
+	assert.Equal(t, 0.8, p.Cost)
+	p, ok = s.Get("m", "L4")
+	assert.True(t, ok)
+	assert.Equal(t, 0.4, p.Cost)
+
+	assert.Error(t, s.LoadFromPath(filepath.Join(dir, "missing")))
+}
+
+func TestLoadFromConfigMap(t *testing.T) {
+	client := fake.NewSimpleClientset(&v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "gpu-profiles", Namespace: "aibrix-system"},
+		Data: map[string]string{
+			"m-a10.yaml": "model: m\ngpu: A10\ncost: 0.8\n",
+		},
+	})
+
+	s := NewStore()
+	assert.NoError(t, s.LoadFromConfigMap(context.TODO(), client, "aibrix-system", "gpu-profiles"))
+	p, ok := s.Get("m", "NVIDIA-A10")
+	assert.True(t, ok)
+	assert.Equal(t, 0.8, p.Cost)
+
+	assert.Error(t, s.LoadFromConfigMap(context.TODO(), client, "aibrix-system", "missing"))
+}
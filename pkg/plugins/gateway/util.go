@@ -18,6 +18,8 @@ package gateway
 
 import (
 	"encoding/json"
+	"errors"
+	"sort"
 	"strings"
 
 	configPb "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
@@ -78,25 +80,51 @@ func getRoutingStrategy(headers []*configPb.HeaderValue) (string, bool) {
 
 // getRequestMessage returns input request message field which has user prompt
 func getRequestMessage(jsonMap map[string]interface{}) (string, *extProcPb.ProcessingResponse) {
+	message, err := parseRequestMessage(jsonMap)
+	if err != nil {
+		return "", generateErrorResponse(envoyTypePb.StatusCode_InternalServerError,
+			[]*configPb.HeaderValueOption{{Header: &configPb.HeaderValue{Key: HeaderErrorRequestBodyProcessing, RawValue: []byte("true")}}},
+			err.Error())
+	}
+	return message, nil
+}
+
+// parseRequestMessage returns the messages or prompt field of the request as JSON
+func parseRequestMessage(jsonMap map[string]interface{}) (string, error) {
 	messages, ok := jsonMap["messages"]
 	if !ok || messages == "" {
 		messages, ok = jsonMap["prompt"]
 	}
 
 	if !ok {
-		return "", generateErrorResponse(envoyTypePb.StatusCode_InternalServerError,
-			[]*configPb.HeaderValueOption{{Header: &configPb.HeaderValue{Key: HeaderErrorRequestBodyProcessing, RawValue: []byte("true")}}},
-			"no messages/prompt in the request body")
+		return "", errors.New("no messages/prompt in the request body")
 	}
 	messagesJSON, err := json.Marshal(messages)
 	if err != nil {
-		return "", generateErrorResponse(envoyTypePb.StatusCode_InternalServerError,
-			[]*configPb.HeaderValueOption{{Header: &configPb.HeaderValue{Key: HeaderErrorRequestBodyProcessing, RawValue: []byte("true")}}},
-			"unable to marshal messages from request body")
+		return "", errors.New("unable to marshal messages from request body")
 	}
 	return string(messagesJSON), nil
 }
 
+// appendRoutingHeaders appends the headers set by the router in sorted key order
+func appendRoutingHeaders(headers []*configPb.HeaderValueOption, routingHeaders map[string]string) []*configPb.HeaderValueOption {
+	keys := make([]string, 0, len(routingHeaders))
+	for key := range routingHeaders {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		headers = append(headers, &configPb.HeaderValueOption{
+			Header: &configPb.HeaderValue{
+				Key:      key,
+				RawValue: []byte(routingHeaders[key]),
+			},
+		})
+	}
+	return headers
+}
+
 // generateErrorResponse construct envoy proxy error response
 func generateErrorResponse(statusCode envoyTypePb.StatusCode, headers []*configPb.HeaderValueOption, body string) *extProcPb.ProcessingResponse {
 	// Set the Content-Type header to application/json
@@ -19,15 +19,49 @@ package utils
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/redis/go-redis/v9"
 )
 
+const (
+	userKeyPrefix = "aibrix-users/"
+	// userIndexKey is a sorted set of the user names, all with score 0 so that they are sorted by name
+	userIndexKey = "aibrix-users-index"
+)
+
+// ErrUserExists is returned by CreateUser if the user already exists.
+var ErrUserExists = errors.New("user already exists")
+
 type User struct {
 	Name string `json:"name" validate:"required"`
 	Rpm  int64  `json:"rpm"`
 	Tpm  int64  `json:"tpm"`
+	// Models are the models the user is allowed to list, all models if empty
+	Models []string `json:"models,omitempty"`
+}
+
+// Validate returns an error if the limits of the user are negative.
+func (u User) Validate() error {
+	if u.Rpm < 0 || u.Tpm < 0 {
+		return fmt.Errorf("rpm or tpm can not negative")
+	}
+	return nil
+}
+
+// AllowsModel returns true if the user is allowed to list the model.
+func (u User) AllowsModel(modelName string) bool {
+	if len(u.Models) == 0 {
+		return true
+	}
+	for _, model := range u.Models {
+		if model == modelName {
+			return true
+		}
+	}
+	return false
 }
 
 func CheckUser(ctx context.Context, u User, redisClient *redis.Client) bool {
@@ -54,8 +88,8 @@ func GetUser(ctx context.Context, u User, redisClient *redis.Client) (User, erro
 }
 
 func SetUser(ctx context.Context, u User, redisClient *redis.Client) error {
-	if u.Rpm < 0 || u.Tpm < 0 {
-		return fmt.Errorf("rpm or tpm can not negative")
+	if err := u.Validate(); err != nil {
+		return err
 	}
 
 	b, err := json.Marshal(&u)
@@ -63,13 +97,111 @@ func SetUser(ctx context.Context, u User, redisClient *redis.Client) error {
 		return err
 	}
 
-	return redisClient.Set(ctx, genKey(u.Name), string(b), 0).Err()
+	_, err = redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, genKey(u.Name), string(b), 0)
+		pipe.ZAdd(ctx, userIndexKey, redis.Z{Member: u.Name})
+		return nil
+	})
+	return err
+}
+
+// CreateUser stores the user unless it exists, in which case ErrUserExists is returned.
+func CreateUser(ctx context.Context, u User, redisClient *redis.Client) error {
+	if err := u.Validate(); err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(&u)
+	if err != nil {
+		return err
+	}
+
+	// indexing an existing user again does not change the index
+	var setNX *redis.BoolCmd
+	_, err = redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		setNX = pipe.SetNX(ctx, genKey(u.Name), string(b), 0)
+		pipe.ZAdd(ctx, userIndexKey, redis.Z{Member: u.Name})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if !setNX.Val() {
+		return ErrUserExists
+	}
+	return nil
+}
+
+// ListUsers returns up to limit users sorted by name, starting after the user named after if not empty,
+// and whether there are more users. The page is read from the index of the user names.
+func ListUsers(ctx context.Context, after string, limit int, redisClient *redis.Client) ([]User, bool, error) {
+	start := "-"
+	if after != "" {
+		start = "(" + after
+	}
+	names, err := redisClient.ZRangeByLex(ctx, userIndexKey, &redis.ZRangeBy{
+		Min: start, Max: "+", Count: int64(limit) + 1,
+	}).Result()
+	if err != nil {
+		return nil, false, err
+	}
+	hasMore := len(names) > limit
+	if hasMore {
+		names = names[:limit]
+	}
+	if len(names) == 0 {
+		return []User{}, false, nil
+	}
+
+	keys := make([]string, 0, len(names))
+	for _, name := range names {
+		keys = append(keys, genKey(name))
+	}
+	values, err := redisClient.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, false, err
+	}
+	users := make([]User, 0, len(values))
+	for _, value := range values {
+		val, ok := value.(string)
+		if !ok {
+			// the user is deleted since it was listed
+			continue
+		}
+		var user User
+		if err := json.Unmarshal([]byte(val), &user); err != nil {
+			return nil, false, err
+		}
+		users = append(users, user)
+	}
+	return users, hasMore, nil
+}
+
+// IndexUsers adds the users stored without the index of the user names, e.g. by an earlier version, to the index.
+func IndexUsers(ctx context.Context, redisClient *redis.Client) error {
+	iter := redisClient.Scan(ctx, 0, userKeyPrefix+"*", 0).Iterator()
+	var members []redis.Z
+	for iter.Next(ctx) {
+		members = append(members, redis.Z{Member: strings.TrimPrefix(iter.Val(), userKeyPrefix)})
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	if len(members) == 0 {
+		return nil
+	}
+	return redisClient.ZAdd(ctx, userIndexKey, members...).Err()
 }
 
 func DelUser(ctx context.Context, u User, redisClient *redis.Client) error {
-	return redisClient.Del(ctx, genKey(u.Name)).Err()
+	_, err := redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, genKey(u.Name))
+		pipe.ZRem(ctx, userIndexKey, u.Name)
+		return nil
+	})
+	return err
 }
 
 func genKey(s string) string {
-	return fmt.Sprintf("aibrix-users/%s", s)
+	return userKeyPrefix + s
 }
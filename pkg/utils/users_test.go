@@ -0,0 +1,55 @@
+/*
+Copyright 2025 The Aibrix Team.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListUsersIndex(t *testing.T) {
+	ctx := context.Background()
+	redisServer := miniredis.RunT(t)
+	redisClient := redis.NewClient(&redis.Options{Addr: redisServer.Addr()})
+
+	assert.NoError(t, CreateUser(ctx, User{Name: "bob"}, redisClient))
+	assert.ErrorIs(t, CreateUser(ctx, User{Name: "bob"}, redisClient), ErrUserExists)
+	assert.NoError(t, SetUser(ctx, User{Name: "alice"}, redisClient))
+	// a user stored without the index is listed once indexed
+	assert.NoError(t, redisServer.Set(genKey("carol"), `{"name":"carol","rpm":1}`))
+
+	users, hasMore, err := ListUsers(ctx, "", 10, redisClient)
+	assert.NoError(t, err)
+	assert.Equal(t, []User{{Name: "alice"}, {Name: "bob"}}, users)
+	assert.False(t, hasMore)
+
+	assert.NoError(t, IndexUsers(ctx, redisClient))
+	users, hasMore, err = ListUsers(ctx, "alice", 1, redisClient)
+	assert.NoError(t, err)
+	assert.Equal(t, []User{{Name: "bob"}}, users)
+	assert.True(t, hasMore)
+
+	assert.NoError(t, DelUser(ctx, User{Name: "bob"}, redisClient))
+	users, hasMore, err = ListUsers(ctx, "alice", 1, redisClient)
+	assert.NoError(t, err)
+	assert.Equal(t, []User{{Name: "carol", Rpm: 1}}, users)
+	assert.False(t, hasMore)
+}